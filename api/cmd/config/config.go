@@ -13,6 +13,64 @@ type Configuration struct {
 	ZapAPIKey  string
 	ZapURL     string
 	HMACSecret string
+	Scoring    ScoringConfig
+	Unmapped   UnmappedConfig
+	Artifacts  ArtifactConfig
+	DefectDojo DefectDojoConfig
+	Webhooks   WebhookConfig
+
+	CatalogRefreshSeconds int
+	// ValidateResponses checks responses against the OpenAPI contract, logging the ones that break it
+	ValidateResponses bool
+	// GRPCPort is the port of the gRPC API, which is off when it's 0
+	GRPCPort int
+	// ReleaseConcurrency is how many targets of releases a replica scans at once
+	ReleaseConcurrency int
+	// ReleaseTargetTimeoutMinutes is how long the scan of a release target may take before it's an error
+	ReleaseTargetTimeoutMinutes int
+}
+
+type UnmappedConfig struct {
+	Policy     string
+	RiskScores string
+	AutoCreate bool
+}
+
+type ArtifactConfig struct {
+	Backend       string
+	Dir           string
+	S3Endpoint    string
+	S3Region      string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3ObjectLock  string
+	RetentionDays int
+}
+
+type DefectDojoConfig struct {
+	URL        string
+	Token      string
+	Engagement string
+	AutoPush   bool
+}
+
+type WebhookConfig struct {
+	Secret         string
+	MaxAttempts    int
+	BackoffSeconds int
+	TimeoutSeconds int
+	// AllowedNetworks are CIDRs callbacks may be on even though they're internal
+	AllowedNetworks string
+}
+
+type ScoringConfig struct {
+	Mode        string
+	Aggregation string
+	Cap         int
+	Weights     string
+	Threshold   int
+	Confirmed   float64
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -36,6 +94,32 @@ func getIntEnvOrDefault(key string, defaultValue int) int {
 	return intValue
 }
 
+func getFloatEnvOrDefault(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("[Configuration] Error parsing %s as float: %v, using default %g", key, err, defaultValue)
+		return defaultValue
+	}
+	return floatValue
+}
+
+func getBoolEnvOrDefault(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("[Configuration] Error parsing %s as bool: %v, using default %t", key, err, defaultValue)
+		return defaultValue
+	}
+	return boolValue
+}
+
 func New() *Configuration {
 	var c Configuration
 	err := c.LoadConfig()
@@ -63,6 +147,60 @@ func (cfg *Configuration) LoadConfig() error {
 	HMACSecret := getEnvOrDefault("HMAC_SECRET", "736ffa5e4064da13711d075ed6b71069")
 	cfg.HMACSecret = HMACSecret
 
+	// Scan scoring, "legacy" sums the catalog score of every alert instance
+	cfg.Scoring.Mode = getEnvOrDefault("SCORING_MODE", "legacy")
+	cfg.Scoring.Aggregation = getEnvOrDefault("SCORING_AGGREGATION", "")
+	cfg.Scoring.Cap = getIntEnvOrDefault("SCORING_CAP", 3)
+	cfg.Scoring.Weights = getEnvOrDefault("SCORING_WEIGHTS", "")
+	cfg.Scoring.Threshold = getIntEnvOrDefault("SCORING_THRESHOLD", 8)
+	// Multiplier of findings confirmed by a SAST result
+	cfg.Scoring.Confirmed = getFloatEnvOrDefault("SCORING_CONFIRMED_WEIGHT", 1)
+	log.Printf("[LoadConfig] Scoring mode: '%s' threshold: %d", cfg.Scoring.Mode, cfg.Scoring.Threshold)
+
+	// Alerts without a catalog entry: "ignore", "risk" or "fail"
+	cfg.Unmapped.Policy = getEnvOrDefault("UNMAPPED_ALERT_POLICY", "ignore")
+	cfg.Unmapped.RiskScores = getEnvOrDefault("UNMAPPED_RISK_SCORES", "")
+	cfg.Unmapped.AutoCreate = getBoolEnvOrDefault("UNMAPPED_AUTO_CREATE", true)
+
+	// Raw scan evidence: "none", "filesystem" or "s3". Sessions are read from a volume shared with ZAP
+	cfg.Artifacts.Backend = getEnvOrDefault("ARTIFACT_BACKEND", "none")
+	cfg.Artifacts.Dir = getEnvOrDefault("ARTIFACT_DIR", "/var/lib/dast/artifacts")
+	cfg.Artifacts.S3Endpoint = getEnvOrDefault("ARTIFACT_S3_ENDPOINT", "")
+	cfg.Artifacts.S3Region = getEnvOrDefault("ARTIFACT_S3_REGION", "us-east-1")
+	cfg.Artifacts.S3Bucket = getEnvOrDefault("ARTIFACT_S3_BUCKET", "")
+	cfg.Artifacts.S3AccessKey = getEnvOrDefault("ARTIFACT_S3_ACCESS_KEY", "")
+	cfg.Artifacts.S3SecretKey = getEnvOrDefault("ARTIFACT_S3_SECRET_KEY", "")
+	cfg.Artifacts.S3ObjectLock = getEnvOrDefault("ARTIFACT_S3_OBJECT_LOCK", "")
+	cfg.Artifacts.RetentionDays = getIntEnvOrDefault("ARTIFACT_RETENTION_DAYS", 365)
+	log.Printf("[LoadConfig] Artifact backend: '%s'", cfg.Artifacts.Backend)
+
+	// DefectDojo push, disabled without a URL. Assets without an engagement use DEFECTDOJO_ENGAGEMENT
+	cfg.DefectDojo.URL = getEnvOrDefault("DEFECTDOJO_URL", "")
+	cfg.DefectDojo.Token = getEnvOrDefault("DEFECTDOJO_TOKEN", "")
+	cfg.DefectDojo.Engagement = getEnvOrDefault("DEFECTDOJO_ENGAGEMENT", "DAST")
+	cfg.DefectDojo.AutoPush = getBoolEnvOrDefault("DEFECTDOJO_AUTO_PUSH", false)
+
+	// Completion webhooks are signed with WEBHOOK_SECRET, they're off when it isn't set or is the HMAC
+	// secret. Failed deliveries are retried after WEBHOOK_BACKOFF_SECONDS, doubling each time
+	cfg.Webhooks.Secret = getEnvOrDefault("WEBHOOK_SECRET", "")
+	cfg.Webhooks.AllowedNetworks = getEnvOrDefault("WEBHOOK_ALLOWED_NETWORKS", "")
+	cfg.Webhooks.MaxAttempts = getIntEnvOrDefault("WEBHOOK_MAX_ATTEMPTS", 6)
+	cfg.Webhooks.BackoffSeconds = getIntEnvOrDefault("WEBHOOK_BACKOFF_SECONDS", 10)
+	cfg.Webhooks.TimeoutSeconds = getIntEnvOrDefault("WEBHOOK_TIMEOUT_SECONDS", 10)
+
+	// Targets of releases wait for one of RELEASE_MAX_CONCURRENT_SCANS slots, read at startup
+	cfg.ReleaseConcurrency = getIntEnvOrDefault("RELEASE_MAX_CONCURRENT_SCANS", 2)
+	cfg.ReleaseTargetTimeoutMinutes = getIntEnvOrDefault("RELEASE_TARGET_TIMEOUT_MINUTES", 120)
+
+	// How often replicas check for vulnerability catalog changes
+	cfg.CatalogRefreshSeconds = getIntEnvOrDefault("CATALOG_REFRESH_SECONDS", 30)
+
+	// Requests are always validated against the OpenAPI contract, responses only when enabled
+	cfg.ValidateResponses = getBoolEnvOrDefault("OPENAPI_VALIDATE_RESPONSES", false)
+
+	// The gRPC API runs next to the HTTP one, in plaintext, when GRPC_PORT is set
+	cfg.GRPCPort = getIntEnvOrDefault("GRPC_PORT", 0)
+
 	// Read shared database configuration
 	dbEngine := getEnvOrDefault("DB_ENGINE", "mysql")
 	dbHost := getEnvOrDefault("DB_HOST", "dast-db")
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/artifact"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/zapScanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// The archived HTML report holds the HTTP messages of at most maxReportMessages findings.
+	maxReportMessages = 200
+	// Expired artifacts are deleted expireBatch at a time.
+	expireBatch = 100
+)
+
+// ArtifactLink is an archived artifact with the API path it can be downloaded from.
+type ArtifactLink struct {
+	artifact.Artifact
+	URL string `json:"url"`
+}
+
+func addArtifactMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/artifacts", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanArtifacts)
+	r.GET("/scans/:id/artifacts/:name", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanArtifact)
+}
+
+// GetScanArtifacts lists the raw evidence archived for a scan. The id is the build ID.
+func (cImpl *Controller) GetScanArtifacts(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	artifacts, err := artifact.GetArtifactsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading artifacts of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading artifacts: " + err.Error(),
+		})
+		return
+	}
+	links := []ArtifactLink{}
+	for _, a := range artifacts {
+		links = append(links, ArtifactLink{a, fmt.Sprintf("/scans/%s/artifacts/%s",
+			url.PathEscape(s.Build_id), url.PathEscape(a.Name))})
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": s.Build_id, "artifacts": links})
+}
+
+// GetScanArtifact downloads an archived artifact. Its content is checked against the digest
+// recorded when it was archived.
+func (cImpl *Controller) GetScanArtifact(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	store := cImpl.artifactStore()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "failed", "reason": "artifact storage is not configured"})
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	a, err := artifact.GetArtifactFromDB(cImpl.dbRO, s.ID, c.Param("name"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "artifact not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading artifact %s of scan %s: %v", c.Param("name"), s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading artifact: " + err.Error(),
+		})
+		return
+	}
+	data, err := store.Get(a.StorageKey)
+	if err == artifact.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "artifact content not found in storage"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading artifact %s from storage: %v", a.StorageKey, err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "reason": "error reading artifact: " + err.Error()})
+		return
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != a.SHA256 {
+		log.Printf("Artifact %s doesn't match its recorded digest", a.StorageKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "artifact checksum mismatch"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, a.Name))
+	c.Data(http.StatusOK, a.ContentType, data)
+}
+
+func (cImpl *Controller) artifactScan(c *gin.Context) (scan.Scan, bool) {
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "scan not found"})
+		return s, false
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return s, false
+	}
+	return s, true
+}
+
+// artifactStore builds the store from the current configuration, so /reload picks up changes. It's
+// nil when archiving is disabled or misconfigured.
+func (cImpl *Controller) artifactStore() artifact.Store {
+	ac := cImpl.c.Artifacts
+	store, err := artifact.NewStore(ac.Backend, ac.Dir, artifact.S3Options{
+		Endpoint: ac.S3Endpoint, Region: ac.S3Region, Bucket: ac.S3Bucket,
+		AccessKey: ac.S3AccessKey, SecretKey: ac.S3SecretKey, ObjectLock: ac.S3ObjectLock,
+	})
+	if err != nil {
+		log.Printf("Invalid artifact storage configuration, scans aren't archived: %v", err)
+	}
+	return store
+}
+
+// WatchArtifacts deletes, every interval, the archived artifacts whose retention ended. Every
+// replica runs it, an artifact deleted twice is no error.
+func (cImpl *Controller) WatchArtifacts(interval time.Duration) {
+	store := cImpl.artifactStore()
+	if store == nil {
+		return
+	}
+	for ; ; time.Sleep(interval) {
+		for {
+			n, err := artifact.Expire(cImpl.dbRW, store, time.Now().UTC(), expireBatch)
+			if err != nil {
+				log.Printf("Error deleting expired artifacts: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Deleted %d expired artifacts", n)
+			}
+			if err != nil || n < expireBatch {
+				break
+			}
+		}
+	}
+}
+
+// findingMessages reads from ZAP the HTTP messages of up to maxReportMessages findings, while the
+// session of the scan is still loaded.
+func (cImpl *Controller) findingMessages(s scan.Scan, findings []finding.Finding) map[string]report.Message {
+	messages := make(map[string]report.Message)
+	for _, f := range findings {
+		if _, ok := messages[f.MessageID]; ok || f.MessageID == "" {
+			continue
+		}
+		if len(messages) == maxReportMessages {
+			log.Printf("Scan %s has findings on over %d messages, the HTML report shows the first ones", s.Build_id,
+				maxReportMessages)
+			break
+		}
+		m, err := cImpl.s.GetMessage(f.MessageID)
+		if err != nil {
+			log.Printf("Error reading message %s of scan %s: %v", f.MessageID, s.Build_id, err)
+			continue
+		}
+		messages[f.MessageID] = report.Message{RequestHeader: m.RequestHeader, RequestBody: m.RequestBody,
+			ResponseHeader: m.ResponseHeader, ResponseBody: m.ResponseBody}
+	}
+	return messages
+}
+
+// archiveScan keeps the raw ZAP report, the alerts and the HTML report with the HTTP messages of the
+// findings of a finished scan, s having its final status. Failures are logged, the scan result
+// doesn't depend on them. ZAP's session holds the scans of every application, so the report and
+// alerts are cut down to the site of the scan's target, and the session itself isn't archived.
+func (cImpl *Controller) archiveScan(conn *sql.DB, s scan.Scan, alerts []zapScanner.FullAlert,
+	findings []finding.Finding,
+) {
+	store := cImpl.artifactStore()
+	if store == nil {
+		return
+	}
+	ac := cImpl.c.Artifacts
+	retention := time.Duration(ac.RetentionDays) * 24 * time.Hour
+	archive := func(kind string, name string, contentType string, data []byte) {
+		a := artifact.Artifact{
+			ScanID: s.ID, Name: name, Kind: kind, ContentType: contentType,
+			StorageKey: artifact.Key(s.Application, s.Build_id, s.ID, name),
+		}
+		if _, err := artifact.Archive(conn, store, a, data, retention); err != nil {
+			log.Printf("Error archiving %s of scan %s: %v", name, s.Build_id, err)
+		}
+	}
+
+	zapReport, err := cImpl.s.GetJSONReport()
+	if err == nil {
+		zapReport, err = zapScanner.SiteReport(zapReport, s.Target)
+	}
+	if err != nil {
+		log.Printf("Error getting the ZAP report of scan %s: %v", s.Build_id, err)
+	} else {
+		archive(artifact.KindReport, "zap-report.json", "application/json", zapReport)
+	}
+	b, err := json.Marshal(zapScanner.SiteAlerts(alerts, s.Target))
+	if err != nil {
+		log.Printf("Error marshalling alerts of scan %s: %v", s.Build_id, err)
+	} else {
+		archive(artifact.KindAlerts, "alerts.json", "application/json", b)
+	}
+	r := report.New(s, findings, cImpl.gatePolicy())
+	r.Previous = cImpl.previousScan(s)
+	r.Messages = cImpl.findingMessages(s, findings)
+	var html bytes.Buffer
+	if err := report.WriteHTML(&html, r); err != nil {
+		log.Printf("Error rendering the HTML report of scan %s: %v", s.Build_id, err)
+	} else {
+		archive(artifact.KindHTML, "report.html", "text/html; charset=utf-8", html.Bytes())
+	}
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/artifact"
+	"src/pkg/finding"
+	"src/pkg/scan"
+	"src/pkg/zapScanner"
+)
+
+var artifactColumns = []string{
+	"id", "scan_id", "name", "kind", "storage_key", "content_type", "size", "sha256", "created_at", "retain_until",
+}
+
+func TestGetScanArtifacts(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	created := time.Date(2022, 9, 2, 12, 50, 21, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_artifacts WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(artifactColumns).AddRow(1, 1, "zap-report.json", artifact.KindReport,
+			"shop/abcde-1234/1/zap-report.json", "application/json", 11, "abc123", created, created.AddDate(1, 0, 0)))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/artifacts", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"artifacts":[{"name":"zap-report.json","kind":"zap-report","content_type":"application/json",`+
+		`"size":11,"sha256":"abc123","created_at":"2022-09-02T12:50:21Z","retain_until":"2023-09-02T12:50:21Z",`+
+		`"url":"/scans/abcde-1234/artifacts/zap-report.json"}],"scan_id":"abcde-1234"}`, response.Body.String())
+}
+
+func TestGetScanArtifactWithoutStorage(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/artifacts/alerts.json", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, `{"reason":"artifact storage is not configured","status":"failed"}`, response.Body.String())
+}
+
+func TestGetScanArtifact(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Artifacts.Backend, cfg.Artifacts.Dir = artifact.BackendFilesystem, t.TempDir()
+	defer func() { cfg.Artifacts.Backend = artifact.BackendNone }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	data := []byte(`[{"pluginId":"40018"}]`)
+	sum := sha256.Sum256(data)
+	store := artifact.FileStore{Dir: cfg.Artifacts.Dir}
+	assert.Nil(t, store.Put("shop/abcde-1234/1/alerts.json", data, "application/json", time.Time{}))
+
+	expectArtifact := func(digest string) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+			WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+				AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM scan_artifacts WHERE scan_id=? AND name=?")).
+			WithArgs(int64(1), "alerts.json").
+			WillReturnRows(sqlmock.NewRows(artifactColumns).AddRow(2, 1, "alerts.json", artifact.KindAlerts,
+				"shop/abcde-1234/1/alerts.json", "application/json", len(data), digest, time.Now(), time.Now()))
+	}
+
+	expectArtifact(hex.EncodeToString(sum[:]))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/artifacts/alerts.json", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="alerts.json"`, response.Header().Get("Content-Disposition"))
+	assert.Equal(t, data, response.Body.Bytes())
+
+	expectArtifact("tampered")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/artifacts/alerts.json", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, `{"reason":"artifact checksum mismatch","status":"failed"}`, response.Body.String())
+}
+
+func TestArchiveScan(t *testing.T) {
+	cfg.Artifacts.Backend, cfg.Artifacts.Dir = artifact.BackendFilesystem, t.TempDir()
+	defer func() { cfg.Artifacts.Backend = artifact.BackendNone }()
+	db, mock, _ := sqlmock.New()
+	// The session also holds the scan of another application
+	zapReport := []byte(`{"site":[{"@name":"https://shop","alerts":[{"pluginid":"10038"}]},` +
+		`{"@name":"https://cart","alerts":[{"pluginid":"40018"}]}]}`)
+	clr := New(cfg, zapSVMock{JSONReport: zapReport, Messages: map[string]zapScanner.HTTPMessage{
+		"7": {RequestHeader: "GET https://shop/ HTTP/1.1\r\n\r\n", ResponseHeader: "HTTP/1.1 200 OK\r\n\r\n"},
+	}}, db, db)
+	s := scan.Scan{ID: 1, Status: "failed", Build_id: "abcde-1234", Application: "shop", Target: "https://shop"}
+	alerts := []zapScanner.FullAlert{{ID: "1", PluginID: "10038", URL: "https://shop/"},
+		{ID: "2", PluginID: "40018", URL: "https://cart/?id=1"}}
+	findings := []finding.Finding{{ScanID: 1, PluginID: "10038", Name: "CSP Header Not Set", Risk: "Medium",
+		URL: "https://shop/", Method: "GET", MessageID: "7"}}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_artifacts")).
+		WithArgs(int64(1), "zap-report.json", artifact.KindReport, "shop/abcde-1234/1/zap-report.json",
+			"application/json", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_artifacts")).
+		WithArgs(int64(1), "alerts.json", artifact.KindAlerts, "shop/abcde-1234/1/alerts.json",
+			"application/json", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE application=? AND id<?")).WithArgs("shop", int64(1)).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_artifacts")).
+		WithArgs(int64(1), "report.html", artifact.KindHTML, "shop/abcde-1234/1/report.html",
+			"text/html; charset=utf-8", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	clr.archiveScan(db, s, alerts, findings)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	store := artifact.FileStore{Dir: cfg.Artifacts.Dir}
+	report, err := store.Get("shop/abcde-1234/1/zap-report.json")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"site":[{"@name":"https://shop","alerts":[{"pluginid":"10038"}]}]}`, string(report))
+	archived, err := store.Get("shop/abcde-1234/1/alerts.json")
+	assert.Nil(t, err)
+	assert.Contains(t, string(archived), `"url":"https://shop/"`)
+	assert.NotContains(t, string(archived), "cart")
+	html, err := store.Get("shop/abcde-1234/1/report.html")
+	assert.Nil(t, err)
+	assert.Contains(t, string(html), "Recorded status: failed.")
+	assert.Contains(t, string(html), "<pre>HTTP/1.1 200 OK\r\n\r\n</pre>")
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/asset"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addAssetMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	auth := security.AuthMiddleware(cfg.HMACSecret)
+
+	r.GET("/assets", auth, clr.ListAssets)
+	r.POST("/assets", auth, clr.CreateAsset)
+	r.GET("/assets/:id", auth, clr.GetAsset)
+	r.PUT("/assets/:id", auth, clr.UpdateAsset)
+	r.DELETE("/assets/:id", auth, clr.DeleteAsset)
+	r.GET("/assets/:id/scans", auth, clr.GetAssetScans)
+}
+
+// ListAssets lists the registered applications, only those of an owner with ?owner=.
+func (cImpl *Controller) ListAssets(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	assets, err := asset.GetAssetsFromDB(cImpl.dbRO, c.Query("owner"))
+	if err != nil {
+		log.Printf("Error reading assets from DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading assets: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assets": assets})
+}
+
+// CreateAsset registers an application. The scans it already has are linked to it, and so are the
+// ones submitted for it from then on.
+func (cImpl *Controller) CreateAsset(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	var a asset.Asset
+	if !bindAsset(c, &a) {
+		return
+	}
+	a.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	id, err := asset.AddAssetToDB(cImpl.dbRW, a)
+	if err == asset.ErrDuplicate {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "application " + a.Application + " is already registered"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding asset to DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error creating asset: " + err.Error()})
+		return
+	}
+	a.ID = id
+	log.Printf("Registered asset %d for application %s", a.ID, a.Application)
+	c.JSON(http.StatusCreated, a)
+}
+
+func (cImpl *Controller) GetAsset(c *gin.Context) {
+	id, ok := assetID(c)
+	if !ok || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	a, err := asset.GetAssetFromDB(cImpl.dbRO, id)
+	if err != nil {
+		assetError(c, err, "error reading asset")
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+func (cImpl *Controller) UpdateAsset(c *gin.Context) {
+	id, ok := assetID(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	var a asset.Asset
+	if !bindAsset(c, &a) {
+		return
+	}
+	a.ID = id
+	err := asset.UpdateAssetInDB(cImpl.dbRW, a)
+	if err == asset.ErrDuplicate {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "application " + a.Application + " is already registered"})
+		return
+	}
+	if err != nil {
+		assetError(c, err, "error updating asset")
+		return
+	}
+	// Read back from the primary, the replica may lag behind the update
+	if a, err = asset.GetAssetFromDB(cImpl.dbRW, id); err != nil {
+		assetError(c, err, "error reading asset")
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// DeleteAsset removes an asset from the registry. Its scans are kept.
+func (cImpl *Controller) DeleteAsset(c *gin.Context) {
+	id, ok := assetID(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	if err := asset.DeleteAssetFromDB(cImpl.dbRW, id); err != nil {
+		assetError(c, err, "error deleting asset")
+		return
+	}
+	log.Printf("Deleted asset %d", id)
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": id})
+}
+
+// GetAssetScans is the scan history of an asset, newest first, paged and filtered like the scans of
+// /v2/scans.
+func (cImpl *Controller) GetAssetScans(c *gin.Context) {
+	id, ok := assetID(c)
+	if !ok || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	f := scan.Filter{AssetID: id, Status: c.Query("status")}
+	switch f.Status {
+	case "", statusRunning, scan.StatusPassed, scan.StatusFailed, scan.StatusError, scan.StatusCancelled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid status \"" + f.Status + "\""})
+		return
+	}
+	since, err := parseSince(c.Query("since"), time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	f.Since = since
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "page must be a positive number"})
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPerPage)))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "per_page must be between 1 and " + strconv.Itoa(maxPerPage),
+		})
+		return
+	}
+	f.Limit = perPage
+	f.Offset = (page - 1) * perPage
+
+	a, err := asset.GetAssetFromDB(cImpl.dbRO, id)
+	if err != nil {
+		assetError(c, err, "error reading asset")
+		return
+	}
+	scans, total, err := scan.QueryScansFromDB(cImpl.dbRO, f)
+	if err != nil {
+		log.Printf("Error listing scans of asset %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scans: " + err.Error()})
+		return
+	}
+	resources := []ScanResource{}
+	for _, s := range scans {
+		resources = append(resources, scanResource(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"asset_id": a.ID, "application": a.Application, "scans": resources, "page": page,
+		"per_page": perPage, "total": total})
+}
+
+func assetID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid asset id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindAsset reads an asset from the body, medium criticality when it has none.
+func bindAsset(c *gin.Context, a *asset.Asset) bool {
+	if err := c.BindJSON(a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "couldn't parse asset from body"})
+		return false
+	}
+	if a.Criticality == "" {
+		a.Criticality = asset.CriticalityMedium
+	}
+	if a.Environments == nil {
+		a.Environments = []asset.Environment{}
+	}
+	if err := asset.Validate(*a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return false
+	}
+	return true
+}
+
+func assetError(c *gin.Context, err error, reason string) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "asset not found"})
+		return
+	}
+	log.Printf("%s: %v", reason, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": reason + ": " + err.Error()})
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"src/pkg/asset"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var assetColumns = []string{"id", "project", "owner", "repo", "environments", "criticality", "profile",
+	"defectdojo_product", "defectdojo_engagement", "created_at"}
+
+func TestCreateAsset(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO assets(")).
+		WithArgs("shop", "team-shop", "", `[{"name":"prod","target":"https://shop"}]`, asset.CriticalityMedium,
+			"api-only", nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET asset_id=? WHERE asset_id IS NULL AND application=?")).
+		WithArgs(int64(4), "shop").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/assets", []byte(`{"application":"shop",`+
+		`"owner":"team-shop","environments":[{"name":"prod","target":"https://shop"}],"profile":"api-only"}`)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Regexp(t, `^\{"id":4,"application":"shop","owner":"team-shop","repo":"","environments":\[\{"name":"prod",`+
+		`"target":"https://shop"\}\],"criticality":"medium","profile":"api-only","defectdojo_product":"",`+
+		`"defectdojo_engagement":"","created_at":"[^"]+"\}$`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAssetValidation(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/assets", []byte(`{"application":"shop",`+
+		`"environments":[{"name":"prod"},{"name":"prod"}]}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"environment \"prod\" is listed twice","status":"failed"}`, response.Body.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO assets(")).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'shop'"})
+	mock.ExpectRollback()
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/assets", []byte(`{"application":"shop"}`)))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"application shop is already registered","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAsset(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE id=?")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(assetColumns).
+			AddRow(4, "shop", "team-shop", "github.com/acme/shop", "[]", "high", "", "Shop", "", at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE id=?")).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows(assetColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/assets/4", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"id":4,"application":"shop","owner":"team-shop","repo":"github.com/acme/shop",`+
+		`"environments":[],"criticality":"high","profile":"","defectdojo_product":"Shop","defectdojo_engagement":"",`+
+		`"created_at":"2026-10-19T10:00:00Z"}`, response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/assets/5", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"asset not found","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteMissingAsset(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM assets WHERE id=? FOR UPDATE")).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "DELETE", "/assets/5", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAssetScans(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE id=?")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(assetColumns).AddRow(4, "shop", "", "", "[]", "medium", "", "", "", at))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM scans WHERE 1=1 AND asset_id=? AND status=?")).
+		WithArgs(int64(4), "failed").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE 1=1 AND asset_id=? AND status=? ORDER BY id DESC LIMIT ? OFFSET ?")).
+		WithArgs(int64(4), "failed", 2, 2).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, at))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/assets/4/scans?status=failed&page=2&per_page=2", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^\{"application":"shop","asset_id":4,"page":2,"per_page":2,"scans":\[\{"id":"abcde-1234",`+
+		`"status":"failed",.*\}\],"total":3\}$`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestScanUsesAssetProfile(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	var policy string
+	clr := New(cfg, zapSVMock{StartScanResponse: "3", StartScanPolicy: &policy}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE project=?")).WithArgs("shop").
+		WillReturnRows(sqlmock.NewRows(assetColumns).
+			AddRow(4, "shop", "", "", "[]", "medium", "api-only", "", "", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("(SELECT id FROM assets WHERE project=?)")).
+		WithArgs("started", "abcde-1234", "github", "shop", "https://shop", 3, 1, "shop").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","application":"shop","source":"github"}`)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "api-only", policy)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
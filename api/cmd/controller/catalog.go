@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/catalog"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actorParam identifies who is changing the catalog or an issue, it's recorded in the audit trail.
+// It's a query parameter so the signature covers it.
+const actorParam = "actor"
+
+func addCatalogMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	auth := security.AuthMiddleware(cfg.HMACSecret)
+
+	r.GET("/vulnerabilities", auth, clr.ListVulnerabilities)
+	r.GET("/vulnerabilities/export", auth, clr.ExportVulnerabilities)
+	r.POST("/vulnerabilities/import", auth, clr.ImportVulnerabilities)
+	r.GET("/vulnerabilities/audit", auth, clr.GetVulnerabilityAudit)
+	r.GET("/vulnerabilities/unmapped", auth, clr.GetUnmappedAlerts)
+	r.POST("/vulnerabilities", auth, clr.CreateVulnerability)
+	r.GET("/vulnerabilities/:id", auth, clr.GetVulnerability)
+	r.PUT("/vulnerabilities/:id", auth, clr.UpdateVulnerability)
+	r.DELETE("/vulnerabilities/:id", auth, clr.DeleteVulnerability)
+}
+
+func (cImpl *Controller) ListVulnerabilities(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	entries, err := catalog.GetEntriesFromDB(cImpl.dbRO)
+	if err != nil {
+		log.Printf("Error reading vulnerabilities from DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading vulnerabilities: " + err.Error(),
+		})
+		return
+	}
+	if entries == nil {
+		entries = []catalog.Entry{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version":         cImpl.vulns.Snapshot().Version,
+		"vulnerabilities": entries,
+	})
+}
+
+func (cImpl *Controller) ExportVulnerabilities(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	entries, err := catalog.GetEntriesFromDB(cImpl.dbRO)
+	if err != nil {
+		log.Printf("Error reading vulnerabilities from DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading vulnerabilities: " + err.Error(),
+		})
+		return
+	}
+	if entries == nil {
+		entries = []catalog.Entry{}
+	}
+	c.Header("Content-Disposition", `attachment; filename="vulnerabilities.json"`)
+	c.JSON(http.StatusOK, entries)
+}
+
+func (cImpl *Controller) ImportVulnerabilities(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	var entries []catalog.Entry
+	if err := c.BindJSON(&entries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "couldn't parse vulnerabilities from body",
+		})
+		return
+	}
+	for _, e := range entries {
+		if err := catalog.Validate(e); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "failed", "reason": "invalid vulnerability " + strconv.Quote(e.Name) + ": " + err.Error(),
+			})
+			return
+		}
+	}
+	created, updated, err := catalog.ImportEntriesToDB(cImpl.dbRW, entries, actor)
+	if err != nil {
+		log.Printf("Error importing vulnerabilities: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error importing vulnerabilities: " + err.Error(),
+		})
+		return
+	}
+	cImpl.refreshCatalog()
+	c.JSON(http.StatusOK, gin.H{"status": "imported", "created": created, "updated": updated})
+}
+
+func (cImpl *Controller) GetVulnerabilityAudit(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	var id int64
+	if v := c.Query("vulnerability_id"); v != "" {
+		var err error
+		id, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid vulnerability_id"})
+			return
+		}
+	}
+	records, err := catalog.GetAuditFromDB(cImpl.dbRO, id)
+	if err != nil {
+		log.Printf("Error reading vulnerability audit from DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading audit trail: " + err.Error(),
+		})
+		return
+	}
+	if records == nil {
+		records = []catalog.AuditRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{"audit": records})
+}
+
+// GetUnmappedAlerts lists the plugins reported since the given date (30 days by default) that the
+// catalog doesn't classify yet.
+func (cImpl *Controller) GetUnmappedAlerts(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	since, err := parseSince(c.Query("since"), time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	alerts, err := catalog.GetUnmappedFromDB(cImpl.dbRO, since)
+	if err != nil {
+		log.Printf("Error reading unmapped alerts from DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading unmapped alerts: " + err.Error(),
+		})
+		return
+	}
+	if alerts == nil {
+		alerts = []catalog.UnmappedAlert{}
+	}
+	c.JSON(http.StatusOK, gin.H{"since": since, "unmapped": alerts})
+}
+
+func (cImpl *Controller) CreateVulnerability(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	var e catalog.Entry
+	if !bindEntry(c, &e) {
+		return
+	}
+	id, err := catalog.AddEntryToDB(cImpl.dbRW, e, actor)
+	if err != nil {
+		log.Printf("Error adding vulnerability to DB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error creating vulnerability: " + err.Error(),
+		})
+		return
+	}
+	e.ID = id
+	cImpl.refreshCatalog()
+	c.JSON(http.StatusCreated, e)
+}
+
+func (cImpl *Controller) GetVulnerability(c *gin.Context) {
+	id, ok := entryID(c)
+	if !ok || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	e, err := catalog.GetEntryFromDB(cImpl.dbRO, id)
+	if err != nil {
+		entryError(c, err, "error reading vulnerability")
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+func (cImpl *Controller) UpdateVulnerability(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	id, ok := entryID(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	var e catalog.Entry
+	if !bindEntry(c, &e) {
+		return
+	}
+	e.ID = id
+	if err := catalog.UpdateEntryInDB(cImpl.dbRW, e, actor); err != nil {
+		entryError(c, err, "error updating vulnerability")
+		return
+	}
+	cImpl.refreshCatalog()
+	c.JSON(http.StatusOK, e)
+}
+
+func (cImpl *Controller) DeleteVulnerability(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok {
+		return
+	}
+	id, ok := entryID(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	if err := catalog.DeleteEntryFromDB(cImpl.dbRW, id, actor); err != nil {
+		entryError(c, err, "error deleting vulnerability")
+		return
+	}
+	cImpl.refreshCatalog()
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": id})
+}
+
+func requireDB(c *gin.Context, conn *sql.DB) bool {
+	if conn == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "not connected to database"})
+		return false
+	}
+	return true
+}
+
+// parseSince accepts a date (2006-01-02) or an RFC 3339 timestamp.
+func parseSince(v string, defaultValue time.Time) (time.Time, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", v)
+	}
+	return t, nil
+}
+
+// requireActor reads the actor query parameter. Only timestamped signatures cover the query, so
+// requests signed the legacy way, over the body alone, can't name an actor.
+func requireActor(c *gin.Context) (string, bool) {
+	if c.GetHeader(security.TimestampHeader) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "changes with an actor need a " + security.TimestampHeader + " signature",
+		})
+		return "", false
+	}
+	actor := c.Query(actorParam)
+	if actor == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "missing " + actorParam + " query parameter",
+		})
+		return "", false
+	}
+	return actor, true
+}
+
+func entryID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid vulnerability id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func bindEntry(c *gin.Context, e *catalog.Entry) bool {
+	if err := c.BindJSON(e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "couldn't parse vulnerability from body",
+		})
+		return false
+	}
+	if err := catalog.Validate(*e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return false
+	}
+	return true
+}
+
+func entryError(c *gin.Context, err error, reason string) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "vulnerability not found"})
+		return
+	}
+	if err == catalog.ErrInUse {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "failed", "reason": "vulnerability is referenced by findings, update it instead",
+		})
+		return
+	}
+	log.Printf("%s: %v", reason, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": reason + ": " + err.Error()})
+}
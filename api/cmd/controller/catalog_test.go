@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"src/pkg/security"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func signedRequest(t *testing.T, method string, path string, body []byte) *http.Request {
+	request, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("failed setting up test request")
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	h, err := security.CalculateHMAC(security.RequestPayload(ts, method, path, body), mockHMACSecret)
+	if err != nil {
+		t.Errorf("failed to calculate HMAC")
+	}
+	request.Header.Set(security.TimestampHeader, ts)
+	request.Header.Set("Signature", hex.EncodeToString(h))
+	return request
+}
+
+func TestCreateVulnerabilityWithoutActor(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	body := []byte(`{"name":"SQL Injection","cwe_id":89,"severity":"critical","score":20}`)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/vulnerabilities", body))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"actor is required","status":"failed"}`, response.Body.String())
+}
+
+func TestCreateVulnerabilityWithLegacySignature(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	// The body-only signature doesn't cover the actor, anyone could name someone else
+	body := []byte(`{"name":"SQL Injection","cwe_id":89,"severity":"critical","score":20}`)
+	request, _ := http.NewRequest("POST", "/vulnerabilities?actor=alice", bytes.NewReader(body))
+	h, _ := security.CalculateHMAC(body, mockHMACSecret)
+	request.Header.Set("Signature", hex.EncodeToString(h))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"changes with an actor need a Timestamp signature","status":"failed"}`,
+		response.Body.String())
+}
+
+func TestDeleteVulnerabilityReferencedByFindings(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerabilities WHERE id=? FOR UPDATE")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "cwe_id", "plugin_id", "severity", "score",
+			"unclassified", "solution"}).AddRow(7, "XSS", 79, "40012", "high", 8, false, ""))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM vulnerabilities WHERE id=?")).WithArgs(int64(7)).
+		WillReturnError(&mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"})
+	mock.ExpectRollback()
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "DELETE", "/vulnerabilities/7?actor=alice", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"vulnerability is referenced by findings, update it instead","status":"failed"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateVulnerabilityOnInvalidSeverity(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	body := []byte(`{"name":"SQL Injection","cwe_id":89,"severity":"severe","score":20}`)
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "POST", "/vulnerabilities?actor=alice", body)
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"invalid severity \"severe\"","status":"failed"}`, response.Body.String())
+}
+
+func TestCreateVulnerabilityOnSuccess(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerabilities(name, cwe_id, plugin_id, severity, score, unclassified, solution)")).
+		WithArgs("SQL Injection - MySQL", 89, "40019", "critical", 20, false, "").
+		WillReturnResult(sqlmock.NewResult(71, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_audit")).
+		WithArgs(int64(71), "alice", "create", nil, 20, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE configurations")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := []byte(`{"name":"SQL Injection - MySQL","cwe_id":89,"plugin_id":"40019","severity":"critical","score":20}`)
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "POST", "/vulnerabilities?actor=alice", body)
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	expectedResponse := `{"id":71,"name":"SQL Injection - MySQL","cwe_id":89,"plugin_id":"40019",` +
+		`"severity":"critical","score":20,"unclassified":false}`
+	assert.Equal(t, expectedResponse, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetVulnerabilityNotFound(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerabilities WHERE id=?")).WithArgs(int64(999)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "cwe_id", "plugin_id", "severity", "score", "unclassified", "solution",
+		}))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/vulnerabilities/999", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"vulnerability not found","status":"failed"}`, response.Body.String())
+}
@@ -10,7 +10,16 @@ import (
 
 	"src/pkg/security"
 
+	"src/pkg/asset"
+	"src/pkg/catalog"
+	"src/pkg/event"
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/release"
+	"src/pkg/sast"
 	"src/pkg/scan"
+	"src/pkg/scoring"
+	"src/pkg/webhook"
 
 	"src/cmd/config"
 	"src/pkg/zapScanner"
@@ -22,6 +31,8 @@ const (
 	passed              = "passed"
 	failed              = "failed"
 	scanScoringTreshold = 20
+	// How often event streams look for events published by other replicas
+	eventPollInterval = time.Second
 )
 
 type Controller struct {
@@ -29,14 +40,24 @@ type Controller struct {
 	c     *config.Configuration
 	dbRO  *sql.DB
 	dbRW  *sql.DB
-	vulns map[string]scan.Vulnerability
+	vulns *catalog.Cache
+	// events of scans, streamed to clients
+	events *event.Bus
+	// releaseSlots schedules the scans of release targets, one slot per scan
+	releaseSlots chan struct{}
 }
 
 type ScannerService interface {
-	StartScan(string) (string, error)
+	StartScan(target string, policy string) (string, error)
+	StopScan(string) error
 	CheckScan(string) (int, zapScanner.AScanResult, error)
 	CheckScanAlerts(scanID string) (int, []zapScanner.FullAlert, error)
 	GetActiveScanAlerts(scanID string) (map[string]bool, error)
+	GetURLs(baseURL string) ([]string, error)
+	GetJSONReport() ([]byte, error)
+	StartRetest(messageID string, pluginID string) (string, error)
+	RetestAlerts(scanID string) (int, []zapScanner.FullAlert, error)
+	GetMessage(messageID string) (zapScanner.HTTPMessage, error)
 	StartSession(string) error
 	LoadSession(string) error
 	SaveSession(string) error
@@ -47,6 +68,15 @@ type ScanBody struct {
 	Target      string `json:"target"`
 	Application string `json:"application"`
 	Source      string `json:"source"`
+	// CallbackURLs are notified when the scan finishes
+	CallbackURLs []string `json:"callback_urls,omitempty"`
+	// Force scans a build that was already submitted again, as a new attempt
+	Force bool `json:"force,omitempty"`
+	// Profile is the ZAP scan policy and Scope filters the alerts, both set by the targets of a release.
+	// Other scans use the profile of the asset of their application.
+	Profile string           `json:"-"`
+	Scope   *release.Matcher `json:"-"`
+	SASTBody
 }
 
 type StatusBody struct {
@@ -54,20 +84,46 @@ type StatusBody struct {
 }
 
 func New(cfg *config.Configuration, zapService ScannerService, dbRO *sql.DB, dbRW *sql.DB) *Controller {
-	var v map[string]scan.Vulnerability
-	var err error
+	v := &catalog.Cache{}
 	if dbRO != nil {
-		v, err = scan.GetVulnerabilitiesFromDB(dbRO)
+		err := v.Load(dbRO)
 		if err != nil {
 			log.Printf("Error reading vulnerabilities from DB: %v", err)
 		}
 	}
-	c := Controller{zapService, cfg, dbRO, dbRW, v}
+	slots := cfg.ReleaseConcurrency
+	if slots < 1 {
+		slots = 1
+	}
+	c := Controller{zapService, cfg, dbRO, dbRW, v, event.NewBus(dbRW, dbRO, eventPollInterval),
+		make(chan struct{}, slots)}
 	return &c
 }
 
+// WatchCatalog refreshes the vulnerability catalog whenever another replica changes it.
+func (cImpl *Controller) WatchCatalog(interval time.Duration) {
+	for range time.Tick(interval) {
+		cImpl.refreshCatalog()
+	}
+}
+
+func (cImpl *Controller) refreshCatalog() {
+	if cImpl.dbRO == nil {
+		return
+	}
+	reloaded, err := cImpl.vulns.Refresh(cImpl.dbRO)
+	if err != nil {
+		log.Printf("Error refreshing vulnerability catalog: %v", err)
+		return
+	}
+	if reloaded {
+		log.Printf("Vulnerability catalog reloaded, version %d", cImpl.vulns.Snapshot().Version)
+	}
+}
+
 func CreateURLMappings(clr *Controller, cfg *config.Configuration) *gin.Engine {
 	r := gin.Default()
+	addContractMappings(r, cfg)
 
 	r.GET("/ping", clr.HealthCheck)
 
@@ -80,11 +136,14 @@ func CreateURLMappings(clr *Controller, cfg *config.Configuration) *gin.Engine {
 
 	r.POST("/reload", security.AuthMiddleware(cfg.HMACSecret), clr.Reload)
 
+	addAPIMappings(r, clr, cfg)
+
 	return r
 }
 
 func CreateURLMappingsProd(clr *Controller, cfg *config.Configuration) *gin.Engine {
 	r := gin.Default()
+	addContractMappings(r, cfg)
 
 	r.GET("/ping", clr.HealthCheck)
 
@@ -94,9 +153,32 @@ func CreateURLMappingsProd(clr *Controller, cfg *config.Configuration) *gin.Engi
 
 	r.POST("/reload", security.AuthMiddleware(cfg.HMACSecret), clr.Reload)
 
+	addAPIMappings(r, clr, cfg)
+
 	return r
 }
 
+// addAPIMappings registers the routes served in every environment.
+func addAPIMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	addCatalogMappings(r, clr, cfg)
+	addPolicyMappings(r, clr, cfg)
+	addIssueMappings(r, clr, cfg)
+	addReportMappings(r, clr, cfg)
+	addFindingMappings(r, clr, cfg)
+	addDiffMappings(r, clr, cfg)
+	addArtifactMappings(r, clr, cfg)
+	addImportMappings(r, clr, cfg)
+	addSASTMappings(r, clr, cfg)
+	addDefectDojoMappings(r, clr, cfg)
+	addEventMappings(r, clr, cfg)
+	addWebhookMappings(r, clr, cfg)
+	addWaitMappings(r, clr, cfg)
+	addReleaseMappings(r, clr, cfg)
+	addRetestMappings(r, clr, cfg)
+	addAssetMappings(r, clr, cfg)
+	addV2Mappings(r, clr, cfg)
+}
+
 func (cImpl *Controller) HealthCheck(c *gin.Context) {
 	zapStatus, dbro, dbrw := "ok", "ok", "ok"
 	if cImpl.s == (*zapScanner.ZapService)(nil) {
@@ -143,6 +225,12 @@ func (cImpl *Controller) Reload(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error reloading config values: %v", err)
 	}
+	if cImpl.dbRO != nil {
+		err = cImpl.vulns.Load(cImpl.dbRO)
+		if err != nil {
+			log.Printf("Error reloading vulnerability catalog: %v", err)
+		}
+	}
 	// If zap client is not connected
 	if cImpl.s == (*zapScanner.ZapService)(nil) {
 		s, err := zapScanner.NewWithAuth(cImpl.c.ZapURL, cImpl.c.ZapAPIKey)
@@ -150,7 +238,11 @@ func (cImpl *Controller) Reload(c *gin.Context) {
 			cImpl.s = s
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "reloaded", "zap": cImpl.c.ZapURL})
+	c.JSON(http.StatusOK, gin.H{
+		"status":          "reloaded",
+		"zap":             cImpl.c.ZapURL,
+		"catalog_version": cImpl.vulns.Snapshot().Version,
+	})
 }
 
 func (cImpl *Controller) CreateScan(c *gin.Context) {
@@ -181,7 +273,7 @@ func (cImpl *Controller) CreateScan(c *gin.Context) {
 	}
 	l := log.Default()
 	l.Printf("Received scan data %+v", s)
-	scanID, err := cImpl.s.StartScan(s.Target)
+	scanID, err := cImpl.s.StartScan(s.Target, "")
 	if err != nil {
 		log.Printf("Error initiating scan: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -193,6 +285,7 @@ func (cImpl *Controller) CreateScan(c *gin.Context) {
 	var ss scan.Scan
 	ss.Build_id = s.BuildID
 	ss.Build_source = s.Source
+	ss.Application = s.Application
 	ss.Target = s.Target
 	id, err := strconv.Atoi(scanID)
 	if err != nil {
@@ -224,6 +317,34 @@ func (cImpl *Controller) CreateScanAsyncWait(c *gin.Context) {
 		})
 		return
 	}
+	var sastResults []sast.Result
+	var sastRoutes []sast.Route
+	if len(s.SARIF) > 0 {
+		var err error
+		sastResults, sastRoutes, err = parseSAST(s.SASTBody)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+			return
+		}
+	}
+	if err := cImpl.parseCallbacks(s.CallbackURLs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	attempt := 1
+	if cImpl.dbRO != nil && s.BuildID != "" {
+		prior, n, apiErr := cImpl.resolveSubmission(s)
+		if apiErr != nil {
+			c.JSON(apiErr.status, gin.H{"status": "failed", "reason": apiErr.message})
+			return
+		}
+		if prior.ID > 0 {
+			cImpl.addCallbacks(prior, s.CallbackURLs)
+			c.JSON(http.StatusOK, gin.H{"scanID": strconv.Itoa(prior.Zap_id), "status": "started"})
+			return
+		}
+		attempt = n
+	}
 	/*err := cImpl.s.StartSession(s.BuildID)
 	if err != nil {
 		log.Printf("Error creating session for scan: %v", err)
@@ -233,20 +354,49 @@ func (cImpl *Controller) CreateScanAsyncWait(c *gin.Context) {
 		})
 		return
 	}*/
-	l := log.Default()
-	l.Printf("Received scan data %+v", s)
-	scanID, err := cImpl.s.StartScan(s.Target)
+	ss, err := cImpl.launchScan(s, attempt, sastResults, sastRoutes)
+	if err == scan.ErrDuplicate {
+		// Another replica recorded the same attempt first, its scan is the one
+		if ss, apiErr := findScan(cImpl.dbRW, s.BuildID); apiErr == nil {
+			c.JSON(http.StatusOK, gin.H{"scanID": strconv.Itoa(ss.Zap_id), "status": "started"})
+			return
+		}
+	}
 	if err != nil {
-		log.Printf("Error initiating scan: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "failed",
 			"reason": "zap client error: " + err.Error(),
 		})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"scanID": strconv.Itoa(ss.Zap_id), "status": "started"})
+}
+
+// launchScan starts the ZAP scan of a submission and records it as an attempt of its build with its
+// SAST results, then waits for it in the background. Besides ZAP errors it returns
+// scan.ErrDuplicate, after stopping the ZAP scan, when the build already has the attempt. Other
+// scans that couldn't be recorded have no ID.
+func (cImpl *Controller) launchScan(s ScanBody, attempt int, sastResults []sast.Result, sastRoutes []sast.Route,
+) (scan.Scan, error) {
+	l := log.Default()
+	l.Printf("Received scan data build %s target %s application %s source %s, %d SAST results", s.BuildID,
+		s.Target, s.Application, s.Source, len(sastResults))
+	if s.Profile == "" && s.Application != "" && cImpl.dbRO != nil {
+		a, err := asset.GetApplicationAssetFromDB(cImpl.dbRO, s.Application)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error reading asset of application %s, scanning with the default policy: %v", s.Application, err)
+		}
+		s.Profile = a.Profile
+	}
+	scanID, err := cImpl.s.StartScan(s.Target, s.Profile)
+	if err != nil {
+		log.Printf("Error initiating scan: %v", err)
+		return scan.Scan{}, err
+	}
 	var ss scan.Scan
 	ss.Build_id = s.BuildID
 	ss.Build_source = s.Source
+	ss.Application = s.Application
 	ss.Target = s.Target
 	id, err := strconv.Atoi(scanID)
 	if err != nil {
@@ -254,12 +404,29 @@ func (cImpl *Controller) CreateScanAsyncWait(c *gin.Context) {
 	}
 	ss.Zap_id = id
 	ss.Status = "started"
+	ss.Attempt = attempt
 	ss.ID, err = scan.AddScanToDB(cImpl.dbRW, ss)
+	if err == scan.ErrDuplicate {
+		log.Printf("Build %s already has attempt %d, stopping ZAP scan %s", ss.Build_id, attempt, scanID)
+		if err := cImpl.s.StopScan(scanID); err != nil {
+			log.Printf("Error stopping ZAP scan %s: %v", scanID, err)
+		}
+		return ss, scan.ErrDuplicate
+	}
 	if err != nil {
 		log.Printf("Error adding scan to database: %v", err)
+	} else {
+		if len(sastResults) > 0 || len(sastRoutes) > 0 {
+			if _, err := sast.ReplaceResultsInDB(cImpl.dbRW, ss.ID, sastResults, sastRoutes); err != nil {
+				log.Printf("Error saving SAST results of scan %s: %v", ss.Build_id, err)
+			}
+		}
+		if err := webhook.AddWebhooksToDB(cImpl.dbRW, ss.ID, s.CallbackURLs); err != nil {
+			log.Printf("Error registering callback URLs of scan %s: %v", ss.Build_id, err)
+		}
 	}
-	go cImpl.waitForScan(cImpl.dbRW, ss)
-	c.JSON(http.StatusOK, gin.H{"scanID": scanID, "status": "started"})
+	go cImpl.waitForScan(cImpl.dbRW, ss, s.Scope)
+	return ss, nil
 }
 
 func (cImpl *Controller) GetScanStatus(c *gin.Context) {
@@ -350,7 +517,7 @@ func (cImpl *Controller) GetScanStatusFromDB(c *gin.Context) {
 		})
 		return
 	}
-	if (s.Status == "failed") || (s.Status == "passed") || (s.Status == "error") || (s.Status == "started") {
+	if scan.Finished(s.Status) || s.Status == scan.StatusStarted {
 		c.JSON(http.StatusOK, gin.H{
 			"status": s.Status,
 		})
@@ -362,10 +529,12 @@ func (cImpl *Controller) GetScanStatusFromDB(c *gin.Context) {
 	}
 }
 
-func (cImpl *Controller) waitForScan(conn *sql.DB, s scan.Scan) {
+func (cImpl *Controller) waitForScan(conn *sql.DB, s scan.Scan, scope *release.Matcher) {
 	progress := 0
 	scanID := strconv.Itoa(s.Zap_id)
 	log.Printf("%+v\n", s)
+	cImpl.publish(s, event.TypePhase, event.Phase{Phase: event.PhaseScanning})
+	published := -1
 	var result []zapScanner.FullAlert
 	var err error
 	for progress < 100 {
@@ -373,45 +542,169 @@ func (cImpl *Controller) waitForScan(conn *sql.DB, s scan.Scan) {
 		if err != nil {
 			log.Printf("Error getting scan status: %v", err)
 		}
-		err = scan.UpdateScanStatus(conn, strconv.Itoa(progress), s.Build_id)
-		if err != nil {
+		if cancelled, err := scan.UpdateActiveScanStatus(conn, strconv.Itoa(progress), s.ID); err != nil {
 			log.Printf("Error updating scan status: %v", err)
+		} else if cancelled {
+			log.Printf("Scan %s was cancelled", s.Build_id)
+			return
+		}
+		if progress >= 0 && progress != published {
+			cImpl.publish(s, event.TypeProgress, event.Progress{Progress: progress})
+			published = progress
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
+	if status, err := scan.GetAttemptStatusFromDB(conn, s.ID); err == nil && status == scan.StatusCancelled {
+		log.Printf("Scan %s was cancelled", s.Build_id)
+		return
+	}
+	cImpl.publish(s, event.TypePhase, event.Phase{Phase: event.PhaseAnalyzing})
 	idsFromScan, err := cImpl.s.GetActiveScanAlerts(scanID)
 	if err != nil {
 		log.Printf("Failed to get active scan alert ids: %v", err)
 	}
-	r := checkAlerts(conn, result, s.ID, idsFromScan, cImpl.vulns)
+	urls, err := cImpl.s.GetURLs(s.Target)
+	if err != nil {
+		log.Printf("Failed to get discovered urls: %v", err)
+	} else if err := scan.AddScanURLsToDB(conn, s.ID, scopedURLs(urls, scope)); err != nil {
+		log.Printf("Error saving discovered urls of scan %s: %v", s.Build_id, err)
+	}
+	result = scopedAlerts(result, scope)
+	cImpl.refreshCatalog()
+	findings, v := checkAlerts(conn, result, s, idsFromScan, cImpl.gatePolicy())
+	cImpl.publishFindings(s, findings)
 	status := "failed"
-	if r {
+	if v.Passed {
 		status = "passed"
 	}
-	err = scan.UpdateScanStatus(conn, status, s.Build_id)
-	if err != nil {
+	// Archive before the final status, so artifacts are listed once clients see the scan finished
+	cImpl.publish(s, event.TypePhase, event.Phase{Phase: event.PhaseArchiving})
+	finished := s
+	finished.Status = status
+	cImpl.archiveScan(conn, finished, result, findings)
+	// A scan cancelled while it was analyzed or archived keeps its status, and its cancellation was
+	// already announced
+	if cancelled, err := scan.UpdateActiveScanStatus(conn, status, s.ID); err != nil {
 		log.Printf("Error updating scan status: %v", err)
+	} else if cancelled {
+		log.Printf("Scan %s was cancelled, discarding its %s verdict", s.Build_id, status)
+		return
 	}
-	/*err = cImpl.s.SaveSession(s.Build_id)
+	cImpl.finishScan(conn, s, event.Verdict{Status: status, Score: &v.Score, Findings: len(findings)}, findings)
+	cImpl.autoPushScan(conn, s)
+}
+
+// gatePolicy builds the gate from the current configuration, so /reload picks up changes.
+func (cImpl *Controller) gatePolicy() gate.Policy {
+	sc := cImpl.c.Scoring
+	m, err := scoring.NewModel(sc.Mode, sc.Aggregation, sc.Cap, sc.Weights, float64(sc.Threshold))
 	if err != nil {
-		log.Printf("Error saving session for scan: %s %v", s.Build_id, err)
-	}*/
+		log.Printf("Invalid scoring configuration, using %s mode: %v", m.Mode, err)
+	}
+	m.Confirmed = sc.Confirmed
+	uc := cImpl.c.Unmapped
+	u, err := catalog.NewUnmappedPolicy(uc.Policy, uc.RiskScores, uc.AutoCreate)
+	if err != nil {
+		log.Printf("Invalid unmapped alert configuration, using %s policy: %v", u.Action, err)
+	}
+	return gate.Policy{Vulnerabilities: cImpl.vulns.Snapshot(), Scoring: m, Unmapped: u}
 }
 
-func checkAlerts(conn *sql.DB, alerts []zapScanner.FullAlert, scanID int64, ids map[string]bool,
-	vulnerabilities map[string]scan.Vulnerability,
-) bool {
-	score := 0
+// checkAlerts records the findings of the alerts raised by the active scan and evaluates them.
+func checkAlerts(conn *sql.DB, alerts []zapScanner.FullAlert, s scan.Scan, ids map[string]bool, policy gate.Policy,
+) ([]finding.Finding, gate.Verdict) {
+	var findings []finding.Finding
 	for _, a := range alerts {
 		if _, ok := ids[a.ID]; ok {
-			d := fmt.Sprintf("[Finding] CWE %s URL %s: %s \n", a.Cweid, a.URL, a.Description)
-			v := vulnerabilities[a.Cweid]
-			err := scan.AddVulnerabilityFinding(conn, scanID, v.ID, d)
-			if err != nil {
-				log.Printf("Error when saving findings to DB %v\n", err)
-			}
-			score += v.Score
+			findings = append(findings, alertFinding(s, a))
+		}
+	}
+	findings = recordFindings(conn, s, finding.SourceZAP, findings, policy)
+	v := policy.Evaluate(findings)
+	log.Printf("Scan %s scored %.2f (%s mode, threshold %.2f), %d unmapped alerts, passed: %t", s.Build_id,
+		v.Score, policy.Scoring.Mode, policy.Scoring.Threshold, v.Unmapped, v.Passed)
+	return findings, v
+}
+
+func alertFinding(s scan.Scan, a zapScanner.FullAlert) finding.Finding {
+	return finding.Finding{
+		ScanID:      s.ID,
+		Fingerprint: finding.Fingerprint(s.Application, a.PluginID, a.URL, a.Method, a.Param),
+		PluginID:    a.PluginID,
+		Name:        a.Name,
+		CweID:       a.Cweid,
+		Risk:        a.Risk,
+		Confidence:  a.Confidence,
+		URL:         a.URL,
+		Method:      a.Method,
+		Param:       a.Param,
+		Attack:      a.Attack,
+		Evidence:    a.Evidence,
+		Solution:    a.Solution,
+		Reference:   a.Reference,
+		Details:     fmt.Sprintf("[Finding] CWE %s URL %s: %s \n", a.Cweid, a.URL, a.Description),
+		MessageID:   a.MessageID,
+	}
+}
+
+// recordFindings stores findings of a scan with their catalog entry, creating unclassified entries
+// when the unmapped policy asks for it, correlates them with the scan's SAST results and updates the
+// issues source reported for the application. The findings are returned with their catalog entry,
+// SAST result and suppression.
+func recordFindings(conn *sql.DB, s scan.Scan, source string, findings []finding.Finding, policy gate.Policy,
+) []finding.Finding {
+	created := make(map[string]catalog.Entry)
+	for i := range findings {
+		f := &findings[i]
+		v, ok := policy.Vulnerabilities.Lookup(f.PluginID, f.CweID)
+		if !ok {
+			v, ok = created[f.PluginID]
+		}
+		if !ok && policy.Unmapped.AutoCreate {
+			v = addUnclassified(conn, policy.Unmapped, *f)
+			created[f.PluginID] = v
+		}
+		f.VulnerabilityID = v.ID
+		id, err := finding.AddFindingToDB(conn, *f)
+		if err != nil {
+			log.Printf("Error when saving findings to DB %v\n", err)
+			continue
 		}
+		f.ID = id
+	}
+	if len(findings) > 0 {
+		if n, err := sast.CorrelateScan(conn, s.ID, findings); err != nil {
+			log.Printf("Error correlating findings of scan %s with SAST results: %v", s.Build_id, err)
+		} else if n > 0 {
+			log.Printf("%d findings of scan %s confirmed by SAST results", n, s.Build_id)
+		}
+	}
+	if s.Application == "" {
+		log.Printf("Scan %s has no application, skipping issue tracking", s.Build_id)
+		return findings
+	}
+	if err := finding.TrackIssues(conn, s.Application, s.ID, source, findings); err != nil {
+		log.Printf("Error tracking issues for %s: %v", s.Application, err)
+	}
+	suppressed, err := finding.GetSuppressedFromDB(conn, s.Application)
+	if err != nil {
+		log.Printf("Error reading suppressed issues for %s: %v", s.Application, err)
+	}
+	for i := range findings {
+		findings[i].SuppressionReason, findings[i].Suppressed = suppressed[findings[i].Fingerprint]
+	}
+	return findings
+}
+
+// addUnclassified creates the catalog entry of an unmapped alert so it can be curated later.
+func addUnclassified(conn *sql.DB, policy catalog.UnmappedPolicy, f finding.Finding) catalog.Entry {
+	e := policy.Unclassified(f.PluginID, f.Name, f.CweID, f.Risk)
+	e.Solution = f.Solution
+	id, err := catalog.AddEntryToDB(conn, e, catalog.SystemActor)
+	if err != nil {
+		log.Printf("Error creating unclassified vulnerability for plugin %s: %v", f.PluginID, err)
+		return catalog.Entry{}
 	}
-	return score < 8
+	e.ID = id
+	return e
 }
@@ -7,8 +7,14 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 
+	"src/pkg/catalog"
+	"src/pkg/gate"
+	"src/pkg/scan"
+	"src/pkg/scoring"
 	"src/pkg/security"
 
 	"src/pkg/zapScanner"
@@ -23,20 +29,38 @@ import (
 type zapSVMock struct {
 	StartScanResponse string
 	StartScanError    error
+	// StartScanPolicy records the policy scans are started with
+	StartScanPolicy *string
+	StopScanError   error
 
 	CheckScanProgress int
 	CheckScanResult   zapScanner.AScanResult
 	CheckScanError    error
+
+	JSONReport []byte
+	Messages   map[string]zapScanner.HTTPMessage
+
+	RetestScanID   string
+	RetestError    error
+	RetestProgress int
+	RetestFound    []zapScanner.FullAlert
 }
 
 var cfg = config.New()
 
 const mockHMACSecret = "5cdca760d1bccf301f765ed372028389652b70dd70256e69db28b2222792e21d"
 
-func (z zapSVMock) StartScan(url string) (string, error) {
+func (z zapSVMock) StartScan(url string, policy string) (string, error) {
+	if z.StartScanPolicy != nil {
+		*z.StartScanPolicy = policy
+	}
 	return z.StartScanResponse, z.StartScanError
 }
 
+func (z zapSVMock) StopScan(id string) error {
+	return z.StopScanError
+}
+
 func (z zapSVMock) CheckScan(id string) (int, zapScanner.AScanResult, error) {
 	return z.CheckScanProgress, z.CheckScanResult, z.CheckScanError
 }
@@ -61,6 +85,30 @@ func (z zapSVMock) GetActiveScanAlerts(scanID string) (map[string]bool, error) {
 	return nil, nil
 }
 
+func (z zapSVMock) GetURLs(baseURL string) ([]string, error) {
+	return nil, nil
+}
+
+func (z zapSVMock) GetJSONReport() ([]byte, error) {
+	return z.JSONReport, nil
+}
+
+func (z zapSVMock) StartRetest(messageID string, pluginID string) (string, error) {
+	return z.RetestScanID, z.RetestError
+}
+
+func (z zapSVMock) GetMessage(messageID string) (zapScanner.HTTPMessage, error) {
+	m, ok := z.Messages[messageID]
+	if !ok {
+		return m, errors.New("does_not_exist: Does Not Exist")
+	}
+	return m, nil
+}
+
+func (z zapSVMock) RetestAlerts(scanID string) (int, []zapScanner.FullAlert, error) {
+	return z.RetestProgress, z.RetestFound, nil
+}
+
 func TestHealthCheckOk(t *testing.T) {
 	zap := zapSVMock{
 		StartScanResponse: "",
@@ -118,6 +166,8 @@ func TestCreateScanOnSuccess(t *testing.T) {
 	}
 	db, mock, _ := sqlmock.New()
 	cfg.HMACSecret = mockHMACSecret
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
 	mock.ExpectExec("INSERT INTO scans(status, build_id, build_source, zap_id)" +
 		" VALUES(\"started\", \"abcde-1234\", \"spinnaker\", \"1\") ")
 
@@ -150,6 +200,35 @@ func TestCreateScanOnSuccess(t *testing.T) {
 	assert.Equal(t, expectedResponse, response.Body.String())
 }
 
+func TestCreateScanResubmission(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+			WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+				AddRow(1, "45", "abcde-1234", "spinnaker", "example", "www.example.com", 7, time.Now()))
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scan", []byte(`{"build_id":"abcde-1234",`+
+		`"target":"www.example.com","application":"example","source":"spinnaker"}`)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"scanID":"7","status":"started"}`, response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scan", []byte(`{"build_id":"abcde-1234",`+
+		`"target":"www.example.org","application":"example","source":"spinnaker"}`)))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"build abcde-1234 was already submitted with another target, application or source, `+
+		`set force to scan it again","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestCreateScanOnBadSignature(t *testing.T) {
 	zap := zapSVMock{
 		StartScanResponse: "1",
@@ -293,7 +372,7 @@ func TestCreateScanOnBadRequest(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, response.Code, "Expected code %d, received code %d",
 		http.StatusBadRequest, response.Code)
-	expectedResponse := `{"reason":"couldn't parse scan information from body","status":"failed"}`
+	expectedResponse := `{"reason":"invalid JSON body","status":"failed"}`
 	assert.Equal(t, expectedResponse, response.Body.String())
 }
 
@@ -553,3 +632,92 @@ func TestGetScanInformationOnZapConnectionError(t *testing.T) {
 	expectedResponse := `{"reason":"not connected to zap scanner instance","status":"failed"}`
 	assert.Equal(t, expectedResponse, response.Body.String())
 }
+
+func unmappedAlertPolicy(action string) gate.Policy {
+	u, _ := catalog.NewUnmappedPolicy(action, "", false)
+	return gate.Policy{
+		Vulnerabilities: catalog.NewSnapshot(1, []catalog.Entry{
+			{ID: 24, Name: "SQL Injection", CweID: 89, Severity: "critical", Score: 20},
+		}),
+		Scoring:  scoring.Legacy(8),
+		Unmapped: u,
+	}
+}
+
+var unmappedAlerts = []zapScanner.FullAlert{
+	{ID: "1", PluginID: "10038", Cweid: "693", Risk: "High", Confidence: "High", URL: "https://a/"},
+}
+
+func TestCheckAlertsUnmappedPolicies(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	s := scan.Scan{ID: 1, Build_id: "abcde-1234"}
+	ids := map[string]bool{"1": true}
+
+	_, v := checkAlerts(db, unmappedAlerts, s, ids, unmappedAlertPolicy("ignore"))
+	assert.True(t, v.Passed)
+	_, v = checkAlerts(db, unmappedAlerts, s, ids, unmappedAlertPolicy("risk"))
+	assert.False(t, v.Passed)
+	_, v = checkAlerts(db, unmappedAlerts, s, ids, unmappedAlertPolicy("fail"))
+	assert.False(t, v.Passed)
+}
+
+func TestCheckAlertsStoresUnmappedFindingWithoutVulnerability(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_findings")).
+		WithArgs(int64(1), nil, sqlmock.AnyArg(), sqlmock.AnyArg(), "10038", "", "693", "High", "High",
+			"https://a/", "", "", "", "", "", "", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s := scan.Scan{ID: 1, Build_id: "abcde-1234"}
+
+	checkAlerts(db, unmappedAlerts, s, map[string]bool{"1": true}, unmappedAlertPolicy("ignore"))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckAlertsWeighsFindingsConfirmedBySAST(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_findings")).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(sastResultColumns).
+			AddRow(3, 1, "CodeQL", "go/sql-injection", "89", "internal/users/handler.go", 42, "error", "SQLi"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_routes WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "path", "file"}).
+			AddRow("GET", "/users/{id}", "internal/users/handler.go"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerability_findings SET sast_result_id=? WHERE id=?")).
+		WithArgs(int64(3), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	policy := unmappedAlertPolicy("ignore")
+	policy.Scoring = scoring.Legacy(30)
+	policy.Scoring.Confirmed = 2
+	alerts := []zapScanner.FullAlert{
+		{ID: "1", PluginID: "40018", Cweid: "89", Risk: "High", Confidence: "Medium", URL: "https://a/users/1",
+			Method: "GET"},
+	}
+
+	// 20 on its own, 40 confirmed by the SAST result
+	findings, v := checkAlerts(db, alerts, scan.Scan{ID: 1, Build_id: "abcde-1234"}, map[string]bool{"1": true},
+		policy)
+	assert.False(t, v.Passed)
+	assert.Equal(t, int64(7), findings[0].ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanStatusOfCancelledScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, status, build_id, zap_id FROM scans WHERE build_id=?")).
+		WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "build_id", "zap_id"}).
+			AddRow(1, "cancelled", "abcde-1234", 7))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/status", []byte(`{"ScanID":"abcde-1234"}`)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"status":"cancelled"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"src/cmd/config"
+	"src/pkg/defectdojo"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addDefectDojoMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/defectdojo", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanDefectDojoPushes)
+	r.POST("/scans/:id/defectdojo", security.AuthMiddleware(cfg.HMACSecret), clr.PushScanToDefectDojo)
+}
+
+// dojoClient builds the DefectDojo client from the current configuration, nil when pushing is
+// disabled.
+func (cImpl *Controller) dojoClient() *defectdojo.Client {
+	dc := cImpl.c.DefectDojo
+	if dc.URL == "" {
+		return nil
+	}
+	return defectdojo.NewClient(dc.URL, dc.Token)
+}
+
+// GetScanDefectDojoPushes lists when a scan was pushed to DefectDojo. The id is the build ID.
+func (cImpl *Controller) GetScanDefectDojoPushes(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	pushes, err := defectdojo.GetPushesFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading DefectDojo pushes of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading pushes: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": s.Build_id, "pushes": pushes})
+}
+
+// PushScanToDefectDojo uploads the findings of a finished scan to the DefectDojo product and
+// engagement of its asset, reimporting into the test of the previous push.
+func (cImpl *Controller) PushScanToDefectDojo(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	client := cImpl.dojoClient()
+	if client == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "failed", "reason": "DefectDojo isn't configured"})
+		return
+	}
+	r, ok := cImpl.loadReport(c)
+	if !ok {
+		return
+	}
+	p, err := defectdojo.PushReport(cImpl.dbRO, cImpl.dbRW, client, r, cImpl.c.DefectDojo.Engagement)
+	if err == defectdojo.ErrNoMapping {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	if err != nil && p.TestID == 0 {
+		log.Printf("Error pushing scan %s to DefectDojo: %v", r.Scan.Build_id, err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "reason": "error pushing to DefectDojo: " + err.Error()})
+		return
+	}
+	if err != nil {
+		// The upload went through, only the record of it is missing
+		log.Printf("Error recording the DefectDojo push of scan %s: %v", r.Scan.Build_id, err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "pushed",
+		"scan_id":    r.Scan.Build_id,
+		"product":    p.Product,
+		"engagement": p.Engagement,
+		"test_id":    p.TestID,
+		"reimport":   p.Reimport,
+		"findings":   p.Findings,
+	})
+}
+
+// autoPushScan pushes a completed scan to DefectDojo when DEFECTDOJO_AUTO_PUSH is set. Failures
+// are logged, the scan result doesn't depend on them.
+func (cImpl *Controller) autoPushScan(conn *sql.DB, s scan.Scan) {
+	client := cImpl.dojoClient()
+	if client == nil || !cImpl.c.DefectDojo.AutoPush {
+		return
+	}
+	findings, err := finding.GetFindingsFromDB(conn, s.ID)
+	if err != nil {
+		log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+		return
+	}
+	r := report.New(s, findings, cImpl.gatePolicy())
+	p, err := defectdojo.PushReport(conn, conn, client, r, cImpl.c.DefectDojo.Engagement)
+	if err != nil {
+		log.Printf("Error pushing scan %s to DefectDojo: %v", s.Build_id, err)
+		return
+	}
+	log.Printf("Pushed %d findings of scan %s to DefectDojo %s/%s test %d", p.Findings, s.Build_id, p.Product,
+		p.Engagement, p.TestID)
+}
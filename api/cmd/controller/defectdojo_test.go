@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const dojoMappingQuery = "FROM scans s JOIN assets a ON a.id = s.asset_id"
+
+var dojoPushColumns = []string{
+	"id", "scan_id", "application", "product", "engagement", "test_id", "reimport", "findings", "created_at",
+}
+
+func TestPushScanToDefectDojoNotConfigured(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/defectdojo", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, `{"reason":"DefectDojo isn't configured","status":"failed"}`, response.Body.String())
+}
+
+func TestPushScanToDefectDojo(t *testing.T) {
+	var fields map[string][]string
+	dojo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/import-scan/", r.URL.Path)
+		assert.Equal(t, "Token dojo-key", r.Header.Get("Authorization"))
+		assert.Nil(t, r.ParseMultipartForm(1<<20))
+		fields = r.MultipartForm.Value
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"test_id": 31, "engagement_id": 4, "product_id": 2}`)
+	}))
+	defer dojo.Close()
+	cfg.HMACSecret = mockHMACSecret
+	cfg.DefectDojo.URL = dojo.URL
+	cfg.DefectDojo.Token = "dojo-key"
+	defer func() { cfg.DefectDojo.URL = "" }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).AddRow(1, 1, 0, "fp-1", "40018", "SQL Injection", "89",
+			"High", "Medium", "https://shop/?id=1", "GET", "id", "1'", "", "", "", "", false, "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta(dojoMappingQuery)).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}).AddRow("Shop", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM defectdojo_pushes WHERE application=?")).
+		WithArgs("shop", "Shop", "DAST").WillReturnRows(sqlmock.NewRows(dojoPushColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO defectdojo_pushes(")).
+		WithArgs(int64(1), "shop", "Shop", "DAST", 31, false, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/defectdojo", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"engagement":"DAST","findings":1,"product":"Shop","reimport":false,"scan_id":"abcde-1234",`+
+		`"status":"pushed","test_id":31}`, response.Body.String())
+	assert.Equal(t, []string{"Shop"}, fields["product_name"])
+	assert.Equal(t, []string{"DAST shop"}, fields["test_title"])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPushScanToDefectDojoWithoutAsset(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.DefectDojo.URL = "http://defectdojo.invalid"
+	defer func() { cfg.DefectDojo.URL = "" }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(dojoMappingQuery)).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/defectdojo", nil))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Equal(t, `{"reason":"no asset maps the application to a DefectDojo product","status":"failed"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addDiffMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/diff", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanDiff)
+}
+
+// GetScanDiff compares two finished scans of the same application, given by their build IDs in the
+// base and head query parameters.
+func (cImpl *Controller) GetScanDiff(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	format := c.DefaultQuery("format", report.FormatJSON)
+	if format != report.FormatJSON && format != report.FormatMarkdown {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": fmt.Sprintf("unknown format %q", format)})
+		return
+	}
+	if c.Query("base") == "" || c.Query("head") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "base and head are required"})
+		return
+	}
+	base, ok := cImpl.loadScanResult(c, "base")
+	if !ok {
+		return
+	}
+	head, ok := cImpl.loadScanResult(c, "head")
+	if !ok {
+		return
+	}
+	if base.Scan.Application != head.Scan.Application {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "base and head belong to different applications",
+		})
+		return
+	}
+	cImpl.refreshCatalog()
+	d := report.NewScanDiff(base, head, cImpl.gatePolicy())
+	if format == report.FormatJSON {
+		c.JSON(http.StatusOK, d)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteDiffMarkdown(&b, d); err != nil {
+		log.Printf("Error rendering diff of %s and %s: %v", base.Scan.Build_id, head.Scan.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error rendering diff: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", b.Bytes())
+}
+
+// loadScanResult reads the finished scan named by the query parameter with its findings and URLs.
+// It writes the error response itself when the scan can't be compared.
+func (cImpl *Controller) loadScanResult(c *gin.Context, param string) (report.ScanResult, bool) {
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, c.Query(param))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": param + " scan not found"})
+		return report.ScanResult{}, false
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", c.Query(param), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return report.ScanResult{}, false
+	}
+	if s.Status != passed && s.Status != failed {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": param + " scan hasn't finished"})
+		return report.ScanResult{}, false
+	}
+	findings, err := finding.GetFindingsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading findings: " + err.Error(),
+		})
+		return report.ScanResult{}, false
+	}
+	urls, err := scan.GetScanURLsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading URLs of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading URLs: " + err.Error()})
+		return report.ScanResult{}, false
+	}
+	return report.ScanResult{Scan: s, Findings: findings, URLs: urls}, true
+}
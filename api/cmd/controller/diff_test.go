@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/report"
+)
+
+var diffFindingColumns = []string{
+	"id", "scan_id", "vulnerability_id", "fingerprint", "plugin_id", "name", "cwe_id", "risk", "confidence", "url",
+	"method", "param", "attack", "evidence", "solution", "reference", "details", "suppressed", "suppression_reason",
+	"sast_result_id",
+}
+
+func TestGetScanDiffRequiresBaseAndHead(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/diff?base=abcde-1234", nil))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"head is required","status":"failed"}`, response.Body.String())
+}
+
+func TestGetScanDiffHeadNotFound(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_urls WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-9999").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/diff?base=abcde-1234&head=abcde-9999", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"head scan not found","status":"failed"}`, response.Body.String())
+}
+
+func expectScanResult(mock sqlmock.Sqlmock, id int64, buildID string, application string, findings *sqlmock.Rows,
+	urls ...string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs(buildID).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(id, "failed", buildID, "github", application, "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(id).WillReturnRows(findings)
+	rows := sqlmock.NewRows([]string{"url"})
+	for _, u := range urls {
+		rows.AddRow(u)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_urls WHERE scan_id=?")).WithArgs(id).WillReturnRows(rows)
+}
+
+func TestGetScanDiffDifferentApplications(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	expectScanResult(mock, 1, "abcde-1234", "shop", sqlmock.NewRows(nil))
+	expectScanResult(mock, 2, "abcde-1235", "blog", sqlmock.NewRows(nil))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/diff?base=abcde-1234&head=abcde-1235", nil))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"base and head belong to different applications","status":"failed"}`,
+		response.Body.String())
+}
+
+func TestGetScanDiff(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	expectScanResult(mock, 1, "abcde-1234", "shop", sqlmock.NewRows(diffFindingColumns).
+		AddRow(1, 1, 0, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1", "GET",
+			"id", "1'", "", "", "", "", false, "", 0), "https://shop/", "https://shop/login")
+	expectScanResult(mock, 2, "abcde-1235", "shop", sqlmock.NewRows(diffFindingColumns).
+		AddRow(2, 2, 0, "fp-2", "10038", "CSP Header Not Set", "693", "Medium", "High", "https://shop/", "GET",
+			"", "", "", "", "", "", false, "", 0), "https://shop/", "https://shop/admin")
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/diff?base=abcde-1234&head=abcde-1235", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	var d report.ScanDiff
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &d))
+	assert.Equal(t, report.DiffSummary{New: 1, Fixed: 1, URLsAdded: 1, URLsRemoved: 1}, d.Summary)
+	assert.Equal(t, "fp-2", d.New[0].Fingerprint)
+	assert.Equal(t, "fp-1", d.Fixed[0].Fingerprint)
+	assert.Equal(t, []string{"https://shop/admin"}, d.Surface.Added)
+	assert.Equal(t, []string{"https://shop/login"}, d.Surface.Removed)
+}
+
+func TestGetScanDiffMarkdown(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	expectScanResult(mock, 1, "abcde-1234", "shop", sqlmock.NewRows(nil))
+	expectScanResult(mock, 2, "abcde-1235", "shop", sqlmock.NewRows(nil), "https://shop/admin")
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response,
+		signedRequest(t, "GET", "/scans/diff?base=abcde-1234&head=abcde-1235&format=markdown", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), "### DAST changes `abcde-1234` → `abcde-1235` (shop)")
+	assert.Contains(t, response.Body.String(), "- `https://shop/admin`")
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/event"
+	"src/pkg/finding"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long an event stream stays quiet before a keep-alive comment, so proxies don't close it.
+const eventKeepAlive = 15 * time.Second
+
+func addEventMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/events", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanEvents)
+}
+
+// publish records an event of a scan. Events are informative, failing to record one doesn't
+// fail the scan.
+func (cImpl *Controller) publish(s scan.Scan, typ string, data interface{}) {
+	if s.ID <= 0 {
+		return
+	}
+	if _, err := cImpl.events.Publish(s.ID, typ, data); err != nil {
+		log.Printf("Error publishing %s event of scan %s: %v", typ, s.Build_id, err)
+	}
+}
+
+// publishFindings sends an event for each finding that was recorded.
+func (cImpl *Controller) publishFindings(s scan.Scan, findings []finding.Finding) {
+	vulns := cImpl.vulns.Snapshot()
+	for _, f := range findings {
+		if f.ID == 0 {
+			continue
+		}
+		v, _ := vulns.ByID(f.VulnerabilityID)
+		cImpl.publish(s, event.TypeFinding, event.Finding{
+			ID:          f.ID,
+			Fingerprint: f.Fingerprint,
+			PluginID:    f.PluginID,
+			Name:        f.Name,
+			CweID:       f.CweID,
+			Severity:    v.Severity,
+			Risk:        f.Risk,
+			URL:         f.URL,
+			Method:      f.Method,
+			Param:       f.Param,
+			Suppressed:  f.Suppressed,
+		})
+	}
+}
+
+// GetScanEvents streams the events of a scan as Server-Sent Events: phase changes, progress, the
+// findings once they're recorded and the verdict, which ends the stream. The id is the build ID. A
+// client reconnecting with Last-Event-ID gets the events it missed; a finished scan replays its
+// events.
+func (cImpl *Controller) GetScanEvents(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	var after int64
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		var err error
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil || after < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid Last-Event-ID \"" + v + "\""})
+			return
+		}
+	}
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "scan not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return
+	}
+
+	if scan.Finished(s.Status) {
+		events, err := event.EventsFromDB(cImpl.dbRO, s.ID, after)
+		if err != nil {
+			log.Printf("Error reading events of scan %s: %v", s.Build_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failed", "reason": "error reading events: " + err.Error(),
+			})
+			return
+		}
+		if len(events) == 0 && after == 0 {
+			// The scan finished before its events were recorded
+			data, _ := json.Marshal(event.Verdict{Status: s.Status})
+			events = []event.Event{{Type: event.TypeVerdict, Data: data}}
+		}
+		startEventStream(c)
+		for _, e := range events {
+			writeEvent(c, e)
+		}
+		return
+	}
+
+	sub := cImpl.events.Subscribe(s.ID, after)
+	defer sub.Close()
+	startEventStream(c)
+	for {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), eventKeepAlive)
+		events, err := sub.Next(ctx)
+		cancel()
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		if err == context.DeadlineExceeded {
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+			continue
+		}
+		if err != nil {
+			// The client reconnects and resumes after the last event it got
+			log.Printf("Error reading events of scan %s: %v", s.Build_id, err)
+			return
+		}
+		for _, e := range events {
+			writeEvent(c, e)
+			if e.Type == event.TypeVerdict {
+				return
+			}
+		}
+	}
+}
+
+func startEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+func writeEvent(c *gin.Context, e event.Event) {
+	if e.ID > 0 {
+		fmt.Fprintf(c.Writer, "id: %d\n", e.ID)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+	c.Writer.Flush()
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var eventColumns = []string{"id", "scan_id", "type", "data", "created_at"}
+
+func TestGetScanEventsReplaysFinishedScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events WHERE scan_id=? AND id>?")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(1, 1, "phase", `{"phase":"scanning"}`, time.Now()).
+			AddRow(2, 1, "progress", `{"progress":100}`, time.Now()).
+			AddRow(3, 1, "verdict", `{"status":"failed","score":20,"findings":1}`, time.Now()))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/events", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/event-stream", response.Header().Get("Content-Type"))
+	assert.Equal(t, "id: 1\nevent: phase\ndata: {\"phase\":\"scanning\"}\n\n"+
+		"id: 2\nevent: progress\ndata: {\"progress\":100}\n\n"+
+		"id: 3\nevent: verdict\ndata: {\"status\":\"failed\",\"score\":20,\"findings\":1}\n\n", response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanEventsOfScanWithoutEvents(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/events", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "event: verdict\ndata: {\"status\":\"passed\",\"findings\":0}\n\n", response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanEventsStreamsUntilVerdict(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "40", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	// The client resumes after the events it got before reconnecting
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(6)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(7, 1, "progress", `{"progress":60}`, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(8, 1, "finding", `{"id":3,"name":"SQL Injection"}`, time.Now()).
+			AddRow(9, 1, "verdict", `{"status":"failed","score":20,"findings":1}`, time.Now()))
+
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "GET", "/scans/abcde-1234/events", nil)
+	request.Header.Set("Last-Event-ID", "6")
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "id: 7\nevent: progress\ndata: {\"progress\":60}\n\n"+
+		"id: 8\nevent: finding\ndata: {\"id\":3,\"name\":\"SQL Injection\"}\n\n"+
+		"id: 9\nevent: verdict\ndata: {\"status\":\"failed\",\"score\":20,\"findings\":1}\n\n", response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanEventsErrors(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "GET", "/scans/abcde-1234/events", nil)
+	request.Header.Set("Last-Event-ID", "-1")
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"Last-Event-ID must be at least 0","status":"failed"}`, response.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/missing/events", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"scan not found","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
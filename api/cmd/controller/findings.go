@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"src/cmd/config"
+	"src/pkg/catalog"
+	"src/pkg/finding"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+func addFindingMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/findings", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanFindings)
+}
+
+// GetScanFindings lists the findings of a scan, joined with the catalog and their issue. The id
+// is the build ID the scan was started with.
+func (cImpl *Controller) GetScanFindings(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	filter, page, perPage, err := parseFindingFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "scan not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return
+	}
+	findings, total, err := finding.QueryFindingsFromDB(cImpl.dbRO, s.ID, filter)
+	if err != nil {
+		log.Printf("Error querying findings of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading findings: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scan_id":     s.Build_id,
+		"application": s.Application,
+		"status":      s.Status,
+		"page":        page,
+		"per_page":    perPage,
+		"total":       total,
+		"findings":    findings,
+	})
+}
+
+// parseFindingFilter reads the query string: severity (comma-separated), cwe, url (prefix),
+// suppressed, sort, order, page and per_page.
+func parseFindingFilter(q url.Values) (finding.Filter, int, int, error) {
+	var f finding.Filter
+	fail := func(reason string) (finding.Filter, int, int, error) {
+		return f, 0, 0, errors.New(reason)
+	}
+	query := func(key, fallback string) string {
+		if v, ok := q[key]; ok {
+			return v[0]
+		}
+		return fallback
+	}
+
+	if v := q.Get("severity"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if !catalog.Severities[s] {
+				return fail("invalid severity \"" + s + "\"")
+			}
+			f.Severities = append(f.Severities, s)
+		}
+	}
+	if v := q.Get("cwe"); v != "" {
+		v = strings.TrimPrefix(strings.ToUpper(v), "CWE-")
+		if _, err := strconv.Atoi(v); err != nil {
+			return fail("invalid cwe \"" + q.Get("cwe") + "\"")
+		}
+		f.CweID = v
+	}
+	f.URLPrefix = q.Get("url")
+	if v := q.Get("suppressed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fail("suppressed must be true or false")
+		}
+		f.Suppressed = &b
+	}
+	f.Sort = query("sort", finding.SortID)
+	if !finding.ValidSort(f.Sort) {
+		return fail("invalid sort \"" + f.Sort + "\"")
+	}
+	switch query("order", "asc") {
+	case "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return fail("order must be asc or desc")
+	}
+
+	page, err := strconv.Atoi(query("page", "1"))
+	if err != nil || page < 1 {
+		return fail("page must be a positive number")
+	}
+	perPage, err := strconv.Atoi(query("per_page", strconv.Itoa(defaultPerPage)))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		return fail("per_page must be between 1 and " + strconv.Itoa(maxPerPage))
+	}
+	f.Limit = perPage
+	f.Offset = (page - 1) * perPage
+	return f, page, perPage, nil
+}
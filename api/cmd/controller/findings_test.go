@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetScanFindingsInvalidFilters(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	cases := map[string]string{
+		"severity=high,severe": `{"reason":"invalid severity \"severe\"","status":"failed"}`,
+		"cwe=sql":              `{"reason":"invalid cwe \"sql\"","status":"failed"}`,
+		"suppressed=maybe":     `{"reason":"suppressed must be true or false","status":"failed"}`,
+		"sort=risk":            `{"reason":"invalid sort \"risk\"","status":"failed"}`,
+		"order=up":             `{"reason":"order must be asc or desc","status":"failed"}`,
+		"page=0":               `{"reason":"page must be a positive number","status":"failed"}`,
+		"per_page=1000":        `{"reason":"per_page must be between 1 and 500","status":"failed"}`,
+	}
+	for query, expected := range cases {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/findings?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, response.Code, query)
+		assert.Equal(t, expected, response.Body.String(), query)
+	}
+}
+
+func TestGetScanFindings(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*)")).WithArgs(int64(1), "critical", "89", true).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY COALESCE(v.score, 0) DESC, f.id LIMIT ? OFFSET ?")).
+		WithArgs(int64(1), "critical", "89", true, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "fingerprint", "plugin_id", "name", "cwe_id", "severity", "score", "vulnerability_id",
+			"unclassified", "risk", "confidence", "url", "method", "param", "attack", "evidence", "solution",
+			"reference", "issue_id", "issue_state", "suppressed", "suppression_reason", "correlated", "sast_tool",
+			"sast_rule_id", "sast_file", "sast_line",
+		}).AddRow(3, "fp-3", "40018", "SQL Injection", "89", "critical", 20, 24, false, "High", "Low",
+			"https://shop/?id=1", "GET", "id", "1'", "", "", "", 7, "open", true, "WAF", true, "CodeQL",
+			"go/sql-injection", "internal/users/handler.go", 42))
+
+	response := httptest.NewRecorder()
+	path := "/scans/abcde-1234/findings?severity=Critical&cwe=CWE-89&suppressed=true&sort=score&order=desc&" +
+		"page=2&per_page=2"
+	router.ServeHTTP(response, signedRequest(t, "GET", path, nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	expectedResponse := `{"application":"shop","findings":[{"id":3,"fingerprint":"fp-3","plugin_id":"40018",` +
+		`"name":"SQL Injection","cwe_id":"89","severity":"critical","score":20,"vulnerability_id":24,` +
+		`"unclassified":false,"risk":"High","confidence":"Low","url":"https://shop/?id=1","method":"GET",` +
+		`"param":"id","attack":"1'","evidence":"","solution":"","reference":"","issue_id":7,"issue_state":"open",` +
+		`"suppressed":true,"suppression_reason":"WAF","correlated":true,"sast":{"tool":"CodeQL",` +
+		`"rule_id":"go/sql-injection","file":"internal/users/handler.go","line":42}}],"page":2,"per_page":2,"scan_id":"abcde-1234",` +
+		`"status":"failed","total":3}`
+	assert.Equal(t, expectedResponse, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/scan"
+	"src/pkg/scanpb"
+	"src/pkg/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// How often WatchScan reads the scan it watches.
+const defaultWatchInterval = 2 * time.Second
+
+// grpcCodes are the gRPC status codes of the error codes of the v2 API.
+var grpcCodes = map[string]codes.Code{
+	errCodeInvalidRequest:      codes.InvalidArgument,
+	errCodeUnauthorized:        codes.Unauthenticated,
+	errCodeNotFound:            codes.NotFound,
+	errCodeConflict:            codes.AlreadyExists,
+	errCodeScannerUnavailable:  codes.Unavailable,
+	errCodeScannerError:        codes.Unavailable,
+	errCodeDatabaseUnavailable: codes.Unavailable,
+	errCodeInternal:            codes.Internal,
+}
+
+func grpcError(err *apiError) error {
+	code, ok := grpcCodes[err.code]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, err.message)
+}
+
+// scanServer serves the scans of the v2 API over gRPC, with the same business logic.
+type scanServer struct {
+	scanpb.UnimplementedScanServiceServer
+	clr           *Controller
+	watchInterval time.Duration
+}
+
+// NewGRPCServer creates the gRPC server of the scans. Requests are authenticated like timestamped
+// HTTP ones: the signature metadata is the hex HMAC-SHA256, with the HMAC secret, of the timestamp
+// metadata, the full method and the request message serialized deterministically, see
+// signedPayload. The timestamp must be within security.MaxSignatureAge.
+func NewGRPCServer(clr *Controller, cfg *config.Configuration) *grpc.Server {
+	return newGRPCServer(clr, cfg, defaultWatchInterval)
+}
+
+func newGRPCServer(clr *Controller, cfg *config.Configuration, watchInterval time.Duration) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			if err := verifySignature(ctx, info.FullMethod, req, cfg.HMACSecret); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+			handler grpc.StreamHandler) error {
+			return handler(srv, &signedStream{ServerStream: ss, method: info.FullMethod, secret: cfg.HMACSecret})
+		}),
+	)
+	scanpb.RegisterScanServiceServer(s, &scanServer{clr: clr, watchInterval: watchInterval})
+	return s
+}
+
+// signedStream checks the signature of the messages a stream receives.
+type signedStream struct {
+	grpc.ServerStream
+	method string
+	secret string
+}
+
+func (s *signedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return verifySignature(s.Context(), s.method, m, s.secret)
+}
+
+// signedPayload is what the signature of a call is computed over:
+// "<timestamp>.<full method>.<serialized request>". The method keeps the signature of a request
+// from authorizing another RPC whose request serializes the same.
+func signedPayload(timestamp string, method string, message []byte) []byte {
+	return append([]byte(timestamp+"."+method+"."), message...)
+}
+
+func verifySignature(ctx context.Context, method string, req interface{}, secret string) error {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return status.Error(codes.Internal, "couldn't verify the signature")
+	}
+	message, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return status.Error(codes.Internal, "couldn't verify the signature")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	timestamp, signature := firstValue(md, "timestamp"), firstValue(md, "signature")
+	if !security.Fresh(timestamp, time.Now()) {
+		log.Printf("Invalid signature of %s, timestamp %q is missing or outside the replay window", method, timestamp)
+		return status.Error(codes.Unauthenticated, "invalid signature")
+	}
+	payload := signedPayload(timestamp, method, message)
+	if code, ok := security.CheckSignature(payload, signature, secret); !ok {
+		if code == http.StatusUnauthorized {
+			return status.Error(codes.Unauthenticated, "invalid signature")
+		}
+		return status.Error(codes.Internal, "couldn't verify the signature")
+	}
+	return nil
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func scanMessage(s scan.Scan) *scanpb.Scan {
+	r := scanResource(s)
+	return &scanpb.Scan{
+		Id:          r.ID,
+		Status:      r.Status,
+		Progress:    int32(r.Progress),
+		Application: r.Application,
+		Target:      r.Target,
+		Source:      r.Source,
+		CreatedAt:   timestamppb.New(r.CreatedAt),
+	}
+}
+
+func findingMessage(d finding.Detail) *scanpb.Finding {
+	return &scanpb.Finding{
+		Id:                d.ID,
+		Fingerprint:       d.Fingerprint,
+		PluginId:          d.PluginID,
+		Name:              d.Name,
+		CweId:             d.CweID,
+		Severity:          d.Severity,
+		Score:             int32(d.Score),
+		VulnerabilityId:   d.VulnerabilityID,
+		Unclassified:      d.Unclassified,
+		Risk:              d.Risk,
+		Confidence:        d.Confidence,
+		Url:               d.URL,
+		Method:            d.Method,
+		Param:             d.Param,
+		Attack:            d.Attack,
+		Evidence:          d.Evidence,
+		Solution:          d.Solution,
+		Reference:         d.Reference,
+		IssueId:           d.IssueID,
+		IssueState:        d.IssueState,
+		Suppressed:        d.Suppressed,
+		SuppressionReason: d.SuppressionReason,
+		Correlated:        d.Correlated,
+	}
+}
+
+// readScan reads a scan for the RPCs that only need the read-only database.
+func (srv *scanServer) readScan(id string) (scan.Scan, error) {
+	if srv.clr.dbRO == nil {
+		return scan.Scan{}, status.Error(codes.Unavailable, "not connected to database")
+	}
+	if id == "" {
+		return scan.Scan{}, status.Error(codes.InvalidArgument, "scan ID is required")
+	}
+	s, err := findScan(srv.clr.dbRO, id)
+	if err != nil {
+		return s, grpcError(err)
+	}
+	return s, nil
+}
+
+func (srv *scanServer) SubmitScan(ctx context.Context, req *scanpb.SubmitScanRequest) (*scanpb.Scan, error) {
+	body := ScanBody{
+		BuildID:      req.GetBuildId(),
+		Target:       req.GetTarget(),
+		Application:  req.GetApplication(),
+		Source:       req.GetSource(),
+		CallbackURLs: req.GetCallbackUrls(),
+		Force:        req.GetForce(),
+		SASTBody:     SASTBody{SARIF: json.RawMessage(req.GetSarif()), Routes: json.RawMessage(req.GetRoutes())},
+	}
+	s, _, err := srv.clr.submitScan(body)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return scanMessage(s), nil
+}
+
+func (srv *scanServer) GetScan(ctx context.Context, req *scanpb.GetScanRequest) (*scanpb.Scan, error) {
+	s, err := srv.readScan(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return scanMessage(s), nil
+}
+
+// ListFindings takes the filters of GET /scans/:id/findings, validated the same way.
+func (srv *scanServer) ListFindings(ctx context.Context, req *scanpb.ListFindingsRequest) (*scanpb.ListFindingsResponse,
+	error) {
+	q := url.Values{}
+	if len(req.GetSeverities()) > 0 {
+		q.Set("severity", strings.Join(req.GetSeverities(), ","))
+	}
+	q.Set("cwe", req.GetCwe())
+	q.Set("url", req.GetUrlPrefix())
+	if req.Suppressed != nil {
+		q.Set("suppressed", strconv.FormatBool(req.GetSuppressed()))
+	}
+	if req.GetSort() != "" {
+		q.Set("sort", req.GetSort())
+	}
+	if req.GetDesc() {
+		q.Set("order", "desc")
+	}
+	if req.GetPage() != 0 {
+		q.Set("page", strconv.Itoa(int(req.GetPage())))
+	}
+	if req.GetPerPage() != 0 {
+		q.Set("per_page", strconv.Itoa(int(req.GetPerPage())))
+	}
+	filter, page, perPage, err := parseFindingFilter(q)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s, err := srv.readScan(req.GetScanId())
+	if err != nil {
+		return nil, err
+	}
+	findings, total, err := finding.QueryFindingsFromDB(srv.clr.dbRO, s.ID, filter)
+	if err != nil {
+		log.Printf("Error querying findings of scan %s: %v", s.Build_id, err)
+		return nil, status.Error(codes.Internal, "error reading findings: "+err.Error())
+	}
+	r := &scanpb.ListFindingsResponse{Page: int32(page), PerPage: int32(perPage), Total: int32(total)}
+	for _, f := range findings {
+		r.Findings = append(r.Findings, findingMessage(f))
+	}
+	return r, nil
+}
+
+// WatchScan polls the scan, sending it when its status or progress changes. The stream ends once
+// the scan has finished.
+func (srv *scanServer) WatchScan(req *scanpb.WatchScanRequest, stream scanpb.ScanService_WatchScanServer) error {
+	var last *scanpb.Scan
+	for {
+		s, err := srv.readScan(req.GetId())
+		if err != nil {
+			return err
+		}
+		m := scanMessage(s)
+		if last == nil || m.Status != last.Status || m.Progress != last.Progress {
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+			last = m
+		}
+		if scan.Finished(s.Status) {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-time.After(srv.watchInterval):
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"src/pkg/scanpb"
+	"src/pkg/security"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcClient serves the gRPC API in memory and returns a client of it.
+func grpcClient(t *testing.T, zap zapSVMock, db *sql.DB) scanpb.ScanServiceClient {
+	cfg.HMACSecret = mockHMACSecret
+	clr := New(cfg, zap, db, db)
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer(clr, cfg, time.Millisecond)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }))
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return scanpb.NewScanServiceClient(conn)
+}
+
+func signedContext(t *testing.T, method string, req proto.Message) context.Context {
+	return signedContextAt(t, time.Now(), method, req)
+}
+
+func signedContextAt(t *testing.T, at time.Time, method string, req proto.Message) context.Context {
+	message, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	assert.Nil(t, err)
+	ts := strconv.FormatInt(at.Unix(), 10)
+	h, err := security.CalculateHMAC(signedPayload(ts, method, message), mockHMACSecret)
+	assert.Nil(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "timestamp", ts, "signature", hex.EncodeToString(h))
+}
+
+func TestGRPCRejectsUnsignedRequests(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	client := grpcClient(t, zapSVMock{}, db)
+
+	req := &scanpb.GetScanRequest{Id: "abcde-1234"}
+	_, err := client.GetScan(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The signature is of another request
+	_, err = client.GetScan(signedContext(t, scanpb.ScanService_GetScan_FullMethodName,
+		&scanpb.GetScanRequest{Id: "other"}), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The request serializes like a ListFindings one, whose signature doesn't authorize GetScan
+	_, err = client.GetScan(signedContext(t, scanpb.ScanService_ListFindings_FullMethodName,
+		&scanpb.ListFindingsRequest{ScanId: "abcde-1234"}), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The signature is too old to be replayed
+	_, err = client.GetScan(signedContextAt(t, time.Now().Add(-10*time.Minute),
+		scanpb.ScanService_GetScan_FullMethodName, req), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	watch := &scanpb.WatchScanRequest{Id: "abcde-1234"}
+	stream, err := client.WatchScan(context.Background(), watch)
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCGetScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	client := grpcClient(t, zapSVMock{}, db)
+
+	created := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "40", "abcde-1234", "github", "shop", "https://shop", 7, created))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	req := &scanpb.GetScanRequest{Id: "abcde-1234"}
+	s, err := client.GetScan(signedContext(t, scanpb.ScanService_GetScan_FullMethodName, req), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcde-1234", s.GetId())
+	assert.Equal(t, "running", s.GetStatus())
+	assert.Equal(t, int32(40), s.GetProgress())
+	assert.Equal(t, "shop", s.GetApplication())
+	assert.Equal(t, created, s.GetCreatedAt().AsTime())
+
+	req = &scanpb.GetScanRequest{Id: "missing"}
+	_, err = client.GetScan(signedContext(t, scanpb.ScanService_GetScan_FullMethodName, req), req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "scan not found", status.Convert(err).Message())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGRPCSubmitScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	client := grpcClient(t, zapSVMock{StartScanResponse: "3"}, db)
+
+	req := &scanpb.SubmitScanRequest{BuildId: "abcde-1234"}
+	_, err := client.SubmitScan(signedContext(t, scanpb.ScanService_SubmitScan_FullMethodName, req), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "build_id and target are required", status.Convert(err).Message())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	req = &scanpb.SubmitScanRequest{BuildId: "abcde-1234", Target: "https://shop"}
+	_, err = client.SubmitScan(signedContext(t, scanpb.ScanService_SubmitScan_FullMethodName, req), req)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE project=?")).WithArgs("shop").
+		WillReturnRows(sqlmock.NewRows(assetColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "abcde-1234", "github", "shop", "https://shop", 3, 1, "shop").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	req = &scanpb.SubmitScanRequest{BuildId: "abcde-1234", Target: "https://shop", Application: "shop",
+		Source: "github"}
+	s, err := client.SubmitScan(signedContext(t, scanpb.ScanService_SubmitScan_FullMethodName, req), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcde-1234", s.GetId())
+	assert.Equal(t, "running", s.GetStatus())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGRPCListFindings(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	client := grpcClient(t, zapSVMock{}, db)
+
+	req := &scanpb.ListFindingsRequest{ScanId: "abcde-1234", Sort: "risk"}
+	_, err := client.ListFindings(signedContext(t, scanpb.ScanService_ListFindings_FullMethodName, req), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, `invalid sort "risk"`, status.Convert(err).Message())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*)")).WithArgs(int64(1), "critical", "89", true).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY COALESCE(v.score, 0) DESC, f.id LIMIT ? OFFSET ?")).
+		WithArgs(int64(1), "critical", "89", true, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "fingerprint", "plugin_id", "name", "cwe_id", "severity", "score", "vulnerability_id",
+			"unclassified", "risk", "confidence", "url", "method", "param", "attack", "evidence", "solution",
+			"reference", "issue_id", "issue_state", "suppressed", "suppression_reason", "correlated", "sast_tool",
+			"sast_rule_id", "sast_file", "sast_line",
+		}).AddRow(3, "fp-3", "40018", "SQL Injection", "89", "critical", 20, 24, false, "High", "Low",
+			"https://shop/?id=1", "GET", "id", "1'", "", "", "", 7, "open", true, "WAF", false, "", "", "", 0))
+
+	suppressed := true
+	req = &scanpb.ListFindingsRequest{ScanId: "abcde-1234", Severities: []string{"Critical"}, Cwe: "CWE-89",
+		Suppressed: &suppressed, Sort: "score", Desc: true, Page: 2, PerPage: 2}
+	r, err := client.ListFindings(signedContext(t, scanpb.ScanService_ListFindings_FullMethodName, req), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), r.GetPage())
+	assert.Equal(t, int32(3), r.GetTotal())
+	assert.Len(t, r.GetFindings(), 1)
+	assert.Equal(t, "fp-3", r.GetFindings()[0].GetFingerprint())
+	assert.Equal(t, int32(20), r.GetFindings()[0].GetScore())
+	assert.True(t, r.GetFindings()[0].GetSuppressed())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGRPCWatchScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	client := grpcClient(t, zapSVMock{}, db)
+
+	for _, s := range []string{"10", "10", "60", "passed"} {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+			WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+				AddRow(1, s, "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	}
+
+	req := &scanpb.WatchScanRequest{Id: "abcde-1234"}
+	stream, err := client.WatchScan(signedContext(t, scanpb.ScanService_WatchScan_FullMethodName, req), req)
+	assert.Nil(t, err)
+	var updates []string
+	for {
+		s, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			break
+		}
+		updates = append(updates, fmt.Sprintf("%s %d", s.GetStatus(), s.GetProgress()))
+	}
+	assert.Equal(t, []string{"running 10", "running 60", "passed 100"}, updates)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"src/cmd/config"
+	"src/pkg/event"
+	"src/pkg/finding"
+	"src/pkg/importer"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addImportMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.POST("/scans/:id/import", security.AuthMiddleware(cfg.HMACSecret), clr.ImportScanResults)
+}
+
+// ImportScanResults adds the findings of a third-party report, sent as the request body, to the
+// scan with the build ID in the path and gates the scan again on all of its findings. The scan is
+// created when there is none with the build ID, so scanners can be imported without a ZAP scan, and
+// then the application is required.
+func (cImpl *Controller) ImportScanResults(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	format := c.Query("format")
+	source, ok := importer.Source(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": fmt.Sprintf("unknown format %q", format)})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "error reading body: " + err.Error()})
+		return
+	}
+
+	buildID := c.Param("id")
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, buildID)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error reading scan %s: %v", buildID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return
+	}
+	if !exists && c.Query("application") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "application is required"})
+		return
+	}
+	if !exists {
+		s = scan.Scan{Build_id: buildID, Build_source: "import", Application: c.Query("application"),
+			Target: c.Query("target"), Status: "started"}
+	}
+	if exists && s.Status != passed && s.Status != failed {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "scan hasn't finished"})
+		return
+	}
+	if app := c.Query("application"); app != "" && app != s.Application {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": fmt.Sprintf("scan belongs to application %q", s.Application),
+		})
+		return
+	}
+	parsed, err := importer.Parse(format, s.Application, s.ID, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+
+	var existing []finding.Finding
+	if exists {
+		existing, err = finding.GetFindingsFromDB(cImpl.dbRO, s.ID)
+		if err != nil {
+			log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failed", "reason": "error reading findings: " + err.Error(),
+			})
+			return
+		}
+	} else {
+		s.ID, err = scan.AddScanToDB(cImpl.dbRW, s)
+		if err != nil {
+			log.Printf("Error adding scan to database: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failed", "reason": "error adding scan: " + err.Error(),
+			})
+			return
+		}
+	}
+	// Importing the same report twice, or a report repeating a finding, doesn't add it again
+	stored := make(map[string]bool)
+	for _, f := range existing {
+		stored[f.Fingerprint] = true
+	}
+	var fresh []finding.Finding
+	for _, f := range parsed {
+		if !stored[f.Fingerprint] {
+			stored[f.Fingerprint] = true
+			f.ScanID = s.ID
+			fresh = append(fresh, f)
+		}
+	}
+
+	cImpl.refreshCatalog()
+	policy := cImpl.gatePolicy()
+	fresh = recordFindings(cImpl.dbRW, s, source, fresh, policy)
+	cImpl.publishFindings(s, fresh)
+	all := append(existing, fresh...)
+	v := policy.Evaluate(all)
+	status := failed
+	if v.Passed {
+		status = passed
+	}
+	if err := scan.UpdateScanStatus(cImpl.dbRW, status, s.ID); err != nil {
+		log.Printf("Error updating scan status: %v", err)
+	}
+	cImpl.finishScan(cImpl.dbRW, s, event.Verdict{Status: status, Score: &v.Score, Findings: len(all)}, all)
+	log.Printf("Imported %d %s findings into scan %s, scored %.2f, passed: %t", len(fresh), format, s.Build_id,
+		v.Score, v.Passed)
+	c.JSON(http.StatusOK, gin.H{
+		"status":     status,
+		"scan_id":    s.Build_id,
+		"source":     source,
+		"imported":   len(fresh),
+		"duplicates": len(parsed) - len(fresh),
+		"findings":   len(existing) + len(fresh),
+		"score":      v.Score,
+	})
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/finding"
+)
+
+func TestImportScanResultsUnknownFormat(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/import?format=nikto", []byte("{}")))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"invalid format \"nikto\"","status":"failed"}`, response.Body.String())
+}
+
+func TestImportScanResultsIntoRunningScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/import?format=nuclei", []byte("")))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"scan hasn't finished","status":"failed"}`, response.Body.String())
+}
+
+func TestImportScanResultsInvalidReport(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/import?format=burp&application=shop",
+		[]byte("<html>")))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), `"reason":"invalid Burp XML:`)
+	assert.Nil(t, mock.ExpectationsWereMet(), "no scan is created")
+}
+
+func TestImportScanResultsNewScanWithoutApplication(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	body, _ := os.ReadFile("../../pkg/importer/mocks/burp.xml")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/import?format=burp&target=https://shop", body))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"application is required","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet(), "no scan is created")
+}
+
+func TestImportScanResultsCreatesScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Unmapped.AutoCreate = false
+	defer func() { cfg.Unmapped.AutoCreate = true }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	body, _ := os.ReadFile("../../pkg/importer/mocks/burp.xml")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "abcde-1234", "import", "shop", "https://shop", 0, 1, "shop").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_findings(")).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows(sastResultColumns))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO issues(")).WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=?")).
+		WithArgs(finding.StateFixed, int64(9), "shop", finding.SourceBurp, int64(9), finding.StateFixed, "shop", int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM issues WHERE application=? AND suppressed=1")).WithArgs("shop").
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "suppression_reason"}))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).WithArgs(int64(9), "finding", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET status=? WHERE id=?")).
+		WithArgs("passed", int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).
+		WithArgs(int64(9), "verdict", `{"status":"passed","score":0,"findings":2}`).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST",
+		"/scans/abcde-1234/import?format=burp&application=shop&target=https://shop", body))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"duplicates":0,"findings":2,"imported":2,"scan_id":"abcde-1234","score":0,"source":"burp",`+
+		`"status":"passed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestImportScanResultsSkipsStoredFindings(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	stored := `{"template-id":"tech-detect","info":{"name":"Tech","severity":"info"},"type":"http",` +
+		`"matched-at":"https://shop/","request":"GET / HTTP/1.1"}`
+	// The report repeats a new finding, it's only imported once
+	repeated := `{"template-id":"git-config","info":{"name":"Git Config","severity":"info"},"type":"http",` +
+		`"matched-at":"https://shop/.git/config","request":"GET /.git/config HTTP/1.1"}`
+	body := []byte(stored + "\n" + repeated + "\n" + repeated + "\n")
+	fingerprint := finding.Fingerprint("shop", "nuclei:tech-detect", "https://shop/", "GET", "")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).AddRow(1, 1, 0, fingerprint, "nuclei:tech-detect", "Tech",
+			"", "Informational", "Medium", "https://shop/", "GET", "", "", "", "", "", "", false, "", 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_findings(")).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(sastResultColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO issues(")).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=?")).
+		WithArgs(finding.StateFixed, int64(1), "shop", finding.SourceNuclei, int64(1), finding.StateFixed, "shop",
+			int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM issues WHERE application=? AND suppressed=1")).WithArgs("shop").
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "suppression_reason"}))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).WithArgs(int64(1), "finding", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET status=? WHERE id=?")).
+		WithArgs("passed", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).
+		WithArgs(int64(1), "verdict", `{"status":"passed","score":0,"findings":2}`).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/import?format=nuclei", body))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"duplicates":2,"findings":2,"imported":1`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
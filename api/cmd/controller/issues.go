@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SuppressionBody struct {
+	Reason string `json:"reason"`
+}
+
+func addIssueMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	auth := security.AuthMiddleware(cfg.HMACSecret)
+
+	r.PUT("/issues/:id/suppression", auth, clr.SuppressIssue)
+	r.DELETE("/issues/:id/suppression", auth, clr.UnsuppressIssue)
+}
+
+// SuppressIssue accepts the risk of an issue. Its findings stay in reports, marked as
+// suppressed, but no longer count towards the gate.
+func (cImpl *Controller) SuppressIssue(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	id, ok := issueID(c)
+	if !ok {
+		return
+	}
+	var b SuppressionBody
+	if err := c.BindJSON(&b); err != nil || b.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "a suppression needs a reason"})
+		return
+	}
+	if err := finding.SuppressIssue(cImpl.dbRW, id, actor, b.Reason); err != nil {
+		issueError(c, err, "error suppressing issue")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "suppressed": true, "reason": b.Reason})
+}
+
+func (cImpl *Controller) UnsuppressIssue(c *gin.Context) {
+	actor, ok := requireActor(c)
+	if !ok || !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	id, ok := issueID(c)
+	if !ok {
+		return
+	}
+	if err := finding.UnsuppressIssue(cImpl.dbRW, id, actor); err != nil {
+		issueError(c, err, "error removing suppression")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "suppressed": false})
+}
+
+func issueID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid issue id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func issueError(c *gin.Context, err error, reason string) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "issue not found"})
+		return
+	}
+	log.Printf("%s: %v", reason, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": reason + ": " + err.Error()})
+}
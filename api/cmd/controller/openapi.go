@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"src/cmd/config"
+	"src/pkg/openapi"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contractViolation is called with responses that don't match the OpenAPI contract, when
+// responses are validated. Tests fail on them.
+var contractViolation = func(c *gin.Context, err error) {
+	log.Printf("Response breaks the API contract: %v", err)
+}
+
+// addContractMappings validates requests against the OpenAPI contract and serves it. It has to
+// come before the other mappings for the validation to apply to their routes. Signatures are
+// checked first, so an unsigned request is unauthorized rather than invalid.
+func addContractMappings(r *gin.Engine, cfg *config.Configuration) {
+	r.Use(openapi.Middleware(openapi.Contract(), openapi.Options{
+		Authenticate: func(c *gin.Context) bool {
+			status, ok := security.VerifyRequest(c, cfg.HMACSecret)
+			if !ok {
+				signatureError(c, status)
+			}
+			return ok
+		},
+		ValidateResponses: cfg.ValidateResponses,
+		OnRequestError:    contractError,
+		OnResponseError: func(c *gin.Context, err error) {
+			contractViolation(c, err)
+		},
+	}))
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", openapi.Spec())
+	})
+}
+
+// signatureError rejects a request without a valid signature the way the route's AuthMiddleware
+// does.
+func signatureError(c *gin.Context, status int) {
+	if !strings.HasPrefix(c.FullPath(), "/v2/") {
+		c.AbortWithStatus(status)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		v2Error(c, status, errCodeUnauthorized, "invalid signature")
+		return
+	}
+	v2Error(c, status, errCodeInternal, "couldn't verify the signature")
+}
+
+// contractError rejects a request the contract doesn't allow, with the error envelope of its API
+// version.
+func contractError(c *gin.Context, err error) {
+	if strings.HasPrefix(c.FullPath(), "/v2/") {
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+}
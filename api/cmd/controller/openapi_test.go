@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"src/pkg/openapi"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain checks every response the tests get against the OpenAPI contract, so the run fails
+// when a handler drifts from it.
+func TestMain(m *testing.M) {
+	var mu sync.Mutex
+	var violations []string
+	contractViolation = func(c *gin.Context, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		violations = append(violations, err.Error())
+	}
+	cfg.ValidateResponses = true
+
+	code := m.Run()
+	if len(violations) > 0 {
+		fmt.Println("Responses that break the OpenAPI contract:")
+		for _, v := range violations {
+			fmt.Println("  " + v)
+		}
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func routes(r *gin.Engine) []openapi.Route {
+	routes := []openapi.Route{}
+	for _, ri := range r.Routes() {
+		routes = append(routes, openapi.Route{Method: ri.Method, Path: ri.Path})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func TestRoutesMatchContract(t *testing.T) {
+	clr := New(cfg, zapSVMock{}, nil, nil)
+
+	// The deprecated routes are only served outside production
+	assert.Equal(t, openapi.Contract().Routes(), routes(CreateURLMappings(clr, cfg)))
+	for _, route := range routes(CreateURLMappingsProd(clr, cfg)) {
+		assert.NotNil(t, openapi.Contract().Operation(route.Method, route.Path), "%s %s isn't documented",
+			route.Method, route.Path)
+	}
+}
+
+func TestGetContract(t *testing.T) {
+	router := CreateURLMappings(New(cfg, zapSVMock{}, nil, nil), cfg)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/openapi.json", nil)
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestContractRejectsInvalidRequests(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	for path, expected := range map[string]string{
+		"/vulnerabilities/abc":                    `{"reason":"invalid id \"abc\"","status":"failed"}`,
+		"/scans/abcde-1234/findings?per_page=ten": `{"reason":"invalid per_page \"ten\"","status":"failed"}`,
+		"/v2/scans?status=done":                   `{"error":{"code":"invalid_request","message":"invalid status \"done\""}}`,
+	} {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, signedRequest(t, "GET", path, nil))
+
+		assert.Equal(t, http.StatusBadRequest, response.Code, path)
+		assert.Equal(t, expected, response.Body.String(), path)
+	}
+
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "POST", "/vulnerabilities?actor=alice", []byte(`{"name":"SQL Injection","severity":"high","score":"high"}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"score must be an integer","status":"failed"}`, response.Body.String())
+}
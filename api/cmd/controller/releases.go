@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/release"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/zapScanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often the runner of a release records that it's alive, and how long after the last time a
+// release is taken for abandoned by a replica that stopped.
+const (
+	releaseHeartbeatInterval = time.Minute
+	releaseStaleAfter        = 5 * time.Minute
+)
+
+// Target names are part of the build IDs of their scans.
+var targetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ReleaseBody is a release to scan, one target per service it deploys.
+type ReleaseBody struct {
+	ReleaseID   string              `json:"release_id"`
+	Application string              `json:"application"`
+	Source      string              `json:"source"`
+	Targets     []ReleaseTargetBody `json:"targets"`
+}
+
+// ReleaseTargetBody is a service of a release. Application defaults to the name.
+type ReleaseTargetBody struct {
+	Name        string        `json:"name"`
+	Target      string        `json:"target"`
+	Application string        `json:"application"`
+	Profile     string        `json:"profile"`
+	Scope       release.Scope `json:"scope"`
+}
+
+func addReleaseMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.POST("/releases", security.AuthMiddleware(cfg.HMACSecret), clr.CreateRelease)
+	r.GET("/releases/:id", security.AuthMiddleware(cfg.HMACSecret), clr.GetRelease)
+}
+
+// newRelease checks a release request, returning the release to record and the compiled scope of
+// each target by name.
+func newRelease(body ReleaseBody) (release.Release, map[string]*release.Matcher, error) {
+	r := release.Release{ReleaseID: body.ReleaseID, Application: body.Application, Source: body.Source,
+		Status: release.StatusRunning, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if body.ReleaseID == "" {
+		return r, nil, errors.New("release_id is required")
+	}
+	if len(body.Targets) == 0 || len(body.Targets) > release.MaxTargets {
+		return r, nil, fmt.Errorf("a release has from 1 to %d targets", release.MaxTargets)
+	}
+	scopes := make(map[string]*release.Matcher)
+	// Issues are tracked per application, two targets of one would mark each other's issues fixed
+	applications := make(map[string]string)
+	for _, tb := range body.Targets {
+		if !targetNamePattern.MatchString(tb.Name) {
+			return r, nil, fmt.Errorf("invalid target name %q, use letters, digits, - and _", tb.Name)
+		}
+		if _, ok := scopes[tb.Name]; ok {
+			return r, nil, fmt.Errorf("target %q is listed twice", tb.Name)
+		}
+		if tb.Target == "" {
+			return r, nil, fmt.Errorf("target %q has no URL", tb.Name)
+		}
+		m, err := tb.Scope.Matcher()
+		if err != nil {
+			return r, nil, fmt.Errorf("target %q: %v", tb.Name, err)
+		}
+		scopes[tb.Name] = m
+		t := release.Target{Name: tb.Name, Target: tb.Target, Application: tb.Application, Profile: tb.Profile,
+			Scope: tb.Scope, BuildID: release.BuildID(body.ReleaseID, tb.Name), Status: release.TargetQueued}
+		if t.Application == "" {
+			t.Application = tb.Name
+		}
+		if other, ok := applications[t.Application]; ok {
+			return r, nil, fmt.Errorf("targets %q and %q are both application %q", other, tb.Name, t.Application)
+		}
+		applications[t.Application] = tb.Name
+		// Empty lists are stored like missing ones
+		if len(t.Scope.Include) == 0 {
+			t.Scope.Include = nil
+		}
+		if len(t.Scope.Exclude) == 0 {
+			t.Scope.Exclude = nil
+		}
+		r.Targets = append(r.Targets, t)
+	}
+	return r, scopes, nil
+}
+
+// sameRelease reports whether a release was submitted with the same targets.
+func sameRelease(a release.Release, b release.Release) bool {
+	if a.Application != b.Application || a.Source != b.Source || len(a.Targets) != len(b.Targets) {
+		return false
+	}
+	for i, t := range a.Targets {
+		u := b.Targets[i]
+		if t.Name != u.Name || t.Target != u.Target || t.Application != u.Application || t.Profile != u.Profile ||
+			!reflect.DeepEqual(t.Scope, u.Scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateRelease starts the scans of the targets of a release. Submitting the same release again
+// returns it, submitting a release ID with other targets is a conflict.
+func (cImpl *Controller) CreateRelease(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	if cImpl.s == (*zapScanner.ZapService)(nil) {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "not connected to zap scanner instance"})
+		return
+	}
+	var body ReleaseBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid JSON body"})
+		return
+	}
+	r, scopes, err := newRelease(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+
+	prior, err := release.ReleaseFromDB(cImpl.dbRO, r.ReleaseID)
+	if err == nil {
+		if !sameRelease(prior, r) {
+			c.JSON(http.StatusConflict, gin.H{"status": "failed",
+				"reason": "release " + r.ReleaseID + " was already submitted with other targets"})
+			return
+		}
+		c.JSON(http.StatusOK, prior)
+		return
+	}
+	if err != sql.ErrNoRows {
+		releaseError(c, r.ReleaseID, err)
+		return
+	}
+	r, err = release.AddReleaseToDB(cImpl.dbRW, r)
+	if err == release.ErrDuplicate {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "release " + r.ReleaseID + " already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding release %s to database: %v", r.ReleaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error saving release: " + err.Error()})
+		return
+	}
+	log.Printf("Release %s submitted with %d targets", r.ReleaseID, len(r.Targets))
+	c.JSON(http.StatusCreated, r)
+	// The runner updates the targets, so it starts once they're written
+	go cImpl.runRelease(r, scopes)
+}
+
+// GetRelease returns a release with the verdict of each target and, once they have all finished,
+// the overall verdict.
+func (cImpl *Controller) GetRelease(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	r, err := release.ReleaseFromDB(cImpl.dbRO, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "release not found"})
+		return
+	}
+	if err != nil {
+		releaseError(c, c.Param("id"), err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func releaseError(c *gin.Context, id string, err error) {
+	log.Printf("Error reading release %s: %v", id, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading release: " + err.Error()})
+}
+
+// runRelease scans the targets of a release as slots free up and scores the findings of all of
+// them together once they have finished.
+func (cImpl *Controller) runRelease(r release.Release, scopes map[string]*release.Matcher) {
+	done := make(chan struct{})
+	defer close(done)
+	go cImpl.heartbeatRelease(r, done)
+
+	findings := make([][]finding.Finding, len(r.Targets))
+	var wg sync.WaitGroup
+	for i := range r.Targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			t := &r.Targets[i]
+			cImpl.releaseSlots <- struct{}{}
+			defer func() { <-cImpl.releaseSlots }()
+			findings[i] = cImpl.scanReleaseTarget(r, t, scopes[t.Name])
+		}(i)
+	}
+	wg.Wait()
+
+	var all []finding.Finding
+	for _, f := range findings {
+		all = append(all, f...)
+	}
+	cImpl.refreshCatalog()
+	v := report.New(scan.Scan{Build_id: r.ReleaseID, Application: r.Application}, all, cImpl.gatePolicy()).Verdict()
+	status := release.Verdict(r.Targets, v.Passed)
+	var score *float64
+	if status != release.StatusError {
+		score = &v.Score
+	}
+	if err := release.FinishReleaseInDB(cImpl.dbRW, r.ID, status, score, time.Now().UTC()); err != nil {
+		log.Printf("Error saving verdict of release %s: %v", r.ReleaseID, err)
+	}
+	log.Printf("Release %s %s with %d findings, scored %.2f", r.ReleaseID, status, len(all), v.Score)
+}
+
+// scanReleaseTarget scans a target as a new attempt of its build and waits for its verdict,
+// returning its findings.
+func (cImpl *Controller) scanReleaseTarget(r release.Release, t *release.Target, scope *release.Matcher,
+) []finding.Finding {
+	attempt, err := scan.GetLastAttemptFromDB(cImpl.dbRO, t.BuildID)
+	if err != nil {
+		log.Printf("Error reading attempts of build %s: %v", t.BuildID, err)
+	}
+	s, err := cImpl.launchScan(ScanBody{BuildID: t.BuildID, Target: t.Target, Application: t.Application,
+		Source: r.Source, Profile: t.Profile, Scope: scope}, attempt+1, nil, nil)
+	if err == nil && s.ID <= 0 {
+		err = errors.New("the scan wasn't recorded")
+	}
+	if err != nil {
+		t.Status, t.Error = release.StatusError, "error starting scan: "+err.Error()
+		cImpl.updateReleaseTarget(r, *t)
+		return nil
+	}
+	t.ScanID, t.Status = s.ID, statusRunning
+	cImpl.updateReleaseTarget(r, *t)
+
+	timeout := time.Duration(cImpl.c.ReleaseTargetTimeoutMinutes) * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		_, err := cImpl.events.WaitVerdict(ctx, s.ID)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			// The scan is stopped so it doesn't hold ZAP, and a late verdict can't change the target
+			if err := cImpl.cancelScan(s); err != nil {
+				log.Printf("Error cancelling scan %s of release %s: %v", s.Build_id, r.ReleaseID, err)
+			}
+			t.Status, t.Error = release.StatusError, "scan didn't finish in "+timeout.String()
+			cImpl.updateReleaseTarget(r, *t)
+			return nil
+		}
+		log.Printf("Error waiting for scan %s of release %s: %v", s.Build_id, r.ReleaseID, err)
+		time.Sleep(eventPollInterval)
+	}
+	if t.Status, err = scan.GetAttemptStatusFromDB(cImpl.dbRO, s.ID); err != nil {
+		t.Status, t.Error = release.StatusError, "error reading scan: "+err.Error()
+		cImpl.updateReleaseTarget(r, *t)
+		return nil
+	}
+	var findings []finding.Finding
+	if t.Status == scan.StatusPassed || t.Status == scan.StatusFailed {
+		if findings, err = finding.GetFindingsFromDB(cImpl.dbRO, s.ID); err != nil {
+			t.Status, t.Error = release.StatusError, "error reading findings: "+err.Error()
+			cImpl.updateReleaseTarget(r, *t)
+			return nil
+		}
+		v := report.New(s, findings, cImpl.gatePolicy()).Verdict()
+		t.Score, t.Findings = &v.Score, len(findings)
+	}
+	cImpl.updateReleaseTarget(r, *t)
+	return findings
+}
+
+// heartbeatRelease records that the release is being run until done is closed.
+func (cImpl *Controller) heartbeatRelease(r release.Release, done <-chan struct{}) {
+	ticker := time.NewTicker(releaseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case at := <-ticker.C:
+			if err := release.HeartbeatReleaseInDB(cImpl.dbRW, r.ID, at.UTC()); err != nil {
+				log.Printf("Error recording heartbeat of release %s: %v", r.ReleaseID, err)
+			}
+		}
+	}
+}
+
+// WatchReleases ends in error, when the replica starts and then every interval, the releases whose
+// runner stopped with the replica running them. Their targets aren't scanned anymore.
+func (cImpl *Controller) WatchReleases(interval time.Duration) {
+	for ; ; time.Sleep(interval) {
+		now := time.Now().UTC()
+		failed, err := release.FailStaleReleasesInDB(cImpl.dbRW, now.Add(-releaseStaleAfter),
+			"release abandoned, the replica running it stopped", now)
+		if err != nil {
+			log.Printf("Error looking for abandoned releases: %v", err)
+		}
+		for _, id := range failed {
+			log.Printf("Release %s was abandoned, ended in error", id)
+		}
+	}
+}
+
+func (cImpl *Controller) updateReleaseTarget(r release.Release, t release.Target) {
+	if err := release.UpdateTargetInDB(cImpl.dbRW, t); err != nil {
+		log.Printf("Error saving target %s of release %s: %v", t.Name, r.ReleaseID, err)
+	}
+}
+
+// scopedAlerts drops the alerts on URLs out of the scope of a release target.
+func scopedAlerts(alerts []zapScanner.FullAlert, scope *release.Matcher) []zapScanner.FullAlert {
+	if scope == nil {
+		return alerts
+	}
+	var kept []zapScanner.FullAlert
+	for _, a := range alerts {
+		if scope.InScope(a.URL) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// scopedURLs drops the discovered URLs out of the scope of a release target.
+func scopedURLs(urls []string, scope *release.Matcher) []string {
+	if scope == nil {
+		return urls
+	}
+	var kept []string
+	for _, u := range urls {
+		if scope.InScope(u) {
+			kept = append(kept, u)
+		}
+	}
+	return kept
+}
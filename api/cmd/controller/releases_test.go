@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"src/pkg/release"
+	"src/pkg/zapScanner"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var releaseColumns = []string{"id", "release_id", "application", "source", "status", "score", "created_at",
+	"completed_at"}
+
+var releaseTargetColumns = []string{"id", "release_id", "name", "target", "application", "profile", "scope",
+	"scan_id", "build_id", "status", "score", "findings", "error"}
+
+const releaseBody = `{"release_id":"platform-1.4","application":"platform","source":"github","targets":[` +
+	`{"name":"shop","target":"https://shop","profile":"api-only","scope":{"include":["^https://shop/api/"]}}]}`
+
+func TestCreateReleaseValidation(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	for body, reason := range map[string]string{
+		`{"targets":[{"name":"shop","target":"https://shop"}]}`: "release_id is required",
+		`{"release_id":"r1","targets":[{"name":"shop/api","target":"https://shop"}]}`: `invalid target name ` +
+			`\"shop/api\", use letters, digits, - and _`,
+		`{"release_id":"r1","targets":[{"name":"shop","target":"https://shop"},{"name":"shop","target":"https://a"}]}`: `target \"shop\" is listed twice`,
+		`{"release_id":"r1","targets":[{"name":"shop","target":"https://shop"},{"name":"cart","target":"https://cart",` +
+			`"application":"shop"}]}`: `targets \"shop\" and \"cart\" are both application \"shop\"`,
+		`{"release_id":"r1","targets":[{"name":"shop"}]}`: "targets[0].target is required",
+		`{"release_id":"r1","targets":[{"name":"shop","target":"https://shop","scope":{"exclude":["("]}}]}`: `target ` +
+			`\"shop\": invalid scope pattern \"(\": error parsing regexp: missing closing ): ` + "`(`",
+	} {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, signedRequest(t, "POST", "/releases", []byte(body)))
+
+		assert.Equal(t, http.StatusBadRequest, response.Code, body)
+		assert.Equal(t, `{"reason":"`+reason+`","status":"failed"}`, response.Body.String(), body)
+	}
+}
+
+func TestCreateRelease(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanError: errors.New("zap is down")}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE release_id=?")).WithArgs("platform-1.4").
+		WillReturnRows(sqlmock.NewRows(releaseColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO releases(")).
+		WithArgs("platform-1.4", "platform", "github", "running", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO release_targets(")).
+		WithArgs(int64(3), "shop", "https://shop", "shop", "api-only", `{"include":["^https://shop/api/"]}`,
+			"platform-1.4.shop", "queued").
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+	// The scan of the target can't start, so the release ends in error
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(attempt), 0) FROM scans WHERE build_id=?")).
+		WithArgs("platform-1.4.shop").
+		WillReturnRows(sqlmock.NewRows([]string{"attempt"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE release_targets SET")).
+		WithArgs(nil, "error", nil, 0, "error starting scan: zap is down", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE releases SET status=?, score=?, completed_at=? WHERE id=?")).
+		WithArgs("error", nil, sqlmock.AnyArg(), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/releases", []byte(releaseBody)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Regexp(t, `^\{"id":"platform-1.4","application":"platform","source":"github","status":"running",`+
+		`"created_at":"[^"]+","targets":\[\{"name":"shop","target":"https://shop","application":"shop",`+
+		`"profile":"api-only","scope":\{"include":\["\^https://shop/api/"\]\},"scan_id":"platform-1.4.shop",`+
+		`"status":"queued","findings":0\}\]\}$`, response.Body.String())
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCreateReleaseResubmission(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE release_id=?")).WithArgs("platform-1.4").
+			WillReturnRows(sqlmock.NewRows(releaseColumns).
+				AddRow(3, "platform-1.4", "platform", "github", "running", nil, at, nil))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE release_id=?")).WithArgs(int64(3)).
+			WillReturnRows(sqlmock.NewRows(releaseTargetColumns).
+				AddRow(5, 3, "shop", "https://shop", "shop", "api-only", `{"include":["^https://shop/api/"]}`, 9,
+					"platform-1.4.shop", "running", nil, 0, ""))
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/releases", []byte(releaseBody)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"status":"running"`)
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/releases", []byte(`{"release_id":"platform-1.4",`+
+		`"application":"platform","source":"github","targets":[{"name":"shop","target":"https://shop"}]}`)))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"release platform-1.4 was already submitted with other targets","status":"failed"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRelease(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE release_id=?")).WithArgs("platform-1.4").
+		WillReturnRows(sqlmock.NewRows(releaseColumns).
+			AddRow(3, "platform-1.4", "platform", "github", "failed", 24.5, at, at.Add(time.Hour)))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE release_id=?")).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(releaseTargetColumns).
+			AddRow(5, 3, "cart", "https://cart", "cart", "", `{}`, 8, "platform-1.4.cart", "passed", 0.5, 1, "").
+			AddRow(6, 3, "shop", "https://shop", "shop", "", `{}`, 9, "platform-1.4.shop", "failed", 24, 3, ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE release_id=?")).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(releaseColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/releases/platform-1.4", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"id":"platform-1.4","application":"platform","source":"github","status":"failed",`+
+		`"score":24.5,"created_at":"2026-10-19T10:00:00Z","completed_at":"2026-10-19T11:00:00Z","targets":[`+
+		`{"name":"cart","target":"https://cart","application":"cart","scope":{},"scan_id":"platform-1.4.cart",`+
+		`"status":"passed","score":0.5,"findings":1},`+
+		`{"name":"shop","target":"https://shop","application":"shop","scope":{},"scan_id":"platform-1.4.shop",`+
+		`"status":"failed","score":24,"findings":3}]}`, response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/releases/missing", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"release not found","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestScopedAlerts(t *testing.T) {
+	scope, _ := release.Scope{Include: []string{`^https://shop/api/`}}.Matcher()
+	alerts := []zapScanner.FullAlert{{URL: "https://shop/api/cart"}, {URL: "https://shop/static/app.js"}}
+
+	assert.Equal(t, alerts[:1], scopedAlerts(alerts, scope))
+	assert.Equal(t, alerts, scopedAlerts(alerts, nil))
+	assert.Equal(t, []string{"https://shop/api/"}, scopedURLs([]string{"https://shop/", "https://shop/api/"}, scope))
+}
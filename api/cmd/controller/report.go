@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+type reportFormat struct {
+	contentType string
+	extension   string
+	write       func(io.Writer, report.Report) error
+	// compare loads the previous scan of the application to show what changed.
+	compare bool
+}
+
+var reportFormats = map[string]reportFormat{
+	report.FormatSARIF:      {contentType: "application/sarif+json", extension: "sarif", write: report.WriteSARIF},
+	report.FormatJUnit:      {contentType: "application/xml", extension: "xml", write: report.WriteJUnit},
+	report.FormatDefectDojo: {contentType: "application/json", extension: "json", write: report.WriteDefectDojo},
+	report.FormatHTML: {
+		contentType: "text/html; charset=utf-8", extension: "html", write: report.WriteHTML, compare: true,
+	},
+	// write is set per request from the summary options
+	report.FormatMarkdown: {contentType: "text/markdown; charset=utf-8", extension: "md", compare: true},
+}
+
+// Most findings a Markdown summary lists.
+const maxMarkdownTop = 100
+
+func addReportMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/report", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanReport)
+}
+
+// GetScanReport renders the persisted findings of a finished scan. The id is the build ID the
+// scan was started with.
+func (cImpl *Controller) GetScanReport(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	name := c.DefaultQuery("format", report.FormatSARIF)
+	format, ok := reportFormats[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": fmt.Sprintf("unknown format %q", name)})
+		return
+	}
+	if name == report.FormatMarkdown {
+		opts, err := markdownOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+			return
+		}
+		format.write = func(w io.Writer, r report.Report) error { return report.WriteMarkdown(w, r, opts) }
+	}
+	r, ok := cImpl.loadReport(c)
+	if !ok {
+		return
+	}
+	if format.compare {
+		r.Previous = cImpl.previousScan(r.Scan)
+	}
+
+	var b bytes.Buffer
+	if err := format.write(&b, r); err != nil {
+		log.Printf("Error rendering %s report of %s: %v", name, r.Scan.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error rendering report: " + err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, r.Scan.Build_id, format.extension))
+	c.Data(http.StatusOK, format.contentType, b.Bytes())
+}
+
+// markdownOptions reads the top, max_length and report_url query parameters of a Markdown summary.
+func markdownOptions(c *gin.Context) (report.MarkdownOptions, error) {
+	opts := report.MarkdownOptions{ReportURL: c.Query("report_url")}
+	var err error
+	if opts.Top, err = strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(report.DefaultMarkdownTop))); err != nil ||
+		opts.Top < 0 || opts.Top > maxMarkdownTop {
+		return opts, fmt.Errorf("top must be a number from 0 to %d", maxMarkdownTop)
+	}
+	maxLength := c.DefaultQuery("max_length", strconv.Itoa(report.DefaultMarkdownMaxLength))
+	if opts.MaxLength, err = strconv.Atoi(maxLength); err != nil || opts.MaxLength < 0 {
+		return opts, fmt.Errorf("invalid max_length %q", maxLength)
+	}
+	if opts.ReportURL != "" {
+		u, err := url.Parse(opts.ReportURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, fmt.Errorf("report_url must be an http(s) URL")
+		}
+	}
+	return opts, nil
+}
+
+// loadReport reads the scan in the id path parameter with its findings. It writes the error
+// response itself when the scan can't be reported on.
+func (cImpl *Controller) loadReport(c *gin.Context) (report.Report, bool) {
+	s, err := scan.GetScanDetailsFromDB(cImpl.dbRO, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "scan not found"})
+		return report.Report{}, false
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return report.Report{}, false
+	}
+	if s.Status != passed && s.Status != failed {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "scan hasn't finished"})
+		return report.Report{}, false
+	}
+	findings, err := finding.GetFindingsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading findings: " + err.Error(),
+		})
+		return report.Report{}, false
+	}
+	cImpl.refreshCatalog()
+	return report.New(s, findings, cImpl.gatePolicy()), true
+}
+
+// previousScan returns nil when the application has no earlier finished scan or it can't be read,
+// the report is still useful without the comparison.
+func (cImpl *Controller) previousScan(s scan.Scan) *report.ScanResult {
+	if s.Application == "" {
+		return nil
+	}
+	prev, err := scan.GetPreviousScanFromDB(cImpl.dbRO, s)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading the scan before %s: %v", s.Build_id, err)
+		}
+		return nil
+	}
+	findings, err := finding.GetFindingsFromDB(cImpl.dbRO, prev.ID)
+	if err != nil {
+		log.Printf("Error reading findings of scan %s: %v", prev.Build_id, err)
+		return nil
+	}
+	return &report.ScanResult{Scan: prev, Findings: findings}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var scanDetailsColumns = []string{
+	"id", "status", "build_id", "build_source", "application", "target", "zap_id", "created_at",
+}
+
+func TestGetScanReportUnknownFormat(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/report?format=pdf", nil))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"invalid format \"pdf\"","status":"failed"}`, response.Body.String())
+}
+
+func TestGetScanReportNotFinished(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/report", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"scan hasn't finished","status":"failed"}`, response.Body.String())
+}
+
+func TestGetScanReportSARIF(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).AddRow(1, 1, 0, "fp-1", "40018", "SQL Injection", "89",
+			"High", "Medium", "https://shop/?id=1", "GET", "id", "1'", "", "", "", "", true,
+			"false positive, parameterized", 0))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/report?format=sarif", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/sarif+json", response.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="abcde-1234.sarif"`, response.Header().Get("Content-Disposition"))
+	var doc struct {
+		Runs []struct {
+			Results []struct {
+				RuleID              string            `json:"ruleId"`
+				PartialFingerprints map[string]string `json:"partialFingerprints"`
+				Suppressions        []struct {
+					Justification string `json:"justification"`
+				} `json:"suppressions"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &doc))
+	result := doc.Runs[0].Results[0]
+	assert.Equal(t, "40018", result.RuleID)
+	assert.Equal(t, "fp-1", result.PartialFingerprints["dastFingerprint/v1"])
+	assert.Equal(t, "false positive, parameterized", result.Suppressions[0].Justification)
+}
+
+func TestGetScanReportJUnit(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/report?format=junit", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/xml", response.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="abcde-1234.xml"`, response.Header().Get("Content-Disposition"))
+	assert.Contains(t, response.Body.String(), `<testsuite name="shop/abcde-1234" tests="1" failures="0" skipped="0"`)
+	assert.Contains(t, response.Body.String(), `<testcase name="gate" classname="dast.shop">`+"\n"+
+		`      <system-out><![CDATA[recorded status passed; current legacy policy: score 0.00, threshold 8.00, `+
+		`0 unmapped alerts, passed`)
+}
+
+func TestGetScanReportHTMLComparesWithPreviousScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1235").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(2, "passed", "abcde-1235", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE application=? AND id<?")).WithArgs("shop", int64(2)).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).AddRow(1, 1, 0, "fp-1", "40018", "SQL Injection", "89",
+			"High", "Medium", "https://shop/?id=1", "GET", "id", "1'", "", "", "", "", false, "", 0))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1235/report?format=html", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), "<h2>Compared with build abcde-1234</h2>")
+	assert.Contains(t, response.Body.String(), "<p>0 new, 1 fixed, 0 still present.</p>")
+}
+
+func TestSuppressIssueNeedsReason(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "PUT", "/issues/5/suppression?actor=alice", []byte(`{}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"reason is required","status":"failed"}`, response.Body.String())
+}
+
+func TestSuppressIssueNotFound(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET suppressed=1")).
+		WithArgs("alice", "accepted risk", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	response := httptest.NewRecorder()
+	request := signedRequest(t, "PUT", "/issues/5/suppression?actor=alice", []byte(`{"reason":"accepted risk"}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"reason":"issue not found","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanReportMarkdownInvalidOptions(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	for path, reason := range map[string]string{
+		"/scans/abcde-1234/report?format=markdown&top=1000":                  "top must be between 0 and 100",
+		"/scans/abcde-1234/report?format=markdown&max_length=big":            `invalid max_length \"big\"`,
+		"/scans/abcde-1234/report?format=markdown&report_url=javascript:x()": "report_url must be an http(s) URL",
+	} {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, signedRequest(t, "GET", path, nil))
+
+		assert.Equal(t, http.StatusBadRequest, response.Code, path)
+		assert.Equal(t, `{"reason":"`+reason+`","status":"failed"}`, response.Body.String(), path)
+	}
+}
+
+func TestGetScanReportMarkdown(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1235").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(2, "failed", "abcde-1235", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).AddRow(1, 2, 0, "fp-1", "40018", "SQL Injection", "89",
+			"High", "Medium", "https://shop/?id=1", "GET", "id", "1'", "", "", "", "", false, "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE application=? AND id<?")).WithArgs("shop", int64(2)).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET",
+		"/scans/abcde-1235/report?format=markdown&top=5&report_url=https://ci.example.com/report.html", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), "### ![DAST passed](https://img.shields.io/badge/DAST-passed-brightgreen) shop")
+	assert.Contains(t, response.Body.String(), "[SQL Injection](https://ci.example.com/report.html#rule-40018)")
+	assert.NotContains(t, response.Body.String(), "Compared with build")
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/release"
+	"src/pkg/sast"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/webhook"
+	"src/pkg/zapScanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often a retest is checked and how long it may take before it is stopped.
+const (
+	retestPollInterval = 500 * time.Millisecond
+	retestTimeout      = 5 * time.Minute
+)
+
+var errRetestTimeout = errors.New("retest didn't finish in " + retestTimeout.String())
+
+func addRetestMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.POST("/scans/:id/rescan", security.AuthMiddleware(cfg.HMACSecret), clr.RescanScan)
+	r.POST("/findings/:id/retest", security.AuthMiddleware(cfg.HMACSecret), clr.RetestFinding)
+}
+
+// RescanScan scans a build again as a new attempt, with the configuration its latest attempt was
+// submitted with: target, application, source, callback URLs, SAST results and, for the targets
+// of a release, profile and scope. The id is the build ID.
+func (cImpl *Controller) RescanScan(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	if cImpl.s == (*zapScanner.ZapService)(nil) {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "not connected to zap scanner instance"})
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	if !scan.Finished(s.Status) {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "scan " + s.Build_id + " is still running"})
+		return
+	}
+	body, results, routes, err := cImpl.rescanBody(s)
+	if err != nil {
+		log.Printf("Error reading configuration of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return
+	}
+	attempt, err := scan.GetLastAttemptFromDB(cImpl.dbRO, s.Build_id)
+	if err != nil {
+		log.Printf("Error reading attempts of build %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+		return
+	}
+
+	rescan, err := cImpl.launchScan(body, attempt+1, results, routes)
+	if err == scan.ErrDuplicate {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "build " + s.Build_id + " is already being rescanned"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "reason": "zap client error: " + err.Error()})
+		return
+	}
+	if rescan.ID <= 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "scan started but couldn't be recorded"})
+		return
+	}
+	rescan.Created_at = time.Now().UTC()
+	log.Printf("Build %s rescanned as attempt %d", s.Build_id, rescan.Attempt)
+	r := scanResource(rescan)
+	c.Header("Location", r.Links["self"])
+	c.JSON(http.StatusCreated, r)
+}
+
+// rescanBody rebuilds the submission of a scan from what was recorded for it.
+func (cImpl *Controller) rescanBody(s scan.Scan) (ScanBody, []sast.Result, []sast.Route, error) {
+	body := ScanBody{BuildID: s.Build_id, Target: s.Target, Application: s.Application, Source: s.Build_source}
+	webhooks, err := webhook.WebhooksFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		return body, nil, nil, err
+	}
+	for _, w := range webhooks {
+		body.CallbackURLs = append(body.CallbackURLs, w.URL)
+	}
+	results, err := sast.GetResultsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		return body, nil, nil, err
+	}
+	routes, err := sast.GetRoutesFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		return body, nil, nil, err
+	}
+	t, err := release.TargetFromDB(cImpl.dbRO, s.Build_id)
+	if err == sql.ErrNoRows {
+		return body, results, routes, nil
+	}
+	if err != nil {
+		return body, nil, nil, err
+	}
+	body.Profile = t.Profile
+	// The scope was checked when the release was submitted
+	body.Scope, err = t.Scope.Matcher()
+	return body, results, routes, err
+}
+
+// RetestFinding replays the attack of a finding against its target: the request of the ZAP message
+// the alert was raised on, with only the rule that raised it. The message must still be the
+// finding's request: ZAP message IDs start over in a new session. The issue of the finding is fixed
+// when the alert isn't raised again, and reopened when it was fixed and is. Only findings of ZAP
+// scans can be retested.
+func (cImpl *Controller) RetestFinding(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	if cImpl.s == (*zapScanner.ZapService)(nil) {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "not connected to zap scanner instance"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid finding id"})
+		return
+	}
+	f, issue, err := finding.GetFindingFromDB(cImpl.dbRO, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "reason": "finding not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading finding %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading finding: " + err.Error()})
+		return
+	}
+	if f.MessageID == "" {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "finding has no ZAP message to replay"})
+		return
+	}
+	// Message IDs are only unique within a ZAP session, replay the message only if it's still the finding's
+	m, err := cImpl.s.GetMessage(f.MessageID)
+	if err != nil {
+		log.Printf("Error reading message %s of finding %d: %v", f.MessageID, id, err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "reason": "zap client error: " + err.Error()})
+		return
+	}
+	if method, url, err := m.Request(); err != nil || !strings.EqualFold(method, f.Method) || url != f.URL {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed",
+			"reason": "ZAP message " + f.MessageID + " is no longer the request of the finding"})
+		return
+	}
+
+	present, err := cImpl.retest(c, f, issue.Application)
+	if err == errRetestTimeout {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("Error retesting finding %d: %v", id, err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "reason": "zap client error: " + err.Error()})
+		return
+	}
+	r := finding.Retest{ScanID: f.ScanID, FindingID: f.ID, IssueID: issue.ID, Result: finding.RetestFixed,
+		RetestedAt: time.Now().UTC().Truncate(time.Second)}
+	if present {
+		r.Result = finding.RetestPresent
+	}
+	if issue.ID > 0 {
+		if r.IssueState, err = finding.RetestIssueInDB(cImpl.dbRW, issue, present); err != nil {
+			log.Printf("Error updating issue %d: %v", issue.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error updating issue: " + err.Error()})
+			return
+		}
+	}
+	if r.ID, err = finding.AddRetestToDB(cImpl.dbRW, r); err != nil {
+		log.Printf("Error recording retest of finding %d: %v", id, err)
+	}
+	log.Printf("Finding %d retested, %s", id, r.Result)
+	c.JSON(http.StatusOK, r)
+}
+
+// retest runs the retest of a finding and reports whether it raised the same issue again, an alert
+// with the same fingerprint. A retest that takes too long or whose client went away is stopped.
+func (cImpl *Controller) retest(c *gin.Context, f finding.Finding, application string) (bool, error) {
+	scanID, err := cImpl.s.StartRetest(f.MessageID, f.PluginID)
+	if err != nil {
+		return false, err
+	}
+	deadline := time.Now().Add(retestTimeout)
+	for {
+		progress, alerts, err := cImpl.s.RetestAlerts(scanID)
+		if err != nil {
+			return false, err
+		}
+		if progress >= 100 {
+			for _, a := range alerts {
+				if finding.Fingerprint(application, a.PluginID, a.URL, a.Method, a.Param) == f.Fingerprint {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		if c.Request.Context().Err() != nil || time.Now().After(deadline) {
+			if err := cImpl.s.StopScan(scanID); err != nil {
+				log.Printf("Error stopping retest %s: %v", scanID, err)
+			}
+			return false, errRetestTimeout
+		}
+		time.Sleep(retestPollInterval)
+	}
+}
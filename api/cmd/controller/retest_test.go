@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"src/pkg/finding"
+	"src/pkg/zapScanner"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var retestFindingColumns = []string{"id", "scan_id", "vulnerability_id", "fingerprint", "plugin_id", "name",
+	"cwe_id", "risk", "confidence", "url", "method", "param", "message_id", "application", "issue_id", "issue_state"}
+
+var retestMessages = map[string]zapScanner.HTTPMessage{
+	"17": {RequestHeader: "GET https://shop/?id=1 HTTP/1.1\r\nHost: shop\r\n\r\n"},
+}
+
+func TestRescanScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "8"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("platform-1.4.shop").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "platform-1.4.shop", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).AddRow(1, 1, "https://ci.example/hook", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(sastResultColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_routes WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "path", "file"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE build_id=?")).WithArgs("platform-1.4.shop").
+		WillReturnRows(sqlmock.NewRows(releaseTargetColumns).
+			AddRow(6, 3, "shop", "https://shop", "shop", "api-only", `{"include":["^https://shop/api/"]}`, 1,
+				"platform-1.4.shop", "failed", 24, 3, ""))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(attempt), 0) FROM scans WHERE build_id=?")).
+		WithArgs("platform-1.4.shop").
+		WillReturnRows(sqlmock.NewRows([]string{"attempt"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "platform-1.4.shop", "github", "shop", "https://shop", 8, 2, "shop").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_webhooks(scan_id, url)")).
+		WithArgs(int64(2), "https://ci.example/hook").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/platform-1.4.shop/rescan", nil))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "/v2/scans/platform-1.4.shop", response.Header().Get("Location"))
+	assert.Contains(t, response.Body.String(), `"id":"platform-1.4.shop","status":"running","progress":0`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRescanRunningScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "40", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/rescan", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"scan abcde-1234 is still running","status":"failed"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetestFindingFixed(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{RetestScanID: "9", RetestProgress: 100, Messages: retestMessages}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	fingerprint := finding.Fingerprint("shop", "40018", "https://shop/?id=1", "GET", "id")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(retestFindingColumns).
+			AddRow(4, 1, 24, fingerprint, "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1",
+				"GET", "id", "17", "shop", 5, finding.StateOpen))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=? WHERE id=?")).WithArgs(finding.StateFixed, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO finding_retests(")).
+		WithArgs(int64(1), int64(4), int64(5), finding.RetestFixed, finding.StateFixed, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/findings/4/retest", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^\{"finding_id":4,"issue_id":5,"result":"fixed","issue_state":"fixed","retested_at":"[^"]+"\}$`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetestFindingStillPresent(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	// Alerts of other parameters don't count
+	clr := New(cfg, zapSVMock{RetestScanID: "9", RetestProgress: 100, Messages: retestMessages,
+		RetestFound: []zapScanner.FullAlert{
+			{PluginID: "40018", URL: "https://shop/?q=1", Method: "GET", Param: "q"},
+			{PluginID: "40018", URL: "https://shop/?id=2", Method: "GET", Param: "id"},
+		}}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	fingerprint := finding.Fingerprint("shop", "40018", "https://shop/?id=1", "GET", "id")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(retestFindingColumns).
+			AddRow(4, 1, 24, fingerprint, "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1",
+				"GET", "id", "17", "shop", 5, finding.StateFixed))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=? WHERE id=?")).
+		WithArgs(finding.StateReopened, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO finding_retests(")).
+		WithArgs(int64(1), int64(4), int64(5), finding.RetestPresent, finding.StateReopened, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/findings/4/retest", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"result":"still_present","issue_state":"reopened"`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetestFindingWithoutMessage(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(retestFindingColumns).
+			AddRow(4, 1, 24, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1",
+				"GET", "id", "", "shop", 5, finding.StateOpen))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows(retestFindingColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/findings/4/retest", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"finding has no ZAP message to replay","status":"failed"}`, response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/findings/5/retest", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetestFindingOfAnotherSession(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	// ZAP was restarted, message 17 is now a request of another scan
+	clr := New(cfg, zapSVMock{RetestScanID: "9", RetestProgress: 100, Messages: map[string]zapScanner.HTTPMessage{
+		"17": {RequestHeader: "POST https://blog/login HTTP/1.1\r\nHost: blog\r\n\r\n"},
+	}}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(retestFindingColumns).
+			AddRow(4, 1, 24, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1",
+				"GET", "id", "17", "shop", 5, finding.StateOpen))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/findings/4/retest", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"ZAP message 17 is no longer the request of the finding","status":"failed"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/sast"
+	"src/pkg/scan"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SASTBody carries a SARIF log and the routes of the application, a route map or an OpenAPI
+// document with x-source-file extensions. It's accepted by PUT /scans/:id/sast and with a scan.
+type SASTBody struct {
+	SARIF  json.RawMessage `json:"sarif"`
+	Routes json.RawMessage `json:"routes"`
+}
+
+func addSASTMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/sast", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanSAST)
+	r.PUT("/scans/:id/sast", security.AuthMiddleware(cfg.HMACSecret), clr.SubmitScanSAST)
+}
+
+// GetScanSAST lists the SAST results and routes submitted for a scan. The id is the build ID.
+func (cImpl *Controller) GetScanSAST(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	results, err := sast.GetResultsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading SAST results of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading SAST results: " + err.Error(),
+		})
+		return
+	}
+	routes, err := sast.GetRoutesFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading SAST routes of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading SAST routes: " + err.Error(),
+		})
+		return
+	}
+	if results == nil {
+		results = []sast.Result{}
+	}
+	if routes == nil {
+		routes = []sast.Route{}
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": s.Build_id, "results": results, "routes": routes})
+}
+
+// SubmitScanSAST replaces the SAST results of a scan. Findings of a finished scan are correlated
+// right away and the scan is gated again, a running scan correlates its findings when it completes.
+func (cImpl *Controller) SubmitScanSAST(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) || !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	var body SASTBody
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid JSON body"})
+		return
+	}
+	results, routes, err := parseSAST(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	results, err = sast.ReplaceResultsInDB(cImpl.dbRW, s.ID, results, routes)
+	if err != nil {
+		log.Printf("Error saving SAST results of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error saving SAST results: " + err.Error(),
+		})
+		return
+	}
+	if s.Status != passed && s.Status != failed {
+		c.JSON(http.StatusOK, gin.H{"status": "running", "scan_id": s.Build_id, "results": len(results)})
+		return
+	}
+
+	findings, err := finding.GetFindingsFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading findings: " + err.Error()})
+		return
+	}
+	correlated := sast.Correlate(findings, results, routes)
+	if err := sast.UpdateCorrelationsInDB(cImpl.dbRW, findings); err != nil {
+		log.Printf("Error saving SAST correlations of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error saving correlations: " + err.Error(),
+		})
+		return
+	}
+	cImpl.refreshCatalog()
+	v := cImpl.gatePolicy().Evaluate(findings)
+	status := failed
+	if v.Passed {
+		status = passed
+	}
+	if err := scan.UpdateScanStatus(cImpl.dbRW, status, s.ID); err != nil {
+		log.Printf("Error updating scan status: %v", err)
+	}
+	log.Printf("Correlated %d findings of scan %s with %d SAST results, scored %.2f, passed: %t", correlated,
+		s.Build_id, len(results), v.Score, v.Passed)
+	c.JSON(http.StatusOK, gin.H{
+		"status":     status,
+		"scan_id":    s.Build_id,
+		"results":    len(results),
+		"correlated": correlated,
+		"score":      v.Score,
+	})
+}
+
+// parseSAST reads the SARIF log and routes of a submission. Routes are optional, but without them
+// no finding can be correlated.
+func parseSAST(body SASTBody) ([]sast.Result, []sast.Route, error) {
+	if len(body.SARIF) == 0 {
+		return nil, nil, fmt.Errorf("sarif is required")
+	}
+	results, err := sast.ParseSARIF(body.SARIF)
+	if err != nil {
+		return nil, nil, err
+	}
+	var routes []sast.Route
+	if len(body.Routes) > 0 {
+		if routes, err = sast.ParseRoutes(body.Routes); err != nil {
+			return nil, nil, err
+		}
+	}
+	return results, routes, nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var sastResultColumns = []string{"id", "scan_id", "tool", "rule_id", "cwe_ids", "file", "line", "level", "message"}
+
+func sastBody(t *testing.T) []byte {
+	sarif, err := os.ReadFile("../../pkg/sast/mocks/results.sarif")
+	assert.Nil(t, err)
+	routes, err := os.ReadFile("../../pkg/sast/mocks/routes.json")
+	assert.Nil(t, err)
+	body, err := json.Marshal(SASTBody{SARIF: sarif, Routes: routes})
+	assert.Nil(t, err)
+	return body
+}
+
+func expectReplaceSAST(mock sqlmock.Sqlmock, scanID int64) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerability_findings SET sast_result_id=NULL")).WithArgs(scanID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sast_results")).WithArgs(scanID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sast_routes")).WithArgs(scanID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 1; i <= 3; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sast_results(")).WillReturnResult(sqlmock.NewResult(int64(i), 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sast_routes(")).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+}
+
+func TestSubmitScanSASTRequiresSARIF(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "PUT", "/scans/abcde-1234/sast", []byte(`{"routes":{}}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"sarif is required","status":"failed"}`, response.Body.String())
+}
+
+func TestSubmitScanSASTInvalidRoutes(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "PUT", "/scans/abcde-1234/sast",
+		[]byte(`{"sarif":{"runs":[]},"routes":{"users":"users.go"}}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"invalid route \"users\", expected a path or a method and a path",`+
+		`"status":"failed"}`, response.Body.String())
+}
+
+func TestSubmitScanSASTToRunningScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	expectReplaceSAST(mock, 1)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "PUT", "/scans/abcde-1234/sast", sastBody(t)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"results":3,"scan_id":"abcde-1234","status":"running"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSubmitScanSASTRegatesFinishedScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Scoring.Confirmed = 2
+	defer func() { cfg.Scoring.Confirmed = 1 }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	expectReplaceSAST(mock, 1)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).
+			AddRow(4, 1, 0, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://shop/users/7",
+				"GET", "id", "1'", "", "", "", "", false, "", 0).
+			AddRow(5, 1, 0, "fp-2", "40012", "Cross Site Scripting", "79", "High", "Medium",
+				"https://shop/profile", "GET", "q", "", "", "", "", "", false, "", 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerability_findings SET sast_result_id=? WHERE id=?")).
+		WithArgs(int64(1), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET status=? WHERE id=?")).
+		WithArgs("passed", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "PUT", "/scans/abcde-1234/sast", sastBody(t)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"correlated":1,"results":3,"scan_id":"abcde-1234","score":0,"status":"passed"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanSAST(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(sastResultColumns).
+			AddRow(1, 1, "CodeQL", "go/reflected-xss", "79,116", "internal/search/handler.go", 17, "warning", "XSS"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_routes WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "path", "file"}))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/sast", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"results":[{"id":1,"tool":"CodeQL","rule_id":"go/reflected-xss","cwe_ids":["79","116"],`+
+		`"file":"internal/search/handler.go","line":17,"level":"warning","message":"XSS"}],"routes":[],`+
+		`"scan_id":"abcde-1234"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
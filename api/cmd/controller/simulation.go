@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/gate"
+	"src/pkg/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SimulationBody struct {
+	Policy       gate.PolicySpec `json:"policy"`
+	Since        string          `json:"since"`
+	Until        string          `json:"until"`
+	Applications []string        `json:"applications"`
+}
+
+func addPolicyMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.POST("/policy/simulate", security.AuthMiddleware(cfg.HMACSecret), clr.SimulatePolicy)
+}
+
+// SimulatePolicy re-evaluates the stored findings of past scans with a candidate policy and
+// reports which builds would have changed verdict, without rescanning anything.
+func (cImpl *Controller) SimulatePolicy(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	var b SimulationBody
+	if err := c.BindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed", "reason": "couldn't parse simulation from body",
+		})
+		return
+	}
+	now := time.Now()
+	since, err := parseSince(b.Since, now.AddDate(0, 0, -30))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	until, err := parseUntil(b.Until, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+
+	cImpl.refreshCatalog()
+	current := cImpl.gatePolicy()
+	candidate, err := current.Apply(b.Policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": "invalid policy: " + err.Error()})
+		return
+	}
+	filter := gate.SimulationFilter{Since: since, Until: until, Applications: b.Applications}
+	deltas, changed, err := gate.Simulate(cImpl.dbRO, current, candidate, filter)
+	if err != nil {
+		log.Printf("Error simulating policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failed", "reason": "error reading historical scans: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"since":        since,
+		"until":        until,
+		"applications": deltas,
+		"changed":      changed,
+	})
+}
+
+// parseUntil is parseSince for the exclusive end of a period: a date includes that whole day, so
+// the period ends at midnight of the next one.
+func parseUntil(v string, defaultValue time.Time) (time.Time, error) {
+	t, err := parseSince(v, defaultValue)
+	if err == nil && len(v) == len("2006-01-02") {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, err
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUntilIncludesTheWholeDay(t *testing.T) {
+	now := time.Now()
+
+	until, err := parseUntil("2024-02-01", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC), until)
+
+	until, err = parseUntil("2024-02-01T12:30:00Z", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 2, 1, 12, 30, 0, 0, time.UTC), until)
+
+	until, err = parseUntil("", now)
+	assert.Nil(t, err)
+	assert.Equal(t, now, until)
+
+	_, err = parseUntil("yesterday", now)
+	assert.NotNil(t, err)
+}
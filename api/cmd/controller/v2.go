@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/event"
+	"src/pkg/sast"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/zapScanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of the v2 API, returned in the error envelope with a human readable message.
+const (
+	errCodeInvalidRequest      = "invalid_request"
+	errCodeUnauthorized        = "unauthorized"
+	errCodeNotFound            = "not_found"
+	errCodeConflict            = "conflict"
+	errCodeScannerUnavailable  = "scanner_unavailable"
+	errCodeScannerError        = "scanner_error"
+	errCodeDatabaseUnavailable = "database_unavailable"
+	errCodeInternal            = "internal_error"
+)
+
+// Status of a v2 scan resource that hasn't finished.
+const statusRunning = "running"
+
+// ScanResource is a scan as the v2 API returns it. ID is the build ID the scan was submitted with,
+// Progress the percentage of the active scan that is done.
+type ScanResource struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Progress    int               `json:"progress"`
+	Application string            `json:"application"`
+	Target      string            `json:"target"`
+	Source      string            `json:"source"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Links       map[string]string `json:"links"`
+}
+
+func addV2Mappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	v2 := r.Group("/v2", security.AuthMiddlewareWith(cfg.HMACSecret, signatureError))
+	v2.POST("/scans", clr.CreateScanV2)
+	v2.GET("/scans", clr.ListScansV2)
+	v2.GET("/scans/:id", clr.GetScanV2)
+	v2.DELETE("/scans/:id", clr.DeleteScanV2)
+}
+
+// v2Error writes the error envelope of the v2 API.
+func v2Error(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": gin.H{"code": code, "message": message}})
+}
+
+func v2RequireDB(c *gin.Context, conn *sql.DB) bool {
+	if conn == nil {
+		v2Error(c, http.StatusServiceUnavailable, errCodeDatabaseUnavailable, "not connected to database")
+		return false
+	}
+	return true
+}
+
+func scanResource(s scan.Scan) ScanResource {
+	r := ScanResource{
+		ID:          s.Build_id,
+		Status:      s.Status,
+		Application: s.Application,
+		Target:      s.Target,
+		Source:      s.Build_source,
+		CreatedAt:   s.Created_at,
+		Links: map[string]string{
+			"self":     "/v2/scans/" + s.Build_id,
+			"findings": "/scans/" + s.Build_id + "/findings",
+			"report":   "/scans/" + s.Build_id + "/report",
+		},
+	}
+	switch s.Status {
+	case scan.StatusPassed, scan.StatusFailed:
+		r.Progress = 100
+	case scan.StatusError, scan.StatusCancelled:
+	default:
+		// Running scans store their progress as the status
+		r.Status = statusRunning
+		r.Progress, _ = strconv.Atoi(s.Status)
+	}
+	return r
+}
+
+// apiError is a failed operation of the v2 API, with the HTTP status and error code it's
+// reported with. The gRPC API maps the codes to its own.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// v2Abort writes the error envelope of an apiError.
+func v2Abort(c *gin.Context, err *apiError) {
+	v2Error(c, err.status, err.code, err.message)
+}
+
+// findScan reads a scan by build ID.
+func findScan(conn *sql.DB, id string) (scan.Scan, *apiError) {
+	s, err := scan.GetScanDetailsFromDB(conn, id)
+	if err == sql.ErrNoRows {
+		return s, &apiError{http.StatusNotFound, errCodeNotFound, "scan not found"}
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", id, err)
+		return s, &apiError{http.StatusInternalServerError, errCodeInternal, "error reading scan: " + err.Error()}
+	}
+	return s, nil
+}
+
+// v2Scan reads the scan in the id path parameter, writing the error response when there is none.
+func (cImpl *Controller) v2Scan(c *gin.Context, conn *sql.DB) (scan.Scan, bool) {
+	s, err := findScan(conn, c.Param("id"))
+	if err != nil {
+		v2Abort(c, err)
+		return s, false
+	}
+	return s, true
+}
+
+// sameSubmission reports whether a submission asks for the same scan as an earlier one of its build.
+func sameSubmission(s scan.Scan, body ScanBody) bool {
+	return s.Target == body.Target && s.Application == body.Application && s.Build_source == body.Source
+}
+
+// resolveSubmission decides what a submission of a build that may have been scanned already gets.
+// Resubmitting the same target, application and source returns the latest attempt, whose ID is
+// set. Otherwise it's the attempt number the new scan gets: 1 for a new build, the next one when
+// force is set. A different request without force is a conflict.
+func (cImpl *Controller) resolveSubmission(body ScanBody) (scan.Scan, int, *apiError) {
+	prior, err := scan.GetScanDetailsFromDB(cImpl.dbRO, body.BuildID)
+	if err == sql.ErrNoRows {
+		return scan.Scan{}, 1, nil
+	}
+	if err != nil {
+		log.Printf("Error reading scan %s: %v", body.BuildID, err)
+		return scan.Scan{}, 0, &apiError{http.StatusInternalServerError, errCodeInternal,
+			"error reading scan: " + err.Error()}
+	}
+	if body.Force {
+		last, err := scan.GetLastAttemptFromDB(cImpl.dbRO, body.BuildID)
+		if err != nil {
+			log.Printf("Error reading attempts of build %s: %v", body.BuildID, err)
+			return scan.Scan{}, 0, &apiError{http.StatusInternalServerError, errCodeInternal,
+				"error reading scan: " + err.Error()}
+		}
+		return scan.Scan{}, last + 1, nil
+	}
+	if !sameSubmission(prior, body) {
+		return scan.Scan{}, 0, &apiError{http.StatusConflict, errCodeConflict, "build " + body.BuildID +
+			" was already submitted with another target, application or source, set force to scan it again"}
+	}
+	return prior, 0, nil
+}
+
+// submitScan starts a scan of a build. Submitting a build again returns its latest attempt, which
+// isn't created, unless force asks for a new attempt.
+func (cImpl *Controller) submitScan(body ScanBody) (scan.Scan, bool, *apiError) {
+	if cImpl.dbRW == nil || cImpl.dbRO == nil {
+		return scan.Scan{}, false, &apiError{http.StatusServiceUnavailable, errCodeDatabaseUnavailable,
+			"not connected to database"}
+	}
+	if cImpl.s == (*zapScanner.ZapService)(nil) {
+		return scan.Scan{}, false, &apiError{http.StatusServiceUnavailable, errCodeScannerUnavailable,
+			"not connected to zap scanner instance"}
+	}
+	if body.BuildID == "" || body.Target == "" {
+		return scan.Scan{}, false, &apiError{http.StatusBadRequest, errCodeInvalidRequest,
+			"build_id and target are required"}
+	}
+	if err := cImpl.parseCallbacks(body.CallbackURLs); err != nil {
+		return scan.Scan{}, false, &apiError{http.StatusBadRequest, errCodeInvalidRequest, err.Error()}
+	}
+	var results []sast.Result
+	var routes []sast.Route
+	if len(body.SARIF) > 0 || len(body.Routes) > 0 {
+		var err error
+		if results, routes, err = parseSAST(body.SASTBody); err != nil {
+			return scan.Scan{}, false, &apiError{http.StatusBadRequest, errCodeInvalidRequest, err.Error()}
+		}
+	}
+	prior, attempt, apiErr := cImpl.resolveSubmission(body)
+	if apiErr != nil {
+		return scan.Scan{}, false, apiErr
+	}
+	if prior.ID > 0 {
+		cImpl.addCallbacks(prior, body.CallbackURLs)
+		return prior, false, nil
+	}
+
+	s, err := cImpl.launchScan(body, attempt, results, routes)
+	if err == scan.ErrDuplicate {
+		// Another replica recorded the same attempt first, its scan is the one
+		s, apiErr := findScan(cImpl.dbRW, body.BuildID)
+		return s, false, apiErr
+	}
+	if err != nil {
+		return scan.Scan{}, false, &apiError{http.StatusBadGateway, errCodeScannerError,
+			"zap client error: " + err.Error()}
+	}
+	if s.ID <= 0 {
+		return scan.Scan{}, false, &apiError{http.StatusInternalServerError, errCodeInternal,
+			"scan started but couldn't be recorded"}
+	}
+	s.Created_at = time.Now().UTC()
+	return s, true, nil
+}
+
+// CreateScanV2 starts a scan of a build. Build IDs identify scans: submitting a build again answers
+// with its latest attempt, 200 instead of 201, unless force is set.
+func (cImpl *Controller) CreateScanV2(c *gin.Context) {
+	if !v2RequireDB(c, cImpl.dbRW) || !v2RequireDB(c, cImpl.dbRO) {
+		return
+	}
+	var body ScanBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest, "invalid JSON body")
+		return
+	}
+	s, created, err := cImpl.submitScan(body)
+	if err != nil {
+		v2Abort(c, err)
+		return
+	}
+	r := scanResource(s)
+	c.Header("Location", r.Links["self"])
+	if !created {
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	c.JSON(http.StatusCreated, r)
+}
+
+// GetScanV2 returns a scan by build ID.
+func (cImpl *Controller) GetScanV2(c *gin.Context) {
+	if !v2RequireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.v2Scan(c, cImpl.dbRO)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, scanResource(s))
+}
+
+// ListScansV2 lists scans newest first, filtered by application, status and creation time (since,
+// a date or an RFC 3339 timestamp), with page and per_page.
+func (cImpl *Controller) ListScansV2(c *gin.Context) {
+	if !v2RequireDB(c, cImpl.dbRO) {
+		return
+	}
+	f := scan.Filter{Application: c.Query("application"), Status: c.Query("status")}
+	switch f.Status {
+	case "", statusRunning, scan.StatusPassed, scan.StatusFailed, scan.StatusError, scan.StatusCancelled:
+	default:
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest, "invalid status \""+f.Status+"\"")
+		return
+	}
+	since, err := parseSince(c.Query("since"), time.Time{})
+	if err != nil {
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest, "since must be a date or an RFC 3339 timestamp")
+		return
+	}
+	f.Since = since
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest, "page must be a positive number")
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPerPage)))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		v2Error(c, http.StatusBadRequest, errCodeInvalidRequest,
+			"per_page must be between 1 and "+strconv.Itoa(maxPerPage))
+		return
+	}
+	f.Limit = perPage
+	f.Offset = (page - 1) * perPage
+
+	scans, total, err := scan.QueryScansFromDB(cImpl.dbRO, f)
+	if err != nil {
+		log.Printf("Error listing scans: %v", err)
+		v2Error(c, http.StatusInternalServerError, errCodeInternal, "error reading scans: "+err.Error())
+		return
+	}
+	resources := []ScanResource{}
+	for _, s := range scans {
+		resources = append(resources, scanResource(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"scans": resources, "page": page, "per_page": perPage, "total": total})
+}
+
+// DeleteScanV2 cancels a running scan, which stays listed as cancelled, and deletes a finished one
+// with its findings.
+func (cImpl *Controller) DeleteScanV2(c *gin.Context) {
+	if !v2RequireDB(c, cImpl.dbRW) || !v2RequireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.v2Scan(c, cImpl.dbRW)
+	if !ok {
+		return
+	}
+	if scan.Finished(s.Status) {
+		if err := scan.DeleteScanFromDB(cImpl.dbRW, s.ID); err != nil {
+			log.Printf("Error deleting scan %s: %v", s.Build_id, err)
+			v2Error(c, http.StatusInternalServerError, errCodeInternal, "error deleting scan: "+err.Error())
+			return
+		}
+		log.Printf("Deleted scan %s", s.Build_id)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := cImpl.cancelScan(s); err != nil {
+		v2Error(c, http.StatusInternalServerError, errCodeInternal, "error cancelling scan: "+err.Error())
+		return
+	}
+	s.Status = scan.StatusCancelled
+	c.JSON(http.StatusAccepted, scanResource(s))
+}
+
+// cancelScan stops a running scan and announces its cancelled verdict. The scan is cancelled even
+// when ZAP can't be told, its result would be discarded anyway.
+func (cImpl *Controller) cancelScan(s scan.Scan) error {
+	if cImpl.s != (*zapScanner.ZapService)(nil) {
+		if err := cImpl.s.StopScan(strconv.Itoa(s.Zap_id)); err != nil {
+			log.Printf("Error stopping ZAP scan %d of %s: %v", s.Zap_id, s.Build_id, err)
+		}
+	}
+	if err := scan.UpdateScanStatus(cImpl.dbRW, scan.StatusCancelled, s.ID); err != nil {
+		log.Printf("Error cancelling scan %s: %v", s.Build_id, err)
+		return err
+	}
+	log.Printf("Cancelled scan %s", s.Build_id)
+	s.Status = scan.StatusCancelled
+	cImpl.finishScan(cImpl.dbRW, s, event.Verdict{Status: s.Status}, nil)
+	return nil
+}
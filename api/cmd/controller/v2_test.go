@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestV2RejectsUnsignedRequests(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	request := signedRequest(t, "GET", "/v2/scans", nil)
+	request.Header.Set("Signature", "00")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.Equal(t, `{"error":{"code":"unauthorized","message":"invalid signature"}}`, response.Body.String())
+}
+
+func TestCreateScanV2(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE project=?")).WithArgs("shop").
+		WillReturnRows(sqlmock.NewRows(assetColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "abcde-1234", "github", "shop", "https://shop", 3, 1, "shop").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","application":"shop","source":"github"}`)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "/v2/scans/abcde-1234", response.Header().Get("Location"))
+	assert.Regexp(t, `^\{"id":"abcde-1234","status":"running","progress":0,"application":"shop",`+
+		`"target":"https://shop","source":"github","created_at":"[^"]+","links":\{"findings":"/scans/abcde-1234/findings",`+
+		`"report":"/scans/abcde-1234/report","self":"/v2/scans/abcde-1234"\}\}$`, response.Body.String())
+}
+
+func TestCreateScanV2Validation(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans", []byte(`{"build_id":"abcde-1234"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"error":{"code":"invalid_request","message":"target is required"}}`,
+		response.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop"}`)))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"error":{"code":"conflict","message":"build abcde-1234 was already submitted with another `+
+		`target, application or source, set force to scan it again"}}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateScanV2ReturnsExistingScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","application":"shop","source":"github"}`)))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "/v2/scans/abcde-1234", response.Header().Get("Location"))
+	assert.Regexp(t, `^\{"id":"abcde-1234","status":"passed",`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateScanV2ForceStartsNewAttempt(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(attempt), 0) FROM scans WHERE build_id=?")).
+		WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows([]string{"attempt"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "abcde-1234", "", "", "https://shop", 3, 3, "").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","force":true}`)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetScanV2(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	created := time.Date(2022, 9, 2, 12, 50, 21, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, created))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/v2/scans/abcde-1234", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"id":"abcde-1234","status":"running","progress":45,"application":"shop",`+
+		`"target":"https://shop","source":"github","created_at":"2022-09-02T12:50:21Z",`+
+		`"links":{"findings":"/scans/abcde-1234/findings","report":"/scans/abcde-1234/report",`+
+		`"self":"/v2/scans/abcde-1234"}}`, response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/v2/scans/missing", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, `{"error":{"code":"not_found","message":"scan not found"}}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListScansV2(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	since := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM scans WHERE 1=1 AND application=? AND status=? "+
+		"AND created_at>=?")).WithArgs("shop", "failed", since).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY id DESC LIMIT ? OFFSET ?")).
+		WithArgs("shop", "failed", since, 2, 2).
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, since))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET",
+		"/v2/scans?application=shop&status=failed&since=2022-09-01&page=2&per_page=2", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"page":2,"per_page":2,"scans":[{"id":"abcde-1234","status":"failed",`+
+		`"progress":100`)
+	assert.Contains(t, response.Body.String(), `"total":3}`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListScansV2InvalidStatus(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, _, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/v2/scans?status=done", nil))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"error":{"code":"invalid_request","message":"invalid status \"done\""}}`, response.Body.String())
+}
+
+func TestDeleteScanV2CancelsRunningScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET status=? WHERE id=? AND status<>'cancelled'")).
+		WithArgs("cancelled", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).
+		WithArgs(int64(1), "verdict", `{"status":"cancelled","findings":0}`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "DELETE", "/v2/scans/abcde-1234", nil))
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Contains(t, response.Body.String(), `"status":"cancelled","progress":0`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteScanV2DeletesFinishedScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "passed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectBegin()
+	for _, table := range []string{"vulnerability_findings", "scan_urls", "sast_results",
+		"sast_routes", "defectdojo_pushes", "scan_events", "scan_webhooks", "webhook_deliveries",
+		"webhook_retries", "webhook_dead_letters", "finding_retests"} {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM " + table + " WHERE scan_id=?")).WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE release_targets SET scan_id=NULL WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM scans WHERE id=?")).WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "DELETE", "/v2/scans/abcde-1234", nil))
+
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, "", response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long GET /scans/:id/wait blocks by default and at most.
+const (
+	defaultWaitTimeout = 10 * time.Minute
+	maxWaitTimeout     = 30 * time.Minute
+)
+
+// ScanVerdict is the final result of a scan, answered by GET /scans/:id/wait. Score and
+// explanation are only set for passed and failed scans.
+type ScanVerdict struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Passed      bool              `json:"passed"`
+	Score       *float64          `json:"score,omitempty"`
+	Summary     webhook.Summary   `json:"summary"`
+	Explanation []string          `json:"explanation,omitempty"`
+	Links       map[string]string `json:"links"`
+}
+
+func addWaitMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/wait", security.AuthMiddleware(cfg.HMACSecret), clr.WaitScan)
+}
+
+// parseWaitTimeout accepts a duration (90s, 10m) or a number of seconds.
+func parseWaitTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return defaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		n, nErr := strconv.Atoi(v)
+		d, err = time.Duration(n)*time.Second, nErr
+	}
+	if err != nil || d <= 0 || d > maxWaitTimeout {
+		return 0, fmt.Errorf("timeout must be a duration up to %s", maxWaitTimeout)
+	}
+	return d, nil
+}
+
+// WaitScan blocks until the scan finishes or the timeout passes, so a CI job can gate a build with
+// a single call. A finished scan is answered with its verdict and a summary of its findings, a
+// scan still running after the timeout with 202 and its progress. The id is the build ID. Waiters
+// are woken by the verdict event of the scan and all the waiters of a scan share the reads of its
+// events.
+func (cImpl *Controller) WaitScan(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	timeout, err := parseWaitTimeout(c.Query("timeout"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "reason": err.Error()})
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+
+	if !scan.Finished(s.Status) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		_, err := cImpl.events.WaitVerdict(ctx, s.ID)
+		cancel()
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		if err != nil && err != context.DeadlineExceeded {
+			log.Printf("Error waiting for scan %s: %v", s.Build_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading events: " + err.Error()})
+			return
+		}
+		// Read the attempt that was waited for, a forced one may have been submitted since
+		if s.Status, err = scan.GetAttemptStatusFromDB(cImpl.dbRO, s.ID); err != nil {
+			log.Printf("Error reading scan %s: %v", s.Build_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading scan: " + err.Error()})
+			return
+		}
+		if !scan.Finished(s.Status) {
+			c.JSON(http.StatusAccepted, scanResource(s))
+			return
+		}
+	}
+
+	var findings []finding.Finding
+	scored := s.Status == scan.StatusPassed || s.Status == scan.StatusFailed
+	if scored {
+		if findings, err = finding.GetFindingsFromDB(cImpl.dbRO, s.ID); err != nil {
+			log.Printf("Error reading findings of scan %s: %v", s.Build_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failed", "reason": "error reading findings: " + err.Error(),
+			})
+			return
+		}
+		cImpl.refreshCatalog()
+	}
+	r := report.New(s, findings, cImpl.gatePolicy())
+	verdict := ScanVerdict{
+		ID:      s.Build_id,
+		Status:  s.Status,
+		Passed:  s.Status == scan.StatusPassed,
+		Summary: summarize(r),
+		Links:   scanResource(s).Links,
+	}
+	if scored {
+		v := r.Verdict()
+		verdict.Score = &v.Score
+		verdict.Explanation = r.Explanation(v)
+	}
+	c.JSON(http.StatusOK, verdict)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitScanOfFinishedScan(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(diffFindingColumns).
+			AddRow(1, 1, 0, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://shop/?id=1", "GET",
+				"id", "1'", "", "", "", "", false, "", 0).
+			AddRow(2, 1, 0, "fp-2", "10020", "Missing Anti-clickjacking Header", "1021", "Medium", "Medium",
+				"https://shop/", "GET", "", "", "", "", "", "", true, "framed on purpose", 0))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/wait", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^\{"id":"abcde-1234","status":"failed","passed":false,"score":[0-9.]+,`+
+		`"summary":\{"findings":2,"suppressed":1,"severities":\{"high":1\}\},"explanation":\[.+\],`+
+		`"links":\{.+\}\}$`, response.Body.String())
+}
+
+func TestWaitScanWakesOnVerdict(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(7, 1, "progress", `{"progress":60}`, time.Now()).
+			AddRow(8, 1, "verdict", `{"status":"cancelled","findings":0}`, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM scans WHERE id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("cancelled"))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/wait?timeout=5s", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"id":"abcde-1234","status":"cancelled","passed":false,`+
+		`"summary":{"findings":0,"suppressed":0,"severities":{}},"links":{"findings":"/scans/abcde-1234/findings",`+
+		`"report":"/scans/abcde-1234/report","self":"/v2/scans/abcde-1234"}}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestWaitScanTimesOut(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/wait?timeout=2h", nil))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"reason":"timeout must be a duration up to 30m0s","status":"failed"}`, response.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM scans WHERE id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("60"))
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/wait?timeout=50ms", nil))
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Regexp(t, `^\{"id":"abcde-1234","status":"running","progress":60,`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestParseWaitTimeout(t *testing.T) {
+	for v, want := range map[string]time.Duration{"": 10 * time.Minute, "600": 10 * time.Minute,
+		"90s": 90 * time.Second, "30m": 30 * time.Minute} {
+		d, err := parseWaitTimeout(v)
+		assert.Nil(t, err, v)
+		assert.Equal(t, want, d, v)
+	}
+	for _, v := range []string{"0", "-5s", "31m", "soon"} {
+		_, err := parseWaitTimeout(v)
+		assert.NotNil(t, err, v)
+	}
+}
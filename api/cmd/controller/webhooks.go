@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"src/cmd/config"
+	"src/pkg/event"
+	"src/pkg/finding"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/security"
+	"src/pkg/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// retryBatch is how many webhook retries WatchWebhooks claims at once.
+const retryBatch = 50
+
+func addWebhookMappings(r *gin.Engine, clr *Controller, cfg *config.Configuration) {
+	r.GET("/scans/:id/webhooks", security.AuthMiddleware(cfg.HMACSecret), clr.GetScanWebhooks)
+	r.POST("/scans/:id/webhooks/replay", security.AuthMiddleware(cfg.HMACSecret), clr.ReplayScanWebhooks)
+}
+
+// parseCallbacks checks the callback URLs of a scan request. They're refused when webhooks are off.
+func (cImpl *Controller) parseCallbacks(urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	if !cImpl.webhooksEnabled() {
+		return errors.New("callback URLs can't be registered, webhooks need their own WEBHOOK_SECRET")
+	}
+	if len(urls) > webhook.MaxCallbacks {
+		return fmt.Errorf("at most %d callback URLs can be registered", webhook.MaxCallbacks)
+	}
+	allowed := cImpl.callbackNetworks()
+	for _, u := range urls {
+		if err := webhook.ValidateURL(u, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhooksEnabled reports whether deliveries can be signed. The HMAC secret isn't used for them,
+// receivers holding it could sign requests to the API.
+func (cImpl *Controller) webhooksEnabled() bool {
+	return cImpl.c.Webhooks.Secret != "" && cImpl.c.Webhooks.Secret != cImpl.c.HMACSecret
+}
+
+// callbackNetworks are the internal networks callbacks may be on. None are when the setting is
+// invalid.
+func (cImpl *Controller) callbackNetworks() []*net.IPNet {
+	allowed, err := webhook.ParseNetworks(cImpl.c.Webhooks.AllowedNetworks)
+	if err != nil {
+		log.Printf("Ignoring WEBHOOK_ALLOWED_NETWORKS: %v", err)
+		return nil
+	}
+	return allowed
+}
+
+// addCallbacks registers the callback URLs of a resubmission that the scan doesn't have yet. A scan
+// that has finished isn't notified again.
+func (cImpl *Controller) addCallbacks(s scan.Scan, urls []string) {
+	if len(urls) == 0 || scan.Finished(s.Status) || cImpl.dbRW == nil {
+		return
+	}
+	webhooks, err := webhook.WebhooksFromDB(cImpl.dbRW, s.ID)
+	if err != nil {
+		log.Printf("Error reading webhooks of scan %s: %v", s.Build_id, err)
+		return
+	}
+	registered := make(map[string]bool)
+	for _, w := range webhooks {
+		registered[w.URL] = true
+	}
+	var fresh []string
+	for _, u := range urls {
+		if !registered[u] {
+			fresh = append(fresh, u)
+			registered[u] = true
+		}
+	}
+	if err := webhook.AddWebhooksToDB(cImpl.dbRW, s.ID, fresh); err != nil {
+		log.Printf("Error registering callback URLs of scan %s: %v", s.Build_id, err)
+	}
+}
+
+// webhookSender builds the sender from the current configuration, so /reload picks up changes.
+func (cImpl *Controller) webhookSender() *webhook.Sender {
+	wc := cImpl.c.Webhooks
+	return webhook.NewSender(wc.Secret, wc.MaxAttempts, time.Duration(wc.BackoffSeconds)*time.Second,
+		time.Duration(wc.TimeoutSeconds)*time.Second, cImpl.callbackNetworks())
+}
+
+// finishScan announces the final status of a scan: the verdict event ends its event streams and
+// the callback URLs it registered are notified.
+func (cImpl *Controller) finishScan(conn *sql.DB, s scan.Scan, v event.Verdict, findings []finding.Finding) {
+	cImpl.publish(s, event.TypeVerdict, v)
+	cImpl.notifyWebhooks(conn, s, v, findings)
+}
+
+// notifyWebhooks POSTs the verdict and a summary of the findings to the callback URLs of a scan.
+// Failed deliveries are retried by WatchWebhooks, the scan result doesn't depend on them.
+func (cImpl *Controller) notifyWebhooks(conn *sql.DB, s scan.Scan, v event.Verdict, findings []finding.Finding) {
+	if s.ID <= 0 {
+		return
+	}
+	webhooks, err := webhook.WebhooksFromDB(conn, s.ID)
+	if err != nil {
+		log.Printf("Error reading webhooks of scan %s: %v", s.Build_id, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	if !cImpl.webhooksEnabled() {
+		log.Printf("Not notifying the callback URLs of scan %s, WEBHOOK_SECRET isn't set", s.Build_id)
+		return
+	}
+	body, err := json.Marshal(webhook.Payload{
+		Event:       webhook.EventScanCompleted,
+		ScanID:      s.Build_id,
+		Application: s.Application,
+		Target:      s.Target,
+		Status:      v.Status,
+		Score:       v.Score,
+		Summary:     summarize(report.New(s, findings, cImpl.gatePolicy())),
+		Links:       scanResource(s).Links,
+		CompletedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Error encoding webhook payload of scan %s: %v", s.Build_id, err)
+		return
+	}
+	sender := cImpl.webhookSender()
+	for _, w := range webhooks {
+		go func(w webhook.Webhook) {
+			if err := sender.Deliver(conn, w, webhook.EventScanCompleted, body); err != nil {
+				log.Printf("Couldn't deliver webhook %d of scan %s to %s: %v", w.ID, s.Build_id, w.URL, err)
+			}
+		}(w)
+	}
+}
+
+// summarize counts the findings of a report by the severity of their catalog entry.
+func summarize(r report.Report) webhook.Summary {
+	summary := webhook.Summary{Findings: len(r.Findings), Severities: map[string]int{}}
+	for _, f := range r.Findings {
+		if f.Suppressed {
+			summary.Suppressed++
+			continue
+		}
+		summary.Severities[r.Rule(f).Severity]++
+	}
+	return summary
+}
+
+// GetScanWebhooks lists the callback URLs of a scan with every delivery attempt, and the payloads
+// that couldn't be delivered. The id is the build ID.
+func (cImpl *Controller) GetScanWebhooks(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRO) {
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	webhooks, err := webhook.WebhooksFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		webhookError(c, s, err)
+		return
+	}
+	deliveries, err := webhook.DeliveriesFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		webhookError(c, s, err)
+		return
+	}
+	letters, err := webhook.DeadLettersFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		webhookError(c, s, err)
+		return
+	}
+	retries, err := webhook.RetriesFromDB(cImpl.dbRO, s.ID)
+	if err != nil {
+		webhookError(c, s, err)
+		return
+	}
+	urls := []string{}
+	for _, w := range webhooks {
+		urls = append(urls, w.URL)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scan_id":       s.Build_id,
+		"callback_urls": urls,
+		"deliveries":    deliveries,
+		"retries":       retries,
+		"dead_letters":  letters,
+	})
+}
+
+// ReplayScanWebhooks delivers the dead letters of a scan again. They're retries due now, attempted
+// from the first one by WatchWebhooks. The id is the build ID.
+func (cImpl *Controller) ReplayScanWebhooks(c *gin.Context) {
+	if !requireDB(c, cImpl.dbRW) {
+		return
+	}
+	if !cImpl.webhooksEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "reason": "webhooks are off, WEBHOOK_SECRET isn't set"})
+		return
+	}
+	s, ok := cImpl.artifactScan(c)
+	if !ok {
+		return
+	}
+	n, err := webhook.ReplayDeadLettersInDB(cImpl.dbRW, s.ID, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error replaying dead letters of scan %s: %v", s.Build_id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error replaying dead letters: " +
+			err.Error()})
+		return
+	}
+	log.Printf("Replaying %d dead letters of scan %s", n, s.Build_id)
+	c.JSON(http.StatusAccepted, gin.H{"status": "replaying", "scan_id": s.Build_id, "replayed": n})
+}
+
+// WatchWebhooks makes, every interval, the delivery attempts whose retry is due. Every replica runs
+// it, retries are claimed so only one of them attempts each.
+func (cImpl *Controller) WatchWebhooks(interval time.Duration) {
+	for ; ; time.Sleep(interval) {
+		if !cImpl.webhooksEnabled() {
+			continue
+		}
+		sender := cImpl.webhookSender()
+		for {
+			n, err := sender.RetryDue(cImpl.dbRW, time.Now().UTC(), retryBatch)
+			if err != nil {
+				log.Printf("Error retrying webhook deliveries: %v", err)
+			}
+			if err != nil || n < retryBatch {
+				break
+			}
+		}
+	}
+}
+
+func webhookError(c *gin.Context, s scan.Scan, err error) {
+	log.Printf("Error reading webhook deliveries of scan %s: %v", s.Build_id, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "reason": "error reading deliveries: " + err.Error()})
+}
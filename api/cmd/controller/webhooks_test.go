@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"src/pkg/webhook"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var webhookColumns = []string{"id", "scan_id", "url", "created_at"}
+
+const mockWebhookSecret = "736ffa5e4064da13711d075ed6b71069"
+
+func TestCreateScanV2RegistersCallbacks(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Webhooks.Secret = mockWebhookSecret
+	cfg.Webhooks.AllowedNetworks = ""
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","callback_urls":["ci.example.com/hook"]}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"error":{"code":"invalid_request","message":"invalid callback URL \"ci.example.com/hook\""}}`,
+		response.Body.String())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+		[]byte(`{"build_id":"abcde-1234","target":"https://shop","callback_urls":["http://169.254.169.254/latest"]}`)))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, `{"error":{"code":"invalid_request","message":"callback URL \"http://169.254.169.254/latest\" `+
+		`isn't allowed: callback address 169.254.169.254 isn't public"}}`, response.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=? ORDER BY id DESC")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scans(")).
+		WithArgs("started", "abcde-1234", "", "", "https://shop", 3, 1, "").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	for _, u := range []string{"https://ci.example.com/hook", "http://jenkins:8080/dast"} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_webhooks(scan_id, url)")).WithArgs(int64(9), u).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans", []byte(`{"build_id":"abcde-1234",`+
+		`"target":"https://shop","callback_urls":["https://ci.example.com/hook","http://jenkins:8080/dast"]}`)))
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateScanV2WithoutWebhookSecret(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{StartScanResponse: "3"}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	for _, secret := range []string{"", mockHMACSecret} {
+		cfg.Webhooks.Secret = secret
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, signedRequest(t, "POST", "/v2/scans",
+			[]byte(`{"build_id":"abcde-1234","target":"https://shop","callback_urls":["https://ci.example.com/hook"]}`)))
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, `{"error":{"code":"invalid_request","message":"callback URLs can't be registered, `+
+			`webhooks need their own WEBHOOK_SECRET"}}`, response.Body.String())
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelledScanNotifiesWebhooks(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Webhooks.Secret = mockWebhookSecret
+	// The callback of httptest is on the loopback
+	cfg.Webhooks.AllowedNetworks = "127.0.0.0/8"
+	defer func() { cfg.Webhooks.AllowedNetworks = "" }()
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	delivered := make(chan *http.Request, 1)
+	payloads := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		delivered <- r
+		payloads <- body
+	}))
+	defer srv.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "45", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET status=?")).WithArgs("cancelled", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).AddRow(4, 1, srv.URL, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+		WithArgs(int64(4), int64(1), srv.URL, webhook.EventScanCompleted, 1, 200, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "DELETE", "/v2/scans/abcde-1234", nil))
+	assert.Equal(t, http.StatusAccepted, response.Code)
+
+	var r *http.Request
+	select {
+	case r = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook wasn't delivered")
+	}
+	body := <-payloads
+	ts, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+	assert.Nil(t, err)
+	signature, _ := webhook.Sign(mockWebhookSecret, ts, body)
+	assert.Equal(t, signature, r.Header.Get(webhook.SignatureHeader))
+	assert.Equal(t, webhook.EventScanCompleted, r.Header.Get(webhook.EventHeader))
+
+	var p webhook.Payload
+	assert.Nil(t, json.Unmarshal(body, &p))
+	assert.Equal(t, "abcde-1234", p.ScanID)
+	assert.Equal(t, "cancelled", p.Status)
+	assert.Nil(t, p.Score)
+	assert.Equal(t, webhook.Summary{Severities: map[string]int{}}, p.Summary)
+	assert.Equal(t, "/v2/scans/abcde-1234", p.Links["self"])
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+}
+
+func TestGetScanWebhooks(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_webhooks WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).AddRow(4, 1, "https://ci/hook", at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_deliveries WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "scan_id", "url", "event", "attempt",
+			"status_code", "error", "created_at"}).
+			AddRow(1, 4, 1, "https://ci/hook", "scan.completed", 1, 503, "unexpected status 503 Service Unavailable", at).
+			AddRow(2, 4, 1, "https://ci/hook", "scan.completed", 2, 503, "unexpected status 503 Service Unavailable", at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_dead_letters WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "scan_id", "url", "event", "payload", "attempts",
+			"last_error", "created_at"}).
+			AddRow(1, 4, 1, "https://ci/hook", "scan.completed", `{"status":"failed"}`, 2,
+				"unexpected status 503 Service Unavailable", at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_retries WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "scan_id", "url", "event", "payload", "attempt",
+			"last_error", "due_at"}).
+			AddRow(3, 5, 1, "https://ci/other", "scan.completed", `{"status":"failed"}`, 2, "connection refused",
+				at.Add(10*time.Second)))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "GET", "/scans/abcde-1234/webhooks", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"callback_urls":["https://ci/hook"],"dead_letters":[{"id":1,"url":"https://ci/hook",`+
+		`"event":"scan.completed","payload":{"status":"failed"},"attempts":2,`+
+		`"last_error":"unexpected status 503 Service Unavailable","created_at":"2026-10-19T10:00:00Z"}],`+
+		`"deliveries":[{"id":1,"url":"https://ci/hook","event":"scan.completed","attempt":1,"status_code":503,`+
+		`"error":"unexpected status 503 Service Unavailable","created_at":"2026-10-19T10:00:00Z"},`+
+		`{"id":2,"url":"https://ci/hook","event":"scan.completed","attempt":2,"status_code":503,`+
+		`"error":"unexpected status 503 Service Unavailable","created_at":"2026-10-19T10:00:00Z"}],`+
+		`"retries":[{"id":3,"url":"https://ci/other","event":"scan.completed","attempt":2,`+
+		`"last_error":"connection refused","due_at":"2026-10-19T10:00:10Z"}],"scan_id":"abcde-1234"}`,
+		response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReplayScanWebhooks(t *testing.T) {
+	cfg.HMACSecret = mockHMACSecret
+	cfg.Webhooks.Secret = ""
+	db, mock, _ := sqlmock.New()
+	clr := New(cfg, zapSVMock{}, db, db)
+	router := CreateURLMappings(clr, cfg)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/webhooks/replay", nil))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, `{"reason":"webhooks are off, WEBHOOK_SECRET isn't set","status":"failed"}`, response.Body.String())
+
+	cfg.Webhooks.Secret = mockWebhookSecret
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(scanDetailsColumns).
+			AddRow(1, "failed", "abcde-1234", "github", "shop", "https://shop", 7, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_retries(")).WithArgs(sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_dead_letters WHERE scan_id=?")).WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, signedRequest(t, "POST", "/scans/abcde-1234/webhooks/replay", nil))
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, `{"replayed":2,"scan_id":"abcde-1234","status":"replaying"}`, response.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
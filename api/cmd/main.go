@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
@@ -44,12 +46,33 @@ func main() {
 	log.Println("[MAIN] ZAP connection attempt completed")
 
 	clr := controller.New(cfg, zap, dbConnRO, dbConnRW)
+	if cfg.CatalogRefreshSeconds > 0 {
+		go clr.WatchCatalog(time.Duration(cfg.CatalogRefreshSeconds) * time.Second)
+	}
+	if dbConnRW != nil {
+		go clr.WatchReleases(time.Minute)
+		go clr.WatchArtifacts(time.Hour)
+		go clr.WatchWebhooks(5 * time.Second)
+	}
 
 	log.Println("[MAIN] Creating URL mappings...")
 
 	r := controller.CreateURLMappingsProd(clr, cfg)
 	log.Println("[MAIN] URL mappings created successfully")
 
+	if cfg.GRPCPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("[MAIN] Running gRPC server on port %d...", cfg.GRPCPort)
+		go func() {
+			if err := controller.NewGRPCServer(clr, cfg).Serve(lis); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	log.Println("[MAIN] Running server...")
 	err = r.Run()
 	if err != nil {
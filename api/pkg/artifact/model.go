@@ -0,0 +1,60 @@
+package artifact
+
+import (
+	"errors"
+	"time"
+)
+
+// Storage backends accepted by NewStore. With BackendNone scans aren't archived.
+const (
+	BackendNone       = "none"
+	BackendFilesystem = "filesystem"
+	BackendS3         = "s3"
+)
+
+// Artifact kinds archived for a scan.
+const (
+	KindReport = "zap-report"
+	KindAlerts = "alerts"
+	KindHTML   = "html-report"
+)
+
+// ErrNotFound is returned by a Store when there is no object with the key.
+var ErrNotFound = errors.New("artifact not found")
+
+// Store keeps artifact contents by key. Keys are slash separated and made by Key, so they are safe
+// as file paths and object names. Stores that can lock objects keep them from being deleted before
+// retainUntil; Delete of a missing key isn't an error.
+type Store interface {
+	Put(key string, data []byte, contentType string, retainUntil time.Time) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Artifact is a file archived for a scan, as stored in scan_artifacts. The content lives in the
+// Store under StorageKey, SHA256 is the hex digest of the content when it was archived.
+type Artifact struct {
+	ID          int64     `json:"-"`
+	ScanID      int64     `json:"-"`
+	Name        string    `json:"name"`
+	Kind        string    `json:"kind"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+	RetainUntil time.Time `json:"retain_until"`
+}
+
+// S3Options configures an S3 compatible store. Objects are addressed path style
+// (endpoint/bucket/key), which AWS and MinIO both accept. ObjectLock is the object lock mode,
+// GOVERNANCE or COMPLIANCE, objects are put with until their retention ends; the bucket must have
+// object lock enabled. Objects aren't locked when it's empty.
+type S3Options struct {
+	Endpoint   string
+	Region     string
+	Bucket     string
+	AccessKey  string
+	SecretKey  string
+	ObjectLock string
+}
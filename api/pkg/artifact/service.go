@@ -0,0 +1,155 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewStore returns the store for backend, or nil for BackendNone.
+func NewStore(backend string, dir string, s3 S3Options) (Store, error) {
+	switch backend {
+	case BackendNone, "":
+		return nil, nil
+	case BackendFilesystem:
+		if dir == "" {
+			return nil, fmt.Errorf("the filesystem artifact backend needs a directory")
+		}
+		return FileStore{Dir: dir}, nil
+	case BackendS3:
+		if s3.Bucket == "" {
+			return nil, fmt.Errorf("the s3 artifact backend needs a bucket")
+		}
+		if s3.ObjectLock != "" && s3.ObjectLock != "GOVERNANCE" && s3.ObjectLock != "COMPLIANCE" {
+			return nil, fmt.Errorf("invalid s3 object lock mode %q, use GOVERNANCE or COMPLIANCE", s3.ObjectLock)
+		}
+		return NewS3Store(s3), nil
+	}
+	return nil, fmt.Errorf("unknown artifact backend %q", backend)
+}
+
+// Key is where an artifact of a scan is stored: application/build ID/scan ID/name. Every part is
+// reduced to letters, digits, dots, dashes and underscores.
+func Key(application string, buildID string, scanID int64, name string) string {
+	if application == "" {
+		application = "default"
+	}
+	return strings.Join([]string{keyPart(application), keyPart(buildID), fmt.Sprint(scanID), keyPart(name)}, "/")
+}
+
+func keyPart(s string) string {
+	s = strings.Trim(unsafeKeyChars.ReplaceAllString(s, "_"), ".")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// Archive puts data in the store and records it for the scan. The artifact is kept at least
+// retention from now.
+func Archive(conn *sql.DB, store Store, a Artifact, data []byte, retention time.Duration) (Artifact, error) {
+	sum := sha256.Sum256(data)
+	a.Size = int64(len(data))
+	a.SHA256 = hex.EncodeToString(sum[:])
+	a.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	a.RetainUntil = a.CreatedAt.Add(retention)
+	if err := store.Put(a.StorageKey, data, a.ContentType, a.RetainUntil); err != nil {
+		return a, fmt.Errorf("error storing %s: %v", a.StorageKey, err)
+	}
+	id, err := AddArtifactToDB(conn, a)
+	a.ID = id
+	return a, err
+}
+
+// Expire deletes the contents and records of up to limit artifacts whose retention ended before
+// now, including those of deleted scans. It returns how many were deleted.
+func Expire(conn *sql.DB, store Store, now time.Time, limit int) (int, error) {
+	expired, err := GetExpiredArtifactsFromDB(conn, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	for i, a := range expired {
+		if err := store.Delete(a.StorageKey); err != nil {
+			return i, fmt.Errorf("error deleting %s: %v", a.StorageKey, err)
+		}
+		if err := DeleteArtifactFromDB(conn, a.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+func AddArtifactToDB(conn *sql.DB, a Artifact) (int64, error) {
+	q := "INSERT INTO scan_artifacts(scan_id, name, kind, storage_key, content_type, size, sha256, created_at, " +
+		"retain_until) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, a.ScanID, a.Name, a.Kind, a.StorageKey, a.ContentType, a.Size, a.SHA256, a.CreatedAt,
+		a.RetainUntil)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const artifactColumns = "id, scan_id, name, kind, storage_key, content_type, size, sha256, created_at, retain_until"
+
+func GetArtifactsFromDB(conn *sql.DB, scanID int64) ([]Artifact, error) {
+	q := "SELECT " + artifactColumns + " FROM scan_artifacts WHERE scan_id=? ORDER BY id"
+	artifacts := []Artifact{}
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return artifacts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanArtifact(rows)
+		if err != nil {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
+
+// GetExpiredArtifactsFromDB returns up to limit artifacts whose retention ended before now, oldest
+// first.
+func GetExpiredArtifactsFromDB(conn *sql.DB, now time.Time, limit int) ([]Artifact, error) {
+	q := "SELECT " + artifactColumns + " FROM scan_artifacts WHERE retain_until<? ORDER BY retain_until LIMIT ?"
+	artifacts := []Artifact{}
+	rows, err := conn.Query(q, now, limit)
+	if err != nil {
+		return artifacts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanArtifact(rows)
+		if err != nil {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
+
+func DeleteArtifactFromDB(conn *sql.DB, id int64) error {
+	_, err := conn.Exec("DELETE FROM scan_artifacts WHERE id=?", id)
+	return err
+}
+
+// GetArtifactFromDB returns sql.ErrNoRows when the scan has no artifact with the name.
+func GetArtifactFromDB(conn *sql.DB, scanID int64, name string) (Artifact, error) {
+	q := "SELECT " + artifactColumns + " FROM scan_artifacts WHERE scan_id=? AND name=? ORDER BY id DESC LIMIT 1"
+	return scanArtifact(conn.QueryRow(q, scanID, name))
+}
+
+func scanArtifact(row interface{ Scan(...interface{}) error }) (Artifact, error) {
+	var a Artifact
+	err := row.Scan(&a.ID, &a.ScanID, &a.Name, &a.Kind, &a.StorageKey, &a.ContentType, &a.Size, &a.SHA256,
+		&a.CreatedAt, &a.RetainUntil)
+	return a, err
+}
@@ -0,0 +1,39 @@
+package asset
+
+import (
+	"errors"
+	"time"
+)
+
+// Criticalities of an asset, how much a breach of it would hurt.
+const (
+	CriticalityLow      = "low"
+	CriticalityMedium   = "medium"
+	CriticalityHigh     = "high"
+	CriticalityCritical = "critical"
+)
+
+// ErrDuplicate is returned when the application of an asset is already registered.
+var ErrDuplicate = errors.New("application already registered")
+
+// Asset is an application of the registry, stored in assets with the application as its project.
+// Scans of the application are linked to it. Profile is the ZAP scan policy its scans use unless
+// they ask for another one. The DefectDojo product defaults to the application.
+type Asset struct {
+	ID                   int64         `json:"id"`
+	Application          string        `json:"application"`
+	Owner                string        `json:"owner"`
+	Repo                 string        `json:"repo"`
+	Environments         []Environment `json:"environments"`
+	Criticality          string        `json:"criticality"`
+	Profile              string        `json:"profile"`
+	DefectDojoProduct    string        `json:"defectdojo_product"`
+	DefectDojoEngagement string        `json:"defectdojo_engagement"`
+	CreatedAt            time.Time     `json:"created_at"`
+}
+
+// Environment is a deployment of an asset and the URL it's scanned at.
+type Environment struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
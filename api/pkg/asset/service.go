@@ -0,0 +1,194 @@
+package asset
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error of an insert breaking a unique key.
+const errDupEntry = 1062
+
+const assetColumns = "id, project, COALESCE(owner, ''), COALESCE(repo, ''), COALESCE(environments, '[]'), " +
+	"COALESCE(criticality, ''), COALESCE(profile, ''), COALESCE(defectdojo_product, ''), " +
+	"COALESCE(defectdojo_engagement, ''), created_at"
+
+// Validate checks an asset before it's stored. The criticality is required, the handlers default it
+// to medium.
+func Validate(a Asset) error {
+	if a.Application == "" {
+		return errors.New("application is required")
+	}
+	switch a.Criticality {
+	case CriticalityLow, CriticalityMedium, CriticalityHigh, CriticalityCritical:
+	default:
+		return fmt.Errorf("invalid criticality %q, use low, medium, high or critical", a.Criticality)
+	}
+	names := make(map[string]bool)
+	for _, e := range a.Environments {
+		if e.Name == "" {
+			return errors.New("environments need a name")
+		}
+		if names[e.Name] {
+			return fmt.Errorf("environment %q is listed twice", e.Name)
+		}
+		names[e.Name] = true
+		if u, err := url.Parse(e.Target); e.Target != "" && (err != nil || u.Host == "") {
+			return fmt.Errorf("environment %q has an invalid target", e.Name)
+		}
+	}
+	return nil
+}
+
+// AddAssetToDB registers an asset and links the scans of its application that were recorded
+// before. It returns ErrDuplicate when the application is already registered.
+func AddAssetToDB(conn *sql.DB, a Asset) (int64, error) {
+	var id int64
+	err := withTx(conn, func(tx *sql.Tx) error {
+		environments, err := json.Marshal(a.Environments)
+		if err != nil {
+			return err
+		}
+		q := "INSERT INTO assets(project, owner, repo, environments, criticality, profile, defectdojo_product, " +
+			"defectdojo_engagement, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		res, err := tx.Exec(q, a.Application, a.Owner, a.Repo, string(environments), a.Criticality, a.Profile,
+			nullable(a.DefectDojoProduct), nullable(a.DefectDojoEngagement), a.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return linkScans(tx, id, a.Application)
+	})
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDupEntry {
+		return -1, ErrDuplicate
+	}
+	return id, err
+}
+
+// GetAssetsFromDB lists the assets by application, only those of owner when it isn't empty.
+func GetAssetsFromDB(conn *sql.DB, owner string) ([]Asset, error) {
+	q := "SELECT " + assetColumns + " FROM assets"
+	var args []interface{}
+	if owner != "" {
+		q += " WHERE owner=?"
+		args = append(args, owner)
+	}
+	assets := []Asset{}
+	rows, err := conn.Query(q+" ORDER BY project", args...)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			return assets, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// GetAssetFromDB returns sql.ErrNoRows when the asset doesn't exist.
+func GetAssetFromDB(conn *sql.DB, id int64) (Asset, error) {
+	return scanAsset(conn.QueryRow("SELECT "+assetColumns+" FROM assets WHERE id=?", id))
+}
+
+// GetApplicationAssetFromDB returns the asset of an application, or sql.ErrNoRows when it isn't
+// registered.
+func GetApplicationAssetFromDB(conn *sql.DB, application string) (Asset, error) {
+	return scanAsset(conn.QueryRow("SELECT "+assetColumns+" FROM assets WHERE project=?", application))
+}
+
+// UpdateAssetInDB replaces an asset, linking the scans of its application that aren't linked yet
+// when it's renamed. It returns sql.ErrNoRows when the asset doesn't exist and ErrDuplicate when
+// the application is registered by another asset.
+func UpdateAssetInDB(conn *sql.DB, a Asset) error {
+	err := withTx(conn, func(tx *sql.Tx) error {
+		if err := lockAsset(tx, a.ID); err != nil {
+			return err
+		}
+		environments, err := json.Marshal(a.Environments)
+		if err != nil {
+			return err
+		}
+		q := "UPDATE assets SET project=?, owner=?, repo=?, environments=?, criticality=?, profile=?, " +
+			"defectdojo_product=?, defectdojo_engagement=? WHERE id=?"
+		if _, err := tx.Exec(q, a.Application, a.Owner, a.Repo, string(environments), a.Criticality, a.Profile,
+			nullable(a.DefectDojoProduct), nullable(a.DefectDojoEngagement), a.ID); err != nil {
+			return err
+		}
+		return linkScans(tx, a.ID, a.Application)
+	})
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDupEntry {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// DeleteAssetFromDB removes an asset, its scans are kept without it. It returns sql.ErrNoRows when
+// the asset doesn't exist.
+func DeleteAssetFromDB(conn *sql.DB, id int64) error {
+	return withTx(conn, func(tx *sql.Tx) error {
+		if err := lockAsset(tx, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE scans SET asset_id=NULL WHERE asset_id=?", id); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM assets WHERE id=?", id)
+		return err
+	})
+}
+
+func linkScans(tx *sql.Tx, id int64, application string) error {
+	_, err := tx.Exec("UPDATE scans SET asset_id=? WHERE asset_id IS NULL AND application=?", id, application)
+	return err
+}
+
+func lockAsset(tx *sql.Tx, id int64) error {
+	return tx.QueryRow("SELECT id FROM assets WHERE id=? FOR UPDATE", id).Scan(&id)
+}
+
+func scanAsset(row interface{ Scan(...interface{}) error }) (Asset, error) {
+	var a Asset
+	var environments string
+	err := row.Scan(&a.ID, &a.Application, &a.Owner, &a.Repo, &environments, &a.Criticality, &a.Profile,
+		&a.DefectDojoProduct, &a.DefectDojoEngagement, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+	a.Environments = []Environment{}
+	if err := json.Unmarshal([]byte(environments), &a.Environments); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// nullable stores empty DefectDojo names as NULL, so the defaults apply.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func withTx(conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,109 @@
+package asset
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var assetRows = []string{"id", "project", "owner", "repo", "environments", "criticality", "profile",
+	"defectdojo_product", "defectdojo_engagement", "created_at"}
+
+func TestValidate(t *testing.T) {
+	envs := []Environment{{Name: "prod", Target: "https://shop"}, {Name: "staging"}}
+	assert.Nil(t, Validate(Asset{Application: "shop", Criticality: CriticalityHigh, Environments: envs}))
+	assert.NotNil(t, Validate(Asset{Criticality: CriticalityHigh}))
+	assert.NotNil(t, Validate(Asset{Application: "shop", Criticality: "severe"}))
+	assert.NotNil(t, Validate(Asset{Application: "shop", Criticality: CriticalityLow,
+		Environments: []Environment{{Name: "prod"}, {Name: "prod"}}}))
+	assert.NotNil(t, Validate(Asset{Application: "shop", Criticality: CriticalityLow,
+		Environments: []Environment{{Name: "prod", Target: "shop"}}}))
+}
+
+func TestAddAssetLinksEarlierScans(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO assets(")).
+		WithArgs("shop", "team-shop", "github.com/acme/shop", `[{"name":"prod","target":"https://shop"}]`,
+			CriticalityHigh, "api-only", nil, nil, at).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET asset_id=? WHERE asset_id IS NULL AND application=?")).
+		WithArgs(int64(4), "shop").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	id, err := AddAssetToDB(db, Asset{Application: "shop", Owner: "team-shop", Repo: "github.com/acme/shop",
+		Environments: []Environment{{Name: "prod", Target: "https://shop"}}, Criticality: CriticalityHigh,
+		Profile: "api-only", CreatedAt: at})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestAddDuplicateAsset(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO assets(")).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'shop'"})
+	mock.ExpectRollback()
+
+	_, err := AddAssetToDB(db, Asset{Application: "shop", Criticality: CriticalityMedium})
+
+	assert.Equal(t, ErrDuplicate, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAssetsFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM assets WHERE owner=? ORDER BY project")).WithArgs("team-shop").
+		WillReturnRows(sqlmock.NewRows(assetRows).
+			AddRow(4, "shop", "team-shop", "", "[]", "medium", "", "Shop", "", at).
+			AddRow(5, "cart", "team-shop", "", `[{"name":"prod","target":"https://cart"}]`, "high", "", "", "", at))
+
+	assets, err := GetAssetsFromDB(db, "team-shop")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Asset{
+		{ID: 4, Application: "shop", Owner: "team-shop", Environments: []Environment{}, Criticality: "medium",
+			DefectDojoProduct: "Shop", CreatedAt: at},
+		{ID: 5, Application: "cart", Owner: "team-shop", Environments: []Environment{{Name: "prod",
+			Target: "https://cart"}}, Criticality: "high", CreatedAt: at},
+	}, assets)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAssetUnlinksScans(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM assets WHERE id=? FOR UPDATE")).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scans SET asset_id=NULL WHERE asset_id=?")).WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM assets WHERE id=?")).WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, DeleteAssetFromDB(db, 4))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMissingAssetRollsBack(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM assets WHERE id=? FOR UPDATE")).WithArgs(int64(404)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	err := UpdateAssetInDB(db, Asset{ID: 404, Application: "shop", Criticality: CriticalityLow})
+
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
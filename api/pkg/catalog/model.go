@@ -0,0 +1,68 @@
+package catalog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	versionKey = "catalog_version"
+
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionImport = "import"
+)
+
+// ErrInUse is returned when an entry can't be deleted because findings reference it.
+var ErrInUse = errors.New("vulnerability referenced by findings")
+
+var Severities = map[string]bool{
+	"low":      true,
+	"medium":   true,
+	"high":     true,
+	"critical": true,
+}
+
+// Entry is a row of the vulnerabilities table. Alerts are matched by ZAP plugin ID first and by
+// CWE when no entry exists for the plugin. Unclassified entries are created automatically for
+// unmapped alerts and are still scored by the unmapped policy until someone curates them.
+type Entry struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	CweID        int    `json:"cwe_id"`
+	PluginID     string `json:"plugin_id"`
+	Severity     string `json:"severity"`
+	Score        int    `json:"score"`
+	Unclassified bool   `json:"unclassified"`
+	Solution     string `json:"solution,omitempty"`
+}
+
+// AuditRecord describes a change to the catalog and who made it.
+type AuditRecord struct {
+	ID              int64     `json:"id"`
+	VulnerabilityID int64     `json:"vulnerability_id"`
+	Actor           string    `json:"actor"`
+	Action          string    `json:"action"`
+	OldScore        *int      `json:"old_score"`
+	NewScore        *int      `json:"new_score"`
+	Details         string    `json:"details"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Snapshot is an immutable view of the catalog used to score a scan.
+type Snapshot struct {
+	Version  int64
+	byID     map[int64]Entry
+	byPlugin map[string]Entry
+	byCWE    map[string]Entry
+}
+
+// Cache keeps the catalog in memory and reloads it when the version stored in the database
+// changes, which is how updates made on one replica reach the others.
+type Cache struct {
+	mu       sync.RWMutex
+	loaded   bool
+	snapshot Snapshot
+}
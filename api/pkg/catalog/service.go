@@ -0,0 +1,362 @@
+package catalog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error of a delete breaking a foreign key.
+const errRowReferenced = 1451
+
+const entryColumns = "id, COALESCE(name, ''), cwe_id, COALESCE(plugin_id, ''), severity, score, unclassified, COALESCE(solution, '')"
+
+// NewSnapshot indexes entries by plugin ID and CWE. When several entries share a CWE, entries
+// without a plugin ID take precedence and the last one wins, as the original CWE map did.
+func NewSnapshot(version int64, entries []Entry) Snapshot {
+	s := Snapshot{
+		Version:  version,
+		byID:     make(map[int64]Entry),
+		byPlugin: make(map[string]Entry),
+		byCWE:    make(map[string]Entry),
+	}
+	for _, e := range entries {
+		s.byID[e.ID] = e
+		if e.PluginID != "" {
+			s.byPlugin[e.PluginID] = e
+		}
+	}
+	for _, e := range entries {
+		cwe := strconv.Itoa(e.CweID)
+		if current, ok := s.byCWE[cwe]; ok && current.PluginID == "" && e.PluginID != "" {
+			continue
+		}
+		s.byCWE[cwe] = e
+	}
+	return s
+}
+
+// Lookup finds the catalog entry for an alert, by plugin ID first and then by CWE.
+func (s Snapshot) Lookup(pluginID string, cweID string) (Entry, bool) {
+	if pluginID != "" {
+		if e, ok := s.byPlugin[pluginID]; ok {
+			return e, true
+		}
+	}
+	e, ok := s.byCWE[cweID]
+	return e, ok
+}
+
+func (s Snapshot) ByID(id int64) (Entry, bool) {
+	e, ok := s.byID[id]
+	return e, ok
+}
+
+func (s Snapshot) Len() int {
+	return len(s.byID)
+}
+
+func (c *Cache) Snapshot() Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snapshot
+}
+
+// Refresh reloads the catalog if its version in the database differs from the cached one.
+// It reports whether a reload happened.
+func (c *Cache) Refresh(conn *sql.DB) (bool, error) {
+	v, err := GetVersionFromDB(conn)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	current := c.loaded && c.snapshot.Version == v
+	c.mu.RUnlock()
+	if current {
+		return false, nil
+	}
+	return true, c.load(conn, v)
+}
+
+// Load unconditionally reloads the catalog.
+func (c *Cache) Load(conn *sql.DB) error {
+	v, err := GetVersionFromDB(conn)
+	if err != nil {
+		return err
+	}
+	return c.load(conn, v)
+}
+
+func (c *Cache) load(conn *sql.DB, version int64) error {
+	entries, err := GetEntriesFromDB(conn)
+	if err != nil {
+		return err
+	}
+	s := NewSnapshot(version, entries)
+	c.mu.Lock()
+	c.snapshot = s
+	c.loaded = true
+	c.mu.Unlock()
+	return nil
+}
+
+func Validate(e Entry) error {
+	if e.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !Severities[e.Severity] {
+		return fmt.Errorf("invalid severity %q", e.Severity)
+	}
+	if e.Score < 0 {
+		return fmt.Errorf("score must not be negative")
+	}
+	if e.CweID < 0 {
+		return fmt.Errorf("cwe_id must not be negative")
+	}
+	return nil
+}
+
+func GetVersionFromDB(conn *sql.DB) (int64, error) {
+	var v string
+	q := "SELECT value FROM configurations WHERE `key`=?"
+	err := conn.QueryRow(q, versionKey).Scan(&v)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func GetEntriesFromDB(conn *sql.DB) ([]Entry, error) {
+	q := "SELECT " + entryColumns + " FROM vulnerabilities ORDER BY id"
+	var entries []Entry
+	rows, err := conn.Query(q)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Name, &e.CweID, &e.PluginID, &e.Severity, &e.Score,
+			&e.Unclassified, &e.Solution); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetEntryFromDB returns sql.ErrNoRows when the entry doesn't exist.
+func GetEntryFromDB(conn *sql.DB, id int64) (Entry, error) {
+	var e Entry
+	q := "SELECT " + entryColumns + " FROM vulnerabilities WHERE id=?"
+	err := conn.QueryRow(q, id).Scan(&e.ID, &e.Name, &e.CweID, &e.PluginID, &e.Severity, &e.Score,
+		&e.Unclassified, &e.Solution)
+	return e, err
+}
+
+func AddEntryToDB(conn *sql.DB, e Entry, actor string) (int64, error) {
+	var id int64
+	err := withTx(conn, func(tx *sql.Tx) error {
+		var err error
+		id, err = insertEntry(tx, e, actor, ActionCreate)
+		if err != nil {
+			return err
+		}
+		return bumpVersion(tx)
+	})
+	return id, err
+}
+
+// UpdateEntryInDB returns sql.ErrNoRows when the entry doesn't exist.
+func UpdateEntryInDB(conn *sql.DB, e Entry, actor string) error {
+	return withTx(conn, func(tx *sql.Tx) error {
+		if err := updateEntry(tx, e, actor, ActionUpdate); err != nil {
+			return err
+		}
+		return bumpVersion(tx)
+	})
+}
+
+// DeleteEntryFromDB returns sql.ErrNoRows when the entry doesn't exist and ErrInUse when findings
+// reference it.
+func DeleteEntryFromDB(conn *sql.DB, id int64, actor string) error {
+	err := withTx(conn, func(tx *sql.Tx) error {
+		old, err := lockEntry(tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM vulnerabilities WHERE id=?", id); err != nil {
+			return err
+		}
+		if err := addAudit(tx, id, actor, ActionDelete, &old, nil); err != nil {
+			return err
+		}
+		return bumpVersion(tx)
+	})
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errRowReferenced {
+		return ErrInUse
+	}
+	return err
+}
+
+// ImportEntriesToDB updates entries that carry an ID and creates the rest, in a single
+// transaction. It returns the number of created and updated entries.
+func ImportEntriesToDB(conn *sql.DB, entries []Entry, actor string) (int, int, error) {
+	created, updated := 0, 0
+	err := withTx(conn, func(tx *sql.Tx) error {
+		for _, e := range entries {
+			if e.ID > 0 {
+				if err := updateEntry(tx, e, actor, ActionImport); err != nil {
+					return fmt.Errorf("entry %d: %v", e.ID, err)
+				}
+				updated++
+				continue
+			}
+			if _, err := insertEntry(tx, e, actor, ActionImport); err != nil {
+				return fmt.Errorf("entry %q: %v", e.Name, err)
+			}
+			created++
+		}
+		return bumpVersion(tx)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// GetAuditFromDB lists catalog changes, newest first. A vulnerabilityID of 0 lists all changes.
+func GetAuditFromDB(conn *sql.DB, vulnerabilityID int64) ([]AuditRecord, error) {
+	q := "SELECT id, vulnerability_id, actor, action, old_score, new_score, details, created_at " +
+		"FROM vulnerability_audit"
+	var args []interface{}
+	if vulnerabilityID > 0 {
+		q += " WHERE vulnerability_id=?"
+		args = append(args, vulnerabilityID)
+	}
+	q += " ORDER BY id DESC"
+	var records []AuditRecord
+	rows, err := conn.Query(q, args...)
+	if err != nil {
+		return records, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r AuditRecord
+		var oldScore, newScore sql.NullInt64
+		err := rows.Scan(&r.ID, &r.VulnerabilityID, &r.Actor, &r.Action, &oldScore, &newScore, &r.Details,
+			&r.CreatedAt)
+		if err != nil {
+			return records, err
+		}
+		r.OldScore = nullableScore(oldScore)
+		r.NewScore = nullableScore(newScore)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func withTx(conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertEntry(tx *sql.Tx, e Entry, actor string, action string) (int64, error) {
+	q := "INSERT INTO vulnerabilities(name, cwe_id, plugin_id, severity, score, unclassified, solution) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?)"
+	res, err := tx.Exec(q, e.Name, e.CweID, nullablePluginID(e.PluginID), e.Severity, e.Score, e.Unclassified,
+		e.Solution)
+	if err != nil {
+		return -1, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+	e.ID = id
+	return id, addAudit(tx, id, actor, action, nil, &e)
+}
+
+func updateEntry(tx *sql.Tx, e Entry, actor string, action string) error {
+	old, err := lockEntry(tx, e.ID)
+	if err != nil {
+		return err
+	}
+	q := "UPDATE vulnerabilities SET name=?, cwe_id=?, plugin_id=?, severity=?, score=?, unclassified=?, " +
+		"solution=? WHERE id=?"
+	_, err = tx.Exec(q, e.Name, e.CweID, nullablePluginID(e.PluginID), e.Severity, e.Score, e.Unclassified,
+		e.Solution, e.ID)
+	if err != nil {
+		return err
+	}
+	return addAudit(tx, e.ID, actor, action, &old, &e)
+}
+
+func lockEntry(tx *sql.Tx, id int64) (Entry, error) {
+	var e Entry
+	q := "SELECT " + entryColumns + " FROM vulnerabilities WHERE id=? FOR UPDATE"
+	err := tx.QueryRow(q, id).Scan(&e.ID, &e.Name, &e.CweID, &e.PluginID, &e.Severity, &e.Score,
+		&e.Unclassified, &e.Solution)
+	return e, err
+}
+
+func addAudit(tx *sql.Tx, id int64, actor string, action string, before *Entry, after *Entry) error {
+	var oldScore, newScore interface{}
+	if before != nil {
+		oldScore = before.Score
+	}
+	if after != nil {
+		newScore = after.Score
+	}
+	details, err := json.Marshal(map[string]*Entry{"before": before, "after": after})
+	if err != nil {
+		return err
+	}
+	q := "INSERT INTO vulnerability_audit(vulnerability_id, actor, action, old_score, new_score, details) " +
+		"VALUES (?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(q, id, actor, action, oldScore, newScore, string(details))
+	return err
+}
+
+func bumpVersion(tx *sql.Tx) error {
+	q := "UPDATE configurations SET value=CAST(value AS UNSIGNED)+1 WHERE `key`=?"
+	res, err := tx.Exec(q, versionKey)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO configurations(`key`, value) VALUES (?, '1')", versionKey)
+	return err
+}
+
+func nullablePluginID(pluginID string) interface{} {
+	if pluginID == "" {
+		return nil
+	}
+	return pluginID
+}
+
+func nullableScore(s sql.NullInt64) *int {
+	if !s.Valid {
+		return nil
+	}
+	v := int(s.Int64)
+	return &v
+}
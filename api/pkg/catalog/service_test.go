@@ -0,0 +1,166 @@
+package catalog
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var entryRows = []string{"id", "name", "cwe_id", "plugin_id", "severity", "score", "unclassified", "solution"}
+
+func TestSnapshotLookupPrefersPluginID(t *testing.T) {
+	s := NewSnapshot(1, []Entry{
+		{ID: 1, Name: "SQL Injection", CweID: 89, Severity: "critical", Score: 20},
+		{ID: 2, Name: "SQL Injection - SQLite", CweID: 89, PluginID: "40024", Severity: "critical", Score: 8},
+		{ID: 3, Name: "Directory Browsing", CweID: 548, Severity: "high", Score: 1},
+	})
+
+	e, ok := s.Lookup("40024", "89")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), e.ID)
+
+	e, ok = s.Lookup("40018", "89")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), e.ID)
+
+	e, ok = s.Lookup("", "548")
+	assert.True(t, ok)
+	assert.Equal(t, 1, e.Score)
+
+	_, ok = s.Lookup("10038", "693")
+	assert.False(t, ok)
+}
+
+func TestCacheRefreshOnlyReloadsOnVersionChange(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	versionQuery := regexp.QuoteMeta("SELECT value FROM configurations WHERE `key`=?")
+	entriesQuery := regexp.QuoteMeta("FROM vulnerabilities ORDER BY id")
+
+	mock.ExpectQuery(versionQuery).WithArgs(versionKey).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("4"))
+	mock.ExpectQuery(entriesQuery).
+		WillReturnRows(sqlmock.NewRows(entryRows).AddRow(1, "SQL Injection", 89, "", "critical", 20, false, ""))
+	mock.ExpectQuery(versionQuery).WithArgs(versionKey).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("4"))
+	mock.ExpectQuery(versionQuery).WithArgs(versionKey).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("5"))
+	mock.ExpectQuery(entriesQuery).
+		WillReturnRows(sqlmock.NewRows(entryRows).AddRow(1, "SQL Injection", 89, "", "critical", 4, false, ""))
+
+	c := &Cache{}
+	reloaded, err := c.Refresh(db)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+
+	reloaded, err = c.Refresh(db)
+	assert.Nil(t, err)
+	assert.False(t, reloaded)
+
+	reloaded, err = c.Refresh(db)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+
+	e, _ := c.Snapshot().Lookup("", "89")
+	assert.Equal(t, 4, e.Score)
+	assert.Equal(t, int64(5), c.Snapshot().Version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEntryAuditsScoreChangeAndBumpsVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerabilities WHERE id=? FOR UPDATE")).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows(entryRows).AddRow(9, "Path Traversal", 22, "", "high", 4, false, ""))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerabilities SET")).
+		WithArgs("Path Traversal", 22, "6", "high", 8, false, "", int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vulnerability_audit")).
+		WithArgs(int64(9), "alice", ActionUpdate, 4, 8, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE configurations SET value=CAST(value AS UNSIGNED)+1")).
+		WithArgs(versionKey).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := Entry{ID: 9, Name: "Path Traversal", CweID: 22, PluginID: "6", Severity: "high", Score: 8}
+	err := UpdateEntryInDB(db, e, "alice")
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMissingEntryRollsBack(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerabilities WHERE id=? FOR UPDATE")).WithArgs(int64(404)).
+		WillReturnRows(sqlmock.NewRows(entryRows))
+	mock.ExpectRollback()
+
+	err := UpdateEntryInDB(db, Entry{ID: 404, Name: "x", Severity: "low"}, "alice")
+
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteReferencedEntry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerabilities WHERE id=? FOR UPDATE")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(entryRows).AddRow(7, "XSS", 79, "40012", "high", 8, false, ""))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM vulnerabilities WHERE id=?")).WithArgs(int64(7)).
+		WillReturnError(&mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"})
+	mock.ExpectRollback()
+
+	err := DeleteEntryFromDB(db, 7, "alice")
+
+	assert.Equal(t, ErrInUse, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate(Entry{Name: "XSS", CweID: 79, Severity: "medium"}))
+	assert.NotNil(t, Validate(Entry{CweID: 79, Severity: "medium"}))
+	assert.NotNil(t, Validate(Entry{Name: "XSS", CweID: 79, Severity: "severe"}))
+	assert.NotNil(t, Validate(Entry{Name: "XSS", CweID: 79, Severity: "low", Score: -1}))
+}
+
+func TestUnmappedPolicyScores(t *testing.T) {
+	ignore, err := NewUnmappedPolicy("ignore", "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ignore.Score("High"))
+	assert.False(t, ignore.FailsScan(3))
+
+	risk, err := NewUnmappedPolicy("risk", `{"High": 20, "2": 5}`, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, risk.Score("3"))
+	assert.Equal(t, 5, risk.Score("Medium"))
+	assert.Equal(t, 0, risk.Score("Low"))
+
+	fail, err := NewUnmappedPolicy("fail", "", false)
+	assert.Nil(t, err)
+	assert.True(t, fail.FailsScan(1))
+	assert.False(t, fail.FailsScan(0))
+
+	_, err = NewUnmappedPolicy("panic", "", false)
+	assert.NotNil(t, err)
+}
+
+func TestUnclassifiedEntry(t *testing.T) {
+	p, _ := NewUnmappedPolicy("risk", "", true)
+
+	e := p.Unclassified("10038", "Content Security Policy (CSP) Header Not Set", "693", "Medium")
+
+	assert.Equal(t, Entry{
+		Name:         "Unclassified: Content Security Policy (CSP) Header Not Set",
+		CweID:        693,
+		PluginID:     "10038",
+		Severity:     "medium",
+		Score:        4,
+		Unclassified: true,
+	}, e)
+	assert.Equal(t, "low", p.Unclassified("10096", "Timestamp Disclosure", "200", "Informational").Severity)
+}
@@ -0,0 +1,133 @@
+package catalog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/pkg/scoring"
+)
+
+// Actions for alerts that have no catalog entry, or only an unclassified one.
+const (
+	UnmappedIgnore = "ignore" // unmapped alerts score 0
+	UnmappedRisk   = "risk"   // unmapped alerts score by their ZAP risk level
+	UnmappedFail   = "fail"   // any unmapped alert fails the scan
+)
+
+// SystemActor is recorded in the audit trail for entries created by the API itself.
+const SystemActor = "dast-api"
+
+// DefaultRiskScores are used by the risk action when no scores are configured.
+var DefaultRiskScores = map[string]int{
+	scoring.RiskHigh:          8,
+	scoring.RiskMedium:        4,
+	scoring.RiskLow:           1,
+	scoring.RiskInformational: 0,
+}
+
+// UnmappedPolicy decides how alerts missing from the catalog are scored.
+type UnmappedPolicy struct {
+	Action     string
+	RiskScores map[string]int
+	AutoCreate bool
+}
+
+// UnmappedAlert is a plugin reported by scans that the catalog doesn't classify yet.
+type UnmappedAlert struct {
+	PluginID        string `json:"plugin_id"`
+	Name            string `json:"name"`
+	CweID           string `json:"cwe_id"`
+	VulnerabilityID *int64 `json:"vulnerability_id"`
+	Findings        int    `json:"findings"`
+	Scans           int    `json:"scans"`
+	LastScanID      int64  `json:"last_scan_id"`
+}
+
+// NewUnmappedPolicy builds the policy from configuration values. riskScoresJSON optionally
+// overrides DefaultRiskScores, e.g. {"High": 20, "Medium": 4}.
+func NewUnmappedPolicy(action string, riskScoresJSON string, autoCreate bool) (UnmappedPolicy, error) {
+	p := UnmappedPolicy{Action: UnmappedIgnore, RiskScores: DefaultRiskScores, AutoCreate: autoCreate}
+	switch strings.ToLower(action) {
+	case "", UnmappedIgnore:
+	case UnmappedRisk, UnmappedFail:
+		p.Action = strings.ToLower(action)
+	default:
+		return p, fmt.Errorf("unknown unmapped alert policy %q", action)
+	}
+	if riskScoresJSON != "" {
+		var raw map[string]int
+		if err := json.Unmarshal([]byte(riskScoresJSON), &raw); err != nil {
+			return p, fmt.Errorf("error parsing unmapped risk scores: %v", err)
+		}
+		p.RiskScores = make(map[string]int)
+		for risk, score := range raw {
+			p.RiskScores[scoring.NormalizeRisk(risk)] = score
+		}
+	}
+	return p, nil
+}
+
+// Score is the score of an unmapped alert.
+func (p UnmappedPolicy) Score(risk string) int {
+	if p.Action != UnmappedRisk {
+		return 0
+	}
+	return p.RiskScores[scoring.NormalizeRisk(risk)]
+}
+
+// FailsScan reports whether unmapped alerts fail a scan on their own.
+func (p UnmappedPolicy) FailsScan(unmapped int) bool {
+	return p.Action == UnmappedFail && unmapped > 0
+}
+
+// Unclassified builds the catalog entry created for an unmapped alert.
+func (p UnmappedPolicy) Unclassified(pluginID string, name string, cweID string, risk string) Entry {
+	cwe, _ := strconv.Atoi(cweID)
+	severity := scoring.NormalizeRisk(risk)
+	if !Severities[severity] {
+		severity = "low"
+	}
+	return Entry{
+		Name:         "Unclassified: " + name,
+		CweID:        cwe,
+		PluginID:     pluginID,
+		Severity:     severity,
+		Score:        p.Score(risk),
+		Unclassified: true,
+	}
+}
+
+// GetUnmappedFromDB reports the plugins whose findings have no catalog entry or an unclassified
+// one, most frequent first, so the catalog can be curated.
+func GetUnmappedFromDB(conn *sql.DB, since time.Time) ([]UnmappedAlert, error) {
+	q := "SELECT f.plugin_id, MAX(COALESCE(f.name, '')), MAX(COALESCE(f.cwe_id, '')), MAX(v.id), " +
+		"COUNT(*), COUNT(DISTINCT f.scan_id), MAX(f.scan_id) " +
+		"FROM vulnerability_findings f " +
+		"LEFT JOIN vulnerabilities v ON f.vulnerability_id=v.id " +
+		"JOIN scans s ON f.scan_id=s.id " +
+		"WHERE (v.id IS NULL OR v.unclassified=1) AND s.created_at>=? " +
+		"GROUP BY f.plugin_id ORDER BY COUNT(*) DESC"
+	var alerts []UnmappedAlert
+	rows, err := conn.Query(q, since)
+	if err != nil {
+		return alerts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a UnmappedAlert
+		var id sql.NullInt64
+		err := rows.Scan(&a.PluginID, &a.Name, &a.CweID, &id, &a.Findings, &a.Scans, &a.LastScanID)
+		if err != nil {
+			return alerts, err
+		}
+		if id.Valid {
+			a.VulnerabilityID = &id.Int64
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
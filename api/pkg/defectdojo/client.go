@@ -0,0 +1,105 @@
+package defectdojo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	importPath   = "/api/v2/import-scan/"
+	reimportPath = "/api/v2/reimport-scan/"
+	dateLayout   = "2006-01-02"
+)
+
+// Client uploads reports to the DefectDojo v2 REST API, authenticated with an API key.
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewClient(url string, token string) *Client {
+	return &Client{url: strings.TrimRight(url, "/"), token: token, client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+// Import uploads a Generic Findings Import report. Reimports close the findings of the test that
+// the report no longer contains, so the test follows the latest scan.
+func (c *Client) Import(report []byte, opts ImportOptions) (ImportResult, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fields := [][2]string{{"scan_type", ScanType}, {"minimum_severity", "Info"}}
+	if !opts.ScanDate.IsZero() {
+		fields = append(fields, [2]string{"scan_date", opts.ScanDate.Format(dateLayout)})
+	}
+	path := importPath
+	if opts.TestID > 0 {
+		path = reimportPath
+		fields = append(fields, [2]string{"test", strconv.FormatInt(opts.TestID, 10)})
+	} else {
+		fields = append(fields, [][2]string{
+			{"product_name", opts.Product},
+			{"engagement_name", opts.Engagement},
+			{"test_title", opts.TestTitle},
+			{"auto_create_context", "true"},
+		}...)
+	}
+	for _, f := range fields {
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			return ImportResult{}, err
+		}
+	}
+	fw, err := mw.CreateFormFile("file", "report.json")
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if _, err := fw.Write(report); err != nil {
+		return ImportResult{}, err
+	}
+	if err := mw.Close(); err != nil {
+		return ImportResult{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url+path, &body)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return ImportResult{}, dojoError(res)
+	}
+	var result ImportResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return ImportResult{}, fmt.Errorf("defectdojo %s: invalid response: %w", path, err)
+	}
+	// Older releases only return the test as "test"
+	if result.TestID == 0 {
+		result.TestID = result.Test
+	}
+	if result.TestID == 0 {
+		result.TestID = opts.TestID
+	}
+	return result, nil
+}
+
+func dojoError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return fmt.Errorf("defectdojo %s: unexpected status %s", res.Request.URL.Path, res.Status)
+	}
+	return fmt.Errorf("defectdojo %s: unexpected status %s: %s", res.Request.URL.Path, res.Status, msg)
+}
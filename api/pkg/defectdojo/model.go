@@ -0,0 +1,57 @@
+package defectdojo
+
+import (
+	"errors"
+	"time"
+)
+
+// ScanType is the DefectDojo parser reports are imported with, report.WriteDefectDojo's format.
+const ScanType = "Generic Findings Import"
+
+// DefaultEngagement is used for assets that don't name an engagement.
+const DefaultEngagement = "DAST"
+
+// ErrNoMapping is returned when no asset maps the application of a scan to a DefectDojo product.
+var ErrNoMapping = errors.New("no asset maps the application to a DefectDojo product")
+
+// Mapping names the DefectDojo product and engagement the scans of an asset are pushed to. It
+// comes from the defectdojo_product and defectdojo_engagement columns of assets, the product
+// defaults to the asset's project.
+type Mapping struct {
+	Product    string
+	Engagement string
+}
+
+// ImportOptions describes one upload. With a TestID the report is reimported into that test,
+// otherwise a new test is created in the product and engagement, which DefectDojo creates when
+// they don't exist yet.
+type ImportOptions struct {
+	Product    string
+	Engagement string
+	TestTitle  string
+	TestID     int64
+	ScanDate   time.Time
+}
+
+// ImportResult is the part of the import-scan and reimport-scan responses that identifies where
+// the findings went.
+type ImportResult struct {
+	TestID       int64 `json:"test_id"`
+	Test         int64 `json:"test"`
+	EngagementID int64 `json:"engagement_id"`
+	ProductID    int64 `json:"product_id"`
+}
+
+// Push records a report uploaded to DefectDojo, as stored in defectdojo_pushes. Later pushes of
+// the application to the same engagement reimport into TestID.
+type Push struct {
+	ID          int64     `json:"-"`
+	ScanID      int64     `json:"-"`
+	Application string    `json:"application"`
+	Product     string    `json:"product"`
+	Engagement  string    `json:"engagement"`
+	TestID      int64     `json:"test_id"`
+	Reimport    bool      `json:"reimport"`
+	Findings    int       `json:"findings"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,123 @@
+package defectdojo
+
+import (
+	"bytes"
+	"database/sql"
+	"time"
+
+	"src/pkg/report"
+)
+
+// PushReport uploads the report of a finished scan to the product and engagement its asset maps
+// to. The first push of an application to an engagement creates a test, later ones reimport into
+// it so DefectDojo tracks the findings across scans.
+func PushReport(ro *sql.DB, rw *sql.DB, c *Client, r report.Report, defaultEngagement string) (Push, error) {
+	m, err := GetMappingFromDB(ro, r.Scan.ID, defaultEngagement)
+	if err != nil {
+		return Push{}, err
+	}
+	var b bytes.Buffer
+	if err := report.WriteDefectDojo(&b, r); err != nil {
+		return Push{}, err
+	}
+	p := Push{
+		ScanID:      r.Scan.ID,
+		Application: r.Scan.Application,
+		Product:     m.Product,
+		Engagement:  m.Engagement,
+		Findings:    len(r.Findings),
+	}
+	last, err := GetLastPushFromDB(ro, r.Scan.Application, m)
+	if err != nil && err != sql.ErrNoRows {
+		return Push{}, err
+	}
+	opts := ImportOptions{
+		Product:    m.Product,
+		Engagement: m.Engagement,
+		TestTitle:  "DAST " + r.Scan.Application,
+		TestID:     last.TestID,
+		ScanDate:   r.Scan.Created_at,
+	}
+	res, err := c.Import(b.Bytes(), opts)
+	if err != nil {
+		return Push{}, err
+	}
+	p.TestID = res.TestID
+	p.Reimport = last.TestID > 0
+	p.CreatedAt = time.Now().UTC()
+	if p.ID, err = AddPushToDB(rw, p); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// GetMappingFromDB resolves the DefectDojo product and engagement of a scan from the asset it was
+// started for, or the asset whose project is the scan's application. It returns ErrNoMapping when
+// there is no such asset.
+func GetMappingFromDB(conn *sql.DB, scanID int64, defaultEngagement string) (Mapping, error) {
+	q := "SELECT COALESCE(NULLIF(a.defectdojo_product, ''), a.project, ''), COALESCE(a.defectdojo_engagement, '') " +
+		"FROM scans s JOIN assets a ON a.id = s.asset_id OR (s.asset_id IS NULL AND a.project = s.application) " +
+		"WHERE s.id=? ORDER BY a.id LIMIT 1"
+	var m Mapping
+	err := conn.QueryRow(q, scanID).Scan(&m.Product, &m.Engagement)
+	if err == sql.ErrNoRows || (err == nil && m.Product == "") {
+		return Mapping{}, ErrNoMapping
+	}
+	if err != nil {
+		return Mapping{}, err
+	}
+	if m.Engagement == "" {
+		m.Engagement = defaultEngagement
+	}
+	if m.Engagement == "" {
+		m.Engagement = DefaultEngagement
+	}
+	return m, nil
+}
+
+const pushColumns = "id, scan_id, application, product, engagement, test_id, reimport, findings, created_at"
+
+// GetLastPushFromDB returns the last push of an application to the product and engagement, or
+// sql.ErrNoRows when it was never pushed there.
+func GetLastPushFromDB(conn *sql.DB, application string, m Mapping) (Push, error) {
+	q := "SELECT " + pushColumns + " FROM defectdojo_pushes WHERE application=? AND product=? AND engagement=? " +
+		"ORDER BY id DESC LIMIT 1"
+	return scanPush(conn.QueryRow(q, application, m.Product, m.Engagement))
+}
+
+// GetPushesFromDB lists the pushes of a scan, oldest first.
+func GetPushesFromDB(conn *sql.DB, scanID int64) ([]Push, error) {
+	q := "SELECT " + pushColumns + " FROM defectdojo_pushes WHERE scan_id=? ORDER BY id"
+	pushes := []Push{}
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return pushes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p, err := scanPush(rows)
+		if err != nil {
+			return pushes, err
+		}
+		pushes = append(pushes, p)
+	}
+	return pushes, rows.Err()
+}
+
+func AddPushToDB(conn *sql.DB, p Push) (int64, error) {
+	q := "INSERT INTO defectdojo_pushes(scan_id, application, product, engagement, test_id, reimport, findings, " +
+		"created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, p.ScanID, p.Application, p.Product, p.Engagement, p.TestID, p.Reimport, p.Findings,
+		p.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func scanPush(row interface{ Scan(...interface{}) error }) (Push, error) {
+	var p Push
+	err := row.Scan(&p.ID, &p.ScanID, &p.Application, &p.Product, &p.Engagement, &p.TestID, &p.Reimport, &p.Findings,
+		&p.CreatedAt)
+	return p, err
+}
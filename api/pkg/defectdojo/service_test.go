@@ -0,0 +1,212 @@
+package defectdojo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/catalog"
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/report"
+	"src/pkg/scan"
+	"src/pkg/scoring"
+)
+
+const testToken = "dojo-api-key"
+
+// fakeDojo stands in for the import endpoints of DefectDojo and keeps the uploads it accepted.
+type fakeDojo struct {
+	t       *testing.T
+	uploads []upload
+}
+
+type upload struct {
+	path   string
+	fields map[string]string
+	report map[string][]map[string]interface{}
+}
+
+func (f *fakeDojo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token "+testToken {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"detail":"Invalid token."}`)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	u := upload{path: r.URL.Path, fields: map[string]string{}}
+	for k, v := range r.MultipartForm.Value {
+		u.fields[k] = v[0]
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"file":["No file was submitted."]}`)
+		return
+	}
+	defer file.Close()
+	assert.Nil(f.t, json.NewDecoder(file).Decode(&u.report))
+	f.uploads = append(f.uploads, u)
+
+	w.WriteHeader(http.StatusCreated)
+	if u.path == reimportPath {
+		io.WriteString(w, `{"test": 31, "engagement_id": 4, "product_id": 2}`)
+		return
+	}
+	io.WriteString(w, `{"test": 31, "test_id": 31, "engagement_id": 4, "product_id": 2}`)
+}
+
+func newFakeDojo(t *testing.T) (*fakeDojo, *httptest.Server) {
+	f := &fakeDojo{t: t}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestImportCreatesTest(t *testing.T) {
+	f, srv := newFakeDojo(t)
+	c := NewClient(srv.URL+"/", testToken)
+
+	res, err := c.Import([]byte(`{"findings":[]}`), ImportOptions{Product: "shop", Engagement: "DAST",
+		TestTitle: "DAST shop", ScanDate: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ImportResult{TestID: 31, Test: 31, EngagementID: 4, ProductID: 2}, res)
+	assert.Equal(t, importPath, f.uploads[0].path)
+	assert.Equal(t, map[string]string{
+		"scan_type":           ScanType,
+		"minimum_severity":    "Info",
+		"scan_date":           "2024-03-01",
+		"product_name":        "shop",
+		"engagement_name":     "DAST",
+		"test_title":          "DAST shop",
+		"auto_create_context": "true",
+	}, f.uploads[0].fields)
+}
+
+func TestImportReimportsIntoTest(t *testing.T) {
+	f, srv := newFakeDojo(t)
+	c := NewClient(srv.URL, testToken)
+
+	res, err := c.Import([]byte(`{"findings":[]}`), ImportOptions{Product: "shop", Engagement: "DAST", TestID: 31})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(31), res.TestID)
+	assert.Equal(t, reimportPath, f.uploads[0].path)
+	assert.Equal(t, map[string]string{"scan_type": ScanType, "minimum_severity": "Info", "test": "31"},
+		f.uploads[0].fields)
+}
+
+func TestImportWrongToken(t *testing.T) {
+	_, srv := newFakeDojo(t)
+	c := NewClient(srv.URL, "wrong")
+
+	_, err := c.Import([]byte(`{"findings":[]}`), ImportOptions{Product: "shop", Engagement: "DAST"})
+
+	assert.EqualError(t, err, `defectdojo /api/v2/import-scan/: unexpected status 403 Forbidden: `+
+		`{"detail":"Invalid token."}`)
+}
+
+const mappingQuery = "FROM scans s JOIN assets a ON a.id = s.asset_id OR " +
+	"(s.asset_id IS NULL AND a.project = s.application)"
+
+func TestGetMappingFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}).AddRow("Shop", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}).AddRow("Shop", "Release 4"))
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}))
+
+	m, err := GetMappingFromDB(db, 7, "")
+	assert.Nil(t, err)
+	assert.Equal(t, Mapping{Product: "Shop", Engagement: DefaultEngagement}, m)
+
+	m, err = GetMappingFromDB(db, 8, "Nightly")
+	assert.Nil(t, err)
+	assert.Equal(t, Mapping{Product: "Shop", Engagement: "Release 4"}, m)
+
+	_, err = GetMappingFromDB(db, 9, "Nightly")
+	assert.Equal(t, ErrNoMapping, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func testReport() report.Report {
+	u, _ := catalog.NewUnmappedPolicy("ignore", "", false)
+	findings := []finding.Finding{
+		{ID: 1, Fingerprint: "f1", PluginID: "10038", CweID: "693", Name: "CSP Missing", Risk: "Medium",
+			Confidence: "High", URL: "https://shop.example.com/", Method: "GET"},
+	}
+	s := scan.Scan{ID: 7, Status: "failed", Build_id: "b-7", Application: "shop"}
+	return report.New(s, findings, gate.Policy{Vulnerabilities: catalog.NewSnapshot(1, nil), Scoring: scoring.Legacy(8),
+		Unmapped: u})
+}
+
+func TestPushReportImportsThenReimports(t *testing.T) {
+	f, srv := newFakeDojo(t)
+	c := NewClient(srv.URL, testToken)
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	pushColumnNames := []string{"id", "scan_id", "application", "product", "engagement", "test_id", "reimport",
+		"findings", "created_at"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}).AddRow("Shop", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM defectdojo_pushes WHERE application=? AND product=? AND engagement=?")).
+		WithArgs("shop", "Shop", "Nightly").WillReturnRows(sqlmock.NewRows(pushColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO defectdojo_pushes(")).
+		WithArgs(7, "shop", "Shop", "Nightly", 31, false, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	p, err := PushReport(db, db, c, testReport(), "Nightly")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(31), p.TestID)
+	assert.False(t, p.Reimport)
+	assert.Equal(t, importPath, f.uploads[0].path)
+	assert.Equal(t, "f1", f.uploads[0].report["findings"][0]["unique_id_from_tool"])
+
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}).AddRow("Shop", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM defectdojo_pushes WHERE application=? AND product=? AND engagement=?")).
+		WithArgs("shop", "Shop", "Nightly").
+		WillReturnRows(sqlmock.NewRows(pushColumnNames).AddRow(1, 7, "shop", "Shop", "Nightly", 31, false, 1,
+			time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO defectdojo_pushes(")).
+		WithArgs(7, "shop", "Shop", "Nightly", 31, true, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	p, err = PushReport(db, db, c, testReport(), "Nightly")
+
+	assert.Nil(t, err)
+	assert.True(t, p.Reimport)
+	assert.Equal(t, reimportPath, f.uploads[1].path)
+	assert.Equal(t, "31", f.uploads[1].fields["test"])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPushReportWithoutMapping(t *testing.T) {
+	f, srv := newFakeDojo(t)
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(mappingQuery)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"product", "engagement"}))
+
+	_, err := PushReport(db, db, NewClient(srv.URL, testToken), testReport(), "")
+
+	assert.Equal(t, ErrNoMapping, err)
+	assert.Empty(t, f.uploads)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,99 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Types of the events of a scan.
+const (
+	TypePhase    = "phase"
+	TypeProgress = "progress"
+	TypeFinding  = "finding"
+	TypeVerdict  = "verdict"
+)
+
+// Phases a scan goes through before its verdict.
+const (
+	PhaseScanning  = "scanning"
+	PhaseAnalyzing = "analyzing"
+	PhaseArchiving = "archiving"
+)
+
+// Event is something that happened to a scan. IDs grow across scans, so a subscriber resumes
+// after the last ID it got.
+type Event struct {
+	ID        int64
+	ScanID    int64
+	Type      string
+	Data      json.RawMessage
+	CreatedAt time.Time
+}
+
+// Phase is the data of a phase event.
+type Phase struct {
+	Phase string `json:"phase"`
+}
+
+// Progress is the data of a progress event, the percentage of the active scan that is done.
+type Progress struct {
+	Progress int `json:"progress"`
+}
+
+// Finding is the data of a finding event, sent once the finding is recorded.
+type Finding struct {
+	ID          int64  `json:"id"`
+	Fingerprint string `json:"fingerprint"`
+	PluginID    string `json:"plugin_id"`
+	Name        string `json:"name"`
+	CweID       string `json:"cwe_id"`
+	Severity    string `json:"severity"`
+	Risk        string `json:"risk"`
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	Param       string `json:"param"`
+	Suppressed  bool   `json:"suppressed"`
+}
+
+// Verdict is the data of the verdict event, the final status of a scan. Score is only set for
+// passed and failed scans.
+type Verdict struct {
+	Status   string   `json:"status"`
+	Score    *float64 `json:"score,omitempty"`
+	Findings int      `json:"findings"`
+}
+
+// Bus publishes the events of scans and delivers them to subscribers. Events are stored, so
+// subscribers on other replicas get them too: a subscription reads the events it hasn't seen
+// when an event of its scan is published on this replica, and every poll interval otherwise.
+type Bus struct {
+	rw       *sql.DB
+	ro       *sql.DB
+	interval time.Duration
+	newTimer func(time.Duration) *time.Timer
+
+	mu      sync.Mutex
+	subs    map[int64]map[*Subscription]bool
+	watches map[int64]*watch
+}
+
+// Subscription follows the events of a scan after a given event ID.
+type Subscription struct {
+	bus    *Bus
+	scanID int64
+	last   int64
+	notify chan struct{}
+}
+
+// watch follows a scan until its verdict for all the callers of WaitVerdict, so waiters of the same
+// scan share a subscription. It stops when the last waiter gives up.
+type watch struct {
+	waiters int
+	cancel  context.CancelFunc
+	done    chan struct{}
+	verdict Event
+	err     error
+}
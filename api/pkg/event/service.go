@@ -0,0 +1,171 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// NewBus creates a bus storing events in rw and reading them from ro, which is polled every
+// interval for the events of other replicas.
+func NewBus(rw *sql.DB, ro *sql.DB, interval time.Duration) *Bus {
+	return &Bus{rw: rw, ro: ro, interval: interval, newTimer: time.NewTimer,
+		subs: make(map[int64]map[*Subscription]bool), watches: make(map[int64]*watch)}
+}
+
+func AddEventToDB(conn *sql.DB, e Event) (int64, error) {
+	q := "INSERT INTO scan_events(scan_id, type, data) VALUES (?, ?, ?)"
+	res, err := conn.Exec(q, e.ScanID, e.Type, string(e.Data))
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+// EventsFromDB lists the events of a scan with an ID greater than after, oldest first.
+func EventsFromDB(conn *sql.DB, scanID int64, after int64) ([]Event, error) {
+	q := "SELECT id, scan_id, type, data, created_at FROM scan_events WHERE scan_id=? AND id>? ORDER BY id"
+	rows, err := conn.Query(q, scanID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var data string
+		if err := rows.Scan(&e.ID, &e.ScanID, &e.Type, &data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(data)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Publish stores an event of a scan and wakes up the subscribers of the scan on this replica.
+func (b *Bus) Publish(scanID int64, typ string, data interface{}) (Event, error) {
+	if b.rw == nil {
+		return Event{}, errors.New("not connected to database")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	e := Event{ScanID: scanID, Type: typ, Data: raw, CreatedAt: time.Now().UTC()}
+	if e.ID, err = AddEventToDB(b.rw, e); err != nil {
+		return Event{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[scanID] {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+			// It's already due to read
+		}
+	}
+	return e, nil
+}
+
+// Subscribe follows the events of a scan with an ID greater than after. The subscription has to
+// be closed.
+func (b *Bus) Subscribe(scanID int64, after int64) *Subscription {
+	s := &Subscription{bus: b, scanID: scanID, last: after, notify: make(chan struct{}, 1)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[scanID] == nil {
+		b.subs[scanID] = make(map[*Subscription]bool)
+	}
+	b.subs[scanID][s] = true
+	return s
+}
+
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs[s.scanID], s)
+	if len(b.subs[s.scanID]) == 0 {
+		delete(b.subs, s.scanID)
+	}
+}
+
+// Next waits for the events after the last one the subscription got, until ctx is done.
+func (s *Subscription) Next(ctx context.Context) ([]Event, error) {
+	if s.bus.ro == nil {
+		return nil, errors.New("not connected to database")
+	}
+	for {
+		events, err := EventsFromDB(s.bus.ro, s.scanID, s.last)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			s.last = events[len(events)-1].ID
+			return events, nil
+		}
+		timer := s.bus.newTimer(s.bus.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-s.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// WaitVerdict waits for the verdict event of a scan until ctx is done. However many callers wait
+// for the same scan, its events are read once.
+func (b *Bus) WaitVerdict(ctx context.Context, scanID int64) (Event, error) {
+	b.mu.Lock()
+	w := b.watches[scanID]
+	if w == nil {
+		wctx, cancel := context.WithCancel(context.Background())
+		w = &watch{cancel: cancel, done: make(chan struct{})}
+		b.watches[scanID] = w
+		go b.watchVerdict(wctx, scanID, w)
+	}
+	w.waiters++
+	b.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return w.verdict, w.err
+	case <-ctx.Done():
+		b.mu.Lock()
+		w.waiters--
+		if w.waiters == 0 && b.watches[scanID] == w {
+			delete(b.watches, scanID)
+			w.cancel()
+		}
+		b.mu.Unlock()
+		return Event{}, ctx.Err()
+	}
+}
+
+func (b *Bus) watchVerdict(ctx context.Context, scanID int64, w *watch) {
+	sub := b.Subscribe(scanID, 0)
+	defer sub.Close()
+	for w.err == nil && w.verdict.ID == 0 {
+		var events []Event
+		events, w.err = sub.Next(ctx)
+		for _, e := range events {
+			if e.Type == TypeVerdict {
+				w.verdict = e
+				break
+			}
+		}
+	}
+	b.mu.Lock()
+	if b.watches[scanID] == w {
+		delete(b.watches, scanID)
+	}
+	b.mu.Unlock()
+	w.cancel()
+	close(w.done)
+}
@@ -0,0 +1,153 @@
+package event
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var eventColumns = []string{"id", "scan_id", "type", "data", "created_at"}
+
+func TestEventsFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events WHERE scan_id=? AND id>? ORDER BY id")).
+		WithArgs(int64(1), int64(4)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(5, 1, "phase", `{"phase":"scanning"}`, now).
+			AddRow(6, 1, "progress", `{"progress":20}`, now))
+
+	events, err := EventsFromDB(db, 1, 4)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{ID: 5, ScanID: 1, Type: TypePhase, Data: []byte(`{"phase":"scanning"}`), CreatedAt: now},
+		{ID: 6, ScanID: 1, Type: TypeProgress, Data: []byte(`{"progress":20}`), CreatedAt: now},
+	}, events)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishWakesSubscribers(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	// Polling alone would never deliver within the test
+	bus := NewBus(db, db, time.Hour)
+	sub := bus.Subscribe(1, 0)
+	defer sub.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events(scan_id, type, data) VALUES (?, ?, ?)")).
+		WithArgs(int64(1), "progress", `{"progress":40}`).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	// The read replica is behind at first
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(7, 1, "progress", `{"progress":40}`, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+
+	e, err := bus.Publish(1, TypeProgress, Progress{Progress: 40})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), e.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	events, err := sub.Next(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, int64(7), events[0].ID)
+
+	// Nothing new after the last event
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = sub.Next(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionsAreRemovedOnClose(t *testing.T) {
+	bus := NewBus(nil, nil, time.Second)
+	a := bus.Subscribe(1, 0)
+	b := bus.Subscribe(1, 0)
+
+	a.Close()
+	assert.Len(t, bus.subs[1], 1)
+	b.Close()
+	assert.Empty(t, bus.subs)
+
+	_, err := bus.Publish(1, TypePhase, Phase{Phase: PhaseScanning})
+	assert.EqualError(t, err, "not connected to database")
+}
+
+func TestWaitVerdictSharesTheWatch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	bus := NewBus(db, db, time.Hour)
+	// The watch signals when it has read the events so far and waits for more
+	idle := make(chan struct{})
+	bus.newTimer = func(d time.Duration) *time.Timer {
+		idle <- struct{}{}
+		return time.NewTimer(d)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(3, 1, "progress", `{"progress":40}`, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(3)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+
+	verdicts := make(chan Event, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			e, err := bus.WaitVerdict(ctx, 1)
+			assert.Nil(t, err)
+			verdicts <- e
+		}()
+	}
+	<-idle
+	assert.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return bus.watches[1] != nil && bus.watches[1].waiters == 2
+	}, time.Second, time.Millisecond)
+
+	// The watch only reads again once woken up by the verdict
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scan_events")).WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(3)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(8, 1, "verdict", `{"status":"passed"}`, time.Now()))
+	_, err := bus.Publish(1, TypeVerdict, Verdict{Status: "passed"})
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, int64(8), (<-verdicts).ID)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	assert.Empty(t, bus.watches)
+	assert.Empty(t, bus.subs)
+}
+
+func TestWaitVerdictStopsWithTheLastWaiter(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	bus := NewBus(db, db, time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scan_events")).WithArgs(int64(1), int64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := bus.WaitVerdict(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.watches) == 0 && len(bus.subs) == 0
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, err = NewBus(nil, nil, time.Second).WaitVerdict(context.Background(), 1)
+	assert.EqualError(t, err, "not connected to database")
+}
@@ -0,0 +1,148 @@
+package finding
+
+import (
+	"time"
+)
+
+// Issue lifecycle states. An issue is open when first seen, fixed when a completed scan of the
+// same application no longer reports it and reopened when it shows up again after being fixed.
+const (
+	StateOpen     = "open"
+	StateFixed    = "fixed"
+	StateReopened = "reopened"
+)
+
+// Scanners findings come from. Issues are tracked per source: a scan only fixes the issues its own
+// scanner reported before.
+const (
+	SourceZAP    = "zap"
+	SourceNuclei = "nuclei"
+	SourceBurp   = "burp"
+)
+
+// Sort keys accepted by Filter.
+const (
+	SortID       = "id"
+	SortSeverity = "severity"
+	SortScore    = "score"
+	SortURL      = "url"
+	SortName     = "name"
+	SortCWE      = "cwe"
+)
+
+// Finding is a single alert reported by a scan, as stored in vulnerability_findings.
+// VulnerabilityID is 0 when the alert has no catalog entry. Suppression comes from the issue
+// the finding belongs to. SASTResultID is the static analysis result confirming the finding, if any.
+// MessageID is the ZAP message the alert was raised on, empty for imported findings.
+type Finding struct {
+	ID                int64
+	ScanID            int64
+	VulnerabilityID   int64
+	Fingerprint       string
+	PluginID          string
+	Name              string
+	CweID             string
+	Risk              string
+	Confidence        string
+	URL               string
+	Method            string
+	Param             string
+	Attack            string
+	Evidence          string
+	Solution          string
+	Reference         string
+	Details           string
+	MessageID         string
+	Suppressed        bool
+	SuppressionReason string
+	SASTResultID      int64
+}
+
+// Issue is the deduplicated view of every finding sharing a fingerprint within an application.
+type Issue struct {
+	ID              int64
+	Application     string
+	Fingerprint     string
+	VulnerabilityID int64
+	PluginID        string
+	URL             string
+	Method          string
+	Param           string
+	FirstScanID     int64
+	LastScanID      int64
+	FirstSeen       time.Time
+	LastSeen        time.Time
+	Occurrences     int
+	State           string
+
+	Suppressed        bool
+	SuppressedBy      string
+	SuppressionReason string
+}
+
+// Results of a retest.
+const (
+	RetestFixed   = "fixed"
+	RetestPresent = "still_present"
+)
+
+// Retest is the result of replaying the attack of a finding against its target. IssueState is the
+// lifecycle state of the finding's issue afterwards, empty when the finding has no issue.
+type Retest struct {
+	ID         int64     `json:"-"`
+	ScanID     int64     `json:"-"`
+	FindingID  int64     `json:"finding_id"`
+	IssueID    int64     `json:"issue_id"`
+	Result     string    `json:"result"`
+	IssueState string    `json:"issue_state"`
+	RetestedAt time.Time `json:"retested_at"`
+}
+
+// Filter selects, orders and pages the findings of a scan. Zero values don't filter.
+type Filter struct {
+	Severities []string
+	CweID      string
+	URLPrefix  string
+	Suppressed *bool
+	Sort       string
+	Desc       bool
+	Limit      int
+	Offset     int
+}
+
+// Detail is a finding joined with its catalog entry, issue and SAST result. Severity comes from
+// the catalog, or from the ZAP risk when the finding has no entry.
+type Detail struct {
+	ID                int64      `json:"id"`
+	Fingerprint       string     `json:"fingerprint"`
+	PluginID          string     `json:"plugin_id"`
+	Name              string     `json:"name"`
+	CweID             string     `json:"cwe_id"`
+	Severity          string     `json:"severity"`
+	Score             int        `json:"score"`
+	VulnerabilityID   int64      `json:"vulnerability_id"`
+	Unclassified      bool       `json:"unclassified"`
+	Risk              string     `json:"risk"`
+	Confidence        string     `json:"confidence"`
+	URL               string     `json:"url"`
+	Method            string     `json:"method"`
+	Param             string     `json:"param"`
+	Attack            string     `json:"attack"`
+	Evidence          string     `json:"evidence"`
+	Solution          string     `json:"solution"`
+	Reference         string     `json:"reference"`
+	IssueID           int64      `json:"issue_id"`
+	IssueState        string     `json:"issue_state"`
+	Suppressed        bool       `json:"suppressed"`
+	SuppressionReason string     `json:"suppression_reason"`
+	Correlated        bool       `json:"correlated"`
+	SAST              *SASTMatch `json:"sast,omitempty"`
+}
+
+// SASTMatch is the static analysis result a correlated finding was confirmed by.
+type SASTMatch struct {
+	Tool   string `json:"tool"`
+	RuleID string `json:"rule_id"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+}
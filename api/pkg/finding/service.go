@@ -0,0 +1,408 @@
+package finding
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"src/pkg/zapScanner"
+)
+
+const idPlaceholder = "{id}"
+
+// ZAP reports use codes where the alerts API uses names.
+var (
+	riskNames       = map[string]string{"0": "Informational", "1": "Low", "2": "Medium", "3": "High"}
+	confidenceNames = map[string]string{
+		"0": "False Positive", "1": "Low", "2": "Medium", "3": "High", "4": "Confirmed",
+	}
+)
+
+var idSegment = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// Fingerprint identifies an issue across scans of the same application. It only depends on the
+// application, the ZAP plugin, the normalized URL path, the HTTP method and the parameter, so the
+// same problem found by different builds of an application always produces the same value, and
+// the same problem in another application produces a different one.
+func Fingerprint(application, pluginID, rawURL, method, param string) string {
+	parts := []string{
+		application,
+		pluginID,
+		NormalizePath(rawURL),
+		strings.ToUpper(method),
+		param,
+	}
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:])
+}
+
+// NormalizePath strips scheme, host, query and fragment from a URL and replaces numeric and UUID
+// path segments with a placeholder, so /users/1 and /users/2/ are considered the same endpoint.
+func NormalizePath(rawURL string) string {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		p = u.Path
+	} else if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			segments[i] = idPlaceholder
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func AddFindingToDB(conn *sql.DB, f Finding) (int64, error) {
+	q := "INSERT INTO vulnerability_findings(scan_id, vulnerability_id, details, fingerprint, plugin_id, name, " +
+		"cwe_id, risk, confidence, url, method, param, attack, evidence, solution, reference, message_id) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	var vulnerabilityID interface{}
+	if f.VulnerabilityID > 0 {
+		vulnerabilityID = f.VulnerabilityID
+	}
+	res, err := conn.Exec(q, f.ScanID, vulnerabilityID, f.Details, f.Fingerprint, f.PluginID, f.Name, f.CweID,
+		f.Risk, f.Confidence, f.URL, f.Method, f.Param, f.Attack, f.Evidence,
+		f.Solution, f.Reference, f.MessageID)
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+// TrackIssues updates the deduplicated issues of an application with the findings source reported
+// for a completed scan. Every fingerprint in findings is counted once: new ones are opened and
+// fixed ones are reopened, unless a later scan fixed them. Scans can finish out of order, or get
+// results imported after newer ones finished, so an issue keeps the latest scan that reported it
+// and its source. Issues of the source that were open but last reported by an earlier scan are
+// marked as fixed, only when no later scan of the application has finished: that scan's findings
+// are the current ones.
+func TrackIssues(conn *sql.DB, application string, scanID int64, source string, findings []Finding) error {
+	// MySQL assigns in order, the state and source compare with the last_scan_id before the update
+	upsert := "INSERT INTO issues(application, fingerprint, vulnerability_id, plugin_id, url, method, param, " +
+		"source, first_scan_id, last_scan_id, first_seen, last_seen, occurrences, state) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW(), 1, ?) " +
+		"ON DUPLICATE KEY UPDATE " +
+		"state=IF(state=? AND VALUES(last_scan_id)>COALESCE(fixed_scan_id, 0), ?, state), " +
+		"source=IF(VALUES(last_scan_id)>=last_scan_id, VALUES(source), source), " +
+		"last_scan_id=GREATEST(last_scan_id, VALUES(last_scan_id)), last_seen=NOW(), occurrences=occurrences+1"
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if seen[f.Fingerprint] {
+			continue
+		}
+		seen[f.Fingerprint] = true
+		_, err := conn.Exec(upsert, application, f.Fingerprint, f.VulnerabilityID, f.PluginID, f.URL, f.Method,
+			f.Param, source, scanID, scanID, StateOpen, StateFixed, StateReopened)
+		if err != nil {
+			return err
+		}
+	}
+	fix := "UPDATE issues SET state=?, fixed_scan_id=? WHERE application=? AND source=? AND last_scan_id<? " +
+		"AND state<>? AND NOT EXISTS (SELECT 1 FROM scans WHERE application=? AND id>? " +
+		"AND status IN ('passed', 'failed'))"
+	_, err := conn.Exec(fix, StateFixed, scanID, application, source, scanID, StateFixed, application, scanID)
+	return err
+}
+
+func GetIssuesFromDB(conn *sql.DB, application string) ([]Issue, error) {
+	q := "SELECT id, application, fingerprint, vulnerability_id, plugin_id, url, method, param, first_scan_id, " +
+		"last_scan_id, first_seen, last_seen, occurrences, state, suppressed, COALESCE(suppressed_by, ''), " +
+		"COALESCE(suppression_reason, '') FROM issues WHERE application=? ORDER BY id"
+	var issues []Issue
+	rows, err := conn.Query(q, application)
+	if err != nil {
+		return issues, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i Issue
+		err := rows.Scan(&i.ID, &i.Application, &i.Fingerprint, &i.VulnerabilityID, &i.PluginID, &i.URL,
+			&i.Method, &i.Param, &i.FirstScanID, &i.LastScanID, &i.FirstSeen, &i.LastSeen, &i.Occurrences,
+			&i.State, &i.Suppressed, &i.SuppressedBy, &i.SuppressionReason)
+		if err != nil {
+			return issues, err
+		}
+		issues = append(issues, i)
+	}
+	return issues, rows.Err()
+}
+
+// FromReport turns every alert instance of a ZAP JSON report into a finding, the same way alerts
+// read from the ZAP API are stored.
+func FromReport(application string, scanID int64, report zapScanner.AScanResult) []Finding {
+	var findings []Finding
+	for _, site := range report.Sites {
+		for _, a := range site.Alerts {
+			for _, i := range a.Instances {
+				findings = append(findings, Finding{
+					ScanID:      scanID,
+					Fingerprint: Fingerprint(application, a.Pluginid, i.URI, i.Method, i.Param),
+					PluginID:    a.Pluginid,
+					Name:        a.Name,
+					CweID:       a.Cweid,
+					Risk:        codeName(riskNames, a.Riskcode),
+					Confidence:  codeName(confidenceNames, a.Confidence),
+					URL:         i.URI,
+					Method:      i.Method,
+					Param:       i.Param,
+					Attack:      i.Attack,
+					Evidence:    i.Evidence,
+					Solution:    StripTags(a.Solution),
+					Reference:   StripTags(a.Reference),
+					Details:     fmt.Sprintf("[Finding] CWE %s URL %s: %s \n", a.Cweid, i.URI, a.Desc),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+var paragraph = regexp.MustCompile(`</p>\s*<p>`)
+var tag = regexp.MustCompile(`<[^>]*>`)
+
+// StripTags turns the HTML paragraphs of ZAP reports into plain text lines.
+func StripTags(s string) string {
+	s = paragraph.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(tag.ReplaceAllString(s, ""))
+}
+
+func codeName(names map[string]string, code string) string {
+	if n, ok := names[code]; ok {
+		return n
+	}
+	return code
+}
+
+// GetFindingsFromDB returns the findings of a scan with the suppression state of their issue.
+func GetFindingsFromDB(conn *sql.DB, scanID int64) ([]Finding, error) {
+	q := "SELECT f.id, f.scan_id, COALESCE(f.vulnerability_id, 0), COALESCE(f.fingerprint, ''), " +
+		"COALESCE(f.plugin_id, ''), COALESCE(f.name, ''), COALESCE(f.cwe_id, ''), COALESCE(f.risk, ''), " +
+		"COALESCE(f.confidence, ''), COALESCE(f.url, ''), COALESCE(f.method, ''), COALESCE(f.param, ''), " +
+		"COALESCE(f.attack, ''), COALESCE(f.evidence, ''), COALESCE(f.solution, ''), " +
+		"COALESCE(f.reference, ''), COALESCE(f.details, ''), " +
+		"COALESCE(i.suppressed, 0), COALESCE(i.suppression_reason, ''), COALESCE(f.sast_result_id, 0) " +
+		"FROM vulnerability_findings f JOIN scans s ON s.id=f.scan_id " +
+		"LEFT JOIN issues i ON i.application=s.application AND i.fingerprint=f.fingerprint " +
+		"WHERE f.scan_id=? ORDER BY f.id"
+	var findings []Finding
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return findings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f Finding
+		err := rows.Scan(&f.ID, &f.ScanID, &f.VulnerabilityID, &f.Fingerprint, &f.PluginID, &f.Name, &f.CweID,
+			&f.Risk, &f.Confidence, &f.URL, &f.Method, &f.Param, &f.Attack, &f.Evidence, &f.Solution,
+			&f.Reference, &f.Details,
+			&f.Suppressed, &f.SuppressionReason, &f.SASTResultID)
+		if err != nil {
+			return findings, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// GetFindingFromDB returns a finding with its issue, or sql.ErrNoRows when there is none. The issue
+// has the application of the finding's scan and an ID of 0 when the finding has no issue.
+func GetFindingFromDB(conn *sql.DB, id int64) (Finding, Issue, error) {
+	q := "SELECT f.id, f.scan_id, COALESCE(f.vulnerability_id, 0), COALESCE(f.fingerprint, ''), " +
+		"COALESCE(f.plugin_id, ''), COALESCE(f.name, ''), COALESCE(f.cwe_id, ''), COALESCE(f.risk, ''), " +
+		"COALESCE(f.confidence, ''), COALESCE(f.url, ''), COALESCE(f.method, ''), COALESCE(f.param, ''), " +
+		"COALESCE(f.message_id, ''), COALESCE(s.application, ''), COALESCE(i.id, 0), COALESCE(i.state, '') " +
+		"FROM vulnerability_findings f JOIN scans s ON s.id=f.scan_id " +
+		"LEFT JOIN issues i ON i.application=s.application AND i.fingerprint=f.fingerprint " +
+		"WHERE f.id=?"
+	var f Finding
+	var i Issue
+	err := conn.QueryRow(q, id).Scan(&f.ID, &f.ScanID, &f.VulnerabilityID, &f.Fingerprint, &f.PluginID, &f.Name,
+		&f.CweID, &f.Risk, &f.Confidence, &f.URL, &f.Method, &f.Param, &f.MessageID, &i.Application, &i.ID,
+		&i.State)
+	i.Fingerprint = f.Fingerprint
+	return f, i, err
+}
+
+// RetestIssueInDB updates the state of an issue with the result of a retest: an issue that wasn't
+// reproduced is fixed and a fixed one that was is reopened. It returns the new state.
+func RetestIssueInDB(conn *sql.DB, issue Issue, present bool) (string, error) {
+	state := issue.State
+	if !present {
+		state = StateFixed
+	} else if state == StateFixed {
+		state = StateReopened
+	}
+	if state == issue.State {
+		return state, nil
+	}
+	_, err := conn.Exec("UPDATE issues SET state=? WHERE id=?", state, issue.ID)
+	return state, err
+}
+
+// AddRetestToDB records the result of a retest.
+func AddRetestToDB(conn *sql.DB, r Retest) (int64, error) {
+	q := "INSERT INTO finding_retests(scan_id, finding_id, issue_id, result, issue_state, created_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, r.ScanID, r.FindingID, r.IssueID, r.Result, r.IssueState, r.RetestedAt)
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+// severityExpr is the severity of a finding: its catalog entry's, or the ZAP risk when it has none.
+const severityExpr = "COALESCE(v.severity, CASE LOWER(f.risk) WHEN 'high' THEN 'high' WHEN '3' THEN 'high' " +
+	"WHEN 'medium' THEN 'medium' WHEN '2' THEN 'medium' ELSE 'low' END)"
+
+var sortColumns = map[string]string{
+	SortID:       "f.id",
+	SortSeverity: "FIELD(" + severityExpr + ", 'low', 'medium', 'high', 'critical')",
+	SortScore:    "COALESCE(v.score, 0)",
+	SortURL:      "f.url",
+	SortName:     "name",
+	SortCWE:      "CAST(cwe_id AS UNSIGNED)",
+}
+
+// ValidSort tells whether key is one of the Sort* keys.
+func ValidSort(key string) bool {
+	_, ok := sortColumns[key]
+	return ok
+}
+
+// QueryFindingsFromDB returns a page of the findings of a scan matching filter, and how many
+// match in total.
+func QueryFindingsFromDB(conn *sql.DB, scanID int64, filter Filter) ([]Detail, int, error) {
+	from := " FROM vulnerability_findings f JOIN scans s ON s.id=f.scan_id " +
+		"LEFT JOIN vulnerabilities v ON v.id=f.vulnerability_id " +
+		"LEFT JOIN issues i ON i.application=s.application AND i.fingerprint=f.fingerprint " +
+		"LEFT JOIN sast_results r ON r.id=f.sast_result_id " +
+		"WHERE f.scan_id=?"
+	args := []interface{}{scanID}
+	if len(filter.Severities) > 0 {
+		from += " AND " + severityExpr + " IN (?" + strings.Repeat(", ?", len(filter.Severities)-1) + ")"
+		for _, s := range filter.Severities {
+			args = append(args, s)
+		}
+	}
+	if filter.CweID != "" {
+		from += " AND COALESCE(NULLIF(f.cwe_id, ''), v.cwe_id)=?"
+		args = append(args, filter.CweID)
+	}
+	if filter.URLPrefix != "" {
+		from += " AND f.url LIKE ?"
+		args = append(args, escapeLike(filter.URLPrefix)+"%")
+	}
+	if filter.Suppressed != nil {
+		from += " AND COALESCE(i.suppressed, 0)=?"
+		args = append(args, *filter.Suppressed)
+	}
+
+	var total int
+	if err := conn.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := sortColumns[filter.Sort]
+	if !ok {
+		order = sortColumns[SortID]
+	}
+	if filter.Desc {
+		order += " DESC"
+	}
+	if order != sortColumns[SortID] {
+		order += ", f.id"
+	}
+	q := "SELECT f.id, COALESCE(f.fingerprint, ''), COALESCE(f.plugin_id, ''), " +
+		"COALESCE(v.name, f.name, '') AS name, COALESCE(NULLIF(f.cwe_id, ''), CAST(v.cwe_id AS CHAR), '') AS cwe_id, " +
+		severityExpr + ", COALESCE(v.score, 0), COALESCE(f.vulnerability_id, 0), COALESCE(v.unclassified, 0), " +
+		"COALESCE(f.risk, ''), COALESCE(f.confidence, ''), COALESCE(f.url, ''), COALESCE(f.method, ''), " +
+		"COALESCE(f.param, ''), COALESCE(f.attack, ''), COALESCE(f.evidence, ''), " +
+		"COALESCE(NULLIF(v.solution, ''), f.solution, ''), COALESCE(f.reference, ''), COALESCE(i.id, 0), " +
+		"COALESCE(i.state, ''), COALESCE(i.suppressed, 0), COALESCE(i.suppression_reason, ''), " +
+		"r.id IS NOT NULL, COALESCE(r.tool, ''), COALESCE(r.rule_id, ''), COALESCE(r.file, ''), COALESCE(r.line, 0)" +
+		from + " ORDER BY " + order
+	if filter.Limit > 0 {
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	details := []Detail{}
+	rows, err := conn.Query(q, args...)
+	if err != nil {
+		return details, total, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d Detail
+		d.SAST = &SASTMatch{}
+		err := rows.Scan(&d.ID, &d.Fingerprint, &d.PluginID, &d.Name, &d.CweID, &d.Severity, &d.Score,
+			&d.VulnerabilityID, &d.Unclassified, &d.Risk, &d.Confidence, &d.URL, &d.Method, &d.Param, &d.Attack,
+			&d.Evidence, &d.Solution, &d.Reference, &d.IssueID, &d.IssueState, &d.Suppressed, &d.SuppressionReason,
+			&d.Correlated, &d.SAST.Tool, &d.SAST.RuleID, &d.SAST.File, &d.SAST.Line)
+		if err != nil {
+			return details, total, err
+		}
+		if !d.Correlated {
+			d.SAST = nil
+		}
+		details = append(details, d)
+	}
+	return details, total, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetSuppressedFromDB maps the fingerprints of an application's suppressed issues to the reason.
+func GetSuppressedFromDB(conn *sql.DB, application string) (map[string]string, error) {
+	q := "SELECT fingerprint, COALESCE(suppression_reason, '') FROM issues WHERE application=? AND suppressed=1"
+	suppressed := make(map[string]string)
+	rows, err := conn.Query(q, application)
+	if err != nil {
+		return suppressed, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fingerprint, reason string
+		if err := rows.Scan(&fingerprint, &reason); err != nil {
+			return suppressed, err
+		}
+		suppressed[fingerprint] = reason
+	}
+	return suppressed, rows.Err()
+}
+
+// SuppressIssue accepts the risk of an issue, its findings no longer count towards the gate.
+// It returns sql.ErrNoRows when the issue doesn't exist.
+func SuppressIssue(conn *sql.DB, id int64, actor string, reason string) error {
+	q := "UPDATE issues SET suppressed=1, suppressed_by=?, suppression_reason=?, suppressed_at=NOW() WHERE id=?"
+	return updateIssue(conn, q, actor, reason, id)
+}
+
+// UnsuppressIssue returns sql.ErrNoRows when the issue doesn't exist.
+func UnsuppressIssue(conn *sql.DB, id int64, actor string) error {
+	q := "UPDATE issues SET suppressed=0, suppressed_by=?, suppression_reason=NULL, suppressed_at=NULL WHERE id=?"
+	return updateIssue(conn, q, actor, id)
+}
+
+func updateIssue(conn *sql.DB, q string, args ...interface{}) error {
+	res, err := conn.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package finding
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/zapScanner"
+)
+
+func TestNormalizePath(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com":                             "/",
+		"https://example.com/":                            "/",
+		"https://example.com/login?next=/home":            "/login",
+		"https://example.com/users/42/":                   "/users/{id}",
+		"https://example.com/users/42/orders/7#x":         "/users/{id}/orders/{id}",
+		"/api/items/3f2b8c1e-1d2a-4c5b-9e8f-0a1b2c3d4e5f": "/api/items/{id}",
+		"https://example.com/v2/assets":                   "/v2/assets",
+	}
+	for in, expected := range cases {
+		assert.Equal(t, expected, NormalizePath(in), in)
+	}
+}
+
+func TestFingerprintIsStableAcrossBuilds(t *testing.T) {
+	a := Fingerprint("shop", "40018", "https://shop.example.com/users/1?q=a", "get", "id")
+	b := Fingerprint("shop", "40018", "https://shop.example.com/users/2", "GET", "id")
+
+	assert.Equal(t, a, b)
+	assert.Len(t, a, 64)
+}
+
+func TestFingerprintDiffers(t *testing.T) {
+	base := Fingerprint("shop", "40018", "https://shop.example.com/login", "POST", "user")
+
+	assert.NotEqual(t, base, Fingerprint("blog", "40018", "https://shop.example.com/login", "POST", "user"))
+	assert.NotEqual(t, base, Fingerprint("shop", "40012", "https://shop.example.com/login", "POST", "user"))
+	assert.NotEqual(t, base, Fingerprint("shop", "40018", "https://shop.example.com/logout", "POST", "user"))
+	assert.NotEqual(t, base, Fingerprint("shop", "40018", "https://shop.example.com/login", "GET", "user"))
+	assert.NotEqual(t, base, Fingerprint("shop", "40018", "https://shop.example.com/login", "POST", "pass"))
+}
+
+func TestTrackIssuesCountsFingerprintOncePerScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	findings := []Finding{
+		{Fingerprint: "aaa", VulnerabilityID: 24, PluginID: "40018", URL: "https://a/1", Method: "GET", Param: "id"},
+		{Fingerprint: "aaa", VulnerabilityID: 24, PluginID: "40018", URL: "https://a/2", Method: "GET", Param: "id"},
+		{Fingerprint: "bbb", VulnerabilityID: 64, PluginID: "0", URL: "https://a/", Method: "GET"},
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO issues(")).
+		WithArgs("shop", "aaa", int64(24), "40018", "https://a/1", "GET", "id", SourceZAP, int64(7), int64(7),
+			StateOpen, StateFixed, StateReopened).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO issues(")).
+		WithArgs("shop", "bbb", int64(64), "0", "https://a/", "GET", "", SourceZAP, int64(7), int64(7),
+			StateOpen, StateFixed, StateReopened).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	fix := "UPDATE issues SET state=?, fixed_scan_id=? WHERE application=? AND source=? AND last_scan_id<?"
+	mock.ExpectExec(regexp.QuoteMeta(fix)).
+		WithArgs(StateFixed, int64(7), "shop", SourceZAP, int64(7), StateFixed, "shop", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := TrackIssues(db, "shop", 7, SourceZAP, findings)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTrackIssuesMarksEverythingFixedOnCleanScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=?")).
+		WithArgs(StateFixed, int64(8), "shop", SourceNuclei, int64(8), StateFixed, "shop", int64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := TrackIssues(db, "shop", 8, SourceNuclei, nil)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTrackIssuesInterleavedScans(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	upsert := regexp.QuoteMeta("ON DUPLICATE KEY UPDATE " +
+		"state=IF(state=? AND VALUES(last_scan_id)>COALESCE(fixed_scan_id, 0), ?, state), " +
+		"source=IF(VALUES(last_scan_id)>=last_scan_id, VALUES(source), source), " +
+		"last_scan_id=GREATEST(last_scan_id, VALUES(last_scan_id))")
+	fix := regexp.QuoteMeta("last_scan_id<? AND state<>? AND NOT EXISTS " +
+		"(SELECT 1 FROM scans WHERE application=? AND id>? AND status IN ('passed', 'failed'))")
+	newer := []Finding{{Fingerprint: "aaa", VulnerabilityID: 24, PluginID: "40018", URL: "https://a/", Method: "GET"}}
+	older := []Finding{{Fingerprint: "bbb", VulnerabilityID: 64, PluginID: "0", URL: "https://a/", Method: "GET"}}
+	// scan 11 finishes first and fixes what scan 10 will report, then scan 10 finishes
+	mock.ExpectExec(upsert).
+		WithArgs("shop", "aaa", int64(24), "40018", "https://a/", "GET", "", SourceZAP, int64(11), int64(11),
+			StateOpen, StateFixed, StateReopened).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(fix).
+		WithArgs(StateFixed, int64(11), "shop", SourceZAP, int64(11), StateFixed, "shop", int64(11)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(upsert).
+		WithArgs("shop", "bbb", int64(64), "0", "https://a/", "GET", "", SourceZAP, int64(10), int64(10),
+			StateOpen, StateFixed, StateReopened).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec(fix).
+		WithArgs(StateFixed, int64(10), "shop", SourceZAP, int64(10), StateFixed, "shop", int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, TrackIssues(db, "shop", 11, SourceZAP, newer))
+	assert.Nil(t, TrackIssues(db, "shop", 10, SourceZAP, older))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestFromReport(t *testing.T) {
+	b, _ := os.ReadFile("../zapScanner/mocks/scan_result.json")
+	var result zapScanner.AScanResult
+	assert.Nil(t, json.Unmarshal(b, &result))
+
+	findings := FromReport("phet", 42, result)
+
+	assert.Len(t, findings, 7)
+	f := findings[0]
+	assert.Equal(t, int64(42), f.ScanID)
+	assert.Equal(t, "10038", f.PluginID)
+	assert.Equal(t, "693", f.CweID)
+	assert.Equal(t, "Medium", f.Risk)
+	assert.Equal(t, "High", f.Confidence)
+	assert.Equal(t, "GET", f.Method)
+	assert.Equal(t, Fingerprint("phet", "10038", f.URL, "GET", ""), f.Fingerprint)
+	assert.Equal(t, "Informational", findings[6].Risk)
+}
+
+func TestGetFindingsFromDBIncludesSuppression(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	columns := []string{
+		"id", "scan_id", "vulnerability_id", "fingerprint", "plugin_id", "name", "cwe_id", "risk", "confidence",
+		"url", "method", "param", "attack", "evidence", "solution", "reference", "details", "suppressed",
+		"suppression_reason", "sast_result_id",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN issues i ON i.application=s.application")).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 3, 24, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://a/?id=1", "GET",
+				"id", "1'", "", "", "", "", false, "", 8).
+			AddRow(2, 3, 0, "fp-2", "10038", "CSP Header Not Set", "693", "Medium", "High", "https://a/", "GET",
+				"", "", "", "", "", "", true, "handled by the CDN", 0))
+
+	findings, err := GetFindingsFromDB(db, 3)
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 2)
+	assert.False(t, findings[0].Suppressed)
+	assert.Equal(t, "1'", findings[0].Attack)
+	assert.Equal(t, int64(8), findings[0].SASTResultID)
+	assert.True(t, findings[1].Suppressed)
+	assert.Equal(t, "handled by the CDN", findings[1].SuppressionReason)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSuppressIssue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET suppressed=1")).
+		WithArgs("alice", "accepted risk", int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET suppressed=1")).
+		WithArgs("alice", "accepted risk", int64(6)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, SuppressIssue(db, 5, "alice", "accepted risk"))
+	assert.Equal(t, sql.ErrNoRows, SuppressIssue(db, 6, "alice", "accepted risk"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFindingFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	columns := []string{
+		"id", "scan_id", "vulnerability_id", "fingerprint", "plugin_id", "name", "cwe_id", "risk", "confidence",
+		"url", "method", "param", "message_id", "application", "issue_id", "issue_state",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 3, 24, "fp-1", "40018", "SQL Injection", "89", "High", "Medium", "https://a/?id=1", "GET",
+				"id", "17", "shop", 5, StateOpen))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM vulnerability_findings f JOIN scans s")).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	f, i, err := GetFindingFromDB(db, 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "17", f.MessageID)
+	assert.Equal(t, "40018", f.PluginID)
+	assert.Equal(t, Issue{ID: 5, Application: "shop", Fingerprint: "fp-1", State: StateOpen}, i)
+
+	_, _, err = GetFindingFromDB(db, 2)
+
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetestIssueInDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=? WHERE id=?")).WithArgs(StateFixed, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE issues SET state=? WHERE id=?")).WithArgs(StateReopened, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	state, err := RetestIssueInDB(db, Issue{ID: 5, State: StateReopened}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, StateFixed, state)
+	state, err = RetestIssueInDB(db, Issue{ID: 5, State: StateFixed}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, StateReopened, state)
+	// An issue that is still open stays open
+	state, err = RetestIssueInDB(db, Issue{ID: 5, State: StateOpen}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, StateOpen, state)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+var detailColumns = []string{
+	"id", "fingerprint", "plugin_id", "name", "cwe_id", "severity", "score", "vulnerability_id", "unclassified",
+	"risk", "confidence", "url", "method", "param", "attack", "evidence", "solution", "reference", "issue_id",
+	"issue_state", "suppressed", "suppression_reason", "correlated", "sast_tool", "sast_rule_id", "sast_file",
+	"sast_line",
+}
+
+func TestQueryFindingsFromDBFiltersAndPages(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	suppressed := false
+	filter := Filter{
+		Severities: []string{"critical", "high"},
+		CweID:      "89",
+		URLPrefix:  "https://shop/api_v1/",
+		Suppressed: &suppressed,
+		Sort:       SortSeverity,
+		Desc:       true,
+		Limit:      20,
+		Offset:     40,
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM vulnerability_findings f")).
+		WithArgs(int64(3), "critical", "high", "89", `https://shop/api\_v1/%`, false).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(41))
+	mock.ExpectQuery(regexp.QuoteMeta("'low', 'medium', 'high', 'critical') DESC, f.id LIMIT ? OFFSET ?")).
+		WithArgs(int64(3), "critical", "high", "89", `https://shop/api\_v1/%`, false, 20, 40).
+		WillReturnRows(sqlmock.NewRows(detailColumns).AddRow(9, "fp", "40018", "SQL Injection", "89", "critical", 20,
+			24, false, "High", "Medium", "https://shop/api_v1/items?id=1", "GET", "id", "1'", "",
+			"Use prepared statements.", "", 5, "open", false, "", false, "", "", "", 0))
+
+	details, total, err := QueryFindingsFromDB(db, 3, filter)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 41, total)
+	assert.Equal(t, []Detail{{ID: 9, Fingerprint: "fp", PluginID: "40018", Name: "SQL Injection", CweID: "89",
+		Severity: "critical", Score: 20, VulnerabilityID: 24, Risk: "High", Confidence: "Medium",
+		URL: "https://shop/api_v1/items?id=1", Method: "GET", Param: "id", Attack: "1'",
+		Solution: "Use prepared statements.", IssueID: 5, IssueState: "open"}}, details)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryFindingsFromDBDefaultsToIDOrder(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*)")).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE f.scan_id=? ORDER BY f.id")).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(detailColumns))
+
+	details, total, err := QueryFindingsFromDB(db, 3, Filter{Sort: "unknown"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, total)
+	assert.Equal(t, []Detail{}, details)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
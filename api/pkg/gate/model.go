@@ -0,0 +1,69 @@
+package gate
+
+import (
+	"time"
+
+	"src/pkg/catalog"
+	"src/pkg/scoring"
+)
+
+// Policy decides whether the findings of a scan pass.
+type Policy struct {
+	Vulnerabilities catalog.Snapshot
+	Scoring         scoring.Model
+	Unmapped        catalog.UnmappedPolicy
+}
+
+// Verdict is the outcome of evaluating a policy.
+type Verdict struct {
+	Passed   bool    `json:"passed"`
+	Score    float64 `json:"score"`
+	Unmapped int     `json:"unmapped"`
+}
+
+// PolicySpec is the JSON form of a candidate policy. Omitted sections keep the configured values.
+type PolicySpec struct {
+	Scoring  *ScoringSpec  `json:"scoring"`
+	Unmapped *UnmappedSpec `json:"unmapped"`
+}
+
+type ScoringSpec struct {
+	Mode            string                        `json:"mode"`
+	Aggregation     string                        `json:"aggregation"`
+	Cap             int                           `json:"cap"`
+	Weights         map[string]map[string]float64 `json:"weights"`
+	Threshold       float64                       `json:"threshold"`
+	ConfirmedWeight float64                       `json:"confirmed_weight"`
+}
+
+type UnmappedSpec struct {
+	Policy     string         `json:"policy"`
+	RiskScores map[string]int `json:"risk_scores"`
+}
+
+// SimulationFilter selects the historical scans a candidate policy is evaluated against.
+type SimulationFilter struct {
+	Since        time.Time
+	Until        time.Time
+	Applications []string
+}
+
+// ScanOutcome compares the current and the candidate verdict of a historical scan.
+type ScanOutcome struct {
+	ScanID      int64   `json:"scan_id"`
+	BuildID     string  `json:"build_id"`
+	Application string  `json:"application"`
+	Recorded    string  `json:"recorded"`
+	Current     Verdict `json:"current"`
+	Candidate   Verdict `json:"candidate"`
+}
+
+// ApplicationDelta summarizes how a candidate policy changes the outcome of an application's scans.
+type ApplicationDelta struct {
+	Application     string   `json:"application"`
+	Scans           int      `json:"scans"`
+	FailedCurrent   int      `json:"failed_current"`
+	FailedCandidate int      `json:"failed_candidate"`
+	NewlyFailed     []string `json:"newly_failed"`
+	NewlyPassed     []string `json:"newly_passed"`
+}
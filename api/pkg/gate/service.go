@@ -0,0 +1,212 @@
+package gate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"src/pkg/catalog"
+	"src/pkg/finding"
+	"src/pkg/scoring"
+)
+
+// Evaluate scores the findings of a scan. Findings are matched to the catalog by plugin ID and
+// CWE, falling back to the vulnerability they were stored with, so older findings that predate
+// those columns can still be evaluated. Suppressed findings don't count.
+func (p Policy) Evaluate(findings []finding.Finding) Verdict {
+	var alerts []scoring.Alert
+	unmapped := 0
+	for _, f := range findings {
+		if f.Suppressed {
+			continue
+		}
+		score, ok := p.baseScore(f)
+		if !ok {
+			unmapped++
+		}
+		alerts = append(alerts, scoring.Alert{
+			Issue:      IssueKey(f),
+			URL:        f.URL,
+			Risk:       f.Risk,
+			Confidence: f.Confidence,
+			Score:      score,
+			Confirmed:  f.SASTResultID > 0,
+		})
+	}
+	total := p.Scoring.Score(alerts)
+	return Verdict{
+		Passed:   p.Scoring.Passed(total) && !p.Unmapped.FailsScan(unmapped),
+		Score:    total,
+		Unmapped: unmapped,
+	}
+}
+
+// Score is what a finding would add to the scan score on its own, before aggregation with the
+// other instances of its issue.
+func (p Policy) Score(f finding.Finding) float64 {
+	if f.Suppressed {
+		return 0
+	}
+	score, _ := p.baseScore(f)
+	weight := p.Scoring.Weight(f.Risk, f.Confidence)
+	if f.SASTResultID > 0 {
+		weight *= p.Scoring.ConfirmedWeight()
+	}
+	return float64(score) * weight
+}
+
+// IssueKey groups the instances of the same problem, the ZAP plugin or the CWE when there is none.
+func IssueKey(f finding.Finding) string {
+	if f.PluginID == "" {
+		return "cwe-" + f.CweID
+	}
+	return f.PluginID
+}
+
+func (p Policy) baseScore(f finding.Finding) (int, bool) {
+	v, ok := p.Vulnerabilities.Lookup(f.PluginID, f.CweID)
+	if !ok && f.VulnerabilityID > 0 {
+		v, ok = p.Vulnerabilities.ByID(f.VulnerabilityID)
+	}
+	if !ok || v.Unclassified {
+		return p.Unmapped.Score(f.Risk), false
+	}
+	return v.Score, true
+}
+
+// Apply returns a copy of the policy with the sections present in spec replaced.
+func (p Policy) Apply(spec PolicySpec) (Policy, error) {
+	if spec.Scoring != nil {
+		weights := ""
+		if spec.Scoring.Weights != nil {
+			b, err := json.Marshal(spec.Scoring.Weights)
+			if err != nil {
+				return p, err
+			}
+			weights = string(b)
+		}
+		threshold := spec.Scoring.Threshold
+		if threshold == 0 {
+			threshold = p.Scoring.Threshold
+		}
+		m, err := scoring.NewModel(spec.Scoring.Mode, spec.Scoring.Aggregation, spec.Scoring.Cap, weights, threshold)
+		if err != nil {
+			return p, err
+		}
+		m.Confirmed = spec.Scoring.ConfirmedWeight
+		if m.Confirmed == 0 {
+			m.Confirmed = p.Scoring.Confirmed
+		}
+		p.Scoring = m
+	}
+	if spec.Unmapped != nil {
+		riskScores := ""
+		if spec.Unmapped.RiskScores != nil {
+			b, err := json.Marshal(spec.Unmapped.RiskScores)
+			if err != nil {
+				return p, err
+			}
+			riskScores = string(b)
+		}
+		u, err := catalog.NewUnmappedPolicy(spec.Unmapped.Policy, riskScores, p.Unmapped.AutoCreate)
+		if err != nil {
+			return p, err
+		}
+		p.Unmapped = u
+	}
+	return p, nil
+}
+
+// Simulate evaluates the current and the candidate policy against the stored findings of the
+// completed scans matching filter. It returns the per-application deltas and the scans whose
+// verdict changes.
+func Simulate(conn *sql.DB, current Policy, candidate Policy, filter SimulationFilter) (
+	[]ApplicationDelta, []ScanOutcome, error,
+) {
+	scans, findings, err := getHistoricalScansFromDB(conn, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	deltas := make(map[string]*ApplicationDelta)
+	changed := []ScanOutcome{}
+	for _, o := range scans {
+		o.Current = current.Evaluate(findings[o.ScanID])
+		o.Candidate = candidate.Evaluate(findings[o.ScanID])
+
+		d, ok := deltas[o.Application]
+		if !ok {
+			d = &ApplicationDelta{Application: o.Application, NewlyFailed: []string{}, NewlyPassed: []string{}}
+			deltas[o.Application] = d
+		}
+		d.Scans++
+		if !o.Current.Passed {
+			d.FailedCurrent++
+		}
+		if !o.Candidate.Passed {
+			d.FailedCandidate++
+		}
+		if o.Current.Passed != o.Candidate.Passed {
+			if o.Candidate.Passed {
+				d.NewlyPassed = append(d.NewlyPassed, o.BuildID)
+			} else {
+				d.NewlyFailed = append(d.NewlyFailed, o.BuildID)
+			}
+			changed = append(changed, o)
+		}
+	}
+
+	result := []ApplicationDelta{}
+	for _, d := range deltas {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Application < result[j].Application })
+	return result, changed, nil
+}
+
+func getHistoricalScansFromDB(conn *sql.DB, filter SimulationFilter) (
+	[]ScanOutcome, map[int64][]finding.Finding, error,
+) {
+	q := "SELECT s.id, s.build_id, COALESCE(s.application, ''), s.status, f.id, " +
+		"COALESCE(f.vulnerability_id, 0), COALESCE(f.plugin_id, ''), COALESCE(f.cwe_id, ''), " +
+		"COALESCE(f.risk, ''), COALESCE(f.confidence, ''), COALESCE(f.url, ''), COALESCE(i.suppressed, 0), " +
+		"COALESCE(f.sast_result_id, 0) " +
+		"FROM scans s LEFT JOIN vulnerability_findings f ON f.scan_id=s.id " +
+		"LEFT JOIN issues i ON i.application=s.application AND i.fingerprint=f.fingerprint " +
+		"WHERE s.status IN ('passed', 'failed') AND s.created_at>=? AND s.created_at<?"
+	args := []interface{}{filter.Since, filter.Until}
+	if len(filter.Applications) > 0 {
+		q += " AND s.application IN (?" + strings.Repeat(", ?", len(filter.Applications)-1) + ")"
+		for _, a := range filter.Applications {
+			args = append(args, a)
+		}
+	}
+	q += " ORDER BY s.id"
+
+	var scans []ScanOutcome
+	findings := make(map[int64][]finding.Finding)
+	rows, err := conn.Query(q, args...)
+	if err != nil {
+		return scans, findings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o ScanOutcome
+		var findingID sql.NullInt64
+		var f finding.Finding
+		err := rows.Scan(&o.ScanID, &o.BuildID, &o.Application, &o.Recorded, &findingID, &f.VulnerabilityID,
+			&f.PluginID, &f.CweID, &f.Risk, &f.Confidence, &f.URL, &f.Suppressed, &f.SASTResultID)
+		if err != nil {
+			return scans, findings, err
+		}
+		if len(scans) == 0 || scans[len(scans)-1].ScanID != o.ScanID {
+			scans = append(scans, o)
+		}
+		if findingID.Valid {
+			f.ID = findingID.Int64
+			f.ScanID = o.ScanID
+			findings[o.ScanID] = append(findings[o.ScanID], f)
+		}
+	}
+	return scans, findings, rows.Err()
+}
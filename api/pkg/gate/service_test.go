@@ -0,0 +1,127 @@
+package gate
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/catalog"
+	"src/pkg/finding"
+	"src/pkg/scoring"
+)
+
+var testCatalog = catalog.NewSnapshot(1, []catalog.Entry{
+	{ID: 24, Name: "SQL Injection", CweID: 89, Severity: "critical", Score: 20},
+	{ID: 64, Name: "Directory Browsing", CweID: 548, Severity: "high", Score: 1},
+})
+
+func legacyPolicy() Policy {
+	u, _ := catalog.NewUnmappedPolicy("ignore", "", false)
+	return Policy{Vulnerabilities: testCatalog, Scoring: scoring.Legacy(8), Unmapped: u}
+}
+
+func TestEvaluateLegacy(t *testing.T) {
+	p := legacyPolicy()
+
+	v := p.Evaluate([]finding.Finding{
+		{PluginID: "0", CweID: "548", URL: "https://a/img/"},
+		{PluginID: "0", CweID: "548", URL: "https://a/css/"},
+	})
+	assert.Equal(t, Verdict{Passed: true, Score: 2}, v)
+
+	v = p.Evaluate([]finding.Finding{{PluginID: "40018", CweID: "89", Risk: "High", Confidence: "Low"}})
+	assert.Equal(t, Verdict{Passed: false, Score: 20}, v)
+}
+
+func TestEvaluateSkipsSuppressed(t *testing.T) {
+	v := legacyPolicy().Evaluate([]finding.Finding{
+		{PluginID: "40018", CweID: "89", Suppressed: true, SuppressionReason: "WAF blocks it"},
+		{PluginID: "0", CweID: "548", URL: "https://a/img/"},
+	})
+
+	assert.Equal(t, Verdict{Passed: true, Score: 1}, v)
+}
+
+func TestEvaluateFallsBackToStoredVulnerability(t *testing.T) {
+	v := legacyPolicy().Evaluate([]finding.Finding{{VulnerabilityID: 24}})
+
+	assert.Equal(t, Verdict{Passed: false, Score: 20}, v)
+}
+
+func TestEvaluateCountsUnmapped(t *testing.T) {
+	p, err := legacyPolicy().Apply(PolicySpec{Unmapped: &UnmappedSpec{Policy: "fail"}})
+	assert.Nil(t, err)
+
+	v := p.Evaluate([]finding.Finding{{PluginID: "10038", CweID: "693", Risk: "Medium"}})
+
+	assert.Equal(t, Verdict{Passed: false, Score: 0, Unmapped: 1}, v)
+}
+
+func TestEvaluateWeighsConfirmedFindings(t *testing.T) {
+	p := legacyPolicy()
+	p.Scoring.Confirmed = 2
+	confirmed := finding.Finding{PluginID: "0", CweID: "548", URL: "https://a/img/", SASTResultID: 3}
+
+	v := p.Evaluate([]finding.Finding{confirmed, {PluginID: "0", CweID: "548", URL: "https://a/css/"}})
+
+	assert.Equal(t, Verdict{Passed: true, Score: 3}, v)
+	assert.Equal(t, 2.0, p.Score(confirmed))
+
+	// Candidates keep the configured weight unless they set one
+	candidate, err := p.Apply(PolicySpec{Scoring: &ScoringSpec{Mode: "weighted"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, candidate.Scoring.Confirmed)
+	candidate, _ = p.Apply(PolicySpec{Scoring: &ScoringSpec{Mode: "weighted", ConfirmedWeight: 1.5}})
+	assert.Equal(t, 1.5, candidate.Scoring.Confirmed)
+}
+
+func TestApplyKeepsThresholdWhenOmitted(t *testing.T) {
+	p, err := legacyPolicy().Apply(PolicySpec{Scoring: &ScoringSpec{
+		Mode:    "weighted",
+		Weights: map[string]map[string]float64{"High": {"Low": 0.1}},
+	}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, scoring.ModeWeighted, p.Scoring.Mode)
+	assert.Equal(t, 8.0, p.Scoring.Threshold)
+	assert.Equal(t, 0.1, p.Scoring.Weight("High", "Low"))
+
+	_, err = legacyPolicy().Apply(PolicySpec{Scoring: &ScoringSpec{Mode: "weighted", Aggregation: "twice"}})
+	assert.NotNil(t, err)
+}
+
+func TestSimulate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{
+		"id", "build_id", "application", "status", "f.id", "vulnerability_id", "plugin_id", "cwe_id", "risk",
+		"confidence", "url", "suppressed", "sast_result_id",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans s LEFT JOIN vulnerability_findings f ON f.scan_id=s.id")).
+		WithArgs(since, until, "shop", "blog").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "b-1", "shop", "passed", 10, 64, "0", "548", "High", "Low", "https://a/img/", false, 0).
+			AddRow(1, "b-1", "shop", "passed", 11, 64, "0", "548", "High", "Low", "https://a/css/", false, 0).
+			AddRow(2, "b-2", "shop", "passed", nil, 0, "", "", "", "", "", false, 0).
+			AddRow(3, "b-3", "blog", "failed", 12, 24, "40018", "89", "High", "Low", "https://b/", false, 7))
+
+	candidate, _ := legacyPolicy().Apply(PolicySpec{Scoring: &ScoringSpec{Mode: "legacy", Threshold: 2}})
+	filter := SimulationFilter{Since: since, Until: until, Applications: []string{"shop", "blog"}}
+	deltas, changed, err := Simulate(db, legacyPolicy(), candidate, filter)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ApplicationDelta{
+		{Application: "blog", Scans: 1, FailedCurrent: 1, FailedCandidate: 1, NewlyFailed: []string{},
+			NewlyPassed: []string{}},
+		{Application: "shop", Scans: 2, FailedCurrent: 0, FailedCandidate: 1, NewlyFailed: []string{"b-1"},
+			NewlyPassed: []string{}},
+	}, deltas)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, "b-1", changed[0].BuildID)
+	assert.Equal(t, "passed", changed[0].Recorded)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package importer
+
+import "encoding/xml"
+
+// Report formats accepted by Parse.
+const (
+	FormatNuclei  = "nuclei"
+	FormatBurp    = "burp"
+	FormatZAPXML  = "zap-xml"
+	FormatZAPJSON = "zap-json"
+)
+
+// Plugin ID prefixes of third-party findings, so their rule IDs can't collide with ZAP plugin IDs
+// in the catalog.
+const (
+	nucleiPrefix = "nuclei:"
+	burpPrefix   = "burp:"
+)
+
+// nucleiResult is a line of `nuclei -jsonl` output. Older Nuclei versions name some fields
+// differently, both are read.
+type nucleiResult struct {
+	TemplateID       string     `json:"template-id"`
+	OldTemplateID    string     `json:"templateID"`
+	Info             nucleiInfo `json:"info"`
+	Type             string     `json:"type"`
+	Host             string     `json:"host"`
+	MatchedAt        string     `json:"matched-at"`
+	OldMatched       string     `json:"matched"`
+	MatcherName      string     `json:"matcher-name"`
+	ExtractedResults []string   `json:"extracted-results"`
+	Request          string     `json:"request"`
+}
+
+type nucleiInfo struct {
+	Name           string               `json:"name"`
+	Severity       string               `json:"severity"`
+	Description    string               `json:"description"`
+	Remediation    string               `json:"remediation"`
+	Reference      stringList           `json:"reference"`
+	Classification nucleiClassification `json:"classification"`
+}
+
+type nucleiClassification struct {
+	CweID stringList `json:"cwe-id"`
+}
+
+// stringList reads a JSON string or array of strings, templates may use either.
+type stringList []string
+
+// burpIssues is the XML export of Burp Suite's issue list.
+type burpIssues struct {
+	XMLName xml.Name    `xml:"issues"`
+	Issues  []burpIssue `xml:"issue"`
+}
+
+type burpIssue struct {
+	Type                  string `xml:"type"`
+	Name                  string `xml:"name"`
+	Host                  string `xml:"host"`
+	Path                  string `xml:"path"`
+	Location              string `xml:"location"`
+	Severity              string `xml:"severity"`
+	Confidence            string `xml:"confidence"`
+	IssueBackground       string `xml:"issueBackground"`
+	RemediationBackground string `xml:"remediationBackground"`
+	IssueDetail           string `xml:"issueDetail"`
+	RemediationDetail     string `xml:"remediationDetail"`
+	References            string `xml:"references"`
+	Classifications       string `xml:"vulnerabilityClassifications"`
+	Requests              []struct {
+		Request struct {
+			Method string `xml:"method,attr"`
+		} `xml:"request"`
+	} `xml:"requestresponse"`
+}
+
+// zapXMLReport is ZAP's traditional XML report, the XML form of zapScanner.AScanResult.
+type zapXMLReport struct {
+	Version   string       `xml:"version,attr"`
+	Generated string       `xml:"generated,attr"`
+	Sites     []zapXMLSite `xml:"site"`
+}
+
+type zapXMLSite struct {
+	Name   string        `xml:"name,attr"`
+	Host   string        `xml:"host,attr"`
+	Port   string        `xml:"port,attr"`
+	SSL    string        `xml:"ssl,attr"`
+	Alerts []zapXMLAlert `xml:"alerts>alertitem"`
+}
+
+type zapXMLAlert struct {
+	Pluginid   string           `xml:"pluginid"`
+	AlertRef   string           `xml:"alertRef"`
+	Alert      string           `xml:"alert"`
+	Name       string           `xml:"name"`
+	Riskcode   string           `xml:"riskcode"`
+	Confidence string           `xml:"confidence"`
+	Riskdesc   string           `xml:"riskdesc"`
+	Desc       string           `xml:"desc"`
+	Instances  []zapXMLInstance `xml:"instances>instance"`
+	Count      string           `xml:"count"`
+	Solution   string           `xml:"solution"`
+	Otherinfo  string           `xml:"otherinfo"`
+	Reference  string           `xml:"reference"`
+	Cweid      string           `xml:"cweid"`
+	Wascid     string           `xml:"wascid"`
+	Sourceid   string           `xml:"sourceid"`
+}
+
+type zapXMLInstance struct {
+	URI      string `xml:"uri"`
+	Method   string `xml:"method"`
+	Param    string `xml:"param"`
+	Attack   string `xml:"attack"`
+	Evidence string `xml:"evidence"`
+}
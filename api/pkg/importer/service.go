@@ -0,0 +1,250 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"src/pkg/finding"
+	"src/pkg/zapScanner"
+)
+
+var sources = map[string]string{
+	FormatNuclei:  finding.SourceNuclei,
+	FormatBurp:    finding.SourceBurp,
+	FormatZAPXML:  finding.SourceZAP,
+	FormatZAPJSON: finding.SourceZAP,
+}
+
+var (
+	nucleiRisks    = map[string]string{"critical": "High", "high": "High", "medium": "Medium", "low": "Low"}
+	burpRisks      = map[string]string{"High": "High", "Medium": "Medium", "Low": "Low"}
+	burpConfidence = map[string]string{"Certain": "High", "Firm": "Medium", "Tentative": "Low"}
+
+	burpParam = regexp.MustCompile(`\[(\S+) (?:parameter|cookie|HTTP header)\]`)
+	cweNumber = regexp.MustCompile(`(?i)CWE-(\d+)`)
+	href      = regexp.MustCompile(`href="([^"]+)"`)
+)
+
+// Source returns the scanner that reports in format come from, false for an unknown format.
+func Source(format string) (string, bool) {
+	s, ok := sources[format]
+	return s, ok
+}
+
+// Parse normalizes a third-party report into findings of a scan, the way alerts read from ZAP are
+// stored. Catalog entries aren't resolved.
+func Parse(format string, application string, scanID int64, data []byte) ([]finding.Finding, error) {
+	var findings []finding.Finding
+	var err error
+	switch format {
+	case FormatNuclei:
+		findings, err = parseNuclei(data)
+	case FormatBurp:
+		findings, err = parseBurp(data)
+	case FormatZAPXML:
+		return parseZAPXML(application, scanID, data)
+	case FormatZAPJSON:
+		var r zapScanner.AScanResult
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("invalid ZAP JSON report: %v", err)
+		}
+		return finding.FromReport(application, scanID, r), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	for i := range findings {
+		f := &findings[i]
+		f.ScanID = scanID
+		f.Fingerprint = finding.Fingerprint(application, f.PluginID, f.URL, f.Method, f.Param)
+	}
+	return findings, err
+}
+
+// parseNuclei reads JSON lines, or the JSON array written by -json-export.
+func parseNuclei(data []byte) ([]finding.Finding, error) {
+	var results []nucleiResult
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("invalid Nuclei JSON: %v", err)
+		}
+	} else {
+		s := bufio.NewScanner(bytes.NewReader(data))
+		s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; s.Scan(); line++ {
+			if len(bytes.TrimSpace(s.Bytes())) == 0 {
+				continue
+			}
+			var r nucleiResult
+			if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+				return nil, fmt.Errorf("invalid Nuclei JSON on line %d: %v", line, err)
+			}
+			results = append(results, r)
+		}
+		if err := s.Err(); err != nil {
+			return nil, fmt.Errorf("error reading Nuclei output: %v", err)
+		}
+	}
+
+	var findings []finding.Finding
+	for _, r := range results {
+		id := first(r.TemplateID, r.OldTemplateID)
+		if id == "" {
+			return nil, fmt.Errorf("nuclei result without a template ID")
+		}
+		f := finding.Finding{
+			PluginID:   nucleiPrefix + id,
+			Name:       first(r.Info.Name, id),
+			CweID:      cweID(strings.Join(r.Info.Classification.CweID, " ")),
+			Risk:       riskName(nucleiRisks, strings.ToLower(r.Info.Severity)),
+			Confidence: "Medium",
+			URL:        first(r.MatchedAt, r.OldMatched, r.Host),
+			Evidence:   first(strings.Join(r.ExtractedResults, ", "), r.MatcherName),
+			Solution:   strings.TrimSpace(r.Info.Remediation),
+			Reference:  strings.Join(r.Info.Reference, "\n"),
+		}
+		if r.Type == "http" {
+			f.Method = requestMethod(r.Request)
+		}
+		f.Details = details(f, r.Info.Description)
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+func parseBurp(data []byte) ([]finding.Finding, error) {
+	var r burpIssues
+	if err := xml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid Burp XML: %v", err)
+	}
+	var findings []finding.Finding
+	for _, i := range r.Issues {
+		if i.Severity == "False positive" {
+			continue
+		}
+		f := finding.Finding{
+			PluginID:   burpPrefix + i.Type,
+			Name:       i.Name,
+			CweID:      cweID(i.Classifications),
+			Risk:       riskName(burpRisks, i.Severity),
+			Confidence: burpConfidence[i.Confidence],
+			URL:        strings.TrimRight(i.Host, "/") + i.Path,
+			Method:     "GET",
+			Solution:   joinText(i.RemediationBackground, i.RemediationDetail),
+			Reference:  links(i.References + i.Classifications),
+		}
+		if len(i.Requests) > 0 && i.Requests[0].Request.Method != "" {
+			f.Method = i.Requests[0].Request.Method
+		}
+		if m := burpParam.FindStringSubmatch(i.Location); m != nil {
+			f.Param = m[1]
+		}
+		f.Details = details(f, joinText(i.IssueBackground, i.IssueDetail))
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+func parseZAPXML(application string, scanID int64, data []byte) ([]finding.Finding, error) {
+	var x struct {
+		XMLName xml.Name `xml:"OWASPZAPReport"`
+		zapXMLReport
+	}
+	if err := xml.Unmarshal(data, &x); err != nil {
+		return nil, fmt.Errorf("invalid ZAP XML report: %v", err)
+	}
+	r := zapScanner.AScanResult{Version: x.Version, Generated: x.Generated}
+	for _, xs := range x.Sites {
+		site := zapScanner.Site{Name: xs.Name, Host: xs.Host, Port: xs.Port, Ssl: xs.SSL}
+		for _, xa := range xs.Alerts {
+			a := zapScanner.Alert{
+				Pluginid: xa.Pluginid, AlertRef: xa.AlertRef, Alert: xa.Alert, Name: xa.Name, Riskcode: xa.Riskcode,
+				Confidence: xa.Confidence, Riskdesc: xa.Riskdesc, Desc: xa.Desc, Count: xa.Count,
+				Solution: xa.Solution, Otherinfo: xa.Otherinfo, Reference: xa.Reference, Cweid: xa.Cweid,
+				Wascid: xa.Wascid, Sourceid: xa.Sourceid,
+			}
+			for _, xi := range xa.Instances {
+				a.Instances = append(a.Instances, zapScanner.Instance(xi))
+			}
+			site.Alerts = append(site.Alerts, a)
+		}
+		r.Sites = append(r.Sites, site)
+	}
+	return finding.FromReport(application, scanID, r), nil
+}
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = stringList{s}
+		if s == "" {
+			*l = nil
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func details(f finding.Finding, description string) string {
+	return fmt.Sprintf("[Finding] CWE %s URL %s: %s \n", f.CweID, f.URL, description)
+}
+
+// riskName maps a scanner severity to the ZAP risk names, anything else is informational.
+func riskName(risks map[string]string, severity string) string {
+	if r, ok := risks[severity]; ok {
+		return r
+	}
+	return "Informational"
+}
+
+// cweID returns the first CWE number mentioned in s.
+func cweID(s string) string {
+	if m := cweNumber.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// links lists the links of an HTML fragment, one per line.
+func links(html string) string {
+	var refs []string
+	for _, m := range href.FindAllStringSubmatch(html, -1) {
+		refs = append(refs, m[1])
+	}
+	return strings.Join(refs, "\n")
+}
+
+func requestMethod(request string) string {
+	if i := strings.IndexByte(request, ' '); i > 0 {
+		return request[:i]
+	}
+	return ""
+}
+
+func joinText(parts ...string) string {
+	var text []string
+	for _, p := range parts {
+		if p = finding.StripTags(p); p != "" {
+			text = append(text, p)
+		}
+	}
+	return strings.Join(text, "\n\n")
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
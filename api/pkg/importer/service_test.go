@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/finding"
+)
+
+func readFile(t *testing.T, name string) []byte {
+	b, err := os.ReadFile("mocks/" + name)
+	assert.Nil(t, err)
+	return b
+}
+
+func TestParseNuclei(t *testing.T) {
+	findings, err := Parse(FormatNuclei, "phet", 42, readFile(t, "nuclei.jsonl"))
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 3)
+	f := findings[0]
+	assert.Equal(t, int64(42), f.ScanID)
+	assert.Equal(t, "nuclei:error-based-sql-injection", f.PluginID)
+	assert.Equal(t, "Error based SQL Injection", f.Name)
+	assert.Equal(t, "89", f.CweID)
+	assert.Equal(t, "High", f.Risk)
+	assert.Equal(t, "Medium", f.Confidence)
+	assert.Equal(t, "https://phet-dev.colorado.edu/search?q=%27", f.URL)
+	assert.Equal(t, "GET", f.Method)
+	assert.Equal(t, "You have an error in your SQL syntax", f.Evidence)
+	assert.Equal(t, "Use parameterized queries.", f.Solution)
+	assert.Equal(t, "https://owasp.org/www-community/attacks/SQL_Injection", f.Reference)
+	assert.Equal(t, finding.Fingerprint("phet", "nuclei:error-based-sql-injection",
+		"https://phet-dev.colorado.edu/search?q=%27", "GET", ""), f.Fingerprint)
+
+	assert.Equal(t, "Informational", findings[1].Risk)
+	assert.Equal(t, "nginx", findings[1].Evidence)
+	assert.Equal(t, "", findings[1].CweID)
+
+	// Older field names and a network template
+	assert.Equal(t, "nuclei:weak-cipher-suites", findings[2].PluginID)
+	assert.Equal(t, "phet-dev.colorado.edu:443", findings[2].URL)
+	assert.Equal(t, "", findings[2].Method)
+	assert.Equal(t, "326", findings[2].CweID)
+}
+
+func TestParseNucleiJSONExport(t *testing.T) {
+	findings, err := Parse(FormatNuclei, "phet", 42, []byte(`[{"template-id":"tech-detect","info":{"name":"Tech",`+
+		`"severity":"critical"},"type":"http","matched-at":"https://a/","request":"HEAD / HTTP/1.1"}]`))
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 1)
+	assert.Equal(t, "High", findings[0].Risk)
+	assert.Equal(t, "HEAD", findings[0].Method)
+}
+
+func TestParseNucleiInvalidLine(t *testing.T) {
+	_, err := Parse(FormatNuclei, "phet", 42, []byte("{\"template-id\":\"a\"}\nnot json\n"))
+
+	assert.EqualError(t, err, "invalid Nuclei JSON on line 2: invalid character 'o' in literal null (expecting 'u')")
+}
+
+func TestParseBurp(t *testing.T) {
+	findings, err := Parse(FormatBurp, "phet", 42, readFile(t, "burp.xml"))
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 2, "false positives are skipped")
+	f := findings[0]
+	assert.Equal(t, "burp:1049088", f.PluginID)
+	assert.Equal(t, "SQL injection", f.Name)
+	assert.Equal(t, "89", f.CweID)
+	assert.Equal(t, "High", f.Risk)
+	assert.Equal(t, "Medium", f.Confidence)
+	assert.Equal(t, "https://phet-dev.colorado.edu/search", f.URL)
+	assert.Equal(t, "POST", f.Method)
+	assert.Equal(t, "q", f.Param)
+	assert.Equal(t, "The most effective way to prevent SQL injection attacks is to use parameterized queries.",
+		f.Solution)
+	assert.Equal(t, "https://portswigger.net/web-security/sql-injection\n"+
+		"https://cwe.mitre.org/data/definitions/89.html", f.Reference)
+	assert.Contains(t, f.Details, "The q parameter appears to be vulnerable")
+
+	assert.Equal(t, "Informational", findings[1].Risk)
+	assert.Equal(t, "GET", findings[1].Method)
+	assert.Equal(t, "", findings[1].Param)
+}
+
+func TestParseZAPXML(t *testing.T) {
+	findings, err := Parse(FormatZAPXML, "phet", 42, readFile(t, "zap.xml"))
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 2)
+	f := findings[0]
+	assert.Equal(t, "10038", f.PluginID)
+	assert.Equal(t, "693", f.CweID)
+	assert.Equal(t, "Medium", f.Risk)
+	assert.Equal(t, "High", f.Confidence)
+	assert.Equal(t, "https://phet-dev.colorado.edu/", f.URL)
+	assert.Equal(t, "Ensure that your web server sets the Content-Security-Policy header.", f.Solution)
+	assert.Equal(t, finding.Fingerprint("phet", "10038", "https://phet-dev.colorado.edu/", "GET", ""), f.Fingerprint)
+}
+
+func TestParseZAPJSON(t *testing.T) {
+	findings, err := Parse(FormatZAPJSON, "phet", 42, readFile(t, "../../zapScanner/mocks/scan_result.json"))
+
+	assert.Nil(t, err)
+	assert.Len(t, findings, 7)
+}
+
+func TestParseRejectsOtherFormats(t *testing.T) {
+	_, err := Parse(FormatBurp, "phet", 42, readFile(t, "zap.xml"))
+	assert.EqualError(t, err, "invalid Burp XML: expected element type <issues> but have <OWASPZAPReport>")
+
+	_, err = Parse(FormatZAPXML, "phet", 42, readFile(t, "burp.xml"))
+	assert.EqualError(t, err, "invalid ZAP XML report: expected element type <OWASPZAPReport> but have <issues>")
+
+	_, err = Parse("nikto", "phet", 42, nil)
+	assert.EqualError(t, err, `unknown format "nikto"`)
+}
+
+func TestSource(t *testing.T) {
+	s, ok := Source(FormatZAPXML)
+	assert.True(t, ok)
+	assert.Equal(t, finding.SourceZAP, s)
+
+	_, ok = Source("nikto")
+	assert.False(t, ok)
+}
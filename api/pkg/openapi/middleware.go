@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options of Middleware.
+type Options struct {
+	// Authenticate is called before the validation of the operations the document secures, so
+	// unauthenticated requests are rejected as such. It writes the response when it returns false.
+	Authenticate func(c *gin.Context) bool
+	// ValidateResponses buffers the responses to check them against the contract too.
+	ValidateResponses bool
+	// OnRequestError writes the response to a request the contract doesn't allow, the request is
+	// aborted afterwards.
+	OnRequestError func(c *gin.Context, err error)
+	// OnResponseError is called with responses that don't match the contract, they are sent anyway.
+	OnResponseError func(c *gin.Context, err error)
+}
+
+// Middleware validates the requests of the routes the document describes: their path, query and
+// header parameters and their JSON body. Routes the document doesn't describe are let through.
+// The body is read and put back, so handlers and the HMAC check still see it.
+func Middleware(d *Document, o Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := d.Operation(c.Request.Method, c.FullPath())
+		if op == nil {
+			c.Next()
+			return
+		}
+		if o.Authenticate != nil && d.Secured(op) && !o.Authenticate(c) {
+			c.Abort()
+			return
+		}
+		if err := d.ValidateRequest(op, c); err != nil {
+			o.OnRequestError(c, err)
+			c.Abort()
+			return
+		}
+		if !o.ValidateResponses {
+			c.Next()
+			return
+		}
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if err := d.ValidateResponse(op, w.Status(), w.Header().Get("Content-Type"), w.body.Bytes()); err != nil {
+			o.OnResponseError(c, fmt.Errorf("%s %s: %w", c.Request.Method, c.FullPath(), err))
+		}
+	}
+}
+
+// ValidateRequest checks the parameters and the body of a request to a route of the operation.
+func (d *Document) ValidateRequest(op *Operation, c *gin.Context) error {
+	if err := d.ValidateParameters(op, c.Param, c.Request.URL.Query(), c.GetHeader); err != nil {
+		return err
+	}
+	if op.RequestBody == nil || c.Request.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return invalid("error reading body: %v", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return invalid("body is required")
+		}
+		return nil
+	}
+	// Clients don't always say they send JSON
+	contentType := c.ContentType()
+	if contentType != "" && !isJSON(contentType) {
+		return nil
+	}
+	m, ok := op.RequestBody.Content["application/json"]
+	if !ok || m.Schema == nil {
+		return nil
+	}
+	return d.ValidateJSON(m.Schema, "body", body)
+}
+
+// ValidateResponse checks the status, the content type and the JSON body of a response.
+func (d *Document) ValidateResponse(op *Operation, status int, contentType string, body []byte) error {
+	r, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if r, ok = op.Responses["default"]; !ok {
+			return invalid("undocumented status %d", status)
+		}
+	}
+	if len(r.Content) == 0 {
+		if len(body) > 0 {
+			return invalid("status %d has no body, got %d bytes", status, len(body))
+		}
+		return nil
+	}
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	m, ok := r.Content[mediaType]
+	if !ok {
+		if _, ok = r.Content["*/*"]; !ok {
+			return invalid("undocumented content type %q for status %d", contentType, status)
+		}
+		// Any content, there's no schema to check
+		return nil
+	}
+	if m.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+	if err := d.ValidateJSON(m.Schema, "body", body); err != nil {
+		return fmt.Errorf("status %d: %w", status, err)
+	}
+	return nil
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
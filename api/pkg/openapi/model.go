@@ -0,0 +1,113 @@
+package openapi
+
+import "strings"
+
+// Document is the subset of an OpenAPI 3.0 document the API contract uses. Parameters, request
+// bodies and responses can be components referenced with $ref, schemas can reference
+// #/components/schemas.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Security   []map[string][]string `json:"security"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+
+	// operations by method and gin route, e.g. "GET /scans/:id/findings"
+	operations map[string]*Operation
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+type PathItem struct {
+	Get    *Operation `json:"get"`
+	Post   *Operation `json:"post"`
+	Put    *Operation `json:"put"`
+	Delete *Operation `json:"delete"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security overrides the requirements of the document, an empty list makes the operation public
+	Security *[]map[string][]string `json:"security"`
+}
+
+// Secured tells whether requests to the operation have to be authenticated.
+func (d *Document) Secured(op *Operation) bool {
+	if op.Security != nil {
+		return len(*op.Security) > 0
+	}
+	return len(d.Security) > 0
+}
+
+// Parameter is a path, query or header parameter. Array query parameters are comma-separated.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType describes a body by content type. Only JSON bodies are checked against their schema,
+// */* matches any content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema the contract uses. Properties not listed are allowed, and
+// checked against AdditionalProperties when it's set.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+}
+
+// Route is an operation of the contract with its path in gin's syntax.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// ginPath turns the path template /scans/{id} into gin's /scans/:id.
+func ginPath(p string) string {
+	p = strings.ReplaceAll(p, "{", ":")
+	return strings.ReplaceAll(p, "}", "")
+}
+
+func isJSON(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
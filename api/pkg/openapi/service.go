@@ -0,0 +1,157 @@
+package openapi
+
+import (
+	// The contract is compiled into the binary
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+var contract *Document
+
+func init() {
+	var err error
+	if contract, err = Load(spec); err != nil {
+		panic("invalid OpenAPI contract: " + err.Error())
+	}
+}
+
+// Spec returns the OpenAPI document of the API as it's served.
+func Spec() []byte {
+	return spec
+}
+
+// Contract returns the parsed OpenAPI document of the API.
+func Contract() *Document {
+	return contract
+}
+
+// Load parses an OpenAPI document, resolving the $ref of its parameters and responses. A
+// reference to a component that doesn't exist is an error.
+func Load(data []byte) (*Document, error) {
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	d.operations = map[string]*Operation{}
+	for p, item := range d.Paths {
+		for method, op := range item.methods() {
+			for i, param := range op.Parameters {
+				if param.Ref == "" {
+					continue
+				}
+				resolved, ok := d.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown parameter %s", method, p, param.Ref)
+				}
+				op.Parameters[i] = resolved
+			}
+			for code, r := range op.Responses {
+				if r.Ref == "" {
+					continue
+				}
+				resolved, ok := d.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown response %s", method, p, r.Ref)
+				}
+				op.Responses[code] = resolved
+			}
+			if err := d.checkRefs(op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, p, err)
+			}
+			d.operations[method+" "+ginPath(p)] = op
+		}
+	}
+	return &d, nil
+}
+
+// Operation returns the operation of a method and a gin route, nil when the contract doesn't
+// document it.
+func (d *Document) Operation(method, route string) *Operation {
+	return d.operations[method+" "+route]
+}
+
+// Routes lists the operations of the contract, sorted by path and method.
+func (d *Document) Routes() []Route {
+	routes := []Route{}
+	for k := range d.operations {
+		parts := strings.SplitN(k, " ", 2)
+		routes = append(routes, Route{Method: parts[0], Path: parts[1]})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (item *PathItem) methods() map[string]*Operation {
+	m := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		http.MethodGet: item.Get, http.MethodPost: item.Post, http.MethodPut: item.Put, http.MethodDelete: item.Delete,
+	} {
+		if op != nil {
+			m[method] = op
+		}
+	}
+	return m
+}
+
+// checkRefs makes sure every schema an operation references exists.
+func (d *Document) checkRefs(op *Operation) error {
+	schemas := []*Schema{}
+	for _, p := range op.Parameters {
+		schemas = append(schemas, p.Schema)
+	}
+	if op.RequestBody != nil {
+		for _, m := range op.RequestBody.Content {
+			schemas = append(schemas, m.Schema)
+		}
+	}
+	for _, r := range op.Responses {
+		for _, m := range r.Content {
+			schemas = append(schemas, m.Schema)
+		}
+	}
+	seen := map[*Schema]bool{}
+	for len(schemas) > 0 {
+		s := schemas[len(schemas)-1]
+		schemas = schemas[:len(schemas)-1]
+		if s == nil || seen[s] {
+			continue
+		}
+		seen[s] = true
+		if s.Ref != "" {
+			resolved, err := d.resolve(s)
+			if err != nil {
+				return err
+			}
+			schemas = append(schemas, resolved)
+			continue
+		}
+		schemas = append(schemas, s.Items, s.AdditionalProperties)
+		for _, p := range s.Properties {
+			schemas = append(schemas, p)
+		}
+	}
+	return nil
+}
+
+func (d *Document) resolve(s *Schema) (*Schema, error) {
+	for s != nil && s.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %s", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
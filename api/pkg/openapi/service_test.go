@@ -0,0 +1,250 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "security": [{"hmac": []}],
+  "paths": {
+    "/items/{id}": {
+      "put": {
+        "parameters": [
+          {"$ref": "#/components/parameters/Actor"},
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["a", "b", "c"]}}},
+          {"name": "dry_run", "in": "query", "schema": {"type": "boolean"}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 10}}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+        "responses": {
+          "200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+          "204": {"description": "no content"},
+          "default": {"description": "error", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/public": {"get": {"security": [], "responses": {"200": {"description": "ok"}}}}
+  },
+  "components": {
+    "parameters": {"Actor": {"name": "Actor", "in": "header", "required": true, "schema": {"type": "string"}}},
+    "schemas": {
+      "Item": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string", "minLength": 1},
+          "order": {"type": "string", "enum": ["asc", "desc"]},
+          "size": {"type": "integer", "minimum": 0},
+          "parent": {"type": "integer", "nullable": true},
+          "labels": {"type": "array", "items": {"type": "string"}},
+          "created_at": {"type": "string", "format": "date-time"},
+          "weights": {"type": "object", "additionalProperties": {"type": "number"}}
+        }
+      }
+    }
+  }
+}`
+
+func testDocument(t *testing.T) *Document {
+	d, err := Load([]byte(testSpec))
+	assert.Nil(t, err)
+	return d
+}
+
+func TestContractLoads(t *testing.T) {
+	assert.NotNil(t, Contract().Operation("GET", "/scans/:id/findings"))
+	assert.NotNil(t, Contract().Operation("DELETE", "/v2/scans/:id"))
+	assert.Nil(t, Contract().Operation("GET", "/scans/{id}/findings"))
+	assert.False(t, Contract().Secured(Contract().Operation("GET", "/ping")))
+	assert.True(t, Contract().Secured(Contract().Operation("POST", "/scan")))
+}
+
+func TestLoadUnknownReference(t *testing.T) {
+	_, err := Load([]byte(strings.Replace(testSpec, `"$ref": "#/components/schemas/Item"}}}},
+          "204"`, `"$ref": "#/components/schemas/Thing"}}}},
+          "204"`, 1)))
+	assert.EqualError(t, err, "PUT /items/{id}: unknown schema #/components/schemas/Thing")
+
+	_, err = Load([]byte(strings.Replace(testSpec, "#/components/parameters/Actor", "#/components/parameters/User", 1)))
+	assert.EqualError(t, err, "PUT /items/{id}: unknown parameter #/components/parameters/User")
+}
+
+func TestRoutes(t *testing.T) {
+	assert.Equal(t, []Route{{"PUT", "/items/:id"}, {"GET", "/public"}}, testDocument(t).Routes())
+}
+
+func TestValidateParameters(t *testing.T) {
+	d := testDocument(t)
+	op := d.Operation("PUT", "/items/:id")
+	path := func(id string) func(string) string {
+		return func(string) string { return id }
+	}
+	actor := func(h string) string { return map[string]string{"Actor": "alice"}[h] }
+
+	cases := map[string]string{
+		"":                 "",
+		"tags=a,c":         "",
+		"tags=a,d":         `invalid tags "d"`,
+		"dry_run=yes":      "dry_run must be true or false",
+		"limit=0":          "limit must be between 1 and 10",
+		"limit=five":       `invalid limit "five"`,
+		"limit=2.5":        `invalid limit "2.5"`,
+		"dry_run=1&tags=b": "",
+	}
+	for query, expected := range cases {
+		values, _ := url.ParseQuery(query)
+		err := d.ValidateParameters(op, path("7"), values, actor)
+		if expected == "" {
+			assert.Nil(t, err, query)
+			continue
+		}
+		assert.EqualError(t, err, expected, query)
+	}
+
+	assert.EqualError(t, d.ValidateParameters(op, path("x"), url.Values{}, actor), `invalid id "x"`)
+	assert.EqualError(t, d.ValidateParameters(op, path("7"), url.Values{}, func(string) string { return "" }),
+		"missing Actor header")
+}
+
+func TestValidateJSON(t *testing.T) {
+	d := testDocument(t)
+	item := &Schema{Ref: "#/components/schemas/Item"}
+
+	cases := map[string]string{
+		`{"name":"a"}`: "",
+		`{"name":"a","size":3,"parent":null,"extra":[1]}`:  "",
+		`{"name":"a","created_at":"2026-10-19T10:00:00Z"}`: "",
+		`{"name":"a","weights":{"x":1.5,"y":2}}`:           "",
+		`{"name":"a"} {}`:                                  "invalid JSON body",
+		`{"name":`:                                         "invalid JSON body",
+		`[]`:                                               "body must be an object",
+		`{}`:                                               "name is required",
+		`{"name":""}`:                                      "name can't be empty",
+		`{"name":1}`:                                       "name must be a string",
+		`{"name":"a","order":"up"}`:                        "order must be asc or desc",
+		`{"name":"a","size":"3"}`:                          "size must be an integer",
+		`{"name":"a","size":1.5}`:                          "size must be an integer",
+		`{"name":"a","size":-1}`:                           "size must be at least 0",
+		`{"name":"a","size":null}`:                         "size can't be null",
+		`{"name":"a","labels":["x",2]}`:                    "labels[1] must be a string",
+		`{"name":"a","created_at":"yesterday"}`:            "created_at must be an RFC 3339 timestamp",
+		`{"name":"a","weights":{"x":"heavy"}}`:             "weights.x must be a number",
+		`{"name":"a","labels":"x","size":"big"}`:           "labels must be an array",
+	}
+	for body, expected := range cases {
+		err := d.ValidateJSON(item, "body", []byte(body))
+		if expected == "" {
+			assert.Nil(t, err, body)
+			continue
+		}
+		assert.EqualError(t, err, expected, body)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := testDocument(t)
+	op := d.Operation("PUT", "/items/:id")
+
+	assert.Nil(t, d.ValidateResponse(op, 200, "application/json; charset=utf-8", []byte(`{"name":"a"}`)))
+	assert.Nil(t, d.ValidateResponse(op, 204, "", nil))
+	assert.Nil(t, d.ValidateResponse(op, 500, "text/plain", []byte("oops")))
+	assert.EqualError(t, d.ValidateResponse(op, 200, "application/json", []byte(`{"size":1}`)),
+		"status 200: name is required")
+	assert.EqualError(t, d.ValidateResponse(op, 200, "text/html", []byte(`<p>`)),
+		`undocumented content type "text/html" for status 200`)
+	assert.EqualError(t, d.ValidateResponse(op, 204, "", []byte("{}")), "status 204 has no body, got 2 bytes")
+
+	op = d.Operation("GET", "/public")
+	assert.EqualError(t, d.ValidateResponse(op, 404, "", nil), "undocumented status 404")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := testDocument(t)
+	var violations []string
+	authenticated := 0
+	r := gin.New()
+	r.Use(Middleware(d, Options{
+		Authenticate: func(c *gin.Context) bool {
+			authenticated++
+			if c.GetHeader("Signature") == "" {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return false
+			}
+			return true
+		},
+		ValidateResponses: true,
+		OnRequestError: func(c *gin.Context, err error) {
+			c.String(http.StatusBadRequest, err.Error())
+		},
+		OnResponseError: func(c *gin.Context, err error) {
+			violations = append(violations, err.Error())
+		},
+	}))
+	r.PUT("/items/:id", func(c *gin.Context) {
+		// The body is still there for the handler
+		b, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", b)
+	})
+	r.GET("/public", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	r.GET("/undocumented", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	send := func(method, path, body, signature string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Actor", "alice")
+		if signature != "" {
+			request.Header.Set("Signature", signature)
+		}
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+		return response
+	}
+
+	response := send("PUT", "/items/7", `{"name":"a"}`, "00")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"name":"a"}`, response.Body.String())
+
+	response = send("PUT", "/items/7?limit=20", `{"name":"a"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+
+	response = send("PUT", "/items/7?limit=20", `{"name":"a"}`, "00")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "limit must be between 1 and 10", response.Body.String())
+
+	response = send("PUT", "/items/7", "", "00")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "body is required", response.Body.String())
+
+	response = send("PUT", "/items/7", `{"name":"a","size":-2}`, "00")
+	assert.Equal(t, "size must be at least 0", response.Body.String())
+
+	// A JSON body sent as something else isn't checked, the handler's response is
+	request, _ := http.NewRequest("PUT", "/items/7", strings.NewReader(`{"size":1}`))
+	request.Header.Set("Actor", "alice")
+	request.Header.Set("Signature", "00")
+	request.Header.Set("Content-Type", "text/plain")
+	r.ServeHTTP(httptest.NewRecorder(), request)
+
+	send("GET", "/public", "", "")
+	send("GET", "/undocumented", "", "")
+
+	assert.Equal(t, 6, authenticated)
+	assert.Equal(t, []string{
+		"PUT /items/:id: status 200: name is required",
+		"GET /public: undocumented status 404",
+	}, violations)
+}
@@ -0,0 +1,239 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is a request or response the contract doesn't allow. The message names the
+// parameter or the property, e.g. "per_page must be between 1 and 500" or "findings[0].id must be
+// an integer".
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalid(format string, a ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, a...)}
+}
+
+// ValidateParameters checks the path, query and header parameters of a request. path returns a
+// path parameter, header a header.
+func (d *Document) ValidateParameters(op *Operation, path func(string) string, query url.Values,
+	header func(string) string) error {
+	for _, p := range op.Parameters {
+		var v string
+		var present bool
+		switch p.In {
+		case "path":
+			v = path(p.Name)
+			present = v != ""
+		case "query":
+			v = query.Get(p.Name)
+			present = v != ""
+		case "header":
+			v = header(p.Name)
+			present = v != ""
+		default:
+			continue
+		}
+		if !present {
+			if !p.Required {
+				continue
+			}
+			if p.In == "header" {
+				return invalid("missing %s header", p.Name)
+			}
+			return invalid("%s is required", p.Name)
+		}
+		if err := d.validateParameter(p.Name, p.Schema, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Document) validateParameter(name string, s *Schema, raw string) error {
+	s, err := d.resolve(s)
+	if err != nil || s == nil {
+		return err
+	}
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil || (s.Type == "integer" && n != float64(int64(n))) {
+			return invalid("invalid %s %q", name, raw)
+		}
+		return checkBounds(name, s, n)
+	case "boolean":
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return invalid("%s must be true or false", name)
+		}
+		return nil
+	case "array":
+		for _, item := range strings.Split(raw, ",") {
+			if err := d.validateParameter(name, s.Items, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkString(name, s, raw)
+}
+
+// ValidateJSON checks a JSON document against a schema, name is how errors call the document.
+func (d *Document) ValidateJSON(s *Schema, name string, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return invalid("invalid JSON %s", name)
+	}
+	return d.validateValue(s, name, v)
+}
+
+func (d *Document) validateValue(s *Schema, name string, v interface{}) error {
+	s, err := d.resolve(s)
+	if err != nil || s == nil {
+		return err
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return invalid("%s can't be null", name)
+	}
+	switch s.Type {
+	case "object":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid("%s must be an object", name)
+		}
+		for _, r := range s.Required {
+			if _, ok := o[r]; !ok {
+				return invalid("%s is required", join(name, r))
+			}
+		}
+		// Sorted so the first error is the same on every request
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ps, ok := s.Properties[k]
+			if !ok {
+				ps = s.AdditionalProperties
+			}
+			if err := d.validateValue(ps, join(name, k), o[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return invalid("%s must be an array", name)
+		}
+		for i, item := range a {
+			if err := d.validateValue(s.Items, fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok && s.Type == "integer" {
+			return invalid("%s must be an integer", name)
+		}
+		if !ok {
+			return invalid("%s must be a number", name)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return invalid("%s must be a number", name)
+		}
+		if s.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return invalid("%s must be an integer", name)
+			}
+		}
+		return checkBounds(name, s, f)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid("%s must be true or false", name)
+		}
+		return nil
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid("%s must be a string", name)
+		}
+		return checkString(name, s, str)
+	}
+	return nil
+}
+
+func checkString(name string, s *Schema, v string) error {
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		if len(s.Enum) == 2 {
+			return invalid("%s must be %v or %v", name, s.Enum[0], s.Enum[1])
+		}
+		return invalid("invalid %s %q", name, v)
+	}
+	if s.MinLength != nil && len(v) < *s.MinLength {
+		if *s.MinLength == 1 {
+			return invalid("%s can't be empty", name)
+		}
+		return invalid("%s must be at least %d characters", name, *s.MinLength)
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return invalid("%s must be an RFC 3339 timestamp", name)
+		}
+	}
+	return nil
+}
+
+func checkBounds(name string, s *Schema, n float64) error {
+	tooLow := s.Minimum != nil && n < *s.Minimum
+	tooHigh := s.Maximum != nil && n > *s.Maximum
+	if !tooLow && !tooHigh {
+		return nil
+	}
+	switch {
+	case s.Minimum != nil && s.Maximum != nil:
+		return invalid("%s must be between %v and %v", name, *s.Minimum, *s.Maximum)
+	case s.Minimum != nil && *s.Minimum == 1 && s.Type == "integer":
+		return invalid("%s must be a positive number", name)
+	case s.Minimum != nil:
+		return invalid("%s must be at least %v", name, *s.Minimum)
+	}
+	return invalid("%s must be at most %v", name, *s.Maximum)
+}
+
+func inEnum(enum []interface{}, v string) bool {
+	for _, e := range enum {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// join names a property of a document, the top-level properties of a body by their own name.
+func join(name, property string) string {
+	if name == "body" {
+		return property
+	}
+	return name + "." + property
+}
@@ -0,0 +1,68 @@
+package release
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// Statuses of a release. Targets are queued until the scheduler starts their scan, then they have
+// the status of the scan.
+const (
+	StatusRunning = "running"
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusError   = "error"
+	TargetQueued  = "queued"
+)
+
+// MaxTargets is how many targets a release can have.
+const MaxTargets = 20
+
+// ErrDuplicate is returned when a release ID was already submitted.
+var ErrDuplicate = errors.New("release already exists")
+
+// Release scans the targets of a platform release and gives one verdict for all of them. Score is
+// the score of the findings of all targets, set once every target has finished.
+type Release struct {
+	ID          int64      `json:"-"`
+	ReleaseID   string     `json:"id"`
+	Application string     `json:"application"`
+	Source      string     `json:"source"`
+	Status      string     `json:"status"`
+	Score       *float64   `json:"score,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Targets     []Target   `json:"targets"`
+}
+
+// Target is a service of a release, scanned as its own scan with the build ID <release>.<name>.
+// Profile is the ZAP scan policy of the active scan, the default policy when it's empty.
+type Target struct {
+	ID          int64    `json:"-"`
+	ReleaseID   int64    `json:"-"`
+	Name        string   `json:"name"`
+	Target      string   `json:"target"`
+	Application string   `json:"application"`
+	Profile     string   `json:"profile,omitempty"`
+	Scope       Scope    `json:"scope"`
+	ScanID      int64    `json:"-"`
+	BuildID     string   `json:"scan_id"`
+	Status      string   `json:"status"`
+	Score       *float64 `json:"score,omitempty"`
+	Findings    int      `json:"findings"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Scope limits the findings of a target to the URLs matching an include pattern, all of them when
+// there is none, and no exclude pattern. Patterns are regular expressions.
+type Scope struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Matcher is a compiled Scope. A nil Matcher has every URL in scope.
+type Matcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
@@ -0,0 +1,264 @@
+package release
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error of an insert breaking a unique key.
+const errDupEntry = 1062
+
+// BuildID is the build ID of the scan of a release target.
+func BuildID(releaseID string, name string) string {
+	return releaseID + "." + name
+}
+
+// Matcher compiles the patterns of the scope.
+func (s Scope) Matcher() (*Matcher, error) {
+	if len(s.Include) == 0 && len(s.Exclude) == 0 {
+		return nil, nil
+	}
+	m := &Matcher{}
+	for _, p := range s.Include {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope pattern %q: %v", p, err)
+		}
+		m.include = append(m.include, re)
+	}
+	for _, p := range s.Exclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope pattern %q: %v", p, err)
+		}
+		m.exclude = append(m.exclude, re)
+	}
+	return m, nil
+}
+
+// InScope reports whether findings on the URL count.
+func (m *Matcher) InScope(url string) bool {
+	if m == nil {
+		return true
+	}
+	for _, re := range m.exclude {
+		if re.MatchString(url) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, re := range m.include {
+		if re.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verdict is the status of a release once all its targets have finished: error when a target
+// couldn't be scanned or was cancelled, failed when a target failed or the findings of all the
+// targets together fail the gate, passed otherwise.
+func Verdict(targets []Target, aggregatePassed bool) string {
+	status := StatusPassed
+	for _, t := range targets {
+		switch t.Status {
+		case StatusPassed:
+		case StatusFailed:
+			if status == StatusPassed {
+				status = StatusFailed
+			}
+		default:
+			return StatusError
+		}
+	}
+	if !aggregatePassed {
+		return StatusFailed
+	}
+	return status
+}
+
+// AddReleaseToDB records a release with its targets, returning it with their IDs. A release ID
+// that was already submitted gives ErrDuplicate.
+func AddReleaseToDB(conn *sql.DB, r Release) (Release, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return r, err
+	}
+	q := "INSERT INTO releases(release_id, application, source, status, created_at) VALUES (?, ?, ?, ?, ?)"
+	res, err := tx.Exec(q, r.ReleaseID, r.Application, r.Source, r.Status, r.CreatedAt)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDupEntry {
+		tx.Rollback()
+		return r, ErrDuplicate
+	}
+	if err == nil {
+		r.ID, err = res.LastInsertId()
+	}
+	for i := range r.Targets {
+		if err != nil {
+			break
+		}
+		t := &r.Targets[i]
+		t.ReleaseID = r.ID
+		var scope []byte
+		if scope, err = json.Marshal(t.Scope); err != nil {
+			break
+		}
+		q = "INSERT INTO release_targets(release_id, name, target, application, profile, scope, build_id, status) " +
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+		if res, err = tx.Exec(q, r.ID, t.Name, t.Target, t.Application, t.Profile, string(scope), t.BuildID,
+			t.Status); err == nil {
+			t.ID, err = res.LastInsertId()
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return r, err
+	}
+	return r, tx.Commit()
+}
+
+// ReleaseFromDB returns a release with its targets in the order they were submitted, or
+// sql.ErrNoRows when there is none.
+func ReleaseFromDB(conn *sql.DB, releaseID string) (Release, error) {
+	var r Release
+	var score sql.NullFloat64
+	var completed sql.NullTime
+	q := "SELECT id, release_id, application, source, status, score, created_at, completed_at FROM releases " +
+		"WHERE release_id=?"
+	err := conn.QueryRow(q, releaseID).Scan(&r.ID, &r.ReleaseID, &r.Application, &r.Source, &r.Status, &score,
+		&r.CreatedAt, &completed)
+	if err != nil {
+		return r, err
+	}
+	if score.Valid {
+		r.Score = &score.Float64
+	}
+	if completed.Valid {
+		r.CompletedAt = &completed.Time
+	}
+
+	rows, err := conn.Query(targetQuery+"WHERE release_id=? ORDER BY id", r.ID)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	r.Targets = []Target{}
+	for rows.Next() {
+		t, err := scanTarget(rows)
+		if err != nil {
+			return r, err
+		}
+		r.Targets = append(r.Targets, t)
+	}
+	return r, rows.Err()
+}
+
+// TargetFromDB returns the release target scanned with a build ID, or sql.ErrNoRows when the build
+// isn't part of a release.
+func TargetFromDB(conn *sql.DB, buildID string) (Target, error) {
+	return scanTarget(conn.QueryRow(targetQuery+"WHERE build_id=? ORDER BY id DESC LIMIT 1", buildID))
+}
+
+const targetQuery = "SELECT id, release_id, name, target, application, profile, scope, COALESCE(scan_id, 0), " +
+	"build_id, status, score, findings, COALESCE(error, '') FROM release_targets "
+
+func scanTarget(row interface{ Scan(...interface{}) error }) (Target, error) {
+	var t Target
+	var scope string
+	var score sql.NullFloat64
+	if err := row.Scan(&t.ID, &t.ReleaseID, &t.Name, &t.Target, &t.Application, &t.Profile, &scope, &t.ScanID,
+		&t.BuildID, &t.Status, &score, &t.Findings, &t.Error); err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal([]byte(scope), &t.Scope); err != nil {
+		return t, err
+	}
+	if score.Valid {
+		t.Score = &score.Float64
+	}
+	return t, nil
+}
+
+// UpdateTargetInDB records the scan of a target and its result.
+func UpdateTargetInDB(conn *sql.DB, t Target) error {
+	var scanID interface{}
+	if t.ScanID > 0 {
+		scanID = t.ScanID
+	}
+	q := "UPDATE release_targets SET scan_id=?, status=?, score=?, findings=?, error=? WHERE id=?"
+	_, err := conn.Exec(q, scanID, t.Status, t.Score, t.Findings, t.Error, t.ID)
+	return err
+}
+
+// FinishReleaseInDB records the verdict of a release. A release that was already given up as
+// abandoned keeps its error.
+func FinishReleaseInDB(conn *sql.DB, id int64, status string, score *float64, at time.Time) error {
+	q := "UPDATE releases SET status=?, score=?, completed_at=? WHERE id=? AND status='running'"
+	_, err := conn.Exec(q, status, score, at, id)
+	return err
+}
+
+// HeartbeatReleaseInDB records that the runner of a release is still alive.
+func HeartbeatReleaseInDB(conn *sql.DB, id int64, at time.Time) error {
+	_, err := conn.Exec("UPDATE releases SET heartbeat_at=? WHERE id=? AND status='running'", at, id)
+	return err
+}
+
+// FailStaleReleasesInDB ends in error the running releases whose runner hasn't been heard of since
+// before, because the replica running them stopped. Their unfinished targets get the reason as
+// error. It returns the IDs of the releases.
+func FailStaleReleasesInDB(conn *sql.DB, before time.Time, reason string, at time.Time) ([]string, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	q := "SELECT id, release_id FROM releases WHERE status='running' AND COALESCE(heartbeat_at, created_at)<? " +
+		"FOR UPDATE"
+	rows, err := tx.Query(q, before)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	ids := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var releaseID string
+		if err = rows.Scan(&id, &releaseID); err != nil {
+			break
+		}
+		ids[id] = releaseID
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	var failed []string
+	for id, releaseID := range ids {
+		if err != nil {
+			break
+		}
+		q = "UPDATE release_targets SET status=?, error=? WHERE release_id=? AND status NOT IN " +
+			"('passed', 'failed', 'error', 'cancelled')"
+		if _, err = tx.Exec(q, StatusError, reason, id); err != nil {
+			break
+		}
+		q = "UPDATE releases SET status=?, completed_at=? WHERE id=?"
+		if _, err = tx.Exec(q, StatusError, at, id); err == nil {
+			failed = append(failed, releaseID)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return failed, tx.Commit()
+}
@@ -0,0 +1,167 @@
+package release
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var targetColumns = []string{"id", "release_id", "name", "target", "application", "profile", "scope", "scan_id",
+	"build_id", "status", "score", "findings", "error"}
+
+func TestScopeMatcher(t *testing.T) {
+	m, err := Scope{}.Matcher()
+	assert.Nil(t, err)
+	assert.True(t, m.InScope("https://anything/"))
+
+	m, err = Scope{Include: []string{`^https://shop/api/`}, Exclude: []string{`/logout$`}}.Matcher()
+	assert.Nil(t, err)
+	assert.True(t, m.InScope("https://shop/api/cart"))
+	assert.False(t, m.InScope("https://shop/api/logout"))
+	assert.False(t, m.InScope("https://shop/static/app.js"))
+
+	m, err = Scope{Exclude: []string{`/health`}}.Matcher()
+	assert.Nil(t, err)
+	assert.True(t, m.InScope("https://shop/"))
+	assert.False(t, m.InScope("https://shop/health"))
+
+	_, err = Scope{Include: []string{"("}}.Matcher()
+	assert.EqualError(t, err, "invalid scope pattern \"(\": error parsing regexp: missing closing ): `(`")
+}
+
+func TestVerdict(t *testing.T) {
+	passed, failed := Target{Status: StatusPassed}, Target{Status: StatusFailed}
+	assert.Equal(t, StatusPassed, Verdict([]Target{passed, passed}, true))
+	assert.Equal(t, StatusFailed, Verdict([]Target{passed, passed}, false))
+	assert.Equal(t, StatusFailed, Verdict([]Target{failed, passed}, true))
+	assert.Equal(t, StatusError, Verdict([]Target{failed, {Status: StatusError}}, false))
+	assert.Equal(t, StatusError, Verdict([]Target{passed, {Status: "cancelled"}}, true))
+}
+
+func TestAddReleaseToDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	r := Release{ReleaseID: "platform-1.4", Application: "platform", Source: "github", Status: StatusRunning,
+		CreatedAt: at, Targets: []Target{
+			{Name: "cart", Target: "https://cart", Application: "cart", BuildID: "platform-1.4.cart",
+				Status: TargetQueued},
+			{Name: "shop", Target: "https://shop", Application: "shop", Profile: "api-only",
+				Scope: Scope{Include: []string{"^https://shop/api/"}}, BuildID: "platform-1.4.shop", Status: TargetQueued},
+		}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO releases(release_id, application, source, status, created_at)")).
+		WithArgs("platform-1.4", "platform", "github", "running", at).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO release_targets(")).
+		WithArgs(int64(3), "cart", "https://cart", "cart", "", `{}`, "platform-1.4.cart", "queued").
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO release_targets(")).
+		WithArgs(int64(3), "shop", "https://shop", "shop", "api-only", `{"include":["^https://shop/api/"]}`,
+			"platform-1.4.shop", "queued").
+		WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectCommit()
+
+	r, err := AddReleaseToDB(db, r)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), r.ID)
+	assert.Equal(t, []int64{5, 6}, []int64{r.Targets[0].ID, r.Targets[1].ID})
+	assert.Equal(t, int64(3), r.Targets[1].ReleaseID)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO releases(")).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'platform-1.4'"})
+	mock.ExpectRollback()
+
+	_, err = AddReleaseToDB(db, r)
+	assert.Equal(t, ErrDuplicate, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE release_id=?")).WithArgs("platform-1.4").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "release_id", "application", "source", "status", "score",
+			"created_at", "completed_at"}).
+			AddRow(3, "platform-1.4", "platform", "github", "running", nil, at, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE release_id=? ORDER BY id")).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(targetColumns).
+			AddRow(5, 3, "cart", "https://cart", "cart", "", `{}`, 11, "platform-1.4.cart", "passed", 2.5, 1, "").
+			AddRow(6, 3, "shop", "https://shop", "shop", "api-only", `{"include":["^https://shop/api/"]}`, 0,
+				"platform-1.4.shop", "queued", nil, 0, ""))
+
+	r, err := ReleaseFromDB(db, "platform-1.4")
+	assert.Nil(t, err)
+	score := 2.5
+	assert.Equal(t, Release{ID: 3, ReleaseID: "platform-1.4", Application: "platform", Source: "github",
+		Status: StatusRunning, CreatedAt: at, Targets: []Target{
+			{ID: 5, ReleaseID: 3, Name: "cart", Target: "https://cart", Application: "cart", ScanID: 11,
+				BuildID: "platform-1.4.cart", Status: StatusPassed, Score: &score, Findings: 1},
+			{ID: 6, ReleaseID: 3, Name: "shop", Target: "https://shop", Application: "shop", Profile: "api-only",
+				Scope: Scope{Include: []string{"^https://shop/api/"}}, BuildID: "platform-1.4.shop",
+				Status: TargetQueued},
+		}}, r)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTargetFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE build_id=?")).WithArgs("platform-1.4.shop").
+		WillReturnRows(sqlmock.NewRows(targetColumns).
+			AddRow(6, 3, "shop", "https://shop", "shop", "api-only", `{"exclude":["/health$"]}`, 12,
+				"platform-1.4.shop", "failed", nil, 3, ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM release_targets WHERE build_id=?")).WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows(targetColumns))
+
+	tg, err := TargetFromDB(db, "platform-1.4.shop")
+	assert.Nil(t, err)
+	assert.Equal(t, "api-only", tg.Profile)
+	assert.Equal(t, Scope{Exclude: []string{"/health$"}}, tg.Scope)
+	_, err = TargetFromDB(db, "abcde-1234")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestFailStaleReleasesInDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	before := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	at := before.Add(5 * time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM releases WHERE status='running' AND COALESCE(heartbeat_at, created_at)<? FOR UPDATE")).
+		WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "release_id"}).AddRow(3, "platform-1.4"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE release_targets SET status=?, error=? WHERE release_id=? AND status NOT IN")).
+		WithArgs(StatusError, "abandoned", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE releases SET status=?, completed_at=? WHERE id=?")).
+		WithArgs(StatusError, at, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	failed, err := FailStaleReleasesInDB(db, before, "abandoned", at)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"platform-1.4"}, failed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestFinishReleaseKeepsAbandonedError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE releases SET status=?, score=?, completed_at=? WHERE id=? AND status='running'")).
+		WithArgs(StatusPassed, nil, at, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, FinishReleaseInDB(db, 3, StatusPassed, nil, at))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
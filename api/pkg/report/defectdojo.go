@@ -0,0 +1,137 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"src/pkg/scoring"
+)
+
+const dateLayout = "2006-01-02"
+
+var dojoSeverity = map[string]string{
+	"critical": "Critical",
+	"high":     "High",
+	"medium":   "Medium",
+	"low":      "Low",
+}
+
+// dojoReport is DefectDojo's Generic Findings Import format.
+type dojoReport struct {
+	Findings []dojoFinding `json:"findings"`
+}
+
+type dojoFinding struct {
+	Title            string         `json:"title"`
+	Description      string         `json:"description"`
+	Severity         string         `json:"severity"`
+	Mitigation       string         `json:"mitigation,omitempty"`
+	References       string         `json:"references,omitempty"`
+	CWE              int            `json:"cwe,omitempty"`
+	Date             string         `json:"date,omitempty"`
+	Active           bool           `json:"active"`
+	Verified         bool           `json:"verified"`
+	FalsePositive    bool           `json:"false_p"`
+	RiskAccepted     bool           `json:"risk_accepted"`
+	StaticFinding    bool           `json:"static_finding"`
+	DynamicFinding   bool           `json:"dynamic_finding"`
+	UniqueIDFromTool string         `json:"unique_id_from_tool"`
+	VulnIDFromTool   string         `json:"vuln_id_from_tool"`
+	Param            string         `json:"param,omitempty"`
+	Payload          string         `json:"payload,omitempty"`
+	Endpoints        []dojoEndpoint `json:"endpoints,omitempty"`
+}
+
+type dojoEndpoint struct {
+	Protocol string `json:"protocol,omitempty"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Query    string `json:"query,omitempty"`
+}
+
+// WriteDefectDojo renders the report in DefectDojo's Generic Findings Import JSON. The issue
+// fingerprint is the tool's unique ID so reimports match findings across builds. Suppressed
+// findings are exported as accepted risks, findings confirmed by SAST as verified.
+func WriteDefectDojo(w io.Writer, r Report) error {
+	doc := dojoReport{Findings: []dojoFinding{}}
+	date := ""
+	if !r.Scan.Created_at.IsZero() {
+		date = r.Scan.Created_at.Format(dateLayout)
+	}
+	for _, f := range r.Findings {
+		rule := r.Rule(f)
+		severity := dojoSeverity[rule.Severity]
+		if rule.Unclassified && scoring.NormalizeRisk(f.Risk) == scoring.RiskInformational {
+			severity = "Info"
+		}
+		cwe, _ := strconv.Atoi(rule.CweID)
+		falsePositive := strings.EqualFold(f.Confidence, "False Positive")
+		df := dojoFinding{
+			Title:            rule.Name,
+			Description:      dojoDescription(f.Method, f.URL, f.Param, f.Attack, f.Evidence, f.Risk, f.Confidence),
+			Severity:         severity,
+			Mitigation:       rule.Solution,
+			References:       strings.Join(rule.References, "\n"),
+			CWE:              cwe,
+			Date:             date,
+			Active:           !f.Suppressed && !falsePositive,
+			Verified:         f.SASTResultID > 0 || strings.EqualFold(f.Confidence, "Confirmed"),
+			FalsePositive:    falsePositive,
+			RiskAccepted:     f.Suppressed,
+			DynamicFinding:   true,
+			UniqueIDFromTool: f.Fingerprint,
+			VulnIDFromTool:   rule.ID,
+			Param:            f.Param,
+			Payload:          f.Attack,
+		}
+		if e, ok := dojoURLEndpoint(f.URL); ok {
+			df.Endpoints = []dojoEndpoint{e}
+		}
+		doc.Findings = append(doc.Findings, df)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
+
+func dojoDescription(method, u, param, attack, evidence, risk, confidence string) string {
+	lines := []string{"**URL:** " + u}
+	if method != "" {
+		lines = append(lines, "**Method:** "+method)
+	}
+	if param != "" {
+		lines = append(lines, "**Parameter:** "+param)
+	}
+	if attack != "" {
+		lines = append(lines, "**Attack:** "+attack)
+	}
+	if evidence != "" {
+		lines = append(lines, "**Evidence:** "+evidence)
+	}
+	lines = append(lines, "**Risk:** "+risk, "**Confidence:** "+confidence)
+	return strings.Join(lines, "\n\n")
+}
+
+// dojoURLEndpoint splits a finding URL the way DefectDojo stores endpoints, paths without their
+// leading slash.
+func dojoURLEndpoint(raw string) (dojoEndpoint, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return dojoEndpoint{}, false
+	}
+	e := dojoEndpoint{
+		Protocol: u.Scheme,
+		Host:     u.Hostname(),
+		Path:     strings.TrimLeft(u.EscapedPath(), "/"),
+		Query:    u.RawQuery,
+	}
+	if p := u.Port(); p != "" {
+		e.Port, _ = strconv.Atoi(p)
+	}
+	return e, true
+}
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+)
+
+// NewScanDiff compares base with head. The policy's catalog gives findings their severity.
+func NewScanDiff(base ScanResult, head ScanResult, policy gate.Policy) ScanDiff {
+	r := Report{Policy: policy}
+	d := Compare(base.Findings, head.Findings)
+	sd := ScanDiff{
+		Base:      diffScan(base.Scan),
+		Head:      diffScan(head.Scan),
+		New:       diffFindings(r, d.New),
+		Fixed:     diffFindings(r, d.Fixed),
+		Unchanged: diffFindings(r, d.Unchanged),
+		Surface:   CompareURLs(base.URLs, head.URLs),
+	}
+	sd.Summary = DiffSummary{
+		New:         len(sd.New),
+		Fixed:       len(sd.Fixed),
+		Unchanged:   len(sd.Unchanged),
+		URLsAdded:   len(sd.Surface.Added),
+		URLsRemoved: len(sd.Surface.Removed),
+	}
+	return sd
+}
+
+// CompareURLs returns the URLs whose normalized path is only in head (added) or only in base
+// (removed), so /items/1 and /items/2 are the same endpoint. Each path is listed once, sorted.
+func CompareURLs(base []string, head []string) SurfaceDiff {
+	inBase := paths(base)
+	inHead := paths(head)
+	return SurfaceDiff{Added: onlyIn(inHead, inBase), Removed: onlyIn(inBase, inHead)}
+}
+
+// WriteDiffMarkdown renders the diff as a summary that can be pasted into a pull request.
+func WriteDiffMarkdown(w io.Writer, d ScanDiff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### DAST changes %s → %s", code(d.Base.BuildID), code(d.Head.BuildID))
+	if d.Head.Application != "" {
+		fmt.Fprintf(&b, " (%s)", cell(d.Head.Application))
+	}
+	b.WriteString("\n\n")
+	b.WriteString("| | Count |\n|---|---|\n")
+	fmt.Fprintf(&b, "| 🆕 New findings | %d |\n", d.Summary.New)
+	fmt.Fprintf(&b, "| ✅ Fixed findings | %d |\n", d.Summary.Fixed)
+	fmt.Fprintf(&b, "| ➖ Unchanged findings | %d |\n", d.Summary.Unchanged)
+	fmt.Fprintf(&b, "| 🌐 URLs added | %d |\n", d.Summary.URLsAdded)
+	fmt.Fprintf(&b, "| 🚫 URLs removed | %d |\n", d.Summary.URLsRemoved)
+
+	writeFindingTable(&b, "New findings", d.New)
+	writeFindingTable(&b, "Fixed findings", d.Fixed)
+	writeURLList(&b, "URLs added", d.Surface.Added)
+	writeURLList(&b, "URLs removed", d.Surface.Removed)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFindingTable(b *strings.Builder, title string, findings []DiffFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n#### %s\n\n| Severity | Finding | Location |\n|---|---|---|\n", title)
+	for _, f := range findings {
+		name := cell(f.Name)
+		if f.Suppressed {
+			name += " (suppressed)"
+		}
+		fmt.Fprintf(b, "| %s | %s | %s |\n", f.Severity, name, code(location(diffToFinding(f))))
+	}
+}
+
+func writeURLList(b *strings.Builder, title string, urls []string) {
+	if len(urls) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n#### %s\n\n", title)
+	for _, u := range urls {
+		fmt.Fprintf(b, "- %s\n", code(u))
+	}
+}
+
+func diffScan(s scan.Scan) DiffScan {
+	return DiffScan{BuildID: s.Build_id, Application: s.Application, Status: s.Status}
+}
+
+func diffFindings(r Report, findings []finding.Finding) []DiffFinding {
+	result := []DiffFinding{}
+	for _, f := range findings {
+		rule := r.Rule(f)
+		result = append(result, DiffFinding{
+			Fingerprint: f.Fingerprint,
+			PluginID:    f.PluginID,
+			Name:        rule.Name,
+			Severity:    rule.Severity,
+			URL:         f.URL,
+			Method:      f.Method,
+			Param:       f.Param,
+			Suppressed:  f.Suppressed,
+		})
+	}
+	return result
+}
+
+func diffToFinding(f DiffFinding) finding.Finding {
+	return finding.Finding{URL: f.URL, Method: f.Method, Param: f.Param}
+}
+
+// paths maps the normalized path of each URL to the first URL seen with it.
+func paths(urls []string) map[string]string {
+	m := make(map[string]string)
+	for _, u := range urls {
+		p := finding.NormalizePath(u)
+		if _, ok := m[p]; !ok {
+			m[p] = u
+		}
+	}
+	return m
+}
+
+func onlyIn(a map[string]string, b map[string]string) []string {
+	result := []string{}
+	for p, u := range a {
+		if _, ok := b[p]; !ok {
+			result = append(result, u)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// cell makes text safe for a Markdown table cell.
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(s)
+}
+
+// code wraps text in a code span, backticks inside it would end the span early.
+func code(s string) string {
+	return "`" + strings.ReplaceAll(cell(s), "`", "'") + "`"
+}
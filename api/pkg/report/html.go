@@ -0,0 +1,134 @@
+package report
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"strings"
+
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+)
+
+//go:embed templates/report.html.tmpl templates/report.css
+var templates embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").Funcs(template.FuncMap{"title": title}).
+	ParseFS(templates, "templates/report.html.tmpl"))
+
+// Bodies of HTTP messages are cut at maxMessageBody bytes, so a large response doesn't bloat the
+// report.
+const maxMessageBody = 16 * 1024
+
+// Severities from the most to the least severe, the order findings are listed in.
+var severityOrder = []string{"critical", "high", "medium", "low"}
+
+type htmlView struct {
+	Scan        scan.Scan
+	Application string
+	Verdict     gate.Verdict
+	Mode        string
+	Threshold   float64
+	Explanation []string
+	Total       int
+	Groups      []htmlGroup
+	Previous    *htmlComparison
+	CSS         template.CSS
+}
+
+type htmlGroup struct {
+	Severity string
+	Count    int
+	Rules    []htmlRule
+}
+
+type htmlRule struct {
+	Rule
+	Score    float64
+	Findings []htmlFinding
+}
+
+type htmlFinding struct {
+	finding.Finding
+	Score   float64
+	Message *Message
+}
+
+type htmlComparison struct {
+	Scan      scan.Scan
+	New       []finding.Finding
+	Fixed     []finding.Finding
+	Unchanged int
+}
+
+// WriteHTML renders a self-contained HTML report: the verdict and why, the findings grouped by
+// severity and rule with their evidence, HTTP messages when the report has them, and remediation,
+// and what changed since the previous scan of the application when there is one.
+func WriteHTML(w io.Writer, r Report) error {
+	css, err := templates.ReadFile("templates/report.css")
+	if err != nil {
+		return err
+	}
+	verdict := r.Verdict()
+	v := htmlView{
+		Scan:        r.Scan,
+		Application: r.Scan.Application,
+		Verdict:     verdict,
+		Mode:        r.Policy.Scoring.Mode,
+		Threshold:   r.Policy.Scoring.Threshold,
+		Explanation: r.Explanation(verdict),
+		Total:       len(r.Findings),
+		CSS:         template.CSS(css),
+	}
+
+	rules := make(map[string]*htmlRule)
+	bySeverity := make(map[string][]*htmlRule)
+	for _, f := range r.Findings {
+		rule := r.Rule(f)
+		hr, ok := rules[rule.ID]
+		if !ok {
+			hr = &htmlRule{Rule: rule}
+			rules[rule.ID] = hr
+			bySeverity[rule.Severity] = append(bySeverity[rule.Severity], hr)
+		}
+		score := r.Policy.Score(f)
+		hr.Score += score
+		hf := htmlFinding{Finding: f, Score: score}
+		if m, ok := r.Messages[f.MessageID]; ok && f.MessageID != "" {
+			m.RequestBody, m.ResponseBody = messageBody(m.RequestBody), messageBody(m.ResponseBody)
+			hf.Message = &m
+		}
+		hr.Findings = append(hr.Findings, hf)
+	}
+	for _, severity := range severityOrder {
+		g := htmlGroup{Severity: severity}
+		for _, hr := range bySeverity[severity] {
+			g.Rules = append(g.Rules, *hr)
+			g.Count += len(hr.Findings)
+		}
+		if g.Count > 0 {
+			v.Groups = append(v.Groups, g)
+		}
+	}
+
+	if r.Previous != nil {
+		d := Compare(r.Previous.Findings, r.Findings)
+		v.Previous = &htmlComparison{Scan: r.Previous.Scan, New: d.New, Fixed: d.Fixed, Unchanged: len(d.Unchanged)}
+	}
+	return htmlTemplate.Execute(w, v)
+}
+
+func messageBody(body string) string {
+	if len(body) <= maxMessageBody {
+		return body
+	}
+	return strings.ToValidUTF8(body[:maxMessageBody], "") + "\n[truncated]"
+}
+
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+)
+
+const junitTimestamp = "2006-01-02T15:04:05"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	Skipped   *junitSkipped  `xml:"skipped"`
+	SystemOut *junitOutput   `xml:"system-out"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit renders the report as JUnit XML for CI test tabs. The gate is the first test case,
+// failing unless the scan was recorded as passed, with the verdict of the current policy labelled
+// as such; a scan that hasn't finished is gated with the current policy. Every rule is another
+// case, with a failure per finding that adds to the score. Rules whose findings are all suppressed
+// are skipped.
+func WriteJUnit(w io.Writer, r Report) error {
+	application := r.Scan.Application
+	if application == "" {
+		application = "dast"
+	}
+	verdict := r.Verdict()
+	suite := junitTestSuite{
+		Name: application + "/" + r.Scan.Build_id,
+		Properties: []junitProperty{
+			{Name: "application", Value: r.Scan.Application},
+			{Name: "build_id", Value: r.Scan.Build_id},
+			{Name: "status", Value: r.Scan.Status},
+			{Name: "current_verdict", Value: verdictStatus(verdict)},
+			{Name: "score", Value: fmt.Sprintf("%.2f", verdict.Score)},
+			{Name: "threshold", Value: fmt.Sprintf("%.2f", r.Policy.Scoring.Threshold)},
+			{Name: "scoring_mode", Value: r.Policy.Scoring.Mode},
+		},
+	}
+	if !r.Scan.Created_at.IsZero() {
+		suite.Timestamp = r.Scan.Created_at.UTC().Format(junitTimestamp)
+	}
+
+	gateCase := junitTestCase{Name: "gate", ClassName: "dast." + application}
+	passed := verdict.Passed
+	current := fmt.Sprintf("current %s policy: score %.2f, threshold %.2f, %d unmapped alerts, %s",
+		r.Policy.Scoring.Mode, verdict.Score, r.Policy.Scoring.Threshold, verdict.Unmapped, verdictStatus(verdict))
+	explanation := append([]string{"Recorded status: " + r.Scan.Status + ". The lines below use the current " +
+		r.Policy.Scoring.Mode + " policy."}, r.Explanation(verdict)...)
+	if scan.Finished(r.Scan.Status) {
+		passed = r.Scan.Status == scan.StatusPassed
+		current = "recorded status " + r.Scan.Status + "; " + current
+	}
+	if !passed {
+		gateCase.Failures = []junitFailure{{Message: current, Type: "gate", Text: strings.Join(explanation, "\n")}}
+	} else {
+		gateCase.SystemOut = &junitOutput{Text: strings.Join(append([]string{current}, r.Explanation(verdict)...), "\n")}
+	}
+	suite.Cases = append(suite.Cases, gateCase)
+
+	for _, rule := range r.Rules() {
+		tc := junitTestCase{Name: rule.ID + " " + rule.Name, ClassName: "dast." + application + "." + rule.Severity}
+		var out []string
+		total, suppressed := 0, 0
+		for _, f := range r.Findings {
+			if r.Rule(f).ID != rule.ID {
+				continue
+			}
+			total++
+			switch {
+			case f.Suppressed:
+				suppressed++
+				out = append(out, fmt.Sprintf("%s (suppressed: %s)", location(f), f.SuppressionReason))
+			case r.Policy.Score(f) > 0:
+				tc.Failures = append(tc.Failures, junitFailure{
+					Message: failureMessage(f),
+					Type:    rule.Severity,
+					Text:    failureText(f, rule, r.Policy.Score(f)),
+				})
+			default:
+				out = append(out, fmt.Sprintf("%s (doesn't add to the score)", location(f)))
+			}
+		}
+		if len(tc.Failures) == 0 && suppressed == total {
+			tc.Skipped = &junitSkipped{Message: fmt.Sprintf("%d suppressed findings", suppressed)}
+			suite.Skipped++
+		}
+		if len(out) > 0 {
+			tc.SystemOut = &junitOutput{Text: strings.Join(out, "\n")}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	for _, tc := range suite.Cases {
+		if len(tc.Failures) > 0 {
+			suite.Failures++
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	doc := junitTestSuites{Name: "dast", Tests: suite.Tests, Failures: suite.Failures, Suites: []junitTestSuite{suite}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func verdictStatus(v gate.Verdict) string {
+	if v.Passed {
+		return scan.StatusPassed
+	}
+	return scan.StatusFailed
+}
+
+func location(f finding.Finding) string {
+	l := strings.TrimSpace(f.Method + " " + f.URL)
+	if f.Param != "" {
+		l += " parameter " + f.Param
+	}
+	return l
+}
+
+func failureMessage(f finding.Finding) string {
+	m := location(f)
+	if f.Evidence != "" {
+		m += " evidence " + f.Evidence
+	}
+	return m
+}
+
+func failureText(f finding.Finding, rule Rule, score float64) string {
+	lines := []string{
+		"URL: " + f.URL,
+		"Method: " + f.Method,
+		"Parameter: " + f.Param,
+		"Attack: " + f.Attack,
+		"Evidence: " + f.Evidence,
+		"Risk: " + f.Risk + " (confidence " + f.Confidence + ")",
+		fmt.Sprintf("Score: %.2f", score),
+		"Fingerprint: " + f.Fingerprint,
+	}
+	if rule.CweID != "" && rule.CweID != "0" {
+		lines = append(lines, "CWE: "+rule.CweID)
+	}
+	if rule.Solution != "" {
+		lines = append(lines, "Solution: "+rule.Solution)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"src/pkg/finding"
+)
+
+var severityIcons = map[string]string{"critical": "🔴", "high": "🟠", "medium": "🟡", "low": "🔵"}
+
+const truncatedNote = "\n\n_Summary truncated, see the full report._\n"
+
+type markdownFinding struct {
+	finding.Finding
+	Rule  Rule
+	Score float64
+	New   bool
+}
+
+type markdownView struct {
+	r          Report
+	opts       MarkdownOptions
+	explain    []string
+	passed     bool
+	diff       *Diff
+	findings   []markdownFinding
+	suppressed []markdownFinding
+}
+
+// WriteMarkdown renders a compact summary of a scan to post on a merge request: the verdict, the
+// findings by severity, the top findings, what changed since the previous scan and which findings
+// are suppressed. It's shortened to opts.MaxLength by listing fewer findings.
+func WriteMarkdown(w io.Writer, r Report, opts MarkdownOptions) error {
+	if opts.Top < 0 {
+		opts.Top = 0
+	}
+	// Parentheses and spaces would end the link destination early
+	opts.ReportURL = strings.NewReplacer("(", "%28", ")", "%29", " ", "%20", "<", "%3C", ">", "%3E").
+		Replace(opts.ReportURL)
+	v := newMarkdownView(r, opts)
+	top := min(opts.Top, len(v.findings))
+	notes := min(opts.Top, len(v.suppressed))
+	s := v.render(top, notes)
+	for opts.MaxLength > 0 && len(s) > opts.MaxLength && top+notes > 0 {
+		if notes > 0 {
+			notes--
+		} else {
+			top--
+		}
+		s = v.render(top, notes)
+	}
+	if opts.MaxLength > 0 && len(s) > opts.MaxLength {
+		s = truncate(s, opts.MaxLength-len(truncatedNote)) + truncatedNote
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func newMarkdownView(r Report, opts MarkdownOptions) markdownView {
+	verdict := r.Verdict()
+	v := markdownView{r: r, opts: opts, explain: r.Explanation(verdict), passed: verdict.Passed}
+	isNew := map[string]bool{}
+	if r.Previous != nil {
+		d := Compare(r.Previous.Findings, r.Findings)
+		v.diff = &d
+		isNew = fingerprints(d.New)
+	}
+	for _, f := range r.Findings {
+		mf := markdownFinding{Finding: f, Rule: r.Rule(f), Score: r.Policy.Score(f), New: isNew[f.Fingerprint]}
+		if f.Suppressed {
+			v.suppressed = append(v.suppressed, mf)
+		} else {
+			v.findings = append(v.findings, mf)
+		}
+	}
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		a, b := v.findings[i], v.findings[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return severityRank(a.Rule.Severity) < severityRank(b.Rule.Severity)
+	})
+	return v
+}
+
+// render writes the summary with the first top findings and the first notes suppressed findings.
+func (v markdownView) render(top int, notes int) string {
+	var b strings.Builder
+	status, color := "failed", "red"
+	if v.passed {
+		status, color = "passed", "brightgreen"
+	}
+	fmt.Fprintf(&b, "### ![DAST %s](https://img.shields.io/badge/DAST-%s-%s) ", status, status, color)
+	if v.r.Scan.Application != "" {
+		b.WriteString(cell(v.r.Scan.Application) + " ")
+	}
+	b.WriteString(code(v.r.Scan.Build_id) + "\n\n")
+	b.WriteString(strings.Join(v.explain, " "))
+	if v.opts.ReportURL != "" {
+		fmt.Fprintf(&b, " [Full report](%s)", v.opts.ReportURL)
+	}
+	b.WriteString("\n")
+
+	if v.diff != nil {
+		fmt.Fprintf(&b, "\nCompared with build %s: **%d** new, **%d** fixed, **%d** unchanged.\n",
+			code(v.r.Previous.Scan.Build_id), len(v.diff.New), len(v.diff.Fixed), len(v.diff.Unchanged))
+	}
+	v.writeCounts(&b)
+
+	if top > 0 {
+		b.WriteString("\n#### Top findings\n\n| Severity | Finding | Location | Score |\n|---|---|---|---|\n")
+		for _, f := range v.findings[:top] {
+			name := v.ruleLink(f.Rule)
+			if f.New {
+				name += " 🆕"
+			}
+			fmt.Fprintf(&b, "| %s %s | %s | %s | %.2f |\n", severityIcons[f.Rule.Severity], title(f.Rule.Severity), name,
+				code(location(f.Finding)), f.Score)
+		}
+	}
+	if more := len(v.findings) - top; more > 0 {
+		fmt.Fprintf(&b, "\n_%d more findings%s._\n", more, v.inReport())
+	}
+
+	if len(v.suppressed) > 0 {
+		fmt.Fprintf(&b, "\n#### Suppressed\n\n%d findings are suppressed and don't count towards the gate.\n",
+			len(v.suppressed))
+		if notes > 0 {
+			b.WriteString("\n")
+		}
+		for _, f := range v.suppressed[:notes] {
+			reason := "no reason given"
+			if f.SuppressionReason != "" {
+				reason = cell(f.SuppressionReason)
+			}
+			fmt.Fprintf(&b, "- %s at %s: %s\n", v.ruleLink(f.Rule), code(location(f.Finding)), reason)
+		}
+		if more := len(v.suppressed) - notes; more > 0 && notes > 0 {
+			fmt.Fprintf(&b, "- _%d more%s_\n", more, v.inReport())
+		}
+	}
+	return b.String()
+}
+
+func (v markdownView) writeCounts(b *strings.Builder) {
+	if len(v.r.Findings) == 0 {
+		b.WriteString("\nNo findings.\n")
+		return
+	}
+	counts := map[string][3]int{}
+	for _, f := range append(append([]markdownFinding{}, v.findings...), v.suppressed...) {
+		c := counts[f.Rule.Severity]
+		c[0]++
+		if f.New {
+			c[1]++
+		}
+		if f.Suppressed {
+			c[2]++
+		}
+		counts[f.Rule.Severity] = c
+	}
+	b.WriteString("\n| Severity | Findings |")
+	if v.diff != nil {
+		b.WriteString(" New |")
+	}
+	b.WriteString(" Suppressed |\n|---|---|")
+	if v.diff != nil {
+		b.WriteString("---|")
+	}
+	b.WriteString("---|\n")
+	for _, severity := range severities(counts) {
+		c := counts[severity]
+		fmt.Fprintf(b, "| %s %s | %d |", severityIcons[severity], title(severity), c[0])
+		if v.diff != nil {
+			fmt.Fprintf(b, " %d |", c[1])
+		}
+		fmt.Fprintf(b, " %d |\n", c[2])
+	}
+}
+
+// ruleLink names the rule, linking it to its section of the full report when there is one.
+func (v markdownView) ruleLink(rule Rule) string {
+	name := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(cell(rule.Name))
+	if v.opts.ReportURL == "" {
+		return name
+	}
+	return fmt.Sprintf("[%s](%s#rule-%s)", name, v.opts.ReportURL, rule.ID)
+}
+
+func (v markdownView) inReport() string {
+	if v.opts.ReportURL == "" {
+		return " in the full report"
+	}
+	return fmt.Sprintf(" in the [full report](%s)", v.opts.ReportURL)
+}
+
+// severities lists the severities with findings, most severe first.
+func severities(counts map[string][3]int) []string {
+	var result []string
+	for s := range counts {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ri, rj := severityRank(result[i]), severityRank(result[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// severityRank orders severities from the most severe, unknown ones last.
+func severityRank(severity string) int {
+	for i, s := range severityOrder {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severityOrder)
+}
+
+// truncate cuts s to at most n bytes at the end of a line.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	if i := strings.LastIndex(s[:n], "\n"); i >= 0 {
+		return s[:i]
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
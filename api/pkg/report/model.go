@@ -0,0 +1,124 @@
+package report
+
+import (
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+)
+
+// Report formats.
+const (
+	FormatSARIF      = "sarif"
+	FormatJUnit      = "junit"
+	FormatHTML       = "html"
+	FormatJSON       = "json"
+	FormatMarkdown   = "markdown"
+	FormatDefectDojo = "defectdojo"
+)
+
+// Defaults of MarkdownOptions. GitHub rejects comments over 65536 characters.
+const (
+	DefaultMarkdownTop       = 10
+	DefaultMarkdownMaxLength = 65000
+)
+
+// Report holds what every report format is rendered from: the scan, its persisted findings and
+// the gate policy, whose catalog describes them.
+type Report struct {
+	Scan     scan.Scan
+	Findings []finding.Finding
+	Policy   gate.Policy
+	// Previous is the last finished scan of the same application before the reported one.
+	Previous *ScanResult
+	// Messages are the HTTP messages of findings by message ID, only read from ZAP when the scan is
+	// archived. The HTML report shows them under their findings.
+	Messages map[string]Message
+}
+
+// Message is the request ZAP sent for a finding and the response it got.
+type Message struct {
+	RequestHeader  string
+	RequestBody    string
+	ResponseHeader string
+	ResponseBody   string
+}
+
+// ScanResult is a scan with what it found. URLs is only loaded when it's needed.
+type ScanResult struct {
+	Scan     scan.Scan
+	Findings []finding.Finding
+	URLs     []string
+}
+
+// MarkdownOptions controls the pull request summary written by WriteMarkdown.
+type MarkdownOptions struct {
+	// Top is how many findings are listed, highest score first.
+	Top int
+	// MaxLength caps the summary in bytes, 0 means no limit. Listed findings and suppression
+	// notes are dropped until it fits.
+	MaxLength int
+	// ReportURL links the full HTML report, findings link to their rule in it.
+	ReportURL string
+}
+
+// Diff compares two scans of an application by issue fingerprint.
+type Diff struct {
+	New       []finding.Finding
+	Fixed     []finding.Finding
+	Unchanged []finding.Finding
+}
+
+// Rule describes the findings of one ZAP plugin, or of one CWE for findings without a plugin.
+// Findings without a catalog entry take their severity from the ZAP risk, informational alerts
+// count as low.
+type Rule struct {
+	ID           string
+	Name         string
+	CweID        string
+	Severity     string
+	Solution     string
+	References   []string
+	Unclassified bool
+}
+
+// ScanDiff is what changed between two scans of an application: findings matched by fingerprint
+// and the attack surface, URLs matched by normalized path.
+type ScanDiff struct {
+	Base      DiffScan      `json:"base"`
+	Head      DiffScan      `json:"head"`
+	Summary   DiffSummary   `json:"summary"`
+	New       []DiffFinding `json:"new"`
+	Fixed     []DiffFinding `json:"fixed"`
+	Unchanged []DiffFinding `json:"unchanged"`
+	Surface   SurfaceDiff   `json:"attack_surface"`
+}
+
+type DiffScan struct {
+	BuildID     string `json:"build_id"`
+	Application string `json:"application"`
+	Status      string `json:"status"`
+}
+
+type DiffSummary struct {
+	New         int `json:"new"`
+	Fixed       int `json:"fixed"`
+	Unchanged   int `json:"unchanged"`
+	URLsAdded   int `json:"urls_added"`
+	URLsRemoved int `json:"urls_removed"`
+}
+
+type DiffFinding struct {
+	Fingerprint string `json:"fingerprint"`
+	PluginID    string `json:"plugin_id"`
+	Name        string `json:"name"`
+	Severity    string `json:"severity"`
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	Param       string `json:"param"`
+	Suppressed  bool   `json:"suppressed"`
+}
+
+type SurfaceDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
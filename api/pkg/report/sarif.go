@@ -0,0 +1,217 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	sarifVersion     = "2.1.0"
+	sarifSchema      = "https://json.schemastore.org/sarif-2.1.0.json"
+	fingerprintKey   = "dastFingerprint/v1"
+	suppressionKind  = "external"
+	suppressionState = "accepted"
+)
+
+// GitHub code scanning ranks results by security-severity, a CVSS-like score.
+var securitySeverity = map[string]string{
+	"critical": "9.5",
+	"high":     "8.0",
+	"medium":   "5.5",
+	"low":      "3.0",
+}
+
+var sarifLevel = map[string]string{
+	"critical": "error",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "note",
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool              sarifTool              `json:"tool"`
+	AutomationDetails sarifAutomationDetails `json:"automationDetails"`
+	Results           []sarifResult          `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifAutomationDetails struct {
+	ID string `json:"id"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	Help                 *sarifMessage       `json:"help,omitempty"`
+	HelpURI              string              `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfiguration  `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperties struct {
+	Tags             []string `json:"tags"`
+	Severity         string   `json:"severity"`
+	SecuritySeverity string   `json:"security-severity"`
+	Unclassified     bool     `json:"unclassified,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                `json:"ruleId"`
+	RuleIndex           int                   `json:"ruleIndex"`
+	Level               string                `json:"level"`
+	Message             sarifMessage          `json:"message"`
+	Locations           []sarifLocation       `json:"locations"`
+	WebRequest          sarifWebRequest       `json:"webRequest"`
+	PartialFingerprints map[string]string     `json:"partialFingerprints"`
+	Suppressions        []sarifSuppression    `json:"suppressions"`
+	Properties          sarifResultProperties `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifWebRequest struct {
+	Method string `json:"method,omitempty"`
+	Target string `json:"target"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifResultProperties struct {
+	Param      string `json:"param,omitempty"`
+	Attack     string `json:"attack,omitempty"`
+	Evidence   string `json:"evidence,omitempty"`
+	Risk       string `json:"risk"`
+	Confidence string `json:"confidence"`
+}
+
+// WriteSARIF renders the report as a SARIF 2.1.0 log with one rule per ZAP plugin and one result
+// per finding. Results carry the issue fingerprint so code scanning tracks them across builds,
+// and an empty suppressions array means the finding was reviewed as not suppressed.
+func WriteSARIF(w io.Writer, r Report) error {
+	rules := r.Rules()
+	index := make(map[string]int)
+	driver := sarifDriver{Name: "OWASP ZAP", InformationURI: "https://www.zaproxy.org/", Rules: []sarifRule{}}
+	for i, rule := range rules {
+		index[rule.ID] = i
+		driver.Rules = append(driver.Rules, toSARIFRule(rule))
+	}
+
+	results := []sarifResult{}
+	for _, f := range r.Findings {
+		rule := r.Rule(f)
+		text := rule.Name + " at " + f.URL
+		if f.Param != "" {
+			text += " (parameter " + f.Param + ")"
+		}
+		suppressions := []sarifSuppression{}
+		if f.Suppressed {
+			suppressions = append(suppressions, sarifSuppression{
+				Kind:          suppressionKind,
+				Status:        suppressionState,
+				Justification: f.SuppressionReason,
+			})
+		}
+		results = append(results, sarifResult{
+			RuleID:    rule.ID,
+			RuleIndex: index[rule.ID],
+			Level:     sarifLevel[rule.Severity],
+			Message:   sarifMessage{Text: text},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.URL},
+			}}},
+			WebRequest:          sarifWebRequest{Method: f.Method, Target: f.URL},
+			PartialFingerprints: map[string]string{fingerprintKey: f.Fingerprint},
+			Suppressions:        suppressions,
+			Properties: sarifResultProperties{
+				Param:      f.Param,
+				Attack:     f.Attack,
+				Evidence:   f.Evidence,
+				Risk:       f.Risk,
+				Confidence: f.Confidence,
+			},
+		})
+	}
+
+	application := r.Scan.Application
+	if application == "" {
+		application = "dast"
+	}
+	doc := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:              sarifTool{Driver: driver},
+			AutomationDetails: sarifAutomationDetails{ID: application + "/" + r.Scan.Build_id},
+			Results:           results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
+
+func toSARIFRule(rule Rule) sarifRule {
+	tags := []string{"security"}
+	if rule.CweID != "" && rule.CweID != "0" {
+		tags = append(tags, "external/cwe/cwe-"+rule.CweID)
+	}
+	r := sarifRule{
+		ID:                   rule.ID,
+		Name:                 rule.Name,
+		ShortDescription:     sarifMessage{Text: rule.Name},
+		DefaultConfiguration: sarifConfiguration{Level: sarifLevel[rule.Severity]},
+		Properties: sarifRuleProperties{
+			Tags:             tags,
+			Severity:         rule.Severity,
+			SecuritySeverity: securitySeverity[rule.Severity],
+			Unclassified:     rule.Unclassified,
+		},
+	}
+	if solution := strings.TrimSpace(rule.Solution); solution != "" {
+		r.Help = &sarifMessage{Text: solution}
+	}
+	if len(rule.References) > 0 {
+		r.HelpURI = rule.References[0]
+	}
+	return r
+}
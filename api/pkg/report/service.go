@@ -0,0 +1,152 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+	"src/pkg/scoring"
+)
+
+func New(s scan.Scan, findings []finding.Finding, policy gate.Policy) Report {
+	return Report{Scan: s, Findings: findings, Policy: policy}
+}
+
+// Verdict evaluates the findings with the current policy, which may differ from the one the scan
+// was gated with.
+func (r Report) Verdict() gate.Verdict {
+	return r.Policy.Evaluate(r.Findings)
+}
+
+// Rule resolves the catalog entry of a finding like the gate does: by plugin ID, then CWE,
+// then the vulnerability it was stored with. The ZAP name is kept when the entry belongs to
+// another plugin that shares the CWE, and ZAP's solution when the entry has none.
+func (r Report) Rule(f finding.Finding) Rule {
+	rule := Rule{
+		ID:         gate.IssueKey(f),
+		Name:       f.Name,
+		CweID:      f.CweID,
+		Severity:   riskSeverity(f.Risk),
+		Solution:   f.Solution,
+		References: references(f.Reference),
+	}
+	e, ok := r.Policy.Vulnerabilities.Lookup(f.PluginID, f.CweID)
+	if !ok && f.VulnerabilityID > 0 {
+		e, ok = r.Policy.Vulnerabilities.ByID(f.VulnerabilityID)
+	}
+	if !ok {
+		rule.Unclassified = true
+		return rule
+	}
+	if e.Name != "" && (e.PluginID == "" || e.PluginID == f.PluginID) {
+		rule.Name = e.Name
+	}
+	if e.CweID > 0 {
+		rule.CweID = strconv.Itoa(e.CweID)
+	}
+	if e.Severity != "" {
+		rule.Severity = e.Severity
+	}
+	if e.Solution != "" {
+		rule.Solution = e.Solution
+	}
+	rule.Unclassified = e.Unclassified
+	return rule
+}
+
+// Rules returns the rules of the report in the order they first appear in the findings.
+func (r Report) Rules() []Rule {
+	var rules []Rule
+	seen := make(map[string]bool)
+	for _, f := range r.Findings {
+		rule := r.Rule(f)
+		if seen[rule.ID] {
+			continue
+		}
+		seen[rule.ID] = true
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Compare matches the findings of two scans by fingerprint. A fingerprint reported several
+// times appears once, with its first finding.
+func Compare(base []finding.Finding, head []finding.Finding) Diff {
+	d := Diff{New: []finding.Finding{}, Fixed: []finding.Finding{}, Unchanged: []finding.Finding{}}
+	inBase := fingerprints(base)
+	inHead := fingerprints(head)
+	seen := make(map[string]bool)
+	for _, f := range head {
+		if seen[f.Fingerprint] {
+			continue
+		}
+		seen[f.Fingerprint] = true
+		if inBase[f.Fingerprint] {
+			d.Unchanged = append(d.Unchanged, f)
+		} else {
+			d.New = append(d.New, f)
+		}
+	}
+	for _, f := range base {
+		if seen[f.Fingerprint] || inHead[f.Fingerprint] {
+			continue
+		}
+		seen[f.Fingerprint] = true
+		d.Fixed = append(d.Fixed, f)
+	}
+	return d
+}
+
+// Explanation describes in a few sentences why the scan passes or fails the current policy.
+func (r Report) Explanation(v gate.Verdict) []string {
+	lines := []string{fmt.Sprintf("Scan score %.2f with %s scoring, scans pass below %.2f.", v.Score,
+		r.Policy.Scoring.Mode, r.Policy.Scoring.Threshold)}
+	if r.Policy.Unmapped.FailsScan(v.Unmapped) {
+		lines = append(lines, fmt.Sprintf("%d alerts have no catalog entry and the unmapped alert policy is %q.",
+			v.Unmapped, r.Policy.Unmapped.Action))
+	}
+	suppressed := 0
+	for _, f := range r.Findings {
+		if f.Suppressed {
+			suppressed++
+		}
+	}
+	if suppressed > 0 {
+		lines = append(lines, fmt.Sprintf("%d suppressed findings don't count.", suppressed))
+	}
+	return lines
+}
+
+func fingerprints(findings []finding.Finding) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range findings {
+		m[f.Fingerprint] = true
+	}
+	return m
+}
+
+// references keeps the links of a ZAP reference, one per line.
+func references(reference string) []string {
+	var refs []string
+	for _, l := range strings.Split(reference, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://") {
+			refs = append(refs, l)
+		}
+	}
+	return refs
+}
+
+func riskSeverity(risk string) string {
+	switch scoring.NormalizeRisk(risk) {
+	case scoring.RiskHigh:
+		return "high"
+	case scoring.RiskMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
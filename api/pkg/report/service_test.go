@@ -0,0 +1,344 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/catalog"
+	"src/pkg/finding"
+	"src/pkg/gate"
+	"src/pkg/scan"
+	"src/pkg/scoring"
+	"src/pkg/zapScanner"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in mocks/")
+
+var testCatalog = catalog.NewSnapshot(3, []catalog.Entry{
+	{ID: 7, Name: "Content Security Policy Missing", CweID: 693, PluginID: "10038", Severity: "high", Score: 4,
+		Solution: "Set the Content-Security-Policy header on every HTML response."},
+	{ID: 12, Name: "Clickjacking", CweID: 1021, Severity: "medium", Score: 2,
+		Solution: "Send X-Frame-Options or a frame-ancestors CSP directive."},
+	{ID: 30, Name: "Unclassified: Cross-Domain Misconfiguration", CweID: 264, PluginID: "10098",
+		Severity: "medium", Score: 4, Unclassified: true},
+})
+
+func testPolicy() gate.Policy {
+	u, _ := catalog.NewUnmappedPolicy("ignore", "", false)
+	return gate.Policy{Vulnerabilities: testCatalog, Scoring: scoring.Legacy(8), Unmapped: u}
+}
+
+// testReport builds a report from the ZAP mock the same way persisted findings are loaded.
+func testReport(t *testing.T) Report {
+	b, err := os.ReadFile("../zapScanner/mocks/scan_result.json")
+	if err != nil {
+		t.Fatalf("reading ZAP mock: %v", err)
+	}
+	var result zapScanner.AScanResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatalf("parsing ZAP mock: %v", err)
+	}
+	findings := finding.FromReport("phet", 42, result)
+	findings[1].Suppressed = true
+	findings[1].SuppressionReason = "test page, not deployed"
+	s := scan.Scan{ID: 42, Status: "failed", Build_id: "build-1234", Application: "phet"}
+	return New(s, findings, testPolicy())
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	path := "mocks/" + name
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestRuleUsesCatalog(t *testing.T) {
+	r := testReport(t)
+
+	rule := r.Rule(r.Findings[0])
+	assert.Equal(t, "10038", rule.ID)
+	assert.Equal(t, "Content Security Policy Missing", rule.Name)
+	assert.Equal(t, "high", rule.Severity)
+	assert.Equal(t, "Set the Content-Security-Policy header on every HTML response.", rule.Solution)
+	assert.Len(t, rule.References, 7)
+	assert.False(t, rule.Unclassified)
+
+	rule = r.Rule(finding.Finding{PluginID: "10015", Name: "Re-examine Cache-control Directives", CweID: "525",
+		Risk: "Informational"})
+	assert.Equal(t, "low", rule.Severity)
+	assert.True(t, rule.Unclassified)
+
+	rule = r.Rule(finding.Finding{CweID: "1021", Risk: "Medium"})
+	assert.Equal(t, "cwe-1021", rule.ID)
+	assert.Equal(t, "Clickjacking", rule.Name)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteSARIF(&b, testReport(t))
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_result.sarif", b.Bytes())
+}
+
+func TestWriteSARIFWithoutFindings(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteSARIF(&b, New(scan.Scan{Build_id: "build-1"}, nil, testPolicy()))
+
+	assert.Nil(t, err)
+	var doc sarifLog
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &doc))
+	assert.Equal(t, "dast/build-1", doc.Runs[0].AutomationDetails.ID)
+	assert.Empty(t, doc.Runs[0].Results)
+	assert.NotNil(t, doc.Runs[0].Results)
+}
+
+func TestWriteDefectDojo(t *testing.T) {
+	var b bytes.Buffer
+	r := testReport(t)
+	r.Scan.Created_at = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	r.Findings[0].SASTResultID = 8
+
+	err := WriteDefectDojo(&b, r)
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_result.defectdojo.json", b.Bytes())
+}
+
+func TestWriteDefectDojoEndpoint(t *testing.T) {
+	findings := []finding.Finding{
+		{PluginID: "40012", CweID: "79", Risk: "High", Confidence: "False Positive",
+			URL: "https://shop.example.com:8443/search?q=x", Method: "GET"},
+		{PluginID: "10015", Risk: "Informational", URL: "not a url"},
+	}
+	var b bytes.Buffer
+
+	err := WriteDefectDojo(&b, New(scan.Scan{Application: "shop", Build_id: "b-1"}, findings, testPolicy()))
+
+	assert.Nil(t, err)
+	var doc dojoReport
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &doc))
+	assert.Equal(t, []dojoEndpoint{{Protocol: "https", Host: "shop.example.com", Port: 8443, Path: "search",
+		Query: "q=x"}}, doc.Findings[0].Endpoints)
+	assert.True(t, doc.Findings[0].FalsePositive)
+	assert.False(t, doc.Findings[0].Active)
+	assert.Equal(t, "High", doc.Findings[0].Severity)
+	assert.Empty(t, doc.Findings[1].Endpoints)
+	assert.Equal(t, "Info", doc.Findings[1].Severity)
+	assert.Equal(t, "", doc.Findings[1].Date)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteJUnit(&b, testReport(t))
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_result.junit.xml", b.Bytes())
+}
+
+func TestWriteJUnitGatesOnRecordedStatus(t *testing.T) {
+	r := testReport(t)
+	r.Scan.Status = "passed"
+	var b bytes.Buffer
+
+	err := WriteJUnit(&b, r)
+
+	assert.Nil(t, err)
+	var doc junitTestSuites
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &doc))
+	gateCase := doc.Suites[0].Cases[0]
+	assert.Empty(t, gateCase.Failures)
+	assert.Contains(t, gateCase.SystemOut.Text, "recorded status passed; current legacy policy: score 14.00, "+
+		"threshold 8.00, 2 unmapped alerts, failed")
+	assert.Contains(t, doc.Suites[0].Properties, junitProperty{Name: "current_verdict", Value: "failed"})
+}
+
+func TestWriteJUnitSkipsSuppressedRules(t *testing.T) {
+	findings := []finding.Finding{
+		{PluginID: "10038", CweID: "693", Risk: "Medium", URL: "https://a/", Suppressed: true, SuppressionReason: "CDN"},
+		{PluginID: "10015", CweID: "525", Risk: "Informational", URL: "https://a/"},
+	}
+	var b bytes.Buffer
+
+	err := WriteJUnit(&b, New(scan.Scan{Application: "shop", Build_id: "b-1"}, findings, testPolicy()))
+
+	assert.Nil(t, err)
+	var doc junitTestSuites
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &doc))
+	suite := doc.Suites[0]
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 0, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, "1 suppressed findings", suite.Cases[1].Skipped.Message)
+	assert.Nil(t, suite.Cases[2].Skipped)
+	assert.Equal(t, "https://a/ (doesn't add to the score)", suite.Cases[2].SystemOut.Text)
+}
+
+func TestCompare(t *testing.T) {
+	base := []finding.Finding{{Fingerprint: "a"}, {Fingerprint: "b"}, {Fingerprint: "b"}}
+	head := []finding.Finding{{Fingerprint: "b", ID: 1}, {Fingerprint: "c", ID: 2}, {Fingerprint: "c", ID: 3}}
+
+	d := Compare(base, head)
+
+	assert.Equal(t, []finding.Finding{{Fingerprint: "c", ID: 2}}, d.New)
+	assert.Equal(t, []finding.Finding{{Fingerprint: "a"}}, d.Fixed)
+	assert.Equal(t, []finding.Finding{{Fingerprint: "b", ID: 1}}, d.Unchanged)
+}
+
+func TestWriteHTML(t *testing.T) {
+	r := testReport(t)
+	r.Scan.Created_at = time.Date(2022, 9, 2, 12, 50, 21, 0, time.UTC)
+	r.Scan.Target = "https://phet-dev.colorado.edu"
+	r.Findings[0].MessageID = "7"
+	r.Messages = map[string]Message{"7": {
+		RequestHeader:  "GET https://phet-dev.colorado.edu/html/build-an-atom/0.0.0-3/simple-text-only-test-page.html HTTP/1.1\r\n\r\n",
+		ResponseHeader: "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n",
+		ResponseBody:   "<html><script>alert(1)</script></html>",
+	}}
+	r.Previous = &ScanResult{
+		Scan: scan.Scan{ID: 41, Build_id: "build-1233", Application: "phet", Status: "passed"},
+		Findings: append(r.Findings[2:], finding.Finding{
+			Fingerprint: "fixed", Name: "Cookie Without Secure Flag", Method: "GET", URL: "https://phet-dev.colorado.edu/",
+			Param: "session",
+		}),
+	}
+	var b bytes.Buffer
+
+	err := WriteHTML(&b, r)
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_result.html", b.Bytes())
+}
+
+func TestWriteHTMLEscapesEvidence(t *testing.T) {
+	findings := []finding.Finding{{PluginID: "40012", Name: "Cross Site Scripting (Reflected)", Risk: "High",
+		URL: "https://a/?q=x", Param: "q", Attack: "<script>alert(1)</script>", Evidence: "<script>alert(1)</script>"}}
+	var b bytes.Buffer
+
+	err := WriteHTML(&b, New(scan.Scan{Build_id: "b-1"}, findings, testPolicy()))
+
+	assert.Nil(t, err)
+	assert.NotContains(t, b.String(), "<script>")
+	assert.Contains(t, b.String(), "&lt;script&gt;alert(1)&lt;/script&gt;")
+}
+
+func TestCompareURLs(t *testing.T) {
+	base := []string{"https://a/items/1", "https://a/items/2?page=3", "https://a/login"}
+	head := []string{"https://a/admin", "https://a/items/7", "https://a/items/8"}
+
+	d := CompareURLs(base, head)
+
+	assert.Equal(t, []string{"https://a/admin"}, d.Added)
+	assert.Equal(t, []string{"https://a/login"}, d.Removed)
+}
+
+func TestNewScanDiff(t *testing.T) {
+	base := ScanResult{
+		Scan: scan.Scan{Build_id: "b-1", Application: "shop", Status: "failed"},
+		Findings: []finding.Finding{
+			{Fingerprint: "a", PluginID: "40018", Name: "SQL Injection", Risk: "High", URL: "https://a/?id=1",
+				Method: "GET", Param: "id"},
+			{Fingerprint: "b", PluginID: "10038", Name: "CSP Header Not Set", Risk: "Medium", URL: "https://a/"},
+		},
+		URLs: []string{"https://a/", "https://a/login"},
+	}
+	head := ScanResult{
+		Scan: scan.Scan{Build_id: "b-2", Application: "shop", Status: "failed"},
+		Findings: []finding.Finding{
+			{Fingerprint: "b", PluginID: "10038", Name: "CSP Header Not Set", Risk: "Medium", URL: "https://a/"},
+			{Fingerprint: "c", PluginID: "40012", Name: "Cross Site Scripting | Reflected", Risk: "High",
+				URL: "https://a/admin?q=x", Method: "POST", Param: "q", Suppressed: true},
+		},
+		URLs: []string{"https://a/", "https://a/admin"},
+	}
+
+	d := NewScanDiff(base, head, testPolicy())
+
+	assert.Equal(t, DiffSummary{New: 1, Fixed: 1, Unchanged: 1, URLsAdded: 1, URLsRemoved: 1}, d.Summary)
+	assert.Equal(t, DiffScan{BuildID: "b-1", Application: "shop", Status: "failed"}, d.Base)
+	assert.Equal(t, "a", d.Fixed[0].Fingerprint)
+	assert.Equal(t, "b", d.Unchanged[0].Fingerprint)
+	assert.True(t, d.New[0].Suppressed)
+
+	var b bytes.Buffer
+	err := WriteDiffMarkdown(&b, d)
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_diff.md", b.Bytes())
+}
+
+func TestNewScanDiffWithoutChanges(t *testing.T) {
+	d := NewScanDiff(ScanResult{}, ScanResult{}, testPolicy())
+
+	assert.Equal(t, []DiffFinding{}, d.New)
+	assert.Equal(t, []string{}, d.Surface.Added)
+}
+
+func markdownReport(t *testing.T) Report {
+	r := testReport(t)
+	r.Previous = &ScanResult{
+		Scan:     scan.Scan{ID: 41, Build_id: "build-1233", Application: "phet", Status: "passed"},
+		Findings: append(r.Findings[2:], finding.Finding{Fingerprint: "fixed", Name: "Cookie Without Secure Flag"}),
+	}
+	return r
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteMarkdown(&b, markdownReport(t), MarkdownOptions{
+		Top: 3, MaxLength: DefaultMarkdownMaxLength, ReportURL: "https://ci.example.com/artifacts/report.html",
+	})
+
+	assert.Nil(t, err)
+	assertGolden(t, "scan_result.md", b.Bytes())
+}
+
+func TestWriteMarkdownTruncates(t *testing.T) {
+	r := markdownReport(t)
+	var full, short, tiny bytes.Buffer
+	assert.Nil(t, WriteMarkdown(&full, r, MarkdownOptions{Top: 10}))
+
+	err := WriteMarkdown(&short, r, MarkdownOptions{Top: 10, MaxLength: full.Len() - 200})
+
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, short.Len(), full.Len()-200)
+	assert.NotContains(t, short.String(), "no reason given")
+	assert.Contains(t, short.String(), "#### Top findings")
+	assert.Regexp(t, `_\d+ more findings in the full report\._`, short.String())
+
+	err = WriteMarkdown(&tiny, r, MarkdownOptions{Top: 10, MaxLength: 200})
+
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, tiny.Len(), 200)
+	assert.True(t, strings.HasSuffix(tiny.String(), "_Summary truncated, see the full report._\n"))
+}
+
+func TestWriteMarkdownWithoutFindings(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteMarkdown(&b, New(scan.Scan{Build_id: "b-1"}, nil, testPolicy()), MarkdownOptions{Top: 10})
+
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), "https://img.shields.io/badge/DAST-passed-brightgreen")
+	assert.Contains(t, b.String(), "\nNo findings.\n")
+	assert.NotContains(t, b.String(), "Top findings")
+}
@@ -0,0 +1,109 @@
+package sast
+
+import "encoding/json"
+
+// OpenAPI operation (or path item) extensions naming the source files that handle a route.
+const (
+	sourceFileExtension  = "x-source-file"
+	handlerFileExtension = "x-handler-file"
+)
+
+// Result is a static analysis result of a SARIF file submitted with a scan. CweIDs come from the
+// result's or its rule's tags and taxa.
+type Result struct {
+	ID      int64    `json:"id"`
+	ScanID  int64    `json:"-"`
+	Tool    string   `json:"tool"`
+	RuleID  string   `json:"rule_id"`
+	CweIDs  []string `json:"cwe_ids"`
+	File    string   `json:"file"`
+	Line    int      `json:"line"`
+	Level   string   `json:"level"`
+	Message string   `json:"message"`
+}
+
+// Route maps an endpoint to the source file handling it. Path is normalized like finding URLs,
+// with every template parameter replaced by {id}. An empty Method matches any method.
+type Route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	File   string `json:"file"`
+}
+
+type sarifLog struct {
+	Runs []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver     sarifComponent   `json:"driver"`
+	Extensions []sarifComponent `json:"extensions"`
+}
+
+type sarifComponent struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID            string              `json:"id"`
+	Properties    sarifProperties     `json:"properties"`
+	Relationships []sarifRelationship `json:"relationships"`
+}
+
+type sarifProperties struct {
+	Tags []string `json:"tags"`
+}
+
+type sarifRelationship struct {
+	Target sarifReference `json:"target"`
+}
+
+// sarifReference points to a taxon, CWE entries have the toolComponent name "CWE".
+type sarifReference struct {
+	ID            string `json:"id"`
+	ToolComponent struct {
+		Name string `json:"name"`
+	} `json:"toolComponent"`
+}
+
+type sarifResult struct {
+	RuleID     string           `json:"ruleId"`
+	RuleIndex  *int             `json:"ruleIndex"`
+	Level      string           `json:"level"`
+	Message    sarifMessage     `json:"message"`
+	Locations  []sarifLocation  `json:"locations"`
+	Properties sarifProperties  `json:"properties"`
+	Taxa       []sarifReference `json:"taxa"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine int `json:"startLine"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// openAPIDocument is the part of an OpenAPI 3 or Swagger 2 document routes are read from.
+type openAPIDocument struct {
+	OpenAPI  string                                `json:"openapi"`
+	Swagger  string                                `json:"swagger"`
+	BasePath string                                `json:"basePath"`
+	Servers  []struct{ URL string }                `json:"servers"`
+	Paths    map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// fileList reads a JSON string or array of strings, routes may be handled by several files.
+type fileList []string
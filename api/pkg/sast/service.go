@@ -0,0 +1,417 @@
+package sast
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"src/pkg/finding"
+)
+
+const defaultLevel = "warning"
+
+// CodeQL tags rules with external/cwe/cwe-089, Semgrep with "CWE-89: Improper Neutralization...".
+var cweTag = regexp.MustCompile(`(?i)\bcwe[-_:/ ]?0*([0-9]+)\b`)
+
+var templateSegment = regexp.MustCompile(`^(\{[^}]*\}|:[^/]+|<[^>]*>)$`)
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// ParseSARIF reads the results of every run of a SARIF 2.1.0 log.
+func ParseSARIF(data []byte) ([]Result, error) {
+	var doc sarifLog
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing SARIF: %v", err)
+	}
+	var results []Result
+	for _, run := range doc.Runs {
+		rules := make(map[string]sarifRule)
+		for _, c := range append([]sarifComponent{run.Tool.Driver}, run.Tool.Extensions...) {
+			for _, r := range c.Rules {
+				rules[r.ID] = r
+			}
+		}
+		for _, sr := range run.Results {
+			rule, ok := rules[sr.RuleID]
+			if !ok && sr.RuleIndex != nil && *sr.RuleIndex >= 0 && *sr.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*sr.RuleIndex]
+			}
+			r := Result{
+				Tool:    run.Tool.Driver.Name,
+				RuleID:  sr.RuleID,
+				CweIDs:  cweIDs(sr, rule),
+				Level:   sr.Level,
+				Message: sr.Message.Text,
+			}
+			if r.RuleID == "" {
+				r.RuleID = rule.ID
+			}
+			if r.Level == "" {
+				r.Level = defaultLevel
+			}
+			if len(sr.Locations) > 0 {
+				loc := sr.Locations[0].PhysicalLocation
+				r.File = cleanFile(loc.ArtifactLocation.URI)
+				r.Line = loc.Region.StartLine
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func cweIDs(r sarifResult, rule sarifRule) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, tags := range [][]string{r.Properties.Tags, rule.Properties.Tags} {
+		for _, t := range tags {
+			for _, m := range cweTag.FindAllStringSubmatch(t, -1) {
+				add(m[1])
+			}
+		}
+	}
+	refs := r.Taxa
+	for _, rel := range rule.Relationships {
+		refs = append(refs, rel.Target)
+	}
+	for _, ref := range refs {
+		if strings.EqualFold(ref.ToolComponent.Name, "CWE") {
+			add(strings.TrimLeft(strings.TrimPrefix(strings.ToUpper(ref.ID), "CWE-"), "0"))
+		}
+	}
+	return ids
+}
+
+// ParseRoutes reads the routes of an application from an OpenAPI 3 or Swagger 2 document whose
+// operations (or path items) have x-source-file or x-handler-file extensions, or from a route
+// map such as {"GET /users/{id}": "src/users.go", "/login": ["auth/login.py", "auth/session.py"]}.
+func ParseRoutes(data []byte) ([]Route, error) {
+	var doc openAPIDocument
+	if err := json.Unmarshal(data, &doc); err == nil && (doc.OpenAPI != "" || doc.Swagger != "") {
+		return openAPIRoutes(doc)
+	}
+	var m map[string]fileList
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing route map: %v", err)
+	}
+	var routes []Route
+	for key, files := range m {
+		method, p := "", strings.TrimSpace(key)
+		if i := strings.IndexByte(p, ' '); i > 0 {
+			method, p = strings.ToUpper(p[:i]), strings.TrimSpace(p[i+1:])
+		}
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("invalid route %q, expected a path or a method and a path", key)
+		}
+		routes = append(routes, newRoutes(method, p, files)...)
+	}
+	sortRoutes(routes)
+	return routes, nil
+}
+
+func openAPIRoutes(doc openAPIDocument) ([]Route, error) {
+	base := doc.BasePath
+	if len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil {
+			base = u.Path
+		}
+	}
+	var routes []Route
+	for p, item := range doc.Paths {
+		shared, err := extensionFiles(item)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %v", p, err)
+		}
+		full := strings.TrimSuffix(base, "/") + p
+		operations := 0
+		for _, method := range httpMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			operations++
+			var op map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", strings.ToUpper(method), p, err)
+			}
+			files, err := extensionFiles(op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", strings.ToUpper(method), p, err)
+			}
+			if len(files) == 0 {
+				files = shared
+			}
+			routes = append(routes, newRoutes(strings.ToUpper(method), full, files)...)
+		}
+		if operations == 0 {
+			routes = append(routes, newRoutes("", full, shared)...)
+		}
+	}
+	sortRoutes(routes)
+	return routes, nil
+}
+
+func extensionFiles(object map[string]json.RawMessage) (fileList, error) {
+	var files fileList
+	for _, ext := range []string{sourceFileExtension, handlerFileExtension} {
+		raw, ok := object[ext]
+		if !ok {
+			continue
+		}
+		var f fileList
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", ext, err)
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
+
+func newRoutes(method, p string, files fileList) []Route {
+	var routes []Route
+	for _, f := range files {
+		if f = cleanFile(f); f != "" {
+			routes = append(routes, Route{Method: method, Path: NormalizeRoute(p), File: f})
+		}
+	}
+	return routes
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.File < b.File
+	})
+}
+
+// NormalizeRoute turns a route template into the form finding URLs are normalized to: /users/{id},
+// /users/:id and /users/<id> all become /users/{id}.
+func NormalizeRoute(route string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i, s := range segments {
+		if templateSegment.MatchString(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return finding.NormalizePath("/" + strings.Join(segments, "/"))
+}
+
+// cleanFile makes SARIF artifact URIs and route map paths comparable: no file:// scheme, forward
+// slashes and no leading ./
+func cleanFile(f string) string {
+	f = strings.TrimSpace(strings.ReplaceAll(f, `\`, "/"))
+	f = strings.TrimPrefix(f, "file://")
+	if f == "" {
+		return ""
+	}
+	return strings.TrimPrefix(path.Clean(f), "./")
+}
+
+// sameFile matches files given relative to different roots, src/users.go is the same file as
+// /build/app/src/users.go.
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, "/"+strings.TrimPrefix(b, "/")) ||
+		strings.HasSuffix(b, "/"+strings.TrimPrefix(a, "/"))
+}
+
+// Correlate marks the findings confirmed by a static result: one with the finding's CWE in a file
+// handling the finding's route. SASTResultID is set to the first matching result, or 0. It returns
+// the number of correlated findings.
+func Correlate(findings []finding.Finding, results []Result, routes []Route) int {
+	correlated := 0
+	for i := range findings {
+		f := &findings[i]
+		f.SASTResultID = 0
+		if f.CweID == "" || f.CweID == "0" || f.CweID == "-1" {
+			continue
+		}
+		p, method := finding.NormalizePath(f.URL), strings.ToUpper(f.Method)
+		for _, r := range results {
+			if contains(r.CweIDs, f.CweID) && handles(routes, method, p, r.File) {
+				f.SASTResultID = r.ID
+				correlated++
+				break
+			}
+		}
+	}
+	return correlated
+}
+
+func handles(routes []Route, method, p, file string) bool {
+	for _, r := range routes {
+		if r.Path == p && (r.Method == "" || r.Method == method) && sameFile(r.File, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CorrelateScan correlates findings of a scan with the SAST results submitted for it and stores
+// the matches. Scans without SAST results are left alone.
+func CorrelateScan(conn *sql.DB, scanID int64, findings []finding.Finding) (int, error) {
+	results, err := GetResultsFromDB(conn, scanID)
+	if err != nil || len(results) == 0 {
+		return 0, err
+	}
+	routes, err := GetRoutesFromDB(conn, scanID)
+	if err != nil {
+		return 0, err
+	}
+	n := Correlate(findings, results, routes)
+	return n, UpdateCorrelationsInDB(conn, findings)
+}
+
+// ReplaceResultsInDB stores the SAST results and routes of a scan, replacing the ones submitted
+// before along with the correlations made from them. The results are returned with their ID.
+func ReplaceResultsInDB(conn *sql.DB, scanID int64, results []Result, routes []Route) ([]Result, error) {
+	err := withTx(conn, func(tx *sql.Tx) error {
+		for _, q := range []string{
+			"UPDATE vulnerability_findings SET sast_result_id=NULL WHERE scan_id=?",
+			"DELETE FROM sast_results WHERE scan_id=?",
+			"DELETE FROM sast_routes WHERE scan_id=?",
+		} {
+			if _, err := tx.Exec(q, scanID); err != nil {
+				return err
+			}
+		}
+		insert := "INSERT INTO sast_results(scan_id, tool, rule_id, cwe_ids, file, line, level, message) " +
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+		for i := range results {
+			r := &results[i]
+			res, err := tx.Exec(insert, scanID, r.Tool, r.RuleID, strings.Join(r.CweIDs, ","), r.File, r.Line,
+				r.Level, r.Message)
+			if err != nil {
+				return err
+			}
+			if r.ID, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			r.ScanID = scanID
+		}
+		if len(routes) == 0 {
+			return nil
+		}
+		q := "INSERT INTO sast_routes(scan_id, method, path, file) VALUES (?, ?, ?, ?)" +
+			strings.Repeat(", (?, ?, ?, ?)", len(routes)-1)
+		args := make([]interface{}, 0, 4*len(routes))
+		for _, r := range routes {
+			args = append(args, scanID, r.Method, r.Path, r.File)
+		}
+		_, err := tx.Exec(q, args...)
+		return err
+	})
+	return results, err
+}
+
+// UpdateCorrelationsInDB records the SAST result of every correlated finding.
+func UpdateCorrelationsInDB(conn *sql.DB, findings []finding.Finding) error {
+	q := "UPDATE vulnerability_findings SET sast_result_id=? WHERE id=?"
+	for _, f := range findings {
+		if f.SASTResultID == 0 || f.ID == 0 {
+			continue
+		}
+		if _, err := conn.Exec(q, f.SASTResultID, f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetResultsFromDB(conn *sql.DB, scanID int64) ([]Result, error) {
+	q := "SELECT id, scan_id, COALESCE(tool, ''), COALESCE(rule_id, ''), COALESCE(cwe_ids, ''), " +
+		"COALESCE(file, ''), COALESCE(line, 0), COALESCE(level, ''), COALESCE(message, '') " +
+		"FROM sast_results WHERE scan_id=? ORDER BY id"
+	var results []Result
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Result
+		var cwes string
+		err := rows.Scan(&r.ID, &r.ScanID, &r.Tool, &r.RuleID, &cwes, &r.File, &r.Line, &r.Level, &r.Message)
+		if err != nil {
+			return results, err
+		}
+		r.CweIDs = []string{}
+		if cwes != "" {
+			r.CweIDs = strings.Split(cwes, ",")
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+func GetRoutesFromDB(conn *sql.DB, scanID int64) ([]Route, error) {
+	q := "SELECT COALESCE(method, ''), path, file FROM sast_routes WHERE scan_id=? ORDER BY path, method, file"
+	var routes []Route
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return routes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Route
+		if err := rows.Scan(&r.Method, &r.Path, &r.File); err != nil {
+			return routes, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+func withTx(conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (l *fileList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = fileList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
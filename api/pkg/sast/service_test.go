@@ -0,0 +1,179 @@
+package sast
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"src/pkg/finding"
+)
+
+func readFile(t *testing.T, name string) []byte {
+	b, err := os.ReadFile("mocks/" + name)
+	assert.Nil(t, err)
+	return b
+}
+
+func TestParseSARIF(t *testing.T) {
+	results, err := ParseSARIF(readFile(t, "results.sarif"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Result{
+		{Tool: "CodeQL", RuleID: "go/sql-injection", CweIDs: []string{"89"}, File: "internal/users/handler.go",
+			Line: 42, Level: "error", Message: "This query depends on a user-provided value."},
+		// Rule found by index, default level
+		{Tool: "CodeQL", RuleID: "go/reflected-xss", CweIDs: []string{"79", "116"},
+			File: "internal/search/handler.go", Line: 17, Level: "warning",
+			Message: "Cross-site scripting vulnerability due to user-provided value."},
+		// CWE from the result tags and the rule's taxonomy relationship, counted once
+		{Tool: "Semgrep", RuleID: "python.flask.security.open-redirect", CweIDs: []string{"601"},
+			File: "legacy/auth/login.py", Line: 8, Level: "warning", Message: "Open redirect."},
+	}, results)
+}
+
+func TestParseSARIFRejectsInvalidJSON(t *testing.T) {
+	_, err := ParseSARIF([]byte("<xml/>"))
+
+	assert.EqualError(t, err, "error parsing SARIF: invalid character '<' looking for beginning of value")
+}
+
+func TestParseRouteMap(t *testing.T) {
+	routes, err := ParseRoutes(readFile(t, "routes.json"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Route{
+		{Method: "POST", Path: "/login", File: "legacy/auth/login.py"},
+		{Method: "", Path: "/search", File: "internal/search/handler.go"},
+		{Method: "", Path: "/search", File: "internal/search/render.go"},
+		{Method: "GET", Path: "/users/{id}", File: "internal/users/handler.go"},
+	}, routes)
+}
+
+func TestParseRouteMapRejectsInvalidRoutes(t *testing.T) {
+	_, err := ParseRoutes([]byte(`{"users": "users.go"}`))
+	assert.EqualError(t, err, `invalid route "users", expected a path or a method and a path`)
+
+	_, err = ParseRoutes([]byte(`{"/users": 1}`))
+	assert.NotNil(t, err)
+}
+
+func TestParseOpenAPIRoutes(t *testing.T) {
+	routes, err := ParseRoutes(readFile(t, "openapi.json"))
+
+	assert.Nil(t, err)
+	// The server path prefixes routes, operations without extensions use the path item's
+	assert.Equal(t, []Route{
+		{Method: "GET", Path: "/api/search", File: "internal/search/handler.go"},
+		{Method: "DELETE", Path: "/api/users/{id}", File: "internal/users/admin.go"},
+		{Method: "GET", Path: "/api/users/{id}", File: "internal/users/handler.go"},
+	}, routes)
+}
+
+func TestNormalizeRoute(t *testing.T) {
+	for route, expected := range map[string]string{
+		"/users/{userId}":           "/users/{id}",
+		"/users/:id/orders/<int:n>": "/users/{id}/orders/{id}",
+		"users/42/":                 "/users/{id}",
+		"/":                         "/",
+	} {
+		assert.Equal(t, expected, NormalizeRoute(route), route)
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	results := []Result{
+		{ID: 1, CweIDs: []string{"89"}, File: "internal/users/handler.go"},
+		{ID: 2, CweIDs: []string{"79", "116"}, File: "/build/shop/internal/search/handler.go"},
+	}
+	routes := []Route{
+		{Method: "GET", Path: "/users/{id}", File: "internal/users/handler.go"},
+		{Path: "/search", File: "internal/search/handler.go"},
+	}
+	findings := []finding.Finding{
+		{ID: 10, CweID: "89", URL: "https://shop.example.com/users/7?id=1", Method: "get"},
+		// Wrong method for the route
+		{ID: 11, CweID: "89", URL: "https://shop.example.com/users/7", Method: "DELETE"},
+		// Any method, file relative to another root
+		{ID: 12, CweID: "79", URL: "https://shop.example.com/search?q=x", Method: "POST"},
+		// CWE not reported for the route's file
+		{ID: 13, CweID: "89", URL: "https://shop.example.com/search", Method: "GET"},
+		{ID: 14, CweID: "", URL: "https://shop.example.com/search", Method: "GET", SASTResultID: 2},
+	}
+
+	assert.Equal(t, 2, Correlate(findings, results, routes))
+	var ids []int64
+	for _, f := range findings {
+		ids = append(ids, f.SASTResultID)
+	}
+	assert.Equal(t, []int64{1, 0, 2, 0, 0}, ids)
+}
+
+func TestReplaceResultsInDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerability_findings SET sast_result_id=NULL WHERE scan_id=?")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sast_results WHERE scan_id=?")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sast_routes WHERE scan_id=?")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sast_results(scan_id, tool, rule_id, cwe_ids, file, line, "+
+		"level, message) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs(3, "CodeQL", "go/reflected-xss", "79,116", "search.go", 17, "warning", "XSS").
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sast_routes(scan_id, method, path, file) VALUES (?, ?, ?, ?), "+
+		"(?, ?, ?, ?)")).
+		WithArgs(3, "GET", "/search", "search.go", 3, "", "/users/{id}", "users.go").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	results, err := ReplaceResultsInDB(db, 3, []Result{{Tool: "CodeQL", RuleID: "go/reflected-xss",
+		CweIDs: []string{"79", "116"}, File: "search.go", Line: 17, Level: "warning", Message: "XSS"}},
+		[]Route{{Method: "GET", Path: "/search", File: "search.go"}, {Path: "/users/{id}", File: "users.go"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), results[0].ID)
+	assert.Equal(t, int64(3), results[0].ScanID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCorrelateScan(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scan_id", "tool", "rule_id", "cwe_ids", "file", "line",
+			"level", "message"}).AddRow(8, 3, "CodeQL", "go/sql-injection", "89", "users.go", 42, "error", "SQLi"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_routes WHERE scan_id=?")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "path", "file"}).AddRow("", "/users/{id}", "users.go"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE vulnerability_findings SET sast_result_id=? WHERE id=?")).
+		WithArgs(8, 21).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	findings := []finding.Finding{
+		{ID: 21, CweID: "89", URL: "https://shop.example.com/users/1", Method: "GET"},
+		{ID: 22, CweID: "79", URL: "https://shop.example.com/users/1", Method: "GET"},
+	}
+	n, err := CorrelateScan(db, 3, findings)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(8), findings[0].SASTResultID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCorrelateScanWithoutResults(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sast_results WHERE scan_id=?")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scan_id", "tool", "rule_id", "cwe_ids", "file", "line",
+			"level", "message"}))
+
+	n, err := CorrelateScan(db, 3, []finding.Finding{{ID: 21, CweID: "89"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
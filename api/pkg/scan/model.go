@@ -2,40 +2,83 @@ package scan
 
 import (
 	"database/sql"
-	"strconv"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Scan statuses besides the progress percentage a running scan stores. A cancelled scan is never
+// updated again.
+const (
+	StatusStarted   = "started"
+	StatusPassed    = "passed"
+	StatusFailed    = "failed"
+	StatusError     = "error"
+	StatusCancelled = "cancelled"
 )
 
+// ErrDuplicate is returned when a build already has a scan with the attempt number, usually because
+// it was submitted twice at the same time.
+var ErrDuplicate = errors.New("the build already has a scan with this attempt")
+
+// MySQL error of a unique key violation.
+const errDupEntry = 1062
+
+// Filter selects the scans listed by QueryScansFromDB. Status "running" matches every scan that
+// hasn't finished.
+type Filter struct {
+	Application string
+	AssetID     int64
+	Status      string
+	Since       time.Time
+	Limit       int
+	Offset      int
+}
+
 type Scan struct {
 	ID           int64
 	Status       string
 	Build_id     string
 	Build_source string
+	Application  string
 	Target       string
 	Zap_id       int
 	Start_date   time.Time
 	End_date     time.Time
 	Asset_id     int64
 	Created_at   time.Time
+	// Attempt numbers the scans of a build, from 1. Submitting a build again with force starts a new
+	// attempt.
+	Attempt int
 }
 
-type Vulnerability struct {
-	Score int
-	ID    int64
-}
-
+// AddScanToDB records a scan as attempt 1 of its build unless it has another attempt number. It
+// returns ErrDuplicate when the build already has that attempt.
 func AddScanToDB(conn *sql.DB, s Scan) (int64, error) {
-	q := "INSERT INTO scans(status, build_id, build_source, target, zap_id) VALUES (?, ?, ?, ?, ?)"
-	res, err := conn.Exec(q, s.Status, s.Build_id, s.Build_source, s.Target, s.Zap_id)
+	if s.Attempt < 1 {
+		s.Attempt = 1
+	}
+	// The scan is linked to the asset of its application when it's registered
+	q := "INSERT INTO scans(status, build_id, build_source, application, target, zap_id, attempt, asset_id) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT id FROM assets WHERE project=?))"
+	res, err := conn.Exec(q, s.Status, s.Build_id, s.Build_source, s.Application, s.Target, s.Zap_id, s.Attempt,
+		s.Application)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDupEntry {
+		return -1, ErrDuplicate
+	}
 	if err != nil {
 		return -1, err
 	}
 	return res.LastInsertId()
 }
 
+// GetScanFromDB returns the latest attempt of a build.
 func GetScanFromDB(conn *sql.DB, buildID string) (Scan, error) {
 	s := Scan{}
-	q := "SELECT id, status, build_id, zap_id FROM scans WHERE build_id=?"
+	q := "SELECT id, status, build_id, zap_id FROM scans WHERE build_id=? ORDER BY id DESC LIMIT 1"
 
 	r, err := conn.Query(q, buildID)
 	if err != nil {
@@ -47,33 +90,197 @@ func GetScanFromDB(conn *sql.DB, buildID string) (Scan, error) {
 	return s, err
 }
 
-func UpdateScanStatus(conn *sql.DB, status string, build_id string) error {
-	q := "UPDATE scans SET status=? WHERE build_id=?"
-	_, err := conn.Exec(q, status, build_id)
+const detailColumns = "id, status, build_id, COALESCE(build_source, ''), COALESCE(application, ''), " +
+	"COALESCE(target, ''), zap_id, created_at"
+
+// GetScanDetailsFromDB returns the full scan of the latest attempt of a build, or sql.ErrNoRows when
+// there is none.
+func GetScanDetailsFromDB(conn *sql.DB, buildID string) (Scan, error) {
+	q := "SELECT " + detailColumns + " FROM scans WHERE build_id=? ORDER BY id DESC LIMIT 1"
+	return scanDetails(conn.QueryRow(q, buildID))
+}
+
+// GetLastAttemptFromDB returns the highest attempt number of a build, 0 when it has no scan.
+func GetLastAttemptFromDB(conn *sql.DB, buildID string) (int, error) {
+	var attempt int
+	err := conn.QueryRow("SELECT COALESCE(MAX(attempt), 0) FROM scans WHERE build_id=?", buildID).Scan(&attempt)
+	return attempt, err
+}
+
+// GetPreviousScanFromDB returns the last finished scan of the same application before s, or
+// sql.ErrNoRows when there is none.
+func GetPreviousScanFromDB(conn *sql.DB, s Scan) (Scan, error) {
+	q := "SELECT " + detailColumns + " FROM scans WHERE application=? AND id<? AND status IN ('passed', 'failed') " +
+		"ORDER BY id DESC LIMIT 1"
+	return scanDetails(conn.QueryRow(q, s.Application, s.ID))
+}
+
+func scanDetails(row *sql.Row) (Scan, error) {
+	s := Scan{}
+	err := row.Scan(&s.ID, &s.Status, &s.Build_id, &s.Build_source, &s.Application, &s.Target, &s.Zap_id,
+		&s.Created_at)
+	return s, err
+}
+
+// AddScanURLsToDB records the URLs a scan discovered, its attack surface.
+func AddScanURLsToDB(conn *sql.DB, scanID int64, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	q := "INSERT INTO scan_urls(scan_id, url) VALUES (?, ?)" + strings.Repeat(", (?, ?)", len(urls)-1)
+	args := make([]interface{}, 0, 2*len(urls))
+	for _, u := range urls {
+		args = append(args, scanID, u)
+	}
+	_, err := conn.Exec(q, args...)
 	return err
 }
 
-func GetVulnerabilitiesFromDB(conn *sql.DB) (map[string]Vulnerability, error) {
-	q := "SELECT cwe_id, id, score FROM vulnerabilities"
-	rows, err := conn.Query(q)
-	vulnerabilities := make(map[string]Vulnerability)
+func GetScanURLsFromDB(conn *sql.DB, scanID int64) ([]string, error) {
+	q := "SELECT url FROM scan_urls WHERE scan_id=? ORDER BY url"
+	var urls []string
+	rows, err := conn.Query(q, scanID)
 	if err != nil {
-		return vulnerabilities, err
+		return urls, err
 	}
+	defer rows.Close()
 	for rows.Next() {
-		var cweID int
-		var v Vulnerability
-		if err := rows.Scan(&cweID, &v.ID, &v.Score); err != nil {
-			return vulnerabilities, err
-		} else {
-			vulnerabilities[strconv.Itoa(cweID)] = v
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return urls, err
 		}
+		urls = append(urls, u)
 	}
-	return vulnerabilities, err
+	return urls, rows.Err()
 }
 
-func AddVulnerabilityFinding(conn *sql.DB, scanID int64, vulnerabilityID int64, description string) error {
-	q := "INSERT INTO vulnerability_findings(scan_id, vulnerability_id, details) VALUES (?, ?, ?)"
-	_, err := conn.Exec(q, scanID, vulnerabilityID, description)
+// UpdateScanStatus sets the status of one attempt. It leaves cancelled scans alone, so a scan still
+// being waited for can't overwrite its cancellation.
+func UpdateScanStatus(conn *sql.DB, status string, scanID int64) error {
+	q := "UPDATE scans SET status=? WHERE id=? AND status<>'cancelled'"
+	_, err := conn.Exec(q, status, scanID)
 	return err
 }
+
+// UpdateActiveScanStatus is UpdateScanStatus for the scan being waited for, reporting whether it
+// was cancelled instead. MySQL counts a row set to the value it had as unaffected, so the status is
+// read back when nothing changed.
+func UpdateActiveScanStatus(conn *sql.DB, status string, scanID int64) (bool, error) {
+	res, err := conn.Exec("UPDATE scans SET status=? WHERE id=? AND status<>'cancelled'", status, scanID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return false, err
+	}
+	current, err := GetAttemptStatusFromDB(conn, scanID)
+	return current == StatusCancelled, err
+}
+
+// GetScanStatusFromDB returns the stored status of the latest attempt of a build, or sql.ErrNoRows
+// when there is none.
+func GetScanStatusFromDB(conn *sql.DB, buildID string) (string, error) {
+	var status string
+	err := conn.QueryRow("SELECT status FROM scans WHERE build_id=? ORDER BY id DESC LIMIT 1", buildID).Scan(&status)
+	return status, err
+}
+
+// GetAttemptStatusFromDB returns the stored status of a scan by its ID.
+func GetAttemptStatusFromDB(conn *sql.DB, scanID int64) (string, error) {
+	var status string
+	err := conn.QueryRow("SELECT status FROM scans WHERE id=?", scanID).Scan(&status)
+	return status, err
+}
+
+// Finished reports whether a scan status is final.
+func Finished(status string) bool {
+	switch status {
+	case StatusPassed, StatusFailed, StatusError, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// QueryScansFromDB lists scans matching the filter, newest first, with the number of matching
+// scans before Limit and Offset apply.
+func QueryScansFromDB(conn *sql.DB, filter Filter) ([]Scan, int, error) {
+	from := " FROM scans WHERE 1=1"
+	var args []interface{}
+	if filter.Application != "" {
+		from += " AND application=?"
+		args = append(args, filter.Application)
+	}
+	if filter.AssetID > 0 {
+		from += " AND asset_id=?"
+		args = append(args, filter.AssetID)
+	}
+	switch filter.Status {
+	case "":
+	case "running":
+		from += " AND status NOT IN ('passed', 'failed', 'error', 'cancelled')"
+	default:
+		from += " AND status=?"
+		args = append(args, filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		from += " AND created_at>=?"
+		args = append(args, filter.Since)
+	}
+
+	var total int
+	if err := conn.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	q := "SELECT " + detailColumns + from + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	scans := []Scan{}
+	rows, err := conn.Query(q, args...)
+	if err != nil {
+		return scans, total, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := Scan{}
+		if err := rows.Scan(&s.ID, &s.Status, &s.Build_id, &s.Build_source, &s.Application, &s.Target, &s.Zap_id,
+			&s.Created_at); err != nil {
+			return scans, total, err
+		}
+		scans = append(scans, s)
+	}
+	return scans, total, rows.Err()
+}
+
+// Tables holding rows of a scan, deleted with it. Issues keep their history.
+var scanTables = []string{
+	"vulnerability_findings", "scan_urls", "sast_results", "sast_routes", "defectdojo_pushes",
+	"scan_events", "scan_webhooks", "webhook_deliveries", "webhook_retries", "webhook_dead_letters",
+	"finding_retests",
+}
+
+// DeleteScanFromDB removes a scan and everything recorded for it but its archived artifacts, which
+// stay recorded and stored until their retention ends and artifact.Expire deletes them.
+func DeleteScanFromDB(conn *sql.DB, scanID int64) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	for _, t := range scanTables {
+		if _, err := tx.Exec("DELETE FROM "+t+" WHERE scan_id=?", scanID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// Release targets keep the result of the scan without it
+	if _, err := tx.Exec("UPDATE release_targets SET scan_id=NULL WHERE scan_id=?", scanID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM scans WHERE id=?", scanID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,8 +1,13 @@
 package scan
 
 import (
+	"errors"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 
 	"src/pkg/zapScanner"
@@ -223,3 +228,102 @@ func TestCheckScanVulnerable(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, true, result)
 }
+
+func TestQueryRunningScans(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM scans WHERE 1=1 AND status NOT IN ('passed', 'failed', " +
+		"'error', 'cancelled')")).WithArgs().WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scans WHERE 1=1 AND status NOT IN ('passed', 'failed', 'error', " +
+		"'cancelled') ORDER BY id DESC")).WithArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "build_id", "build_source", "application", "target",
+			"zap_id", "created_at"}).AddRow(4, "12", "b-4", "github", "shop", "https://shop", 2, time.Now()))
+
+	scans, total, err := QueryScansFromDB(db, Filter{Status: "running"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "b-4", scans[0].Build_id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteScanFromDBRollsBack(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM vulnerability_findings WHERE scan_id=?")).WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM scan_urls WHERE scan_id=?")).WithArgs(4).
+		WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	err := DeleteScanFromDB(db, 4)
+
+	assert.EqualError(t, err, "lock wait timeout")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestFinished(t *testing.T) {
+	for status, expected := range map[string]bool{
+		"passed": true, "failed": true, "error": true, "cancelled": true, "started": false, "45": false,
+	} {
+		assert.Equal(t, expected, Finished(status), status)
+	}
+}
+
+func TestAddScanToDBAttempts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	q := regexp.QuoteMeta("INSERT INTO scans(status, build_id, build_source, application, target, zap_id, attempt, asset_id)")
+
+	mock.ExpectExec(q).WithArgs("started", "abcde-1234", "github", "shop", "https://shop", 3, 1, "shop").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec(q).WithArgs("started", "abcde-1234", "github", "shop", "https://shop", 4, 2, "shop").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abcde-1234-2'"})
+
+	s := Scan{Status: "started", Build_id: "abcde-1234", Build_source: "github", Application: "shop",
+		Target: "https://shop", Zap_id: 3}
+	id, err := AddScanToDB(db, s)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), id)
+
+	s.Zap_id, s.Attempt = 4, 2
+	_, err = AddScanToDB(db, s)
+	assert.Equal(t, ErrDuplicate, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLastAttemptFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(attempt), 0) FROM scans WHERE build_id=?")).
+		WithArgs("abcde-1234").
+		WillReturnRows(sqlmock.NewRows([]string{"attempt"}).AddRow(2))
+
+	attempt, err := GetLastAttemptFromDB(db, "abcde-1234")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempt)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateActiveScanStatus(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	q := regexp.QuoteMeta("UPDATE scans SET status=? WHERE id=? AND status<>'cancelled'")
+	status := regexp.QuoteMeta("SELECT status FROM scans WHERE id=?")
+
+	mock.ExpectExec(q).WithArgs("40", int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Same progress as before, the scan is still running
+	mock.ExpectExec(q).WithArgs("40", int64(9)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(status).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("40"))
+	mock.ExpectExec(q).WithArgs("passed", int64(9)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(status).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusCancelled))
+
+	for _, tc := range []struct {
+		status    string
+		cancelled bool
+	}{{"40", false}, {"40", false}, {"passed", true}} {
+		cancelled, err := UpdateActiveScanStatus(db, tc.status, 9)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.cancelled, cancelled, tc.status)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,4 @@
+// Package scanpb is the gRPC API of the scans, generated from scans.proto.
+package scanpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative scans.proto
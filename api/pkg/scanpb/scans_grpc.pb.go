@@ -0,0 +1,261 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: scans.proto
+
+// The gRPC API of DAST for internal callers. It serves the scans of the v2 HTTP API: scans are
+// identified by the build ID they were submitted with.
+
+package scanpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ScanService_SubmitScan_FullMethodName   = "/dast.v1.ScanService/SubmitScan"
+	ScanService_GetScan_FullMethodName      = "/dast.v1.ScanService/GetScan"
+	ScanService_ListFindings_FullMethodName = "/dast.v1.ScanService/ListFindings"
+	ScanService_WatchScan_FullMethodName    = "/dast.v1.ScanService/WatchScan"
+)
+
+// ScanServiceClient is the client API for ScanService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ScanServiceClient interface {
+	// Starts a scan of a build, or returns the latest attempt of a build submitted before.
+	SubmitScan(ctx context.Context, in *SubmitScanRequest, opts ...grpc.CallOption) (*Scan, error)
+	// Returns a scan, NOT_FOUND when there is none with the ID.
+	GetScan(ctx context.Context, in *GetScanRequest, opts ...grpc.CallOption) (*Scan, error)
+	// Lists the findings of a scan, a page at a time.
+	ListFindings(ctx context.Context, in *ListFindingsRequest, opts ...grpc.CallOption) (*ListFindingsResponse, error)
+	// Sends the scan when it's called and whenever its status or progress changes, until it has
+	// finished.
+	WatchScan(ctx context.Context, in *WatchScanRequest, opts ...grpc.CallOption) (ScanService_WatchScanClient, error)
+}
+
+type scanServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewScanServiceClient(cc grpc.ClientConnInterface) ScanServiceClient {
+	return &scanServiceClient{cc}
+}
+
+func (c *scanServiceClient) SubmitScan(ctx context.Context, in *SubmitScanRequest, opts ...grpc.CallOption) (*Scan, error) {
+	out := new(Scan)
+	err := c.cc.Invoke(ctx, ScanService_SubmitScan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scanServiceClient) GetScan(ctx context.Context, in *GetScanRequest, opts ...grpc.CallOption) (*Scan, error) {
+	out := new(Scan)
+	err := c.cc.Invoke(ctx, ScanService_GetScan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scanServiceClient) ListFindings(ctx context.Context, in *ListFindingsRequest, opts ...grpc.CallOption) (*ListFindingsResponse, error) {
+	out := new(ListFindingsResponse)
+	err := c.cc.Invoke(ctx, ScanService_ListFindings_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scanServiceClient) WatchScan(ctx context.Context, in *WatchScanRequest, opts ...grpc.CallOption) (ScanService_WatchScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ScanService_ServiceDesc.Streams[0], ScanService_WatchScan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &scanServiceWatchScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ScanService_WatchScanClient interface {
+	Recv() (*Scan, error)
+	grpc.ClientStream
+}
+
+type scanServiceWatchScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *scanServiceWatchScanClient) Recv() (*Scan, error) {
+	m := new(Scan)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ScanServiceServer is the server API for ScanService service.
+// All implementations must embed UnimplementedScanServiceServer
+// for forward compatibility
+type ScanServiceServer interface {
+	// Starts a scan of a build, or returns the latest attempt of a build submitted before.
+	SubmitScan(context.Context, *SubmitScanRequest) (*Scan, error)
+	// Returns a scan, NOT_FOUND when there is none with the ID.
+	GetScan(context.Context, *GetScanRequest) (*Scan, error)
+	// Lists the findings of a scan, a page at a time.
+	ListFindings(context.Context, *ListFindingsRequest) (*ListFindingsResponse, error)
+	// Sends the scan when it's called and whenever its status or progress changes, until it has
+	// finished.
+	WatchScan(*WatchScanRequest, ScanService_WatchScanServer) error
+	mustEmbedUnimplementedScanServiceServer()
+}
+
+// UnimplementedScanServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedScanServiceServer struct {
+}
+
+func (UnimplementedScanServiceServer) SubmitScan(context.Context, *SubmitScanRequest) (*Scan, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitScan not implemented")
+}
+func (UnimplementedScanServiceServer) GetScan(context.Context, *GetScanRequest) (*Scan, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetScan not implemented")
+}
+func (UnimplementedScanServiceServer) ListFindings(context.Context, *ListFindingsRequest) (*ListFindingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFindings not implemented")
+}
+func (UnimplementedScanServiceServer) WatchScan(*WatchScanRequest, ScanService_WatchScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchScan not implemented")
+}
+func (UnimplementedScanServiceServer) mustEmbedUnimplementedScanServiceServer() {}
+
+// UnsafeScanServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ScanServiceServer will
+// result in compilation errors.
+type UnsafeScanServiceServer interface {
+	mustEmbedUnimplementedScanServiceServer()
+}
+
+func RegisterScanServiceServer(s grpc.ServiceRegistrar, srv ScanServiceServer) {
+	s.RegisterService(&ScanService_ServiceDesc, srv)
+}
+
+func _ScanService_SubmitScan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScanServiceServer).SubmitScan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScanService_SubmitScan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScanServiceServer).SubmitScan(ctx, req.(*SubmitScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScanService_GetScan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScanServiceServer).GetScan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScanService_GetScan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScanServiceServer).GetScan(ctx, req.(*GetScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScanService_ListFindings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFindingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScanServiceServer).ListFindings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScanService_ListFindings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScanServiceServer).ListFindings(ctx, req.(*ListFindingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScanService_WatchScan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ScanServiceServer).WatchScan(m, &scanServiceWatchScanServer{stream})
+}
+
+type ScanService_WatchScanServer interface {
+	Send(*Scan) error
+	grpc.ServerStream
+}
+
+type scanServiceWatchScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *scanServiceWatchScanServer) Send(m *Scan) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ScanService_ServiceDesc is the grpc.ServiceDesc for ScanService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ScanService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dast.v1.ScanService",
+	HandlerType: (*ScanServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitScan",
+			Handler:    _ScanService_SubmitScan_Handler,
+		},
+		{
+			MethodName: "GetScan",
+			Handler:    _ScanService_GetScan_Handler,
+		},
+		{
+			MethodName: "ListFindings",
+			Handler:    _ScanService_ListFindings_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchScan",
+			Handler:       _ScanService_WatchScan_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "scans.proto",
+}
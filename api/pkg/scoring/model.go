@@ -0,0 +1,76 @@
+package scoring
+
+// Scoring modes. Legacy adds the catalog score of every alert instance, which is how scans were
+// gated before weighting existed. Weighted multiplies the catalog score by the risk × confidence
+// matrix and aggregates instances of the same issue.
+const (
+	ModeLegacy   = "legacy"
+	ModeWeighted = "weighted"
+)
+
+// Aggregation strategies for the instances of a single issue.
+const (
+	AggregateInstance = "instance" // every instance adds its score
+	AggregateOnce     = "once"     // the issue counts once, with its highest instance score
+	AggregateCap      = "cap"      // the issue counts once per instance, up to Model.Cap instances
+	AggregatePerURL   = "url"      // the issue counts once per distinct normalized URL path
+)
+
+// Normalized ZAP risk levels.
+const (
+	RiskInformational = "informational"
+	RiskLow           = "low"
+	RiskMedium        = "medium"
+	RiskHigh          = "high"
+)
+
+// Normalized ZAP confidence levels.
+const (
+	ConfidenceFalsePositive = "false positive"
+	ConfidenceLow           = "low"
+	ConfidenceMedium        = "medium"
+	ConfidenceHigh          = "high"
+	ConfidenceConfirmed     = "confirmed"
+)
+
+// Weights maps a normalized risk level to the multiplier applied for each confidence level.
+type Weights map[string]map[string]float64
+
+// Model decides how the alerts of a scan turn into a score and whether that score passes.
+// Confirmed multiplies the weight of alerts a static analysis result confirms, in both modes.
+type Model struct {
+	Mode        string
+	Weights     Weights
+	Aggregation string
+	Cap         int
+	Threshold   float64
+	Confirmed   float64
+}
+
+// Alert is a scored alert instance. Issue groups the instances of the same problem, which for
+// ZAP alerts is the plugin ID. Confirmed alerts were also reported by static analysis.
+type Alert struct {
+	Issue      string
+	URL        string
+	Risk       string
+	Confidence string
+	Score      int
+	Confirmed  bool
+}
+
+// DefaultWeights is used in weighted mode when no matrix is configured. Low-confidence and
+// informational alerts barely contribute, false positives never do.
+var DefaultWeights = Weights{
+	RiskHigh: {
+		ConfidenceConfirmed: 1, ConfidenceHigh: 1, ConfidenceMedium: 0.75, ConfidenceLow: 0.25,
+	},
+	RiskMedium: {
+		ConfidenceConfirmed: 0.75, ConfidenceHigh: 0.75, ConfidenceMedium: 0.5, ConfidenceLow: 0.1,
+	},
+	RiskLow: {
+		ConfidenceConfirmed: 0.5, ConfidenceHigh: 0.5, ConfidenceMedium: 0.25, ConfidenceLow: 0,
+	},
+	RiskInformational: {
+		ConfidenceConfirmed: 0.1, ConfidenceHigh: 0.1, ConfidenceMedium: 0, ConfidenceLow: 0,
+	},
+}
@@ -0,0 +1,180 @@
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"src/pkg/finding"
+)
+
+const defaultCap = 3
+
+var riskCodes = map[string]string{
+	"0": RiskInformational,
+	"1": RiskLow,
+	"2": RiskMedium,
+	"3": RiskHigh,
+}
+
+var confidenceCodes = map[string]string{
+	"0": ConfidenceFalsePositive,
+	"1": ConfidenceLow,
+	"2": ConfidenceMedium,
+	"3": ConfidenceHigh,
+	"4": ConfidenceConfirmed,
+}
+
+// Legacy returns the model that reproduces the original gate: every instance counts with its
+// catalog score, regardless of risk and confidence.
+func Legacy(threshold float64) Model {
+	return Model{Mode: ModeLegacy, Aggregation: AggregateInstance, Threshold: threshold}
+}
+
+// NewModel builds a scoring model from configuration values. weightsJSON is an optional
+// risk -> confidence -> weight matrix, DefaultWeights is used when it is empty.
+func NewModel(mode string, aggregation string, cap int, weightsJSON string, threshold float64) (Model, error) {
+	switch strings.ToLower(mode) {
+	case "", ModeLegacy:
+		return Legacy(threshold), nil
+	case ModeWeighted:
+	default:
+		return Legacy(threshold), fmt.Errorf("unknown scoring mode %q", mode)
+	}
+
+	m := Model{Mode: ModeWeighted, Weights: DefaultWeights, Aggregation: AggregateOnce, Cap: cap,
+		Threshold: threshold}
+	switch strings.ToLower(aggregation) {
+	case "":
+	case AggregateInstance, AggregateOnce, AggregateCap, AggregatePerURL:
+		m.Aggregation = strings.ToLower(aggregation)
+	default:
+		return m, fmt.Errorf("unknown scoring aggregation %q", aggregation)
+	}
+	if m.Cap <= 0 {
+		m.Cap = defaultCap
+	}
+	if weightsJSON != "" {
+		var raw map[string]map[string]float64
+		if err := json.Unmarshal([]byte(weightsJSON), &raw); err != nil {
+			return m, fmt.Errorf("error parsing scoring weights: %v", err)
+		}
+		w := make(Weights)
+		for risk, row := range raw {
+			r := NormalizeRisk(risk)
+			if w[r] == nil {
+				w[r] = make(map[string]float64)
+			}
+			for confidence, weight := range row {
+				w[r][NormalizeConfidence(confidence)] = weight
+			}
+		}
+		m.Weights = w
+	}
+	return m, nil
+}
+
+// NormalizeRisk accepts ZAP risk names ("High") and risk codes ("3").
+func NormalizeRisk(risk string) string {
+	r := strings.ToLower(strings.TrimSpace(risk))
+	if n, ok := riskCodes[r]; ok {
+		return n
+	}
+	if r == "info" {
+		return RiskInformational
+	}
+	return r
+}
+
+// NormalizeConfidence accepts ZAP confidence names ("Confirmed", "User Confirmed") and codes ("4").
+func NormalizeConfidence(confidence string) string {
+	c := strings.ToLower(strings.TrimSpace(confidence))
+	if n, ok := confidenceCodes[c]; ok {
+		return n
+	}
+	if c == "user confirmed" {
+		return ConfidenceConfirmed
+	}
+	if c == "falsepositive" {
+		return ConfidenceFalsePositive
+	}
+	return c
+}
+
+// Weight is the multiplier applied to an alert. Legacy models and risk levels missing from the
+// matrix weigh 1, false positives and confidence levels missing from a known risk row weigh 0.
+func (m Model) Weight(risk string, confidence string) float64 {
+	if m.Mode != ModeWeighted {
+		return 1
+	}
+	c := NormalizeConfidence(confidence)
+	if c == ConfidenceFalsePositive {
+		return 0
+	}
+	row, ok := m.Weights[NormalizeRisk(risk)]
+	if !ok {
+		return 1
+	}
+	return row[c]
+}
+
+// ConfirmedWeight is the extra multiplier of alerts confirmed by static analysis, 1 when unset.
+func (m Model) ConfirmedWeight() float64 {
+	if m.Confirmed <= 0 {
+		return 1
+	}
+	return m.Confirmed
+}
+
+func (m Model) alertWeight(a Alert) float64 {
+	w := m.Weight(a.Risk, a.Confidence)
+	if a.Confirmed {
+		w *= m.ConfirmedWeight()
+	}
+	return w
+}
+
+// Score adds up the weighted scores of the alerts following the model's aggregation strategy.
+func (m Model) Score(alerts []Alert) float64 {
+	total := 0.0
+	if m.Aggregation == AggregateInstance {
+		for _, a := range alerts {
+			total += float64(a.Score) * m.alertWeight(a)
+		}
+		return total
+	}
+
+	groups := make(map[string][]float64)
+	var keys []string
+	for _, a := range alerts {
+		key := a.Issue
+		if m.Aggregation == AggregatePerURL {
+			key = a.Issue + "\x00" + finding.NormalizePath(a.URL)
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], float64(a.Score)*m.alertWeight(a))
+	}
+	for _, k := range keys {
+		scores := groups[k]
+		sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+		if m.Aggregation == AggregateCap {
+			if len(scores) > m.Cap {
+				scores = scores[:m.Cap]
+			}
+			for _, s := range scores {
+				total += s
+			}
+		} else {
+			total += scores[0]
+		}
+	}
+	return total
+}
+
+// Passed reports whether a score is below the model's threshold.
+func (m Model) Passed(score float64) bool {
+	return score < m.Threshold
+}
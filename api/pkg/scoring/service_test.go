@@ -0,0 +1,101 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var repeatedAlerts = []Alert{
+	{Issue: "40018", URL: "https://a/login", Risk: "High", Confidence: "Medium", Score: 20},
+	{Issue: "40018", URL: "https://a/login?x=1", Risk: "High", Confidence: "Medium", Score: 20},
+	{Issue: "40018", URL: "https://a/search", Risk: "High", Confidence: "High", Score: 20},
+	{Issue: "40018", URL: "https://a/users/1", Risk: "High", Confidence: "Low", Score: 20},
+	{Issue: "10202", URL: "https://a/", Risk: "Low", Confidence: "Low", Score: 4},
+}
+
+func TestLegacyScoreSumsEveryInstance(t *testing.T) {
+	m, err := NewModel("legacy", "once", 1, "", 8)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 84.0, m.Score(repeatedAlerts))
+	assert.False(t, m.Passed(m.Score(repeatedAlerts)))
+}
+
+func TestWeightedScoreCountOnce(t *testing.T) {
+	m, err := NewModel("weighted", "once", 0, "", 8)
+
+	assert.Nil(t, err)
+	// 40018 keeps its best instance (high/high = 20), 10202 is low/low = 0
+	assert.Equal(t, 20.0, m.Score(repeatedAlerts))
+}
+
+func TestWeightedScoreCap(t *testing.T) {
+	m, err := NewModel("weighted", "cap", 2, "", 8)
+
+	assert.Nil(t, err)
+	// 20*1 + 20*0.75
+	assert.Equal(t, 35.0, m.Score(repeatedAlerts))
+}
+
+func TestWeightedScorePerURL(t *testing.T) {
+	m, err := NewModel("weighted", "url", 0, "", 8)
+
+	assert.Nil(t, err)
+	// /login (15, query ignored) + /search (20) + /users/{id} (5)
+	assert.Equal(t, 40.0, m.Score(repeatedAlerts))
+}
+
+func TestWeightedScoreCustomMatrix(t *testing.T) {
+	m, err := NewModel("weighted", "instance", 0, `{"High":{"Low":0.5},"3":{"2":0}}`, 8)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 10.0, m.Score([]Alert{{Issue: "1", Risk: "High", Confidence: "Low", Score: 20}}))
+	assert.Equal(t, 0.0, m.Score([]Alert{{Issue: "1", Risk: "High", Confidence: "Medium", Score: 20}}))
+	// Risk levels missing from the matrix are not discounted
+	assert.Equal(t, 4.0, m.Score([]Alert{{Issue: "1", Risk: "Medium", Confidence: "Low", Score: 4}}))
+}
+
+func TestConfirmedAlertsWeighMore(t *testing.T) {
+	m, _ := NewModel("weighted", "once", 0, "", 8)
+	alerts := []Alert{
+		{Issue: "40018", URL: "https://a/login", Risk: "High", Confidence: "Medium", Score: 20, Confirmed: true},
+		{Issue: "40018", URL: "https://a/search", Risk: "High", Confidence: "High", Score: 20},
+	}
+
+	// Unset, confirmation doesn't change the score
+	assert.Equal(t, 20.0, m.Score(alerts))
+	m.Confirmed = 2
+	// The confirmed instance (20*0.75*2) is now the issue's highest
+	assert.Equal(t, 30.0, m.Score(alerts))
+
+	legacy := Legacy(8)
+	legacy.Confirmed = 1.5
+	assert.Equal(t, 50.0, legacy.Score(alerts))
+}
+
+func TestFalsePositivesNeverCount(t *testing.T) {
+	m, _ := NewModel("weighted", "instance", 0, `{"High":{"False Positive":1}}`, 8)
+
+	assert.Equal(t, 0.0, m.Weight("High", "0"))
+	assert.Equal(t, 0.0, m.Weight("High", "False Positive"))
+}
+
+func TestNormalizeZapCodes(t *testing.T) {
+	assert.Equal(t, RiskHigh, NormalizeRisk("3"))
+	assert.Equal(t, RiskInformational, NormalizeRisk("Informational"))
+	assert.Equal(t, ConfidenceConfirmed, NormalizeConfidence("User Confirmed"))
+	assert.Equal(t, ConfidenceMedium, NormalizeConfidence("2"))
+}
+
+func TestInvalidConfigurationFallsBack(t *testing.T) {
+	m, err := NewModel("fancy", "", 0, "", 8)
+	assert.NotNil(t, err)
+	assert.Equal(t, ModeLegacy, m.Mode)
+
+	_, err = NewModel("weighted", "sometimes", 0, "", 8)
+	assert.NotNil(t, err)
+
+	_, err = NewModel("weighted", "", 0, "{not json", 8)
+	assert.NotNil(t, err)
+}
@@ -7,37 +7,101 @@ import (
 	"encoding/hex"
 	"io/ioutil"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AuthMiddleware(secret string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		bodyBytes, _ := ioutil.ReadAll(c.Request.Body)
+	return AuthMiddlewareWith(secret, func(c *gin.Context, status int) {
+		c.AbortWithStatus(status)
+	})
+}
 
-		calculatedHMAC, err := CalculateHMAC(bodyBytes, secret)
-		if err != nil {
-			log.Printf("Error decoding hmac secret %v", err)
-			c.AbortWithStatus(500)
-			return
-		}
-		s := c.Request.Header.Get("Signature")
-		receivedHMACBytes, err := hex.DecodeString(s)
-		if err != nil {
-			log.Printf("Invalid signature, unable to decode hex value. Received %s", s)
-			c.AbortWithStatus(401)
-			return
-		}
-		if !hmac.Equal(calculatedHMAC, receivedHMACBytes) {
-			log.Printf("Invalid signature. Received %s", s)
-			c.AbortWithStatus(401)
+// AuthMiddlewareWith is AuthMiddleware with the response to rejected requests written by abort.
+func AuthMiddlewareWith(secret string, abort func(c *gin.Context, status int)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status, ok := VerifyRequest(c, secret); !ok {
+			abort(c, status)
 			return
 		}
+		c.Next()
+	}
+}
+
+// TimestampHeader carries the Unix time, in seconds, a request was signed at. The signature of a
+// timestamped request covers its method, path and query too, see RequestPayload, and is only
+// accepted for MaxSignatureAge around that time.
+const TimestampHeader = "Timestamp"
+
+// MaxSignatureAge is how far the timestamp of a request may be from the time it's received.
+const MaxSignatureAge = 5 * time.Minute
 
+// VerifyRequest checks the Signature header of a request, which is put back for the handlers. A
+// request without TimestampHeader is signed over its body only; that's only accepted when it has
+// a body, the signature of an empty one never changes and could be replayed against any route.
+// The status tells why a request is rejected.
+func VerifyRequest(c *gin.Context, secret string) (int, bool) {
+	var bodyBytes []byte
+	if c.Request.Body != nil {
+		bodyBytes, _ = ioutil.ReadAll(c.Request.Body)
 		c.Request.Body.Close()
-		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-		c.Next()
 	}
+
+	payload := bodyBytes
+	if ts := c.Request.Header.Get(TimestampHeader); ts != "" {
+		if !Fresh(ts, time.Now()) {
+			log.Printf("Invalid signature, timestamp %s is missing or outside the replay window", ts)
+			return 401, false
+		}
+		payload = RequestPayload(ts, c.Request.Method, c.Request.URL.RequestURI(), bodyBytes)
+	} else if len(bodyBytes) == 0 {
+		log.Printf("Invalid signature, request without body has no %s header", TimestampHeader)
+		return 401, false
+	}
+	if status, ok := CheckSignature(payload, c.Request.Header.Get("Signature"), secret); !ok {
+		return status, false
+	}
+
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	return 200, true
+}
+
+// RequestPayload is what the signature of a timestamped request is computed over:
+// "<timestamp>.<METHOD>.<path and query as sent>.<body>".
+func RequestPayload(timestamp string, method string, uri string, body []byte) []byte {
+	return append([]byte(timestamp+"."+method+"."+uri+"."), body...)
+}
+
+// Fresh reports whether a timestamp, in Unix seconds, is within MaxSignatureAge of now.
+func Fresh(timestamp string, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	return age <= MaxSignatureAge && age >= -MaxSignatureAge
+}
+
+// CheckSignature checks a hex encoded HMAC of a payload, for requests that don't come over HTTP.
+// The status tells why a signature is rejected.
+func CheckSignature(payload []byte, s string, secret string) (int, bool) {
+	calculatedHMAC, err := CalculateHMAC(payload, secret)
+	if err != nil {
+		log.Printf("Error decoding hmac secret %v", err)
+		return 500, false
+	}
+	receivedHMACBytes, err := hex.DecodeString(s)
+	if err != nil {
+		log.Printf("Invalid signature, unable to decode hex value. Received %s", s)
+		return 401, false
+	}
+	if !hmac.Equal(calculatedHMAC, receivedHMACBytes) {
+		log.Printf("Invalid signature. Received %s", s)
+		return 401, false
+	}
+	return 200, true
 }
 
 func CalculateHMAC(b []byte, secret string) ([]byte, error) {
@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -86,3 +88,58 @@ func TestAuthMiddlewareUnauthorized(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, response.Code, "Expected code %d, received code %d",
 		http.StatusOK, response.Code)
 }
+
+func TestCheckSignature(t *testing.T) {
+	payload := []byte("payload")
+	h, _ := CalculateHMAC(payload, s)
+
+	status, ok := CheckSignature(payload, hex.EncodeToString(h), s)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, ok = CheckSignature([]byte("other"), hex.EncodeToString(h), s)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, ok = CheckSignature(payload, "zz", s)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, ok = CheckSignature(payload, hex.EncodeToString(h), "not hex")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusInternalServerError, status)
+}
+
+func TestAuthMiddlewareTimestampedRequest(t *testing.T) {
+	r := gin.Default()
+	r.DELETE("/scans/:id", AuthMiddleware(s), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	sign := func(ts string, uri string) string {
+		h, _ := CalculateHMAC(RequestPayload(ts, "DELETE", uri, nil), s)
+		return hex.EncodeToString(h)
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-MaxSignatureAge-time.Minute).Unix(), 10)
+	emptyBody, _ := CalculateHMAC(nil, s)
+
+	for _, tc := range []struct {
+		timestamp string
+		signature string
+		status    int
+	}{
+		{now, sign(now, "/scans/a?force=true"), http.StatusNoContent},
+		// Signed for another scan, too old, or over the body only
+		{now, sign(now, "/scans/b?force=true"), http.StatusUnauthorized},
+		{old, sign(old, "/scans/a?force=true"), http.StatusUnauthorized},
+		{"", hex.EncodeToString(emptyBody), http.StatusUnauthorized},
+	} {
+		request, _ := http.NewRequest("DELETE", "/scans/a?force=true", nil)
+		request.Header.Set(TimestampHeader, tc.timestamp)
+		request.Header.Set("Signature", tc.signature)
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+
+		assert.Equal(t, tc.status, response.Code, tc.timestamp)
+	}
+}
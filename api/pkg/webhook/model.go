@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// EventScanCompleted is sent when a scan reaches a final status.
+const EventScanCompleted = "scan.completed"
+
+// MaxCallbacks is how many callback URLs a scan can register.
+const MaxCallbacks = 5
+
+// internalHosts are names of the local machine and of cloud metadata services, refused as callbacks
+// with their subdomains whatever they resolve to.
+var internalHosts = []string{"localhost", "metadata", "metadata.google.internal", "metadata.goog"}
+
+// Headers of a delivery. The signature is the hex HMAC-SHA256 of the timestamp, a dot and the body.
+const (
+	EventHeader     = "X-DAST-Event"
+	TimestampHeader = "X-DAST-Timestamp"
+	SignatureHeader = "X-DAST-Signature"
+)
+
+// Webhook is a callback URL registered by a scan request, as stored in scan_webhooks.
+type Webhook struct {
+	ID        int64
+	ScanID    int64
+	URL       string
+	CreatedAt time.Time
+}
+
+// Payload is the body POSTed to the callback URLs of a scan.
+type Payload struct {
+	Event       string            `json:"event"`
+	ScanID      string            `json:"scan_id"`
+	Application string            `json:"application"`
+	Target      string            `json:"target"`
+	Status      string            `json:"status"`
+	Score       *float64          `json:"score,omitempty"`
+	Summary     Summary           `json:"summary"`
+	Links       map[string]string `json:"links"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// Summary counts the findings of a scan. Severities only counts the findings that aren't
+// suppressed.
+type Summary struct {
+	Findings   int            `json:"findings"`
+	Suppressed int            `json:"suppressed"`
+	Severities map[string]int `json:"severities"`
+}
+
+// Delivery is one attempt to POST a payload, as logged in webhook_deliveries. StatusCode is 0 when
+// the callback couldn't be reached.
+type Delivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  int64     `json:"-"`
+	ScanID     int64     `json:"-"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DeadLetter is a payload that couldn't be delivered, kept in webhook_dead_letters with the error
+// of the last attempt.
+type DeadLetter struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"-"`
+	ScanID    int64           `json:"-"`
+	URL       string          `json:"url"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Retry is a payload waiting in webhook_retries for its next attempt, which is Attempt and is made
+// at DueAt.
+type Retry struct {
+	ID        int64     `json:"id"`
+	WebhookID int64     `json:"-"`
+	ScanID    int64     `json:"-"`
+	URL       string    `json:"url"`
+	Event     string    `json:"event"`
+	Payload   []byte    `json:"-"`
+	Attempt   int       `json:"attempt"`
+	LastError string    `json:"last_error"`
+	DueAt     time.Time `json:"due_at"`
+}
+
+// retryLease is how long a retry claimed by a replica is left alone by the others. It's longer than
+// an attempt takes, a retry that's still claimed after it was lost with its replica.
+const retryLease = 5 * time.Minute
+
+// Sender POSTs signed payloads, retrying failed attempts with exponential backoff: the n-th retry
+// waits Backoff times 2^(n-1).
+type Sender struct {
+	secret      string
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+}
@@ -0,0 +1,409 @@
+package webhook
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"src/pkg/security"
+)
+
+// NewSender returns a sender that only connects to public addresses and the allowed networks, see
+// CheckIP.
+func NewSender(secret string, maxAttempts int, backoff time.Duration, timeout time.Duration,
+	allowed []*net.IPNet) *Sender {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	// The address is checked once it's resolved, so a name can't point at an internal service
+	dialer := &net.Dialer{Timeout: timeout, Control: func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		return CheckIP(net.ParseIP(host), allowed)
+	}}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout}
+	return &Sender{secret: secret, maxAttempts: maxAttempts, backoff: backoff,
+		client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// ParseNetworks reads a comma separated list of CIDRs, like WEBHOOK_ALLOWED_NETWORKS.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", cidr)
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// CheckIP refuses the addresses a callback could use to reach the controller's own network:
+// loopback, link-local, which has the cloud metadata services, private, unspecified and multicast
+// addresses. Addresses in the allowed networks are accepted.
+func CheckIP(ip net.IP, allowed []*net.IPNet) error {
+	if ip == nil {
+		return errors.New("callback address isn't an IP")
+	}
+	for _, n := range allowed {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("callback address %s isn't public", ip)
+	}
+	return nil
+}
+
+// ValidateURL checks that a callback is an absolute http or https URL that isn't on an internal
+// host. Hostnames are checked again with the addresses they resolve to when payloads are delivered.
+func ValidateURL(raw string, allowed []*net.IPNet) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL %q", raw)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if err := CheckIP(ip, allowed); err != nil {
+			return fmt.Errorf("callback URL %q isn't allowed: %v", raw, err)
+		}
+		return nil
+	}
+	for _, internal := range internalHosts {
+		if host == internal || strings.HasSuffix(host, "."+internal) {
+			return fmt.Errorf("callback URL %q isn't allowed: %s is an internal host", raw, host)
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature header of a body sent at timestamp, in Unix seconds. Receivers compute
+// it the same way with the shared secret and should reject old timestamps, so deliveries can't be
+// replayed.
+func Sign(secret string, timestamp int64, body []byte) (string, error) {
+	h, err := security.CalculateHMAC(append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...), secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h), nil
+}
+
+// Deliver POSTs a payload to a webhook. Every attempt is logged in webhook_deliveries. An attempt
+// that can succeed later, when the callback was unreachable or answered 5xx, 408 or 429, is stored
+// in webhook_retries until its backoff elapses and RetryDue makes the next one, so retries outlive
+// the replica. Payloads that weren't delivered, after the last attempt or another 4xx status, go
+// to webhook_dead_letters and the error of the last attempt is returned, nil is returned once the
+// payload is delivered or its retry is stored.
+func (s *Sender) Deliver(conn *sql.DB, w Webhook, event string, body []byte) error {
+	return s.attempt(conn, Retry{WebhookID: w.ID, ScanID: w.ScanID, URL: w.URL, Event: event, Payload: body,
+		Attempt: 1})
+}
+
+// RetryDue makes the next attempt of up to limit retries that are due at now and returns how many
+// it made. The retries are claimed for retryLease first, so replicas don't attempt them twice.
+func (s *Sender) RetryDue(conn *sql.DB, now time.Time, limit int) (int, error) {
+	retries, err := ClaimRetriesFromDB(conn, now, now.Add(retryLease), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range retries {
+		if err := s.attempt(conn, r); err != nil {
+			log.Printf("Couldn't deliver webhook %d to %s after %d attempts: %v", r.WebhookID, r.URL, r.Attempt, err)
+		}
+	}
+	return len(retries), nil
+}
+
+// attempt POSTs a payload once, then stores its retry or dead letter if it failed. A stored retry
+// is updated or deleted.
+func (s *Sender) attempt(conn *sql.DB, r Retry) error {
+	code, err := s.post(r.URL, r.Event, r.Payload)
+	now := time.Now().UTC()
+	d := Delivery{WebhookID: r.WebhookID, ScanID: r.ScanID, URL: r.URL, Event: r.Event, Attempt: r.Attempt,
+		StatusCode: code, CreatedAt: now}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if _, dbErr := AddDeliveryToDB(conn, d); dbErr != nil {
+		log.Printf("Error logging delivery of webhook %d: %v", r.WebhookID, dbErr)
+	}
+	if err == nil {
+		s.forget(conn, r)
+		return nil
+	}
+	if r.Attempt < s.maxAttempts && retryable(code) {
+		next := r
+		next.LastError = err.Error()
+		next.DueAt = now.Add(s.backoff << (r.Attempt - 1))
+		next.Attempt++
+		var dbErr error
+		if r.ID > 0 {
+			dbErr = UpdateRetryInDB(conn, next)
+		} else {
+			_, dbErr = AddRetryToDB(conn, next)
+		}
+		if dbErr == nil {
+			return nil
+		}
+		log.Printf("Error storing retry of webhook %d, dead-lettering it: %v", r.WebhookID, dbErr)
+	}
+	dl := DeadLetter{WebhookID: r.WebhookID, ScanID: r.ScanID, URL: r.URL, Event: r.Event, Payload: r.Payload,
+		Attempts: r.Attempt, LastError: err.Error(), CreatedAt: now}
+	if _, dbErr := AddDeadLetterToDB(conn, dl); dbErr != nil {
+		// A stored retry is kept, it's claimed again once its lease runs out
+		log.Printf("Error dead-lettering webhook %d: %v", r.WebhookID, dbErr)
+		return err
+	}
+	s.forget(conn, r)
+	return err
+}
+
+// forget deletes the stored retry of a payload that was delivered or dead-lettered.
+func (s *Sender) forget(conn *sql.DB, r Retry) {
+	if r.ID <= 0 {
+		return
+	}
+	if err := DeleteRetryFromDB(conn, r.ID); err != nil {
+		log.Printf("Error deleting retry %d of webhook %d: %v", r.ID, r.WebhookID, err)
+	}
+}
+
+func (s *Sender) post(callback string, event string, body []byte) (int, error) {
+	ts := time.Now().Unix()
+	signature, err := Sign(s.secret, ts, body)
+	if err != nil {
+		return 0, fmt.Errorf("error signing payload: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, signature)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// retryable reports whether an attempt that got the status can succeed later. Unreachable
+// callbacks have status 0.
+func retryable(code int) bool {
+	return code == 0 || code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// AddWebhooksToDB registers the callback URLs of a scan.
+func AddWebhooksToDB(conn *sql.DB, scanID int64, urls []string) error {
+	for _, u := range urls {
+		if _, err := conn.Exec("INSERT INTO scan_webhooks(scan_id, url) VALUES (?, ?)", scanID, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhooksFromDB lists the callback URLs of a scan in the order they were registered.
+func WebhooksFromDB(conn *sql.DB, scanID int64) ([]Webhook, error) {
+	q := "SELECT id, scan_id, url, created_at FROM scan_webhooks WHERE scan_id=? ORDER BY id"
+	var webhooks []Webhook
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return webhooks, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.ScanID, &w.URL, &w.CreatedAt); err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func AddDeliveryToDB(conn *sql.DB, d Delivery) (int64, error) {
+	q := "INSERT INTO webhook_deliveries(webhook_id, scan_id, url, event, attempt, status_code, error, created_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, d.WebhookID, d.ScanID, d.URL, d.Event, d.Attempt, d.StatusCode, d.Error, d.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeliveriesFromDB lists the delivery attempts of a scan's webhooks, oldest first.
+func DeliveriesFromDB(conn *sql.DB, scanID int64) ([]Delivery, error) {
+	q := "SELECT id, webhook_id, scan_id, url, event, attempt, status_code, COALESCE(error, ''), created_at " +
+		"FROM webhook_deliveries WHERE scan_id=? ORDER BY id"
+	deliveries := []Delivery{}
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.ScanID, &d.URL, &d.Event, &d.Attempt, &d.StatusCode, &d.Error,
+			&d.CreatedAt); err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func AddDeadLetterToDB(conn *sql.DB, dl DeadLetter) (int64, error) {
+	q := "INSERT INTO webhook_dead_letters(webhook_id, scan_id, url, event, payload, attempts, last_error, " +
+		"created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, dl.WebhookID, dl.ScanID, dl.URL, dl.Event, string(dl.Payload), dl.Attempts, dl.LastError,
+		dl.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeadLettersFromDB lists the payloads of a scan that couldn't be delivered, oldest first.
+func DeadLettersFromDB(conn *sql.DB, scanID int64) ([]DeadLetter, error) {
+	q := "SELECT id, webhook_id, scan_id, url, event, payload, attempts, last_error, created_at " +
+		"FROM webhook_dead_letters WHERE scan_id=? ORDER BY id"
+	letters := []DeadLetter{}
+	rows, err := conn.Query(q, scanID)
+	if err != nil {
+		return letters, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dl DeadLetter
+		var payload string
+		if err := rows.Scan(&dl.ID, &dl.WebhookID, &dl.ScanID, &dl.URL, &dl.Event, &payload, &dl.Attempts,
+			&dl.LastError, &dl.CreatedAt); err != nil {
+			return letters, err
+		}
+		dl.Payload = []byte(payload)
+		letters = append(letters, dl)
+	}
+	return letters, rows.Err()
+}
+
+func AddRetryToDB(conn *sql.DB, r Retry) (int64, error) {
+	q := "INSERT INTO webhook_retries(webhook_id, scan_id, url, event, payload, attempt, last_error, due_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := conn.Exec(q, r.WebhookID, r.ScanID, r.URL, r.Event, string(r.Payload), r.Attempt, r.LastError, r.DueAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateRetryInDB stores the next attempt of a retry.
+func UpdateRetryInDB(conn *sql.DB, r Retry) error {
+	_, err := conn.Exec("UPDATE webhook_retries SET attempt=?, last_error=?, due_at=? WHERE id=?", r.Attempt,
+		r.LastError, r.DueAt, r.ID)
+	return err
+}
+
+func DeleteRetryFromDB(conn *sql.DB, id int64) error {
+	_, err := conn.Exec("DELETE FROM webhook_retries WHERE id=?", id)
+	return err
+}
+
+// ClaimRetriesFromDB returns up to limit retries due at now, the oldest first, and pushes them back
+// to until so other callers don't claim them too.
+func ClaimRetriesFromDB(conn *sql.DB, now time.Time, until time.Time, limit int) ([]Retry, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	q := "SELECT id, webhook_id, scan_id, url, event, payload, attempt, last_error, due_at FROM webhook_retries " +
+		"WHERE due_at<=? ORDER BY due_at LIMIT ? FOR UPDATE"
+	retries, err := scanRetries(tx.Query(q, now, limit))
+	for i := range retries {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("UPDATE webhook_retries SET due_at=? WHERE id=?", until, retries[i].ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return retries, tx.Commit()
+}
+
+// RetriesFromDB lists the payloads of a scan waiting for another attempt, the next due first.
+func RetriesFromDB(conn *sql.DB, scanID int64) ([]Retry, error) {
+	q := "SELECT id, webhook_id, scan_id, url, event, payload, attempt, last_error, due_at FROM webhook_retries " +
+		"WHERE scan_id=? ORDER BY due_at, id"
+	return scanRetries(conn.Query(q, scanID))
+}
+
+// ReplayDeadLettersInDB turns the dead letters of a scan back into retries due at, starting over
+// their attempts, and returns how many there were.
+func ReplayDeadLettersInDB(conn *sql.DB, scanID int64, at time.Time) (int64, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	q := "INSERT INTO webhook_retries(webhook_id, scan_id, url, event, payload, attempt, last_error, due_at) " +
+		"SELECT webhook_id, scan_id, url, event, payload, 1, last_error, ? FROM webhook_dead_letters WHERE scan_id=?"
+	res, err := tx.Exec(q, at, scanID)
+	var n int64
+	if err == nil {
+		n, err = res.RowsAffected()
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM webhook_dead_letters WHERE scan_id=?", scanID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func scanRetries(rows *sql.Rows, err error) ([]Retry, error) {
+	retries := []Retry{}
+	if err != nil {
+		return retries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Retry
+		var payload string
+		if err := rows.Scan(&r.ID, &r.WebhookID, &r.ScanID, &r.URL, &r.Event, &payload, &r.Attempt, &r.LastError,
+			&r.DueAt); err != nil {
+			return retries, err
+		}
+		r.Payload = []byte(payload)
+		retries = append(retries, r)
+	}
+	return retries, rows.Err()
+}
@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "736ffa5e4064da13711d075ed6b71069"
+
+// loopback allows the senders of the tests to reach the callbacks of httptest.
+var loopback, _ = ParseNetworks("127.0.0.0/8, ::1/128")
+
+// callback answers deliveries with the statuses in order and checks their signature.
+func callback(t *testing.T, statuses ...int) (*httptest.Server, *int) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		assert.Nil(t, err)
+		assert.WithinDuration(t, time.Now(), time.Unix(ts, 0), time.Minute)
+		signature, _ := Sign(testSecret, ts, body)
+		assert.Equal(t, signature, r.Header.Get(SignatureHeader))
+		assert.Equal(t, EventScanCompleted, r.Header.Get(EventHeader))
+		assert.Equal(t, `{"status":"passed"}`, string(body))
+		w.WriteHeader(statuses[calls])
+		calls++
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestSign(t *testing.T) {
+	signature, err := Sign(testSecret, 1760868000, []byte(`{"status":"passed"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "6dc8e81f2d5bff3496f77a1b7ac160d643602adccdd880d7e9bb41f62c3de2af", signature)
+
+	_, err = Sign("not hex", 1760868000, nil)
+	assert.NotNil(t, err)
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.Nil(t, ValidateURL("https://ci.example.com/hooks/dast?job=4", nil))
+	assert.Nil(t, ValidateURL("http://jenkins:8080/dast", nil))
+	assert.Nil(t, ValidateURL("https://203.0.113.7/hook", nil))
+	assert.Nil(t, ValidateURL("http://10.2.0.4:8080/dast", []*net.IPNet{mustNetwork(t, "10.2.0.0/16")}))
+	for _, u := range []string{"", "ci.example.com/hook", "ftp://ci.example.com", "https://", "http://%zz",
+		"http://127.0.0.1:8080/", "http://[::1]/", "http://169.254.169.254/latest/meta-data/", "http://10.2.0.4/",
+		"http://192.168.1.1/", "http://0.0.0.0/", "http://localhost/", "http://api.localhost./",
+		"http://metadata.google.internal/computeMetadata/v1/"} {
+		assert.NotNil(t, ValidateURL(u, nil), u)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(" 10.2.0.0/16,,fd00::/8 ")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{mustNetwork(t, "10.2.0.0/16"), mustNetwork(t, "fd00::/8")}, networks)
+
+	_, err = ParseNetworks("10.2.0.0")
+	assert.EqualError(t, err, `invalid network "10.2.0.0"`)
+}
+
+func TestDeliverRefusesInternalAddresses(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	srv, calls := callback(t)
+	w := Webhook{ID: 4, ScanID: 9, URL: srv.URL}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, 1, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_dead_letters(")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	s := NewSender(testSecret, 1, time.Millisecond, time.Second, nil)
+	err := s.Deliver(db, w, EventScanCompleted, []byte(`{"status":"passed"}`))
+	assert.Contains(t, err.Error(), "callback address 127.0.0.1 isn't public")
+	assert.Equal(t, 0, *calls)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func mustNetwork(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	assert.Nil(t, err)
+	return n
+}
+
+var retryColumns = []string{"id", "webhook_id", "scan_id", "url", "event", "payload", "attempt", "last_error",
+	"due_at"}
+
+func TestDeliverStoresRetry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	srv, calls := callback(t, http.StatusBadGateway)
+	w := Webhook{ID: 4, ScanID: 9, URL: srv.URL}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, 1, 502, "unexpected status 502 Bad Gateway",
+			sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_retries(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, `{"status":"passed"}`, 2,
+			"unexpected status 502 Bad Gateway", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	s := NewSender(testSecret, 5, time.Minute, time.Second, loopback)
+	assert.Nil(t, s.Deliver(db, w, EventScanCompleted, []byte(`{"status":"passed"}`)))
+	assert.Equal(t, 1, *calls)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetryDueUntilAccepted(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	srv, calls := callback(t, http.StatusTooManyRequests, http.StatusNoContent)
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	for i, code := range []int{429, 204} {
+		attempt := i + 2
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_retries WHERE due_at<=? ORDER BY due_at LIMIT ? FOR UPDATE")).
+			WithArgs(now, 10).
+			WillReturnRows(sqlmock.NewRows(retryColumns).
+				AddRow(3, 4, 9, srv.URL, EventScanCompleted, `{"status":"passed"}`, attempt, "", now))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_retries SET due_at=? WHERE id=?")).
+			WithArgs(now.Add(retryLease), int64(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		var errMsg interface{} = "unexpected status 429 Too Many Requests"
+		if code == 204 {
+			errMsg = ""
+		}
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+			WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, attempt, code, errMsg, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(attempt), 1))
+		if code == 429 {
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_retries SET attempt=?, last_error=?, due_at=? WHERE id=?")).
+				WithArgs(3, "unexpected status 429 Too Many Requests", sqlmock.AnyArg(), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		} else {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_retries WHERE id=?")).WithArgs(int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+
+	s := NewSender(testSecret, 5, time.Millisecond, time.Second, loopback)
+	for i := 0; i < 2; i++ {
+		n, err := s.RetryDue(db, now, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+	assert.Equal(t, 2, *calls)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetryDueDeadLetters(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	srv, calls := callback(t, http.StatusInternalServerError)
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_retries WHERE due_at<=?")).WithArgs(now, 10).
+		WillReturnRows(sqlmock.NewRows(retryColumns).
+			AddRow(3, 4, 9, srv.URL, EventScanCompleted, `{"status":"passed"}`, 2, "unexpected status 500", now))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_retries SET due_at=? WHERE id=?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, 2, 500, "unexpected status 500 Internal Server Error",
+			sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_dead_letters(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, `{"status":"passed"}`, 2,
+			"unexpected status 500 Internal Server Error", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_retries WHERE id=?")).WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := NewSender(testSecret, 2, time.Millisecond, time.Second, loopback)
+	n, err := s.RetryDue(db, now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, *calls)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReplayDeadLettersInDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_retries(webhook_id, scan_id, url, event, payload, attempt, "+
+		"last_error, due_at) SELECT webhook_id, scan_id, url, event, payload, 1, last_error, ? "+
+		"FROM webhook_dead_letters WHERE scan_id=?")).
+		WithArgs(at, int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_dead_letters WHERE scan_id=?")).WithArgs(int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := ReplayDeadLettersInDB(db, 9, at)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliverDoesNotRetryRejectedPayloads(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	srv, calls := callback(t, http.StatusUnauthorized)
+	w := Webhook{ID: 4, ScanID: 9, URL: srv.URL}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, 1, 401, "unexpected status 401 Unauthorized",
+			sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_dead_letters(")).
+		WithArgs(int64(4), int64(9), srv.URL, EventScanCompleted, `{"status":"passed"}`, 1,
+			"unexpected status 401 Unauthorized", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	s := NewSender(testSecret, 5, time.Millisecond, time.Second, loopback)
+	assert.NotNil(t, s.Deliver(db, w, EventScanCompleted, []byte(`{"status":"passed"}`)))
+	assert.Equal(t, 1, *calls)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliveriesFromDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_deliveries WHERE scan_id=? ORDER BY id")).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "scan_id", "url", "event", "attempt",
+			"status_code", "error", "created_at"}).
+			AddRow(1, 4, 9, "https://ci/hook", EventScanCompleted, 1, 0, "connection refused", at).
+			AddRow(2, 4, 9, "https://ci/hook", EventScanCompleted, 2, 200, "", at))
+
+	deliveries, err := DeliveriesFromDB(db, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, []Delivery{
+		{ID: 1, WebhookID: 4, ScanID: 9, URL: "https://ci/hook", Event: EventScanCompleted, Attempt: 1,
+			Error: "connection refused", CreatedAt: at},
+		{ID: 2, WebhookID: 4, ScanID: 9, URL: "https://ci/hook", Event: EventScanCompleted, Attempt: 2,
+			StatusCode: 200, CreatedAt: at},
+	}, deliveries)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
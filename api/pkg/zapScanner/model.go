@@ -34,6 +34,9 @@ type ActiveScanClient interface {
 	Stop(scanid string) (map[string]interface{}, error)
 	SetOptionMaxScanDurationInMins(i int) (map[string]interface{}, error)
 	AlertsIds(scanid string) (map[string]interface{}, error)
+	AddScanPolicy(scanpolicyname string, alertthreshold string, attackstrength string) (map[string]interface{}, error)
+	DisableAllScanners(scanpolicyname string) (map[string]interface{}, error)
+	EnableScanners(ids string, scanpolicyname string) (map[string]interface{}, error)
 }
 
 type CoreClient interface {
@@ -41,10 +44,13 @@ type CoreClient interface {
 	NewSession(name string, overwrite string) (map[string]interface{}, error)
 	LoadSession(name string) (map[string]interface{}, error)
 	SaveSession(name string, overwrite string) (map[string]interface{}, error)
+	Urls(baseurl string) (map[string]interface{}, error)
+	Message(id string) (map[string]interface{}, error)
 }
 
 type AlertClient interface {
 	Alerts(baseurl string, start string, count string, riskid string) (map[string]interface{}, error)
+	Alert(id string) (map[string]interface{}, error)
 }
 
 type FullAlert struct {
@@ -72,6 +78,14 @@ type FullAlert struct {
 	AlertRef    string      `json:"alertRef"`
 }
 
+// HTTPMessage is a request ZAP sent or proxied and the response it got, as core/view/message has it.
+type HTTPMessage struct {
+	RequestHeader  string `json:"requestHeader"`
+	RequestBody    string `json:"requestBody"`
+	ResponseHeader string `json:"responseHeader"`
+	ResponseBody   string `json:"responseBody"`
+}
+
 type AScanResult struct {
 	Version   string `json:"@version"`
 	Generated string `json:"@generated"`
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zaproxy/zap-api-go/zap"
@@ -20,6 +22,9 @@ const (
 	scanMaxDurationMinutes = 2
 	spiderMaxDepth         = "2"
 
+	// Scan policies of retests are named after the rule they run
+	retestPolicyPrefix = "dast-retest-"
+
 	failedStatus = "failed"
 	passedStatus = "passed"
 )
@@ -93,8 +98,16 @@ func (z *ZapService) SaveSession(id string) error {
 	return err
 }
 
-func (z *ZapService) StartScan(target string) (string, error) {
-	return startScan(z.zapConn.Spider(), z.zapConn.Ascan(), target)
+// StartScan spiders the target and starts an active scan with a ZAP scan policy, the default one
+// when policy is empty.
+func (z *ZapService) StartScan(target string, policy string) (string, error) {
+	return startScan(z.zapConn.Spider(), z.zapConn.Ascan(), target, policy)
+}
+
+// StopScan stops an active scan, the alerts it raised so far are kept in the session.
+func (z *ZapService) StopScan(scanID string) error {
+	_, err := z.zapConn.Ascan().Stop(scanID)
+	return err
 }
 
 func (z *ZapService) CheckScan(scanID string) (int, AScanResult, error) {
@@ -106,7 +119,7 @@ func (z *ZapService) CheckScan(scanID string) (int, AScanResult, error) {
 	var report []byte
 	if progress >= finished {
 		log.Printf("Active Scan with ID: %s completed", scanID)
-		report, err = z.zapConn.Core().Jsonreport()
+		report, err = z.GetJSONReport()
 		if err != nil {
 			return finished, r, fmt.Errorf("error getting scan results: %v", err)
 		}
@@ -118,6 +131,55 @@ func (z *ZapService) CheckScan(scanID string) (int, AScanResult, error) {
 	return progress, r, nil
 }
 
+// GetJSONReport returns ZAP's traditional JSON report of the current session as it was sent.
+func (z *ZapService) GetJSONReport() ([]byte, error) {
+	return z.zapConn.Core().Jsonreport()
+}
+
+// SiteReport cuts a JSON report of the session down to the site of target. The session is shared
+// by the scans of every application, the other sites in it were scanned for someone else.
+func SiteReport(report []byte, target string) ([]byte, error) {
+	var r map[string]json.RawMessage
+	if err := json.Unmarshal(report, &r); err != nil {
+		return nil, err
+	}
+	var sites []json.RawMessage
+	if raw, ok := r["site"]; ok {
+		if err := json.Unmarshal(raw, &sites); err != nil {
+			return nil, err
+		}
+	}
+	kept := []json.RawMessage{}
+	for _, site := range sites {
+		var s struct {
+			Name string `json:"@name"`
+		}
+		if err := json.Unmarshal(site, &s); err != nil {
+			return nil, err
+		}
+		if sameSite(s.Name, target) {
+			kept = append(kept, site)
+		}
+	}
+	b, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	r["site"] = b
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// SiteAlerts keeps the alerts raised on the site of target, see SiteReport.
+func SiteAlerts(alerts []FullAlert, target string) []FullAlert {
+	kept := []FullAlert{}
+	for _, a := range alerts {
+		if sameSite(a.URL, target) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
 func (z *ZapService) CheckScanAlerts(scanID string) (int, []FullAlert, error) {
 	progress, err := checkScan(z.zapConn.Ascan(), scanID)
 	var fullAlerts []FullAlert
@@ -142,6 +204,25 @@ func (z *ZapService) CheckScanAlerts(scanID string) (int, []FullAlert, error) {
 	return progress, fullAlerts, nil
 }
 
+// GetURLs returns the URLs ZAP knows under baseURL, what the spider and the active scan found.
+func (z *ZapService) GetURLs(baseURL string) ([]string, error) {
+	res, err := z.zapConn.Core().Urls(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting urls: %v", err)
+	}
+	list, ok := res["urls"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("error getting urls: unexpected response %v", res)
+	}
+	urls := make([]string, 0, len(list))
+	for _, u := range list {
+		if s, ok := u.(string); ok {
+			urls = append(urls, s)
+		}
+	}
+	return urls, nil
+}
+
 func (z *ZapService) GetActiveScanAlerts(scanID string) (map[string]bool, error) {
 	r, err := z.zapConn.Ascan().AlertsIds(scanID)
 	ids := make(map[string]bool)
@@ -152,7 +233,51 @@ func (z *ZapService) GetActiveScanAlerts(scanID string) (map[string]bool, error)
 	return ids, err
 }
 
-func startScan(sc SpiderClient, asc ActiveScanClient, target string) (string, error) {
+// StartRetest replays the attack of an active scan rule on the request of a message stored by an
+// earlier scan, with a scan policy that only enables that rule.
+func (z *ZapService) StartRetest(messageID string, pluginID string) (string, error) {
+	return startRetest(z.zapConn.Core(), z.zapConn.Ascan(), messageID, pluginID)
+}
+
+// GetMessage returns the HTTP message an alert was raised on, from the current session.
+func (z *ZapService) GetMessage(messageID string) (HTTPMessage, error) {
+	return getMessage(z.zapConn.Core(), messageID)
+}
+
+// RetestAlerts returns the progress of a retest and, once it has finished, the alerts it raised.
+func (z *ZapService) RetestAlerts(scanID string) (int, []FullAlert, error) {
+	progress, err := checkScan(z.zapConn.Ascan(), scanID)
+	if err != nil {
+		return -1, nil, fmt.Errorf("error getting retest status: %v", err)
+	}
+	if progress < finished {
+		return progress, nil, nil
+	}
+	res, err := z.zapConn.Ascan().AlertsIds(scanID)
+	if err := apiError(res, err); err != nil {
+		return finished, nil, fmt.Errorf("error getting retest alerts: %v", err)
+	}
+	ids, _ := res["alertsIds"].([]interface{})
+	alerts := make([]FullAlert, 0, len(ids))
+	for _, id := range ids {
+		res, err := z.zapConn.Alert().Alert(fmt.Sprint(id))
+		if err := apiError(res, err); err != nil {
+			return finished, nil, fmt.Errorf("error getting alert %v: %v", id, err)
+		}
+		var a FullAlert
+		b, err := json.Marshal(res["alert"])
+		if err == nil {
+			err = json.Unmarshal(b, &a)
+		}
+		if err != nil {
+			return finished, nil, fmt.Errorf("error reading alert %v: %v", id, err)
+		}
+		alerts = append(alerts, a)
+	}
+	return finished, alerts, nil
+}
+
+func startScan(sc SpiderClient, asc ActiveScanClient, target string, policy string) (string, error) {
 	// Start spider scan of the target
 	fmt.Println("Spider : " + target)
 	resp, err := sc.Scan(target, spiderMaxDepth, "", "", "")
@@ -184,7 +309,7 @@ func startScan(sc SpiderClient, asc ActiveScanClient, target string) (string, er
 	time.Sleep(passiveScanWait * time.Millisecond)
 	asc.SetOptionMaxScanDurationInMins(scanMaxDurationMinutes)
 	fmt.Println("Active scan : " + target)
-	resp, err = asc.Scan(target, "True", "False", "", "", "",
+	resp, err = asc.Scan(target, "True", "False", policy, "", "",
 		"")
 	if err != nil {
 		return "-1", fmt.Errorf("error starting active scan: %v", err)
@@ -211,3 +336,108 @@ func checkScan(asc ActiveScanClient, scanID string) (int, error) {
 	log.Printf("Active Scan progress : %d\n", progress)
 	return progress, nil
 }
+
+func startRetest(cc CoreClient, asc ActiveScanClient, messageID string, pluginID string) (string, error) {
+	res, err := cc.Message(messageID)
+	if err := apiError(res, err); err != nil {
+		return "-1", fmt.Errorf("error reading message %s: %v", messageID, err)
+	}
+	method, url, body, err := storedRequest(res)
+	if err != nil {
+		return "-1", fmt.Errorf("error reading message %s: %v", messageID, err)
+	}
+	// Retests of a rule share its policy, adding it again fails with already_exists
+	policy := retestPolicyPrefix + pluginID
+	asc.AddScanPolicy(policy, "", "")
+	if res, err := asc.DisableAllScanners(policy); apiError(res, err) != nil {
+		return "-1", fmt.Errorf("error configuring retest policy: %v", apiError(res, err))
+	}
+	if res, err := asc.EnableScanners(pluginID, policy); apiError(res, err) != nil {
+		return "-1", fmt.Errorf("error enabling rule %s: %v", pluginID, apiError(res, err))
+	}
+	res, err = asc.Scan(url, "False", "False", policy, method, body, "")
+	if err := apiError(res, err); err != nil {
+		return "-1", fmt.Errorf("error starting retest: %v", err)
+	}
+	scanID, ok := res["scan"].(string)
+	if !ok {
+		return "-1", fmt.Errorf("error starting retest: couldn't get scan ID from zap: %v", res)
+	}
+	return scanID, nil
+}
+
+func getMessage(cc CoreClient, messageID string) (HTTPMessage, error) {
+	var msg HTTPMessage
+	res, err := cc.Message(messageID)
+	if err := apiError(res, err); err != nil {
+		return msg, fmt.Errorf("error reading message %s: %v", messageID, err)
+	}
+	m, _ := res["message"].(map[string]interface{})
+	msg.RequestHeader, _ = m["requestHeader"].(string)
+	msg.RequestBody, _ = m["requestBody"].(string)
+	msg.ResponseHeader, _ = m["responseHeader"].(string)
+	msg.ResponseBody, _ = m["responseBody"].(string)
+	return msg, nil
+}
+
+// storedRequest reads the method, URL and body of the request of a message from core/view/message.
+func storedRequest(res map[string]interface{}) (string, string, string, error) {
+	m, _ := res["message"].(map[string]interface{})
+	header, _ := m["requestHeader"].(string)
+	method, url, err := requestLine(header)
+	if err != nil {
+		return "", "", "", err
+	}
+	body, _ := m["requestBody"].(string)
+	return method, url, body, nil
+}
+
+// Request returns the method and URL of the request line of a message.
+func (m HTTPMessage) Request() (string, string, error) {
+	return requestLine(m.RequestHeader)
+}
+
+func requestLine(header string) (string, string, error) {
+	line := strings.SplitN(header, "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", "", fmt.Errorf("unexpected request line %q", line)
+	}
+	return fields[0], fields[1], nil
+}
+
+// apiError is the error of a ZAP API call, which ZAP reports with a code in the response body.
+func apiError(res map[string]interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	if code, ok := res["code"]; ok {
+		return fmt.Errorf("%v: %v", code, res["message"])
+	}
+	return nil
+}
+
+// sameSite reports whether two URLs have the same scheme, host and port, the port defaulting to the
+// one of the scheme.
+func sameSite(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Hostname(), ub.Hostname()) &&
+		sitePort(ua) == sitePort(ub)
+}
+
+func sitePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
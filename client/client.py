@@ -7,6 +7,7 @@ import hashlib
 import uuid
 import os
 import sys
+from urllib.parse import quote, urlencode
 from urllib3.exceptions import ReadTimeoutError
 
 u = str(uuid.uuid4())
@@ -16,6 +17,25 @@ api_url = os.getenv("DAST_API_URL", "http://localhost:30080")
 secret = os.getenv("DAST_HMAC_SECRET", "")
 application = os.getenv("DAST_TARGET_APP", "dast-api")
 build_id = os.getenv("DAST_BUILD_ID", u)
+report_format = os.getenv("DAST_REPORT_FORMAT", "")
+report_path = os.getenv("DAST_REPORT_PATH", "")
+sarif_path = os.getenv("DAST_SARIF_PATH", "")
+routes_path = os.getenv("DAST_ROUTES_PATH", "")
+callback_urls = [c for c in os.getenv("DAST_CALLBACK_URLS", "").split(",") if c]
+force = os.getenv("DAST_FORCE", "").lower() in ("1", "true", "yes")
+
+
+def sign(method, path, body):
+    """Timestamp and Signature headers of a request, path includes the query string"""
+    # The secret is hex encoded, plain text ones are used as they are
+    try:
+        secret_bytes = bytearray.fromhex(secret)
+    except ValueError:
+        secret_bytes = secret.encode('utf-8')
+    ts = str(int(time.time()))
+    payload = f"{ts}.{method}.{path}.".encode() + body
+    return {"Timestamp": ts, "Signature": hmac.new(secret_bytes, payload, hashlib.sha256).hexdigest()}
+
 
 # Check for reload command
 if len(sys.argv) > 1 and sys.argv[1] == "reload":
@@ -30,16 +50,8 @@ if len(sys.argv) > 1 and sys.argv[1] == "reload":
     reload_body = {"action": "reload"}
     body = json.dumps(reload_body).encode()
     
-    # Generate HMAC signature (handle both hex and plain text secrets)
-    try:
-        secret_bytes = bytearray.fromhex(secret)
-    except ValueError:
-        secret_bytes = secret.encode('utf-8')
-    h = hmac.new(secret_bytes, body, hashlib.sha256)
-    s = h.hexdigest()
-    
     # Send reload request
-    headers = {'Signature': s, 'Content-Type': 'application/json'}
+    headers = {**sign("POST", "/reload", body), 'Content-Type': 'application/json'}
     response = requests.post(api_url + "/reload", data=body, headers=headers, timeout=10)
     
     if response.status_code == 200:
@@ -52,6 +64,42 @@ if len(sys.argv) > 1 and sys.argv[1] == "reload":
     
     sys.exit(0)
 
+# Check for simulate command: client.py simulate <policy.json> [since] [until] [app1,app2]
+if len(sys.argv) > 1 and sys.argv[1] == "simulate":
+    if len(sys.argv) < 3:
+        print("Usage: client.py simulate <policy.json> [since YYYY-MM-DD] [until YYYY-MM-DD] [app1,app2]")
+        sys.exit(1)
+
+    with open(sys.argv[2]) as f:
+        policy = json.load(f)
+    simulation_body = {"policy": policy}
+    if len(sys.argv) > 3:
+        simulation_body["since"] = sys.argv[3]
+    if len(sys.argv) > 4:
+        simulation_body["until"] = sys.argv[4]
+    if len(sys.argv) > 5:
+        simulation_body["applications"] = sys.argv[5].split(",")
+    body = json.dumps(simulation_body).encode()
+
+    headers = {**sign("POST", "/policy/simulate", body), 'Content-Type': 'application/json'}
+    response = requests.post(api_url + "/policy/simulate", data=body, headers=headers, timeout=120)
+
+    if response.status_code != 200:
+        print(f"❌ Simulation failed: {response.status_code}")
+        print(response.text)
+        sys.exit(1)
+
+    result = response.json()
+    print(f"🔮 Policy simulation from {result['since']} to {result['until']}\n")
+    for app in result["applications"]:
+        print(f"{app['application'] or '(no application)'}: {app['scans']} scans, "
+              f"failed {app['failed_current']} -> {app['failed_candidate']}")
+        for build in app["newly_failed"]:
+            print(f"  ❌ would fail: {build}")
+        for build in app["newly_passed"]:
+            print(f"  ✅ would pass: {build}")
+    sys.exit(0)
+
 api_status = requests.get(api_url+"/ping", timeout=2)
 print("Api status: \n\n")
 print(json.dumps(api_status.json(), indent=4) + "\n")
@@ -68,19 +116,23 @@ scan_body = {
     "application": application
 }
 
-body = json.dumps(scan_body).encode()
+# SAST results to correlate with the scan's findings
+if sarif_path:
+    with open(sarif_path) as f:
+        scan_body["sarif"] = json.load(f)
+    if routes_path:
+        with open(routes_path) as f:
+            scan_body["routes"] = json.load(f)
+if callback_urls:
+    scan_body["callback_urls"] = callback_urls
+if force:
+    scan_body["force"] = True
 
-# Generate HMAC signature (handle both hex and plain text secrets)
-try:
-    secret_bytes = bytearray.fromhex(secret)
-except ValueError:
-    secret_bytes = secret.encode('utf-8')
-h = hmac.new(secret_bytes, body, hashlib.sha256)
-s = h.hexdigest()
+body = json.dumps(scan_body).encode()
 
-headers = {"Signature": s}
+headers = {**sign("POST", "/scan", body), "Content-Type": "application/json"}
 try:
-    create_scan = requests.post(api_url+"/scan", json=scan_body, timeout=60, headers=headers)
+    create_scan = requests.post(api_url+"/scan", data=body, timeout=60, headers=headers)
 except ReadTimeoutError:
     print("Scan creation failed")
     exit()
@@ -97,13 +149,11 @@ finished = False
 
 with progressbar.ProgressBar(max_value=100) as bar:
     while not finished:
-        b = {"ScanID": scan_body["build_id"]}
-        h = hmac.new(bytearray.fromhex(secret), json.dumps(b).encode(), hashlib.sha256)
-        s = h.hexdigest()
-        headers = {"Signature": s}
-        scan_status = requests.post(api_url+"/status", json=b, headers=headers)
+        b = json.dumps({"ScanID": scan_body["build_id"]}).encode()
+        headers = {**sign("POST", "/status", b), "Content-Type": "application/json"}
+        scan_status = requests.post(api_url+"/status", data=b, headers=headers)
         scan_status_dict = scan_status.json()
-        finished = scan_status_dict["status"] in ["passed", "failed", "error"]
+        finished = scan_status_dict["status"] in ["passed", "failed", "error", "cancelled"]
         time.sleep(2)
 
         if scan_status_dict["status"] == "running":
@@ -114,3 +164,17 @@ with progressbar.ProgressBar(max_value=100) as bar:
             bar.update(progress)
 
 print(scan_status.json())
+
+# Download the report of the finished scan, e.g. DAST_REPORT_FORMAT=junit for CI test tabs
+if report_format and scan_status_dict["status"] in ["passed", "failed"]:
+    extensions = {"junit": "xml", "sarif": "sarif", "html": "html", "markdown": "md", "defectdojo": "json"}
+    path = report_path or "dast-report." + extensions.get(report_format, report_format)
+    uri = "/scans/" + quote(build_id) + "/report?" + urlencode({"format": report_format})
+    report = requests.get(api_url + uri, headers=sign("GET", uri, b""), timeout=60)
+    if report.status_code == 200:
+        with open(path, "wb") as f:
+            f.write(report.content)
+        print("Report written to " + path)
+    else:
+        print(f"Report download failed: {report.status_code}")
+        print(report.text)
@@ -29,8 +29,11 @@ CREATE TABLE IF NOT EXISTS `scans`
     `status`       varchar(255),
     `build_id`     varchar(255),
     `build_source` varchar(255),
+    `application`  varchar(255),
     `target`       varchar(255),
     `zap_id`       int,
+    -- Scans of the same build are numbered, a build is only scanned again when forced
+    `attempt`      int NOT NULL DEFAULT 1,
     `asset_id`     int,
     `created_at`   timestamp DEFAULT CURRENT_TIMESTAMP,
     `completed_at` timestamp DEFAULT 0
@@ -42,7 +45,15 @@ CREATE TABLE IF NOT EXISTS `assets`
     `owner`      varchar(255),
     `project`    varchar(255),
     `repo`       varchar(255),
-    `created_at` timestamp
+    -- JSON array of the environments the application is deployed to, with the URL of each
+    `environments` text,
+    `criticality`  varchar(16) DEFAULT 'medium',
+    -- ZAP scan policy of the application's scans that don't set one
+    `profile`      varchar(255),
+    `created_at` timestamp,
+    -- DefectDojo product and engagement scans are pushed to, the product defaults to the project
+    `defectdojo_product`    varchar(255) NULL,
+    `defectdojo_engagement` varchar(255) NULL
 );
 
 CREATE TABLE IF NOT EXISTS `vulnerabilities`
@@ -50,9 +61,12 @@ CREATE TABLE IF NOT EXISTS `vulnerabilities`
     `id`         int PRIMARY KEY AUTO_INCREMENT,
     `name`       varchar(255),
     `cwe_id`     int,
+    `plugin_id`  varchar(128),
     `created_at` timestamp,
-    `severity`   ENUM ('low', 'medium', 'high', 'critical'),
-    `score`      int
+    `severity`     ENUM ('low', 'medium', 'high', 'critical'),
+    `score`        int,
+    `unclassified` tinyint(1) NOT NULL DEFAULT 0,
+    `solution`     text
 );
 
 CREATE TABLE IF NOT EXISTS `vulnerability_findings`
@@ -60,7 +74,224 @@ CREATE TABLE IF NOT EXISTS `vulnerability_findings`
     `id`               int PRIMARY KEY AUTO_INCREMENT,
     `scan_id`          int,
     `vulnerability_id` int,
-    `details`          longtext
+    `details`          longtext,
+    `fingerprint`      char(64),
+    `plugin_id`        varchar(128),
+    `name`             varchar(255),
+    `cwe_id`           varchar(16),
+    `risk`             varchar(32),
+    `confidence`       varchar(32),
+    `url`              varchar(2048),
+    `method`           varchar(16),
+    `param`            varchar(255),
+    `attack`           text,
+    `evidence`         text,
+    `solution`         text,
+    `reference`        text,
+    `sast_result_id`   int NULL,
+    `message_id`       varchar(32)
+);
+
+CREATE TABLE IF NOT EXISTS `finding_retests`
+(
+    `id`          int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id`     int,
+    `finding_id`  int,
+    `issue_id`    int,
+    `result`      varchar(32),
+    `issue_state` varchar(32),
+    `created_at`  timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_scan_id (`scan_id`),
+    KEY idx_finding_id (`finding_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `scan_urls`
+(
+    `id`      int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id` int,
+    `url`     varchar(2048)
+);
+
+CREATE TABLE IF NOT EXISTS `scan_artifacts`
+(
+    `id`           int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id`      int,
+    `name`         varchar(255),
+    `kind`         varchar(32),
+    `storage_key`  varchar(1024),
+    `content_type` varchar(255),
+    `size`         bigint,
+    `sha256`       char(64),
+    `created_at`   timestamp DEFAULT CURRENT_TIMESTAMP,
+    `retain_until` timestamp NULL
+);
+
+CREATE TABLE IF NOT EXISTS `sast_results`
+(
+    `id`      int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id` int,
+    `tool`    varchar(255),
+    `rule_id` varchar(255),
+    `cwe_ids` varchar(255),
+    `file`    varchar(1024),
+    `line`    int,
+    `level`   varchar(16),
+    `message` text
+);
+
+CREATE TABLE IF NOT EXISTS `sast_routes`
+(
+    `id`      int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id` int,
+    `method`  varchar(16),
+    `path`    varchar(2048),
+    `file`    varchar(1024)
+);
+
+CREATE TABLE IF NOT EXISTS `defectdojo_pushes`
+(
+    `id`          int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id`     int,
+    `application` varchar(255),
+    `product`     varchar(255),
+    `engagement`  varchar(255),
+    `test_id`     int,
+    `reimport`    boolean,
+    `findings`    int,
+    `created_at`  timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS `scan_events`
+(
+    `id`         int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id`    int,
+    `type`       varchar(32),
+    `data`       text,
+    `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_scan_id (`scan_id`, `id`)
+);
+
+CREATE TABLE IF NOT EXISTS `scan_webhooks`
+(
+    `id`         int PRIMARY KEY AUTO_INCREMENT,
+    `scan_id`    int,
+    `url`        varchar(2048),
+    `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_scan_id (`scan_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries`
+(
+    `id`          int PRIMARY KEY AUTO_INCREMENT,
+    `webhook_id`  int,
+    `scan_id`     int,
+    `url`         varchar(2048),
+    `event`       varchar(64),
+    `attempt`     int,
+    `status_code` int,
+    `error`       text,
+    `created_at`  timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_scan_id (`scan_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_retries`
+(
+    `id`         int PRIMARY KEY AUTO_INCREMENT,
+    `webhook_id` int,
+    `scan_id`    int,
+    `url`        varchar(2048),
+    `event`      varchar(64),
+    `payload`    text,
+    `attempt`    int,
+    `last_error` text,
+    `due_at`     timestamp NULL,
+    KEY idx_due_at (`due_at`),
+    KEY idx_scan_id (`scan_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_dead_letters`
+(
+    `id`         int PRIMARY KEY AUTO_INCREMENT,
+    `webhook_id` int,
+    `scan_id`    int,
+    `url`        varchar(2048),
+    `event`      varchar(64),
+    `payload`    text,
+    `attempts`   int,
+    `last_error` text,
+    `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_scan_id (`scan_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `releases`
+(
+    `id`           int PRIMARY KEY AUTO_INCREMENT,
+    `release_id`   varchar(255) NOT NULL,
+    `application`  varchar(255),
+    `source`       varchar(255),
+    `status`       varchar(32),
+    `score`        double NULL,
+    `created_at`   timestamp DEFAULT CURRENT_TIMESTAMP,
+    `completed_at` timestamp NULL,
+    -- Last time the replica running the release reported it's alive
+    `heartbeat_at` timestamp NULL,
+    UNIQUE KEY uq_release_id (`release_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `release_targets`
+(
+    `id`          int PRIMARY KEY AUTO_INCREMENT,
+    `release_id`  int,
+    `name`        varchar(64),
+    `target`      varchar(2048),
+    `application` varchar(255),
+    `profile`     varchar(255),
+    `scope`       text,
+    `scan_id`     int NULL,
+    `build_id`    varchar(255),
+    `status`      varchar(32),
+    `score`       double NULL,
+    `findings`    int DEFAULT 0,
+    `error`       text,
+    `created_at`  timestamp DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_release_id (`release_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `issues`
+(
+    `id`               int PRIMARY KEY AUTO_INCREMENT,
+    `application`      varchar(255) NOT NULL,
+    `fingerprint`      char(64)     NOT NULL,
+    `vulnerability_id` int,
+    `plugin_id`        varchar(128),
+    `url`              varchar(2048),
+    `method`           varchar(16),
+    `param`            varchar(255),
+    `source`           varchar(32)  NOT NULL DEFAULT 'zap',
+    `first_scan_id`    int,
+    `last_scan_id`     int,
+    `fixed_scan_id`    int,
+    `first_seen`       timestamp DEFAULT CURRENT_TIMESTAMP,
+    `last_seen`        timestamp DEFAULT 0,
+    `occurrences`      int DEFAULT 1,
+    `state`            ENUM ('open', 'fixed', 'reopened') DEFAULT 'open',
+    `suppressed`         tinyint(1) NOT NULL DEFAULT 0,
+    `suppressed_by`      varchar(255),
+    `suppression_reason` text,
+    `suppressed_at`      timestamp NULL,
+    UNIQUE KEY uq_application_fingerprint (`application`, `fingerprint`)
+);
+
+CREATE TABLE IF NOT EXISTS `vulnerability_audit`
+(
+    `id`               int PRIMARY KEY AUTO_INCREMENT,
+    `vulnerability_id` int,
+    `actor`            varchar(255),
+    `action`           ENUM ('create', 'update', 'delete', 'import'),
+    `old_score`        int,
+    `new_score`        int,
+    `details`          text,
+    `created_at`       timestamp DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS `configurations`
@@ -85,14 +316,25 @@ ALTER TABLE `scans`
 -- =====================================================
 
 -- Add indexes for better query performance
-ALTER TABLE `scans` ADD INDEX idx_build_id (`build_id`);
+ALTER TABLE `scans` ADD UNIQUE INDEX uq_build_attempt (`build_id`, `attempt`);
 ALTER TABLE `scans` ADD INDEX idx_status (`status`);
 ALTER TABLE `scans` ADD INDEX idx_created_at (`created_at`);
-ALTER TABLE `assets` ADD INDEX idx_project (`project`);
+ALTER TABLE `scans` ADD INDEX idx_application (`application`);
+ALTER TABLE `assets` ADD UNIQUE INDEX uq_project (`project`);
 ALTER TABLE `vulnerabilities` ADD INDEX idx_cwe_id (`cwe_id`);
 ALTER TABLE `vulnerabilities` ADD INDEX idx_severity (`severity`);
+ALTER TABLE `vulnerabilities` ADD INDEX idx_plugin_id (`plugin_id`);
+ALTER TABLE `vulnerability_audit` ADD INDEX idx_audit_vulnerability_id (`vulnerability_id`);
 ALTER TABLE `vulnerability_findings` ADD INDEX idx_scan_id (`scan_id`);
 ALTER TABLE `vulnerability_findings` ADD INDEX idx_vulnerability_id (`vulnerability_id`);
+ALTER TABLE `vulnerability_findings` ADD INDEX idx_fingerprint (`fingerprint`);
+ALTER TABLE `scan_urls` ADD INDEX idx_scan_urls_scan_id (`scan_id`);
+ALTER TABLE `scan_artifacts` ADD INDEX idx_scan_artifacts_scan_id (`scan_id`);
+ALTER TABLE `sast_results` ADD INDEX idx_sast_results_scan_id (`scan_id`);
+ALTER TABLE `sast_routes` ADD INDEX idx_sast_routes_scan_id (`scan_id`);
+ALTER TABLE `defectdojo_pushes` ADD INDEX idx_defectdojo_pushes_scan_id (`scan_id`);
+ALTER TABLE `defectdojo_pushes` ADD INDEX idx_defectdojo_pushes_target (`application`, `product`, `engagement`);
+ALTER TABLE `issues` ADD INDEX idx_issue_state (`application`, `state`);
 
 -- =====================================================
 -- VULNERABILITY DATA (134+ vulnerability types)
@@ -179,6 +421,7 @@ INSERT INTO configurations (`key`, `value`) VALUES
 ('max_concurrent_scans', '5'),
 ('default_spider_depth', '2'),
 ('pass_threshold_score', '8'),
+('catalog_version', '1'),
 ('api_version', '1.0.0');
 
 -- =====================================================